@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// ListConversations 获取当前用户的对话列表
+func (h *AIHandler) ListConversations(c *gin.Context) {
+	userID := c.GetString("user_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+
+	conversations, total, err := h.services.ConversationService.List(c.Request.Context(), userID, page, perPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "获取对话列表失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: conversations,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// CreateConversation 创建对话
+func (h *AIHandler) CreateConversation(c *gin.Context) {
+	var req struct {
+		Title        string `json:"title"`
+		Model        string `json:"model"`
+		SystemPrompt string `json:"system_prompt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	conv, err := h.services.ConversationService.Create(c.Request.Context(), c.GetString("user_id"), req.Title, req.Model, req.SystemPrompt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "创建对话失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "创建对话成功",
+		Data:    conv,
+	})
+}
+
+// GetConversation 获取对话及其消息
+//
+// after_seq用于增量同步，只返回该序号之后的消息
+func (h *AIHandler) GetConversation(c *gin.Context) {
+	userID := c.GetString("user_id")
+	afterSeq, _ := strconv.Atoi(c.DefaultQuery("after_seq", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+
+	conv, err := h.services.ConversationService.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		respondConversationError(c, "获取对话失败", err)
+		return
+	}
+
+	messages, err := h.services.ConversationService.GetMessages(c.Request.Context(), userID, conv.ID, afterSeq, limit)
+	if err != nil {
+		respondConversationError(c, "获取对话消息失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取对话成功",
+		Data: gin.H{
+			"conversation": conv,
+			"messages":     messages,
+		},
+	})
+}
+
+// RenameConversation 修改对话标题
+func (h *AIHandler) RenameConversation(c *gin.Context) {
+	var req struct {
+		Title string `json:"title" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if err := h.services.ConversationService.Rename(c.Request.Context(), userID, c.Param("id"), req.Title); err != nil {
+		respondConversationError(c, "重命名对话失败", err)
+		return
+	}
+
+	conv, err := h.services.ConversationService.Get(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		respondConversationError(c, "获取对话失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "重命名对话成功",
+		Data:    conv,
+	})
+}
+
+// DeleteConversation 删除对话
+func (h *AIHandler) DeleteConversation(c *gin.Context) {
+	if err := h.services.ConversationService.Delete(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+		respondConversationError(c, "删除对话失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "删除对话成功",
+	})
+}
+
+func respondConversationError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, services.ErrConversationNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// AICostHandler AI成本和预算（管理员）
+type AICostHandler struct {
+	ai *services.AIClientManager
+}
+
+func NewAICostHandler(ai *services.AIClientManager) *AICostHandler {
+	return &AICostHandler{
+		ai: ai,
+	}
+}
+
+// GetDailyCosts 按天、服务和功能汇总的花费，from/to为YYYY-MM-DD，默认最近7天
+func (h *AICostHandler) GetDailyCosts(c *gin.Context) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -6)
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "from格式错误",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "to格式错误",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	costs, err := h.ai.DailyCosts(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "获取AI成本失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取AI成本成功",
+		Data:    costs,
+	})
+}
+
+// GetBudgetStatus 当日花费、预算和被降级的服务
+func (h *AICostHandler) GetBudgetStatus(c *gin.Context) {
+	status, err := h.ai.BudgetStatus(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "获取AI预算失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取AI预算成功",
+		Data:    status,
+	})
+}
@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/middleware"
 	"qa-toolbox-backend/internal/models"
 	"qa-toolbox-backend/internal/services"
 )
@@ -20,7 +24,10 @@ func NewAIHandler(services *services.Services) *AIHandler {
 
 // RegisterRoutes 注册AI服务路由
 func (h *AIHandler) RegisterRoutes(router *gin.RouterGroup) {
-	ai := router.Group("/ai")
+	// 登录用户按会员计划计量，未登录调用按IP计量
+	optionalAuth := middleware.OptionalAuthMiddleware(h.services.Config.JWTSecret)
+	
+	ai := router.Group("/ai", optionalAuth)
 	{
 		ai.POST("/generate-test-cases", h.GenerateTestCases)
 		ai.POST("/analyze-code", h.AnalyzeCode)
@@ -28,12 +35,26 @@ func (h *AIHandler) RegisterRoutes(router *gin.RouterGroup) {
 	}
 	
 	// LLM大服务路由
-	llm := router.Group("/llm")
+	llm := router.Group("/llm", optionalAuth)
 	{
 		llm.POST("/chat", h.Chat)
 		llm.POST("/generate", h.GenerateText)
 		llm.GET("/models", h.GetAvailableModels)
+		llm.GET("/catalog", h.GetModelCatalog)
 		llm.GET("/health", h.HealthCheck)
+		llm.GET("/usage", h.GetUsage)
+		llm.GET("/tools", h.GetTools)
+		llm.POST("/embeddings", h.Embeddings)
+	}
+	
+	// 服务端保存的多轮对话，需要登录
+	conversations := llm.Group("/conversations", middleware.AuthMiddleware(h.services.Config.JWTSecret))
+	{
+		conversations.GET("", h.ListConversations)
+		conversations.POST("", h.CreateConversation)
+		conversations.GET("/:id", h.GetConversation)
+		conversations.PUT("/:id", h.RenameConversation)
+		conversations.DELETE("/:id", h.DeleteConversation)
 	}
 }
 
@@ -54,13 +75,9 @@ func (h *AIHandler) GenerateTestCases(c *gin.Context) {
 		return
 	}
 
-	response, err := h.services.AIClientManager.GenerateTestCases(req.Code, req.Language, req.TestType)
+	response, err := h.services.AIClientManager.GenerateTestCases(aiContext(c, services.AIFeatureTestGeneration), req.Code, req.Language, req.TestType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to generate test cases",
-			Error:   err.Error(),
-		})
+		respondAIError(c, "Failed to generate test cases", err)
 		return
 	}
 
@@ -68,7 +85,11 @@ func (h *AIHandler) GenerateTestCases(c *gin.Context) {
 		Success: true,
 		Message: "Test cases generated successfully",
 		Data: gin.H{
-			"test_cases": response,
+			"test_cases": response.Content,
+			"model": response.Model,
+			"usage": response.Usage,
+			"cache": response.Cache,
+			"prompt": response.Prompt,
 		},
 	})
 }
@@ -89,13 +110,9 @@ func (h *AIHandler) AnalyzeCode(c *gin.Context) {
 		return
 	}
 
-	response, err := h.services.AIClientManager.AnalyzeCode(req.Code, req.Language)
+	response, err := h.services.AIClientManager.AnalyzeCode(aiContext(c, services.AIFeatureCodeAnalysis), req.Code, req.Language)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to analyze code",
-			Error:   err.Error(),
-		})
+		respondAIError(c, "Failed to analyze code", err)
 		return
 	}
 
@@ -103,7 +120,11 @@ func (h *AIHandler) AnalyzeCode(c *gin.Context) {
 		Success: true,
 		Message: "Code analysis completed successfully",
 		Data: gin.H{
-			"analysis": response,
+			"analysis": response.Content,
+			"model": response.Model,
+			"usage": response.Usage,
+			"cache": response.Cache,
+			"prompt": response.Prompt,
 		},
 	})
 }
@@ -125,13 +146,9 @@ func (h *AIHandler) GenerateContent(c *gin.Context) {
 		return
 	}
 
-	response, err := h.services.AIClientManager.GenerateContent(req.ContentType, req.Prompt, req.Requirements)
+	response, err := h.services.AIClientManager.GenerateContent(aiContext(c, services.AIFeatureCreativeWriting), req.ContentType, req.Prompt, req.Requirements)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to generate content",
-			Error:   err.Error(),
-		})
+		respondAIError(c, "Failed to generate content", err)
 		return
 	}
 
@@ -139,33 +156,47 @@ func (h *AIHandler) GenerateContent(c *gin.Context) {
 		Success: true,
 		Message: "Content generated successfully",
 		Data: gin.H{
-			"content": response,
+			"content": response.Content,
+			"model": response.Model,
+			"usage": response.Usage,
+			"cache": response.Cache,
+			"prompt": response.Prompt,
 		},
 	})
 }
 
 // ChatRequest LLM对话请求
+//
+// 指定ConversationID时，Messages只需包含本轮新增的消息，历史由服务端补全并保存。
+// Tools为允许模型调用的后端工具名称，工具调用在服务端完成，不支持流式输出
 type ChatRequest struct {
-	Messages    []services.AIMessage `json:"messages" validate:"required"`
-	Model       string               `json:"model,omitempty"`
-	Temperature float64              `json:"temperature,omitempty"`
-	MaxTokens   int                  `json:"max_tokens,omitempty"`
-	Stream      bool                 `json:"stream,omitempty"`
+	ConversationID string               `json:"conversation_id,omitempty"`
+	Tools          []string             `json:"tools,omitempty"`
+	Messages       []services.AIMessage `json:"messages" validate:"required"`
+	Model          string               `json:"model,omitempty"`       // auto、模型名或 provider/model
+	Policy         string               `json:"policy,omitempty"`      // cheapest、fastest 或 quality
+	Temperature    *float64             `json:"temperature,omitempty"` // 未传时为0.7，显式传0时原样使用
+	MaxTokens      int                  `json:"max_tokens,omitempty"`
+	Stream         bool                 `json:"stream,omitempty"`
+	Async          bool                 `json:"async,omitempty"` // 加入任务队列，返回202和任务句柄
 }
 
 // ChatResponse LLM对话响应
 type ChatResponse struct {
-	ID      string `json:"id"`
-	Model   string `json:"model"`
-	Message struct {
+	ID             string `json:"id"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Model          string `json:"model"`
+	Message        struct {
 		Role    string `json:"role"`
 		Content string `json:"content"`
 	} `json:"message"`
-	Usage struct {
+	Usage          struct {
 		PromptTokens     int `json:"prompt_tokens"`
 		CompletionTokens int `json:"completion_tokens"`
 		TotalTokens      int `json:"total_tokens"`
 	} `json:"usage"`
+	Cache          string                      `json:"cache,omitempty"`
+	ToolCalls      []services.AIToolInvocation `json:"tool_calls,omitempty"`
 }
 
 // Chat LLM对话接口
@@ -180,12 +211,67 @@ func (h *AIHandler) Chat(c *gin.Context) {
 		return
 	}
 
+	if len(req.Messages) == 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "消息不能为空",
+		})
+		return
+	}
+	if req.Async && req.Stream {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "异步生成不支持流式输出",
+		})
+		return
+	}
+
+	var tools *services.AIToolRegistry
+	if len(req.Tools) > 0 {
+		if req.Stream {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "工具调用不支持流式输出",
+			})
+			return
+		}
+		var err error
+		if tools, err = h.services.AITools.Subset(req.Tools); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request format",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	userID := c.GetString("user_id")
+	if req.ConversationID != "" && userID == "" {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "请先登录",
+		})
+		return
+	}
+
+	policy, err := services.ParseAIRoutePolicy(req.Policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// 设置默认值
 	if req.Model == "" {
 		req.Model = "auto" // 自动选择最佳模型
 	}
-	if req.Temperature == 0 {
-		req.Temperature = 0.7
+	temperature := 0.7
+	if req.Temperature != nil {
+		temperature = *req.Temperature
 	}
 	if req.MaxTokens == 0 {
 		req.MaxTokens = 2000
@@ -195,19 +281,48 @@ func (h *AIHandler) Chat(c *gin.Context) {
 	aiReq := &services.AIRequest{
 		Model:       req.Model,
 		Messages:    req.Messages,
-		Temperature: req.Temperature,
+		Temperature: temperature,
 		MaxTokens:   req.MaxTokens,
 		Stream:      req.Stream,
+		Policy:      policy,
+	}
+
+	ctx := aiContext(c, services.AIFeatureChat)
+
+	// 异步生成
+	if req.Async {
+		h.enqueueGeneration(c, services.NewAIGenerateJob(ctx, aiReq, req.ConversationID, req.Tools))
+		return
+	}
+
+	// 流式输出
+	if req.Stream {
+		if req.ConversationID == "" {
+			h.streamText(c, ctx, aiReq, "LLM服务调用失败")
+			return
+		}
+		stream, err := h.services.ConversationService.SendStream(ctx, userID, req.ConversationID, aiReq)
+		if err != nil {
+			respondAIError(c, "LLM服务调用失败", err)
+			return
+		}
+		writeStream(c, stream, "LLM服务调用失败")
+		return
 	}
 
 	// 调用AI服务
-	resp, err := h.services.AIClientManager.GenerateText(c.Request.Context(), aiReq)
+	var resp *services.AIResponse
+	var invocations []services.AIToolInvocation
+	switch {
+	case req.ConversationID != "":
+		resp, invocations, err = h.services.ConversationService.Send(ctx, userID, req.ConversationID, aiReq, tools)
+	case tools != nil:
+		resp, invocations, err = h.services.AIClientManager.GenerateWithTools(ctx, aiReq, tools)
+	default:
+		resp, err = h.services.AIClientManager.GenerateText(ctx, aiReq)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "LLM服务调用失败",
-			Error:   err.Error(),
-		})
+		respondAIError(c, "LLM服务调用失败", err)
 		return
 	}
 
@@ -221,8 +336,9 @@ func (h *AIHandler) Chat(c *gin.Context) {
 
 	// 构建响应
 	chatResp := ChatResponse{
-		ID:    resp.ID,
-		Model: resp.Model,
+		ID:             resp.ID,
+		ConversationID: req.ConversationID,
+		Model:          resp.Model,
 		Message: struct {
 			Role    string `json:"role"`
 			Content string `json:"content"`
@@ -239,6 +355,8 @@ func (h *AIHandler) Chat(c *gin.Context) {
 			CompletionTokens: resp.Usage.CompletionTokens,
 			TotalTokens:      resp.Usage.TotalTokens,
 		},
+		Cache:     resp.Cache,
+		ToolCalls: invocations,
 	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
@@ -251,10 +369,13 @@ func (h *AIHandler) Chat(c *gin.Context) {
 // GenerateText 文本生成接口
 func (h *AIHandler) GenerateText(c *gin.Context) {
 	var req struct {
-		Prompt      string  `json:"prompt" validate:"required"`
-		Model       string  `json:"model,omitempty"`
-		Temperature float64 `json:"temperature,omitempty"`
-		MaxTokens   int     `json:"max_tokens,omitempty"`
+		Prompt      string   `json:"prompt" validate:"required"`
+		Model       string   `json:"model,omitempty"`
+		Policy      string   `json:"policy,omitempty"`
+		Temperature *float64 `json:"temperature,omitempty"`
+		MaxTokens   int      `json:"max_tokens,omitempty"`
+		Stream      bool     `json:"stream,omitempty"`
+		Async       bool     `json:"async,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -265,13 +386,30 @@ func (h *AIHandler) GenerateText(c *gin.Context) {
 		})
 		return
 	}
+	if req.Async && req.Stream {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "异步生成不支持流式输出",
+		})
+		return
+	}
+	policy, err := services.ParseAIRoutePolicy(req.Policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
 
 	// 设置默认值
 	if req.Model == "" {
 		req.Model = "auto"
 	}
-	if req.Temperature == 0 {
-		req.Temperature = 0.7
+	temperature := 0.7
+	if req.Temperature != nil {
+		temperature = *req.Temperature
 	}
 	if req.MaxTokens == 0 {
 		req.MaxTokens = 1000
@@ -283,18 +421,28 @@ func (h *AIHandler) GenerateText(c *gin.Context) {
 		Messages: []services.AIMessage{
 			{Role: "user", Content: req.Prompt},
 		},
-		Temperature: req.Temperature,
+		Temperature: temperature,
 		MaxTokens:   req.MaxTokens,
+		Stream:      req.Stream,
+		Policy:      policy,
+	}
+
+	// 异步生成
+	if req.Async {
+		h.enqueueGeneration(c, services.NewAIGenerateJob(aiContext(c, services.AIFeatureTextGeneration), aiReq, "", nil))
+		return
+	}
+
+	// 流式输出
+	if req.Stream {
+		h.streamText(c, aiContext(c, services.AIFeatureTextGeneration), aiReq, "文本生成失败")
+		return
 	}
 
 	// 调用AI服务
-	resp, err := h.services.AIClientManager.GenerateText(c.Request.Context(), aiReq)
+	resp, err := h.services.AIClientManager.GenerateText(aiContext(c, services.AIFeatureTextGeneration), aiReq)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "文本生成失败",
-			Error:   err.Error(),
-		})
+		respondAIError(c, "文本生成失败", err)
 		return
 	}
 
@@ -313,6 +461,271 @@ func (h *AIHandler) GenerateText(c *gin.Context) {
 			"text":   resp.Choices[0].Message.Content,
 			"model":  resp.Model,
 			"usage":  resp.Usage,
+			"cache":  resp.Cache,
+		},
+	})
+}
+
+// enqueueGeneration 把生成请求加入任务队列，结果通过 GET /jobs/:id 获取
+func (h *AIHandler) enqueueGeneration(c *gin.Context, payload *services.AIGenerateJob) {
+	job, err := h.services.JobQueue.Enqueue(c.Request.Context(), services.JobTypeAIGenerate, payload.UserID, payload)
+	if err != nil {
+		respondJobError(c, "创建生成任务失败", err)
+		return
+	}
+
+	respondJobAccepted(c, "生成任务已创建", job, nil)
+}
+
+// streamText 以Server-Sent Events的形式输出增量内容
+//
+// 事件类型：message（增量片段）、done（结束，附带用量）、error（流中断）
+func (h *AIHandler) streamText(c *gin.Context, ctx context.Context, aiReq *services.AIRequest, failMessage string) {
+	stream, err := h.services.AIClientManager.GenerateTextStream(ctx, aiReq)
+	if err != nil {
+		respondAIError(c, failMessage, err)
+		return
+	}
+
+	writeStream(c, stream, failMessage)
+}
+
+// writeStream 将已建立的流写为SSE
+func writeStream(c *gin.Context, stream <-chan services.AIStreamChunk, failMessage string) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	var id, model, finishReason string
+	var usage *services.AIUsage
+	c.Stream(func(w io.Writer) bool {
+		chunk, ok := <-stream
+		if !ok {
+			c.SSEvent("done", gin.H{
+				"id":            id,
+				"model":         model,
+				"finish_reason": finishReason,
+				"usage":         usage,
+			})
+			return false
+		}
+		if chunk.Err != nil {
+			c.SSEvent("error", gin.H{
+				"message": failMessage,
+				"error":   chunk.Err.Error(),
+			})
+			return false
+		}
+
+		if chunk.ID != "" {
+			id = chunk.ID
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.FinishReason != "" {
+			finishReason = chunk.FinishReason
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if chunk.Delta != "" {
+			c.SSEvent("message", chunk)
+		}
+		return true
+	})
+}
+
+// respondAIError 将AI调用错误映射为HTTP状态码和结构化的错误详情
+//
+// 故障转移全部失败时，Data中包含每个服务的失败类型、状态码、耗时和是否可重试
+func respondAIError(c *gin.Context, message string, err error) {
+	if respondModerationRejected(c, err) {
+		return
+	}
+	var multiErr *services.AIMultiError
+	var quotaErr *services.AIQuotaError
+	var structuredErr *services.AIStructuredError
+	switch {
+	case errors.As(err, &quotaErr):
+		c.JSON(http.StatusTooManyRequests, models.APIResponse{
+			Success: false,
+			Message: quotaErr.Error(),
+			Data:    quotaErr,
+			Error:   "AI用量超出配额",
+		})
+	case errors.As(err, &multiErr):
+		status := http.StatusBadGateway
+		if multiErr.AllOfKind(services.AIErrorRateLimited) {
+			status = http.StatusTooManyRequests
+		} else if multiErr.AllOfKind(services.AIErrorCircuitOpen) {
+			status = http.StatusServiceUnavailable
+		} else if multiErr.AllOfKind(services.AIErrorUnsupported) {
+			status = http.StatusNotImplemented
+		}
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: message,
+			Data: gin.H{
+				"providers": multiErr.Errors,
+				"retryable": multiErr.Retryable(),
+			},
+			Error: multiErr.Error(),
+		})
+	case errors.As(err, &structuredErr):
+		c.JSON(http.StatusBadGateway, models.APIResponse{
+			Success: false,
+			Message: message,
+			Data:    structuredErr,
+			Error:   structuredErr.Error(),
+		})
+	case errors.Is(err, services.ErrNoAIRoute):
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: message,
+			Error:   err.Error(),
+		})
+	case errors.Is(err, services.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: message,
+			Error:   err.Error(),
+		})
+	case errors.Is(err, services.ErrNoAIService):
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{
+			Success: false,
+			Message: message,
+			Error:   err.Error(),
+		})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, models.APIResponse{
+			Success: false,
+			Message: message,
+			Error:   err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: message,
+			Error:   err.Error(),
+		})
+	}
+}
+
+// aiContext 构建带有调用方、功能模块和语言信息的ctx，用于用量计量、配额检查和提示词选择
+//
+// 语言优先取查询参数locale，其次取Accept-Language头
+func aiContext(c *gin.Context, feature string) context.Context {
+	userID := c.GetString("user_id")
+	ctx := services.WithAIUsageScope(c.Request.Context(), userID, c.ClientIP())
+
+	locale := c.Query("locale")
+	if locale == "" {
+		locale = c.GetHeader("Accept-Language")
+	}
+	ctx = services.WithAILocale(ctx, locale)
+
+	return services.WithAIFeature(ctx, feature)
+}
+
+// GetUsage 获取当前用户的AI用量与配额
+func (h *AIHandler) GetUsage(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{
+			Success: false,
+			Message: "请先登录",
+		})
+		return
+	}
+
+	summary, err := h.services.AIClientManager.GetUsageSummary(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "获取AI用量失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取AI用量成功",
+		Data:    summary,
+	})
+}
+
+// GetTools 获取可以在对话中开放给模型的后端工具
+func (h *AIHandler) GetTools(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取工具列表成功",
+		Data:    h.services.AITools.Definitions(),
+	})
+}
+
+// Embeddings 文本向量化，model为空时使用默认向量服务
+func (h *AIHandler) Embeddings(c *gin.Context) {
+	var req struct {
+		Input []string `json:"input" binding:"required,min=1,max=64"`
+		Model string   `json:"model"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.services.AIClientManager.Embed(aiContext(c, services.AIFeatureEmbedding), req.Model, req.Input)
+	if err != nil {
+		respondAIError(c, "向量化失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "向量化成功",
+		Data:    result,
+	})
+}
+
+// GetModelCatalog 获取模型目录，available表示服务已配置且未熔断
+//
+// ref可以作为请求的model直接指定服务和模型
+func (h *AIHandler) GetModelCatalog(c *gin.Context) {
+	available := make(map[services.AIServiceType]bool)
+	for _, client := range h.services.AIClientManager.GetAvailableClients() {
+		available[client.GetServiceType()] = true
+	}
+
+	catalog := h.services.AIClientManager.Catalog().List()
+	entries := make([]gin.H, 0, len(catalog))
+	for _, info := range catalog {
+		entries = append(entries, gin.H{
+			"ref":            info.Ref(),
+			"provider":       info.Provider,
+			"model":          info.Model,
+			"tier":           info.Tier,
+			"input_price":    info.InputPrice,
+			"output_price":   info.OutputPrice,
+			"context_window": info.ContextWindow,
+			"quality":        info.Quality,
+			"latency_ms":     info.LatencyMs,
+			"available":      available[info.Provider],
+		})
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取模型目录成功",
+		Data: gin.H{
+			"models":   entries,
+			"policies": []services.AIRoutePolicy{services.AIRouteCheapest, services.AIRouteFastest, services.AIRouteQuality},
 		},
 	})
 }
@@ -329,19 +742,21 @@ func (h *AIHandler) GetAvailableModels(c *gin.Context) {
 			"available": client.IsAvailable(),
 		}
 		
-		// 根据服务类型设置模型信息
-		switch serviceType {
-		case services.AIServiceTencent:
-			modelInfo["models"] = []string{"hunyuan-lite", "hunyuan-standard"}
-			modelInfo["description"] = "腾讯混元大模型，国内访问稳定"
-		case services.AIServiceDeepSeek:
-			modelInfo["models"] = []string{"deepseek-chat", "deepseek-coder"}
-			modelInfo["description"] = "DeepSeek AI，功能强大"
-		case services.AIServiceAIMLAPI:
-			modelInfo["models"] = []string{"gpt-3.5-turbo", "gpt-4", "claude-3"}
-			modelInfo["description"] = "AIMLAPI聚合服务，支持多种模型"
-		default:
+		// 根据服务定义设置模型信息
+		spec, _ := h.services.AIClientManager.GetProviderSpec(serviceType)
+		if len(spec.Models) > 0 {
+			modelInfo["models"] = spec.Models
+		} else if spec.DefaultModel != "" {
+			modelInfo["models"] = []string{spec.DefaultModel}
+		} else {
 			modelInfo["models"] = []string{"auto"}
+		}
+		modelInfo["default_model"] = spec.DefaultModel
+		if spec.EmbeddingModel != "" {
+			modelInfo["embedding_model"] = spec.EmbeddingModel
+		}
+		modelInfo["description"] = spec.Description
+		if spec.Description == "" {
 			modelInfo["description"] = "自动选择最佳模型"
 		}
 		
@@ -361,24 +776,27 @@ func (h *AIHandler) GetAvailableModels(c *gin.Context) {
 // HealthCheck LLM服务健康检查
 func (h *AIHandler) HealthCheck(c *gin.Context) {
 	clients := h.services.AIClientManager.GetAvailableClients()
+	providers := h.services.AIClientManager.GetProviderHealth()
+	
+	// 当前的调度顺序（已考虑健康分数）
+	routingOrder := make([]string, 0, len(clients))
+	for _, client := range clients {
+		routingOrder = append(routingOrder, string(client.GetServiceType()))
+	}
 	
 	healthStatus := map[string]interface{}{
 		"status": "healthy",
 		"available_services": len(clients),
-		"services": make([]map[string]interface{}, 0),
-	}
-	
-	for _, client := range clients {
-		serviceInfo := map[string]interface{}{
-			"service": string(client.GetServiceType()),
-			"available": client.IsAvailable(),
-		}
-		healthStatus["services"] = append(healthStatus["services"].([]map[string]interface{}), serviceInfo)
+		"routing_order": routingOrder,
+		"services": providers,
 	}
 	
 	if len(clients) == 0 {
 		healthStatus["status"] = "unhealthy"
 		healthStatus["message"] = "没有可用的LLM服务"
+	} else if len(clients) < len(providers) {
+		healthStatus["status"] = "degraded"
+		healthStatus["message"] = "部分LLM服务已熔断"
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -386,4 +804,4 @@ func (h *AIHandler) HealthCheck(c *gin.Context) {
 		"message": "LLM服务健康检查完成",
 		"data":    healthStatus,
 	})
-}
\ No newline at end of file
+}
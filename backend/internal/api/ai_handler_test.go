@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+const testMockProviders = `
+providers:
+  - name: mock
+    protocol: mock
+    default_model: mock-primary
+    priority: 1
+  - name: mock-backup
+    protocol: mock
+    default_model: mock-backup
+    priority: 2
+`
+
+// newTestAIHandler 使用模拟服务的AIHandler，fixtures为空时不配置任何AI服务
+func newTestAIHandler(t *testing.T, fixtures string) *AIHandler {
+	t.Helper()
+	cfg := &config.Config{AICircuitFailureThreshold: 1, AICircuitOpenSeconds: 60}
+	if fixtures != "" {
+		dir := t.TempDir()
+		cfg.AIProvidersFile = filepath.Join(dir, "providers.yaml")
+		cfg.AIMockFixturesFile = filepath.Join(dir, "fixtures.yaml")
+		cfg.AIMockMode = services.AIMockModeOnly
+		if err := os.WriteFile(cfg.AIProvidersFile, []byte(testMockProviders), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cfg.AIMockFixturesFile, []byte(fixtures), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewAIHandler(&services.Services{
+		Config:          cfg,
+		AIClientManager: services.NewAIClientManager(nil, nil, cfg),
+	})
+}
+
+func TestAIHandlerGenerateTextErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		fixtures   string
+		model      string
+		calls      int
+		wantStatus int
+		wantRetry  *bool
+	}{
+		{
+			name:       "no AI service configured",
+			calls:      1,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "failover succeeds",
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 500}
+  - service: mock-backup
+    match: "."
+    content: backup
+`,
+			calls:      1,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "all rate limited",
+			fixtures: `
+fixtures:
+  - match: "."
+    error: {status: 429}
+`,
+			calls:      1,
+			wantStatus: http.StatusTooManyRequests,
+			wantRetry:  boolPtr(true),
+		},
+		{
+			name: "mixed failures",
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 401}
+  - service: mock-backup
+    match: "."
+    error: {status: 502}
+`,
+			calls:      1,
+			wantStatus: http.StatusBadGateway,
+			wantRetry:  boolPtr(true),
+		},
+		{
+			name: "all failures permanent",
+			fixtures: `
+fixtures:
+  - match: "."
+    error: {status: 401}
+`,
+			calls:      1,
+			wantStatus: http.StatusBadGateway,
+			wantRetry:  boolPtr(false),
+		},
+		{
+			name: "circuit open",
+			fixtures: `
+fixtures:
+  - match: "."
+    error: {status: 500}
+`,
+			model:      "mock/mock-primary",
+			calls:      2, // 第一次失败后熔断，第二次不再调用
+			wantStatus: http.StatusServiceUnavailable,
+			wantRetry:  boolPtr(true),
+		},
+		{
+			name: "pinned service not configured",
+			fixtures: `
+default:
+  content: ok
+`,
+			model:      "deepseek/deepseek-chat", // 目录中有但未配置的服务
+			calls:      1,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/generate", newTestAIHandler(t, tt.fixtures).GenerateText)
+
+			// model为 provider/model 时只调用该服务，便于触发熔断
+			body, _ := json.Marshal(map[string]interface{}{"prompt": "你好", "model": tt.model})
+			var w *httptest.ResponseRecorder
+			for i := 0; i < tt.calls; i++ {
+				w = httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/generate", bytes.NewReader(body)))
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantRetry != nil {
+				var resp struct {
+					Data struct {
+						Providers []services.AIProviderError `json:"providers"`
+						Retryable bool                       `json:"retryable"`
+					} `json:"data"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Data.Providers) == 0 || resp.Data.Retryable != *tt.wantRetry {
+					t.Errorf("data = %+v, want providers and retryable=%v", resp.Data, *tt.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestRespondAIError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	quotaErr := &services.AIQuotaError{Period: "daily", Limit: 1000, Used: 1200, ResetAt: time.Now().Add(time.Hour)}
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"no AI service", services.ErrNoAIService, http.StatusServiceUnavailable},
+		{"wrapped no AI service", fmt.Errorf("生成测试用例失败: %w", services.ErrNoAIService), http.StatusServiceUnavailable},
+		{"quota", quotaErr, http.StatusTooManyRequests},
+		{"wrapped quota", fmt.Errorf("代码分析失败: %w", quotaErr), http.StatusTooManyRequests},
+		{"multi error rate limited", &services.AIMultiError{Errors: []*services.AIProviderError{
+			{Service: "mock", Kind: services.AIErrorRateLimited, Retryable: true},
+		}}, http.StatusTooManyRequests},
+		{"multi error circuit open", &services.AIMultiError{Errors: []*services.AIProviderError{
+			{Service: "mock", Kind: services.AIErrorCircuitOpen, Retryable: true},
+			{Service: "mock-backup", Kind: services.AIErrorCircuitOpen, Retryable: true},
+		}}, http.StatusServiceUnavailable},
+		{"multi error unsupported", &services.AIMultiError{Errors: []*services.AIProviderError{
+			{Service: "mock", Kind: services.AIErrorUnsupported},
+		}}, http.StatusNotImplemented},
+		{"multi error mixed", &services.AIMultiError{Errors: []*services.AIProviderError{
+			{Service: "mock", Kind: services.AIErrorRateLimited, Retryable: true},
+			{Service: "mock-backup", Kind: services.AIErrorAuth},
+		}}, http.StatusBadGateway},
+		{"other", fmt.Errorf("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) { respondAIError(c, "生成失败", tt.err) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp models.APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Success {
+				t.Errorf("body = %s, want failed APIResponse", w.Body.String())
+			}
+		})
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// CreateAPITestSuite 创建API测试套件
+func (h *QAToolBoxHandler) CreateAPITestSuite(c *gin.Context) {
+	var req models.APITestSuiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	suite, err := h.qaToolBoxService.CreateAPITestSuite(c.Request.Context(), c.GetString("user_id"), &req)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to create API test suite", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "API test suite created successfully",
+		Data:    suite,
+	})
+}
+
+// ListAPITestSuites 当前用户的测试套件，可按tag、status和名称关键字q过滤
+func (h *QAToolBoxHandler) ListAPITestSuites(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	suites, total, err := h.qaToolBoxService.ListAPITestSuites(c.Request.Context(), c.GetString("user_id"),
+		c.Query("tag"), c.Query("status"), c.Query("q"), page, perPage)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to get API test suites", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: suites,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// GetAPITestSuite 测试套件详情，包含按执行顺序排列的用例
+func (h *QAToolBoxHandler) GetAPITestSuite(c *gin.Context) {
+	suite, err := h.qaToolBoxService.GetAPITestSuite(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		respondAPISuiteError(c, "Failed to get API test suite", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test suite retrieved successfully",
+		Data:    suite,
+	})
+}
+
+// UpdateAPITestSuite 修改测试套件，只更新请求中提供的字段
+func (h *QAToolBoxHandler) UpdateAPITestSuite(c *gin.Context) {
+	var req models.APITestSuiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	suite, err := h.qaToolBoxService.UpdateAPITestSuite(c.Request.Context(), c.GetString("user_id"), c.Param("id"), &req)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to update API test suite", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test suite updated successfully",
+		Data:    suite,
+	})
+}
+
+// DeleteAPITestSuite 删除测试套件及其用例
+func (h *QAToolBoxHandler) DeleteAPITestSuite(c *gin.Context) {
+	if err := h.qaToolBoxService.DeleteAPITestSuite(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+		respondAPISuiteError(c, "Failed to delete API test suite", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test suite deleted successfully",
+	})
+}
+
+// CloneAPITestSuite 复制测试套件及其用例，name为空时使用原名称加“(副本)”
+func (h *QAToolBoxHandler) CloneAPITestSuite(c *gin.Context) {
+	var req models.APITestSuiteCloneRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request format",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	suite, err := h.qaToolBoxService.CloneAPITestSuite(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req.Name)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to clone API test suite", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "API test suite cloned successfully",
+		Data:    suite,
+	})
+}
+
+// ListAPITestCases 套件的用例，可按tag和enabled过滤
+func (h *QAToolBoxHandler) ListAPITestCases(c *gin.Context) {
+	var enabled *bool
+	if v := c.Query("enabled"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid enabled filter",
+				Error:   err.Error(),
+			})
+			return
+		}
+		enabled = &b
+	}
+
+	testCases, err := h.qaToolBoxService.ListAPITestCases(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Query("tag"), enabled)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to get API test cases", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test cases retrieved successfully",
+		Data:    testCases,
+	})
+}
+
+// CreateAPITestCase 在套件中创建用例，position为空时追加到末尾
+func (h *QAToolBoxHandler) CreateAPITestCase(c *gin.Context) {
+	var req models.APITestCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	testCase, err := h.qaToolBoxService.CreateAPITestCase(c.Request.Context(), c.GetString("user_id"), c.Param("id"), &req)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to create API test case", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "API test case created successfully",
+		Data:    testCase,
+	})
+}
+
+// GetAPITestCase 获取用例
+func (h *QAToolBoxHandler) GetAPITestCase(c *gin.Context) {
+	testCase, err := h.qaToolBoxService.GetAPITestCase(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("caseId"))
+	if err != nil {
+		respondAPISuiteError(c, "Failed to get API test case", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test case retrieved successfully",
+		Data:    testCase,
+	})
+}
+
+// UpdateAPITestCase 修改用例，只更新请求中提供的字段；enabled用于启用或停用，position用于移动
+func (h *QAToolBoxHandler) UpdateAPITestCase(c *gin.Context) {
+	var req models.APITestCaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	testCase, err := h.qaToolBoxService.UpdateAPITestCase(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("caseId"), &req)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to update API test case", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test case updated successfully",
+		Data:    testCase,
+	})
+}
+
+// DeleteAPITestCase 删除用例
+func (h *QAToolBoxHandler) DeleteAPITestCase(c *gin.Context) {
+	if err := h.qaToolBoxService.DeleteAPITestCase(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("caseId")); err != nil {
+		respondAPISuiteError(c, "Failed to delete API test case", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test case deleted successfully",
+	})
+}
+
+// ReorderAPITestCases 按case_ids重排套件的全部用例
+func (h *QAToolBoxHandler) ReorderAPITestCases(c *gin.Context) {
+	var req models.APITestCaseOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	testCases, err := h.qaToolBoxService.ReorderAPITestCases(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req.CaseIDs)
+	if err != nil {
+		respondAPISuiteError(c, "Failed to reorder API test cases", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "API test cases reordered successfully",
+		Data:    testCases,
+	})
+}
+
+// CloneAPITestCase 复制用例，副本排在原用例之后
+func (h *QAToolBoxHandler) CloneAPITestCase(c *gin.Context) {
+	testCase, err := h.qaToolBoxService.CloneAPITestCase(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("caseId"))
+	if err != nil {
+		respondAPISuiteError(c, "Failed to clone API test case", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "API test case cloned successfully",
+		Data:    testCase,
+	})
+}
+
+func respondAPISuiteError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrAPITestSuiteNotFound),
+		errors.Is(err, services.ErrAPITestCaseNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidAPITestSuite),
+		errors.Is(err, services.ErrInvalidAPITestCase),
+		errors.Is(err, services.ErrInvalidAPITestOrder):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
@@ -37,6 +37,9 @@ func (h *CreativeStudioHandler) GenerateContent(c *gin.Context) {
 
 	response, err := h.creativeStudioService.GenerateContent(&req)
 	if err != nil {
+		if respondModerationRejected(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Message: "Failed to generate content",
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// 单次请求最多上传的文件数
+const maxUploadFiles = 10
+
+// FileHandler 文件上传和下载
+type FileHandler struct {
+	files *services.FileService
+}
+
+func NewFileHandler(files *services.FileService) *FileHandler {
+	return &FileHandler{
+		files: files,
+	}
+}
+
+// Upload 上传文件（multipart/form-data），支持一次上传多个文件，purpose为可选的用途标记
+//
+// 文件按顺序流式保存，任意一个文件被拒绝时删除本次已保存的文件
+func (h *FileHandler) Upload(c *gin.Context) {
+	userID := c.GetString("user_id")
+	purpose := c.Query("purpose")
+
+	// 请求体上限为所有文件的上限之和，另留出表单字段的空间
+	if limit := h.files.MaxFileSize(); limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit*maxUploadFiles+1<<20)
+	}
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var uploaded []*services.StoredFile
+	fail := func(status int, message string, err error) {
+		for _, file := range uploaded {
+			h.files.Delete(c.Request.Context(), userID, file.ID)
+		}
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: message,
+			Error:   err.Error(),
+		})
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			status := fileErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				status = http.StatusBadRequest
+			}
+			fail(status, "Invalid request format", err)
+			return
+		}
+		if part.FileName() == "" {
+			if part.FormName() == "purpose" && purpose == "" {
+				value, _ := io.ReadAll(io.LimitReader(part, 50))
+				purpose = string(value)
+			}
+			part.Close()
+			continue
+		}
+		if len(uploaded) == maxUploadFiles {
+			part.Close()
+			fail(http.StatusBadRequest, "上传文件失败", fmt.Errorf("一次最多上传%d个文件", maxUploadFiles))
+			return
+		}
+
+		file, err := h.files.Upload(c.Request.Context(), userID, part.FileName(), purpose, part)
+		part.Close()
+		if err != nil {
+			fail(fileErrorStatus(err), "上传文件失败", err)
+			return
+		}
+		uploaded = append(uploaded, file)
+	}
+
+	if len(uploaded) == 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "没有上传文件",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "文件上传成功",
+		Data:    gin.H{"files": uploaded},
+	})
+}
+
+// ListFiles 当前用户上传的文件，可按purpose过滤
+func (h *FileHandler) ListFiles(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	files, total, err := h.files.List(c.Request.Context(), c.GetString("user_id"), c.Query("purpose"), page, perPage)
+	if err != nil {
+		respondFileError(c, "获取文件列表失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: files,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// GetFile 获取文件信息
+func (h *FileHandler) GetFile(c *gin.Context) {
+	file, err := h.files.Get(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		respondFileError(c, "获取文件失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取文件成功",
+		Data:    file,
+	})
+}
+
+// GetSignedURL 生成签名下载链接，expires_in为有效期（秒）
+func (h *FileHandler) GetSignedURL(c *gin.Context) {
+	expiresIn, _ := strconv.Atoi(c.Query("expires_in"))
+	signed, err := h.files.SignedURL(c.Request.Context(), c.GetString("user_id"), c.Param("id"), time.Duration(expiresIn)*time.Second)
+	if err != nil {
+		respondFileError(c, "生成下载链接失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "生成下载链接成功",
+		Data:    signed,
+	})
+}
+
+// Download 下载自己上传的文件
+func (h *FileHandler) Download(c *gin.Context) {
+	content, err := h.files.Open(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		respondFileError(c, "下载文件失败", err)
+		return
+	}
+	serveFileContent(c, content)
+}
+
+// DownloadSigned 通过签名链接下载文件，无需登录
+func (h *FileHandler) DownloadSigned(c *gin.Context) {
+	content, err := h.files.OpenSigned(c.Request.Context(), c.Param("id"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		respondFileError(c, "下载文件失败", err)
+		return
+	}
+	serveFileContent(c, content)
+}
+
+// DeleteFile 删除文件
+func (h *FileHandler) DeleteFile(c *gin.Context) {
+	if err := h.files.Delete(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+		respondFileError(c, "删除文件失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "文件已删除",
+	})
+}
+
+// serveFileContent 对象存储跳转到预签名地址，本地文件直接输出并支持Range请求
+func serveFileContent(c *gin.Context, content *services.FileContent) {
+	if content.RedirectURL != "" {
+		c.Redirect(http.StatusFound, content.RedirectURL)
+		return
+	}
+	defer content.Body.Close()
+
+	file := content.File
+	c.Header("Content-Type", file.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("ETag", `"`+file.Checksum+`"`)
+
+	if seeker, ok := content.Body.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, file.Filename, file.CreatedAt, seeker)
+		return
+	}
+	c.DataFromReader(http.StatusOK, file.Size, file.ContentType, content.Body, nil)
+}
+
+func fileErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrObjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrEmptyFile):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidFileSignature), errors.Is(err, services.ErrFileURLExpired):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+func respondFileError(c *gin.Context, message string, err error) {
+	c.JSON(fileErrorStatus(err), models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
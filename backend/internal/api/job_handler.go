@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// JobHandler 后台任务状态查询和死信队列管理
+type JobHandler struct {
+	jobs *services.JobQueue
+}
+
+func NewJobHandler(jobs *services.JobQueue) *JobHandler {
+	return &JobHandler{
+		jobs: jobs,
+	}
+}
+
+// JobHandle 异步接口返回的任务句柄，通过StatusURL轮询任务状态
+type JobHandle struct {
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	Status    services.JobStatus `json:"status"`
+	StatusURL string             `json:"status_url"`
+}
+
+func newJobHandle(job *services.Job) JobHandle {
+	return JobHandle{
+		ID:        job.ID,
+		Type:      job.Type,
+		Status:    job.Status,
+		StatusURL: "/api/v1/jobs/" + job.ID,
+	}
+}
+
+// respondJobAccepted 任务已入队，返回202和任务句柄，data中的其他字段一并返回
+func respondJobAccepted(c *gin.Context, message string, job *services.Job, data gin.H) {
+	handle := newJobHandle(job)
+	if data == nil {
+		data = gin.H{}
+	}
+	data["job"] = handle
+
+	c.Header("Location", handle.StatusURL)
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// GetJob 获取任务状态、进度和结果，只能查询自己创建的任务
+func (h *JobHandler) GetJob(c *gin.Context) {
+	job, err := h.jobs.Get(c.Request.Context(), c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		respondJobError(c, "获取任务失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取任务成功",
+		Data:    job,
+	})
+}
+
+// ListDeadJobs 死信队列中最近的任务（管理员）
+func (h *JobHandler) ListDeadJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	jobs, err := h.jobs.DeadJobs(c.Request.Context(), limit)
+	if err != nil {
+		respondJobError(c, "获取死信队列失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取死信队列成功",
+		Data:    jobs,
+	})
+}
+
+// RetryJob 重新执行死信队列中的任务（管理员）
+func (h *JobHandler) RetryJob(c *gin.Context) {
+	job, err := h.jobs.Retry(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondJobError(c, "重试任务失败", err)
+		return
+	}
+
+	respondJobAccepted(c, "任务已重新入队", job, nil)
+}
+
+func respondJobError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrJobQueueUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrJobNotDead):
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
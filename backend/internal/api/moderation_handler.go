@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// ModerationHandler 内容审核记录和申诉
+type ModerationHandler struct {
+	moderation *services.ModerationService
+}
+
+func NewModerationHandler(moderation *services.ModerationService) *ModerationHandler {
+	return &ModerationHandler{
+		moderation: moderation,
+	}
+}
+
+// ListMyAudits 当前用户的审核记录，可按action和appeal_status过滤
+func (h *ModerationHandler) ListMyAudits(c *gin.Context) {
+	filter := auditFilter(c)
+	filter.UserID = c.GetString("user_id")
+	h.listAudits(c, filter)
+}
+
+// GetMyAudit 获取当前用户的一条审核记录
+func (h *ModerationHandler) GetMyAudit(c *gin.Context) {
+	audit, err := h.moderation.GetAudit(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		respondModerationError(c, "获取审核记录失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取审核记录成功",
+		Data:    audit,
+	})
+}
+
+// Appeal 对被拒绝、打码或标记的内容提出申诉
+func (h *ModerationHandler) Appeal(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	audit, err := h.moderation.Appeal(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req.Reason)
+	if err != nil {
+		respondModerationError(c, "提交申诉失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "申诉已提交",
+		Data:    audit,
+	})
+}
+
+// ListAudits 所有审核记录（管理员），可按user_id、source、action和appeal_status过滤
+func (h *ModerationHandler) ListAudits(c *gin.Context) {
+	filter := auditFilter(c)
+	filter.UserID = c.Query("user_id")
+	filter.Source = c.Query("source")
+	h.listAudits(c, filter)
+}
+
+// ReviewAppeal 处理申诉（管理员），decision为 upheld 维持或 overturned 撤销
+func (h *ModerationHandler) ReviewAppeal(c *gin.Context) {
+	var req struct {
+		Decision string `json:"decision" binding:"required"`
+		Note     string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if req.Decision != services.ModerationAppealUpheld && req.Decision != services.ModerationAppealOverturned {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "decision只能为upheld或overturned",
+		})
+		return
+	}
+
+	audit, err := h.moderation.ReviewAppeal(c.Request.Context(), c.GetString("user_id"), c.Param("id"), req.Decision, req.Note)
+	if err != nil {
+		respondModerationError(c, "处理申诉失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "申诉已处理",
+		Data:    audit,
+	})
+}
+
+// ListRules 当前生效的审核规则和类别（管理员）
+func (h *ModerationHandler) ListRules(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取审核规则成功",
+		Data: gin.H{
+			"rules":      h.moderation.Rules(),
+			"categories": h.moderation.Categories(),
+		},
+	})
+}
+
+func (h *ModerationHandler) listAudits(c *gin.Context, filter services.ModerationAuditFilter) {
+	audits, total, err := h.moderation.ListAudits(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "获取审核记录失败",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: audits,
+		Pagination: models.Pagination{
+			Page:       filter.Page,
+			PerPage:    filter.PerPage,
+			Total:      total,
+			TotalPages: (total + filter.PerPage - 1) / filter.PerPage,
+		},
+	})
+}
+
+// auditFilter 解析分页和通用过滤参数
+func auditFilter(c *gin.Context) services.ModerationAuditFilter {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	return services.ModerationAuditFilter{
+		Action:       c.Query("action"),
+		AppealStatus: c.Query("appeal_status"),
+		Page:         page,
+		PerPage:      perPage,
+	}
+}
+
+func respondModerationError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrModerationAuditNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrModerationAppealNotAllowed), errors.Is(err, services.ErrModerationAppealNotPending):
+		status = http.StatusConflict
+	}
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
+
+// respondModerationRejected 内容未通过审核时返回422，返回false表示err不是审核错误
+func respondModerationRejected(c *gin.Context, err error) bool {
+	var moderationErr *services.ModerationError
+	if !errors.As(err, &moderationErr) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, models.APIResponse{
+		Success: false,
+		Message: moderationErr.Error(),
+		Data:    moderationErr,
+		Error:   "内容未通过审核",
+	})
+	return true
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// PromptHandler 提示词模板管理（管理员）
+type PromptHandler struct {
+	prompts *services.PromptLibrary
+}
+
+func NewPromptHandler(prompts *services.PromptLibrary) *PromptHandler {
+	return &PromptHandler{
+		prompts: prompts,
+	}
+}
+
+// ListPrompts 获取所有提示词模板及其分流权重
+func (h *PromptHandler) ListPrompts(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Prompt templates retrieved successfully",
+		Data:    h.prompts.List(),
+	})
+}
+
+// SavePrompt 新增或更新一个提示词模板版本
+func (h *PromptHandler) SavePrompt(c *gin.Context) {
+	var tpl services.PromptTemplate
+	if err := c.ShouldBindJSON(&tpl); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.prompts.Save(c.Request.Context(), &tpl); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Failed to save prompt template",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Prompt template saved successfully",
+		Data:    tpl,
+	})
+}
+
+// SetPromptWeights 设置模板各版本的A/B分流权重
+func (h *PromptHandler) SetPromptWeights(c *gin.Context) {
+	var req struct {
+		Locale  string         `json:"locale" binding:"required"`
+		Weights map[string]int `json:"weights" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := h.prompts.SetWeights(c.Request.Context(), c.Param("name"), req.Locale, req.Weights); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Failed to update prompt weights",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Prompt weights updated successfully",
+		Data:    h.prompts.List(),
+	})
+}
+
+// ReloadPrompts 重新加载内置、文件和数据库中的模板
+func (h *PromptHandler) ReloadPrompts(c *gin.Context) {
+	if err := h.prompts.Reload(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to reload prompt templates",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Prompt templates reloaded successfully",
+		Data:    h.prompts.List(),
+	})
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"errors"
+	"log"
+	"mime"
 	"net/http"
 	"strconv"
 
@@ -36,13 +39,9 @@ func (h *QAToolBoxHandler) GenerateTestCases(c *gin.Context) {
 
 	req.UserID = userID.(string)
 
-	response, err := h.qaToolBoxService.GenerateTestCases(userID.(string), &req)
+	response, err := h.qaToolBoxService.GenerateTestCases(aiContext(c, services.AIFeatureTestGeneration), userID.(string), &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Message: "Failed to generate test cases",
-			Error:   err.Error(),
-		})
+		respondAIError(c, "Failed to generate test cases", err)
 		return
 	}
 
@@ -98,7 +97,24 @@ func (h *QAToolBoxHandler) ConvertPDF(c *gin.Context) {
 
 	req.UserID = userID.(string)
 
-	response, err := h.qaToolBoxService.ConvertPDF(&req)
+	response, job, err := h.qaToolBoxService.ConvertPDF(c.Request.Context(), &req)
+	if errors.Is(err, services.ErrFileNotFound) {
+		c.JSON(http.StatusNotFound, models.APIResponse{
+			Success: false,
+			Message: "Source file not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrUnsupportedConversion) || errors.Is(err, services.ErrInvalidConversionSource) ||
+		errors.Is(err, services.ErrInvalidConversionOptions) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid conversion request",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -108,10 +124,37 @@ func (h *QAToolBoxHandler) ConvertPDF(c *gin.Context) {
 		return
 	}
 
+	respondJobAccepted(c, "PDF conversion queued", job, gin.H{"conversion": response})
+}
+
+// DownloadPDFConversion 下载转换结果
+func (h *QAToolBoxHandler) DownloadPDFConversion(c *gin.Context) {
+	path, filename, err := h.qaToolBoxService.GetPDFConversionFile(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrConversionNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrConversionNotReady):
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: "Failed to download conversion result",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.FileAttachment(path, filename)
+}
+
+// GetConversionFormats 获取支持的转换格式
+func (h *QAToolBoxHandler) GetConversionFormats(c *gin.Context) {
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
-		Message: "PDF converted successfully",
-		Data:    response,
+		Message: "Conversion formats retrieved successfully",
+		Data:    h.qaToolBoxService.ConversionFormats(),
 	})
 }
 
@@ -160,7 +203,15 @@ func (h *QAToolBoxHandler) CreateCrawlerTask(c *gin.Context) {
 
 	req.UserID = userID.(string)
 
-	response, err := h.qaToolBoxService.CreateCrawlerTask(&req)
+	response, job, err := h.qaToolBoxService.CreateCrawlerTask(c.Request.Context(), &req)
+	if errors.Is(err, services.ErrInvalidCrawlerTask) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid crawler task",
+			Error:   err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
@@ -170,11 +221,7 @@ func (h *QAToolBoxHandler) CreateCrawlerTask(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Success: true,
-		Message: "Crawler task created successfully",
-		Data:    response,
-	})
+	respondJobAccepted(c, "Crawler task queued", job, gin.H{"task": response})
 }
 
 // GetCrawlerTasks 获取爬虫任务
@@ -206,6 +253,175 @@ func (h *QAToolBoxHandler) GetCrawlerTasks(c *gin.Context) {
 	})
 }
 
+// GetCrawlerResults 分页获取爬虫任务的结果
+func (h *QAToolBoxHandler) GetCrawlerResults(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	results, total, err := h.qaToolBoxService.GetCrawlerResults(c.Request.Context(), c.GetString("user_id"), c.Param("id"), page, perPage)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrCrawlerTaskNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: "Failed to get crawler results",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: results,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// ExportCrawlerResults 导出爬虫任务的结果，format为csv、jsonl或xlsx
+//
+// 结果边读边写，开始输出后出错只能中断响应
+func (h *QAToolBoxHandler) ExportCrawlerResults(c *gin.Context) {
+	export, err := h.qaToolBoxService.ExportCrawlerResults(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.DefaultQuery("format", services.CrawlerExportCSV))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrCrawlerTaskNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrUnsupportedExportFormat):
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: "Failed to export crawler results",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	if err := export.WriteTo(c.Request.Context(), c.Writer); err != nil {
+		log.Printf("导出爬虫结果失败 (task=%s): %v", c.Param("id"), err)
+		c.Abort()
+	}
+}
+
+// GetCrawlerChanges 监控模式下检测到的页面变化，可按url过滤，alert=true时只返回需要通知的变化
+func (h *QAToolBoxHandler) GetCrawlerChanges(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	alertOnly, _ := strconv.ParseBool(c.Query("alert"))
+
+	changes, total, err := h.qaToolBoxService.GetCrawlerChanges(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Query("url"), alertOnly, page, perPage)
+	if err != nil {
+		respondCrawlerWatchError(c, "Failed to get crawler changes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: changes,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// GetCrawlerChange 单个页面变化，包含文本diff
+func (h *QAToolBoxHandler) GetCrawlerChange(c *gin.Context) {
+	change, err := h.qaToolBoxService.GetCrawlerChange(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("changeId"))
+	if err != nil {
+		respondCrawlerWatchError(c, "Failed to get crawler change", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Crawler change retrieved successfully",
+		Data:    change,
+	})
+}
+
+// GetCrawlerSnapshots 监控模式下保存的页面快照，可按url过滤
+func (h *QAToolBoxHandler) GetCrawlerSnapshots(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	snapshots, total, err := h.qaToolBoxService.GetCrawlerSnapshots(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Query("url"), page, perPage)
+	if err != nil {
+		respondCrawlerWatchError(c, "Failed to get crawler snapshots", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: snapshots,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// GetCrawlerSnapshot 单个页面快照，包含规范化后的页面文本
+func (h *QAToolBoxHandler) GetCrawlerSnapshot(c *gin.Context) {
+	snapshot, err := h.qaToolBoxService.GetCrawlerSnapshot(c.Request.Context(), c.GetString("user_id"), c.Param("id"), c.Param("snapshotId"))
+	if err != nil {
+		respondCrawlerWatchError(c, "Failed to get crawler snapshot", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Crawler snapshot retrieved successfully",
+		Data:    snapshot,
+	})
+}
+
+func respondCrawlerWatchError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrCrawlerTaskNotFound),
+		errors.Is(err, services.ErrCrawlerChangeNotFound),
+		errors.Is(err, services.ErrCrawlerSnapshotNotFound):
+		status = http.StatusNotFound
+	}
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
+
 // RunAPITest 运行API测试
 func (h *QAToolBoxHandler) RunAPITest(c *gin.Context) {
 	userID, _ := c.Get("user_id")
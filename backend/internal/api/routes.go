@@ -36,6 +36,14 @@ func SetupRoutes(router *gin.Engine, services *services.Services, jwtSecret stri
 			// 第三方服务（公开访问，但需要API密钥）
 			thirdPartyHandler := NewThirdPartyHandler(services)
 			thirdPartyHandler.RegisterRoutes(public)
+			
+			// 后台任务状态（匿名创建的异步任务也可查询）
+			jobHandler := NewJobHandler(services.JobQueue)
+			public.GET("/jobs/:id", middleware.OptionalAuthMiddleware(jwtSecret), jobHandler.GetJob)
+			
+			// 签名下载链接（无需登录）
+			fileHandler := NewFileHandler(services.FileService)
+			public.GET("/files/:id/content", fileHandler.DownloadSigned)
 		}
 
 		// 需要认证的路由
@@ -68,6 +76,15 @@ func SetupRoutes(router *gin.Engine, services *services.Services, jwtSecret stri
 			protected.DELETE("/apps/:id/uninstall", appHandler.UninstallApp)
 			protected.GET("/apps/installed", appHandler.GetInstalledApps)
 			
+			// 文件上传和下载
+			fileHandler := NewFileHandler(services.FileService)
+			protected.POST("/files", fileHandler.Upload)
+			protected.GET("/files", fileHandler.ListFiles)
+			protected.GET("/files/:id", fileHandler.GetFile)
+			protected.GET("/files/:id/url", fileHandler.GetSignedURL)
+			protected.GET("/files/:id/download", fileHandler.Download)
+			protected.DELETE("/files/:id", fileHandler.DeleteFile)
+			
 			// QAToolBox Pro功能
 			qaToolboxHandler := NewQAToolBoxHandler(services.QAToolBoxService)
 			qaToolbox := protected.Group("/qa-toolbox")
@@ -75,11 +92,44 @@ func SetupRoutes(router *gin.Engine, services *services.Services, jwtSecret stri
 				qaToolbox.POST("/test-generation", qaToolboxHandler.GenerateTestCases)
 				qaToolbox.GET("/test-cases", qaToolboxHandler.GetTestCases)
 				qaToolbox.POST("/pdf-conversion", qaToolboxHandler.ConvertPDF)
+				qaToolbox.GET("/pdf-conversion/formats", qaToolboxHandler.GetConversionFormats)
 				qaToolbox.GET("/pdf-conversions", qaToolboxHandler.GetPDFConversions)
+				qaToolbox.GET("/pdf-conversions/:id/download", qaToolboxHandler.DownloadPDFConversion)
 				qaToolbox.POST("/crawler", qaToolboxHandler.CreateCrawlerTask)
 				qaToolbox.GET("/crawler-tasks", qaToolboxHandler.GetCrawlerTasks)
+				qaToolbox.GET("/crawler-tasks/:id/results", qaToolboxHandler.GetCrawlerResults)
+				qaToolbox.GET("/crawler-tasks/:id/export", qaToolboxHandler.ExportCrawlerResults)
+				qaToolbox.GET("/crawler-tasks/:id/changes", qaToolboxHandler.GetCrawlerChanges)
+				qaToolbox.GET("/crawler-tasks/:id/changes/:changeId", qaToolboxHandler.GetCrawlerChange)
+				qaToolbox.GET("/crawler-tasks/:id/snapshots", qaToolboxHandler.GetCrawlerSnapshots)
+				qaToolbox.GET("/crawler-tasks/:id/snapshots/:snapshotId", qaToolboxHandler.GetCrawlerSnapshot)
 				qaToolbox.POST("/api-test", qaToolboxHandler.RunAPITest)
 				qaToolbox.GET("/api-tests", qaToolboxHandler.GetAPITests)
+
+				// API测试套件和用例管理
+				qaToolbox.POST("/api-suites", qaToolboxHandler.CreateAPITestSuite)
+				qaToolbox.GET("/api-suites", qaToolboxHandler.ListAPITestSuites)
+				qaToolbox.GET("/api-suites/:id", qaToolboxHandler.GetAPITestSuite)
+				qaToolbox.PUT("/api-suites/:id", qaToolboxHandler.UpdateAPITestSuite)
+				qaToolbox.DELETE("/api-suites/:id", qaToolboxHandler.DeleteAPITestSuite)
+				qaToolbox.POST("/api-suites/:id/clone", qaToolboxHandler.CloneAPITestSuite)
+				qaToolbox.GET("/api-suites/:id/cases", qaToolboxHandler.ListAPITestCases)
+				qaToolbox.POST("/api-suites/:id/cases", qaToolboxHandler.CreateAPITestCase)
+				qaToolbox.PUT("/api-suites/:id/cases/order", qaToolboxHandler.ReorderAPITestCases)
+				qaToolbox.GET("/api-suites/:id/cases/:caseId", qaToolboxHandler.GetAPITestCase)
+				qaToolbox.PUT("/api-suites/:id/cases/:caseId", qaToolboxHandler.UpdateAPITestCase)
+				qaToolbox.DELETE("/api-suites/:id/cases/:caseId", qaToolboxHandler.DeleteAPITestCase)
+				qaToolbox.POST("/api-suites/:id/cases/:caseId/clone", qaToolboxHandler.CloneAPITestCase)
+
+				// 定时执行爬虫任务和API测试套件
+				scheduleHandler := NewScheduleHandler(services.ScheduleService)
+				qaToolbox.POST("/schedules", scheduleHandler.CreateSchedule)
+				qaToolbox.GET("/schedules", scheduleHandler.ListSchedules)
+				qaToolbox.GET("/schedules/:id", scheduleHandler.GetSchedule)
+				qaToolbox.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+				qaToolbox.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+				qaToolbox.POST("/schedules/:id/run", scheduleHandler.RunSchedule)
+				qaToolbox.GET("/schedules/:id/runs", scheduleHandler.GetScheduleRuns)
 			}
 			
 			// LifeMode功能
@@ -134,6 +184,38 @@ func SetupRoutes(router *gin.Engine, services *services.Services, jwtSecret stri
 				creativeStudio.POST("/design", creativeStudioHandler.CreateDesign)
 				creativeStudio.GET("/designs", creativeStudioHandler.GetDesigns)
 			}
+			
+			// 语义搜索
+			searchHandler := NewSearchHandler(services.SemanticSearchService)
+			protected.GET("/search/semantic", searchHandler.SemanticSearch)
+			
+			// 内容审核记录和申诉
+			moderationHandler := NewModerationHandler(services.ModerationService)
+			protected.GET("/moderation/audits", moderationHandler.ListMyAudits)
+			protected.GET("/moderation/audits/:id", moderationHandler.GetMyAudit)
+			protected.POST("/moderation/audits/:id/appeal", moderationHandler.Appeal)
+			
+			// 管理员功能
+			admin := protected.Group("/admin", middleware.AdminMiddleware(services.Config.AdminEmails))
+			{
+				promptHandler := NewPromptHandler(services.AIClientManager.Prompts())
+				admin.GET("/prompts", promptHandler.ListPrompts)
+				admin.POST("/prompts", promptHandler.SavePrompt)
+				admin.PUT("/prompts/:name/weights", promptHandler.SetPromptWeights)
+				admin.POST("/prompts/reload", promptHandler.ReloadPrompts)
+
+				aiCostHandler := NewAICostHandler(services.AIClientManager)
+				admin.GET("/ai/costs", aiCostHandler.GetDailyCosts)
+				admin.GET("/ai/budget", aiCostHandler.GetBudgetStatus)
+
+				admin.GET("/moderation/audits", moderationHandler.ListAudits)
+				admin.PUT("/moderation/audits/:id/review", moderationHandler.ReviewAppeal)
+				admin.GET("/moderation/rules", moderationHandler.ListRules)
+
+				jobHandler := NewJobHandler(services.JobQueue)
+				admin.GET("/jobs/dead", jobHandler.ListDeadJobs)
+				admin.POST("/jobs/:id/retry", jobHandler.RetryJob)
+			}
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// ScheduleHandler 爬虫任务和API测试套件的定时执行
+type ScheduleHandler struct {
+	schedules *services.ScheduleService
+}
+
+func NewScheduleHandler(schedules *services.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{
+		schedules: schedules,
+	}
+}
+
+// CreateSchedule 创建定时任务，cron为5段cron表达式，按timezone（默认UTC）计算执行时间
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.schedules.Create(c.Request.Context(), c.GetString("user_id"), &req)
+	if err != nil {
+		respondScheduleError(c, "创建定时任务失败", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "定时任务创建成功",
+		Data:    schedule,
+	})
+}
+
+// ListSchedules 当前用户的定时任务，可按target_type和target_id过滤
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	page, perPage := schedulePaging(c)
+	schedules, total, err := h.schedules.List(c.Request.Context(), c.GetString("user_id"),
+		c.Query("target_type"), c.Query("target_id"), page, perPage)
+	if err != nil {
+		respondScheduleError(c, "获取定时任务列表失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: schedules,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+// GetSchedule 获取定时任务
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, err := h.schedules.Get(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		respondScheduleError(c, "获取定时任务失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "获取定时任务成功",
+		Data:    schedule,
+	})
+}
+
+// UpdateSchedule 修改cron表达式、时区或启用状态，执行目标不能修改
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request format",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.schedules.Update(c.Request.Context(), c.GetString("user_id"), c.Param("id"), &req)
+	if err != nil {
+		respondScheduleError(c, "更新定时任务失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "定时任务已更新",
+		Data:    schedule,
+	})
+}
+
+// DeleteSchedule 删除定时任务和执行记录
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	if err := h.schedules.Delete(c.Request.Context(), c.GetString("user_id"), c.Param("id")); err != nil {
+		respondScheduleError(c, "删除定时任务失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "定时任务已删除",
+	})
+}
+
+// RunSchedule 立即执行一次，同一目标的上一次执行尚未结束时返回409
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	run, job, err := h.schedules.Trigger(c.Request.Context(), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		respondScheduleError(c, "执行定时任务失败", err)
+		return
+	}
+
+	respondJobAccepted(c, "定时任务已加入执行队列", job, gin.H{"run": run})
+}
+
+// GetScheduleRuns 执行记录，changed=true时只返回结果与上一次不同的记录
+func (h *ScheduleHandler) GetScheduleRuns(c *gin.Context) {
+	page, perPage := schedulePaging(c)
+	changedOnly, _ := strconv.ParseBool(c.Query("changed"))
+	runs, total, err := h.schedules.Runs(c.Request.Context(), c.GetString("user_id"), c.Param("id"), changedOnly, page, perPage)
+	if err != nil {
+		respondScheduleError(c, "获取执行记录失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data: runs,
+		Pagination: models.Pagination{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: (total + perPage - 1) / perPage,
+		},
+	})
+}
+
+func schedulePaging(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	return page, perPage
+}
+
+func respondScheduleError(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrScheduleNotFound),
+		errors.Is(err, services.ErrCrawlerTaskNotFound),
+		errors.Is(err, services.ErrAPITestSuiteNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidSchedule):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrScheduleRunInProgress):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrJobQueueUnavailable):
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, models.APIResponse{
+		Success: false,
+		Message: message,
+		Error:   err.Error(),
+	})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"qa-toolbox-backend/internal/models"
+	"qa-toolbox-backend/internal/services"
+)
+
+// SearchHandler 用户内容搜索
+type SearchHandler struct {
+	search *services.SemanticSearchService
+}
+
+func NewSearchHandler(search *services.SemanticSearchService) *SearchHandler {
+	return &SearchHandler{
+		search: search,
+	}
+}
+
+// SemanticSearch 在当前用户的写作、测试用例、心情记录、聊天和AI对话中做语义搜索
+//
+// types为逗号分隔的内容类型，from/to为RFC3339或YYYY-MM-DD格式的创建时间范围
+func (h *SearchHandler) SemanticSearch(c *gin.Context) {
+	req := &services.SemanticSearchRequest{
+		Query: c.Query("q"),
+	}
+	if req.Query == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "搜索内容不能为空",
+		})
+		return
+	}
+
+	if types := c.Query("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				req.Types = append(req.Types, t)
+			}
+		}
+	}
+	req.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "10"))
+	req.MinScore, _ = strconv.ParseFloat(c.DefaultQuery("min_score", "0"), 64)
+
+	var err error
+	if req.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "from格式错误",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if req.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "to格式错误",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := h.search.Search(aiContext(c, services.AIFeatureEmbedding), c.GetString("user_id"), req)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownSearchSource) {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "不支持的内容类型",
+				Error:   err.Error(),
+			})
+			return
+		}
+		respondAIError(c, "搜索失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "搜索成功",
+		Data:    result,
+	})
+}
+
+// parseSearchTime 解析时间参数，只有日期的to包含当天全天
+func parseSearchTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
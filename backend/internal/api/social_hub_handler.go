@@ -190,6 +190,9 @@ func (h *SocialHubHandler) SendMessage(c *gin.Context) {
 
 	response, err := h.socialHubService.SendMessage(&req)
 	if err != nil {
+		if respondModerationRejected(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
 			Success: false,
 			Message: "Failed to send message",
@@ -35,6 +35,9 @@ type Config struct {
 	JWTSecret     string
 	JWTExpireHours int
 	
+	// 管理员邮箱（可访问 /admin 接口）
+	AdminEmails []string
+	
 	// AI服务配置
 	DeepSeekAPIKey    string
 	DeepSeekBaseURL   string
@@ -43,6 +46,7 @@ type Config struct {
 	TencentSecretID   string
 	TencentSecretKey  string
 	TencentRegion     string
+	TencentBaseURL    string
 	GroqAPIKey        string
 	GroqBaseURL       string
 	AIToolsAPIKey     string
@@ -53,12 +57,90 @@ type Config struct {
 	OpenRouterBaseURL string
 	XunfeiAPIKey      string
 	XunfeiAppID       string
+	XunfeiAPISecret   string
+	XunfeiBaseURL     string
 	BaiduAPIKey       string
 	BaiduSecretKey    string
+	BaiduBaseURL      string
 	BytedanceAPIKey   string
 	BytedanceBaseURL  string
+	BytedanceModel    string
 	SiliconFlowAPIKey string
 	SiliconFlowBaseURL string
+	AIProvidersFile   string
+	AIPromptsDir      string
+	AIModelCatalogFile string
+	AIRoutePolicy      string
+	
+	// AI服务熔断配置
+	AICircuitFailureThreshold int
+	AICircuitErrorRate        float64
+	AICircuitMinRequests      int
+	AICircuitWindowSize       int
+	AICircuitOpenSeconds      int
+
+	// AI用量配额（登录用户按会员计划，匿名调用按IP）
+	AIAnonymousDailyTokenQuota int64
+
+	// AI响应缓存（仅缓存temperature为0的请求）
+	AICacheEnabled    bool
+	AICacheTTLSeconds int
+
+	// 结构化输出不符合Schema时的最大修复次数
+	AIStructuredMaxRepairs int
+
+	// 多轮对话发送给模型的历史消息token预算，超出部分压缩为摘要
+	AIConversationContextTokens int
+
+	// 工具调用循环的最大轮数
+	AIToolMaxRounds int
+
+	// 向量化服务，为空时自动选择，local 表示使用本地向量化
+	AIEmbeddingProvider string
+
+	// AI成本预算，超出后发送通知并降级付费服务，金额为 AIBudgetCurrency 币种
+	AIDailyBudget          float64
+	AIProviderDailyBudgets []string
+	AIBudgetCurrency       string
+	AIExchangeRates        []string
+
+	// 模拟AI服务（离线开发和测试），mode为空时不启用，fallback 作为最后的备选，only 只使用模拟服务
+	AIMockMode         string
+	AIMockFixturesFile string
+	AIMockLatencyMs    int
+	AIMockErrorRate    float64
+
+	// 内容审核，分类器开启时规则未拒绝的内容再由模型判断类别
+	ModerationEnabled              bool
+	ModerationRulesFile            string
+	ModerationActions              []string
+	ModerationClassifierEnabled    bool
+	ModerationClassifierMinScore   float64
+	ModerationClassifierFailClosed bool
+
+	// 后台任务队列（Redis），失败的任务按指数退避重试，重试用完后进入死信队列
+	JobWorkers             int
+	JobMaxAttempts         int
+	JobRetryBackoffSeconds int
+	JobMaxBackoffSeconds   int
+	JobLeaseSeconds        int
+	JobRetentionHours      int
+
+	// 爬虫，CrawlerWorkers为单个任务的最大并发数，CrawlerMaxPages为单个任务的最大页面数
+	CrawlerUserAgent          string
+	CrawlerWorkers            int
+	CrawlerMaxPages           int
+	CrawlerTimeoutSeconds     int
+	CrawlerMaxBodyBytes       int64
+	CrawlerRobotsCacheMinutes int
+	// 允许爬虫和Webhook访问的内网网段（CIDR），默认禁止访问本机、内网和链路本地地址
+	CrawlerAllowedNetworks []string
+
+	// 定时任务，多副本部署时通过Redis选主，只有主节点触发到期的定时任务
+	SchedulerEnabled            bool
+	SchedulerPollSeconds        int
+	SchedulerLeaderTTLSeconds   int
+	SchedulerMinIntervalSeconds int
 	
 	// 地图和位置服务
 	AmapAPIKey  string
@@ -99,6 +181,22 @@ type Config struct {
 	UploadDir         string
 	MaxFileSize       int64
 	AllowedFileTypes  []string
+
+	// 存储后端 local 或 s3（兼容MinIO），签名下载链接使用 StorageSigningKey，为空时使用JWT密钥
+	StorageBackend       string
+	StorageSigningKey    string
+	StorageURLTTLSeconds int
+	S3Endpoint           string
+	S3Region             string
+	S3Bucket             string
+	S3AccessKeyID        string
+	S3SecretAccessKey    string
+	S3UsePathStyle       bool
+
+	// 文档转换，启用时优先使用本地安装的 pdftotext、wkhtmltopdf、LibreOffice
+	ConversionToolsEnabled   bool
+	ConversionFontFile       string
+	ConversionTimeoutSeconds int
 	
 	// 日志配置
 	LogLevel      string
@@ -155,6 +253,8 @@ func Load() *Config {
 		JWTSecret:      getEnv("JWT_SECRET", "your-jwt-secret-key-here"),
 		JWTExpireHours: getEnvAsInt("JWT_EXPIRE_HOURS", 24),
 		
+		AdminEmails: getEnvStringSlice("ADMIN_EMAILS", []string{}),
+		
 		// AI服务配置
 		DeepSeekAPIKey:    getEnv("DEEPSEEK_API_KEY", ""),
 		DeepSeekBaseURL:   getEnv("DEEPSEEK_BASE_URL", "https://api.deepseek.com/v1"),
@@ -163,6 +263,7 @@ func Load() *Config {
 		TencentSecretID:   getEnv("TENCENT_SECRET_ID", ""),
 		TencentSecretKey:  getEnv("TENCENT_SECRET_KEY", ""),
 		TencentRegion:     getEnv("TENCENT_REGION", "ap-beijing"),
+		TencentBaseURL:    getEnv("TENCENT_BASE_URL", "https://hunyuan.tencentcloudapi.com"),
 		GroqAPIKey:        getEnv("GROQ_API_KEY", ""),
 		GroqBaseURL:       getEnv("GROQ_BASE_URL", "https://api.groq.com/openai/v1"),
 		AIToolsAPIKey:     getEnv("AITOOLS_API_KEY", ""),
@@ -173,12 +274,77 @@ func Load() *Config {
 		OpenRouterBaseURL: getEnv("OPENROUTER_BASE_URL", "https://openrouter.ai/api/v1"),
 		XunfeiAPIKey:     getEnv("XUNFEI_API_KEY", ""),
 		XunfeiAppID:      getEnv("XUNFEI_APP_ID", ""),
+		XunfeiAPISecret:  getEnv("XUNFEI_API_SECRET", ""),
+		XunfeiBaseURL:    getEnv("XUNFEI_BASE_URL", "wss://spark-api.xf-yun.com"),
 		BaiduAPIKey:      getEnv("BAIDU_API_KEY", ""),
 		BaiduSecretKey:   getEnv("BAIDU_SECRET_KEY", ""),
+		BaiduBaseURL:     getEnv("BAIDU_BASE_URL", "https://aip.baidubce.com"),
 		BytedanceAPIKey:  getEnv("BYTEDANCE_API_KEY", ""),
 		BytedanceBaseURL: getEnv("BYTEDANCE_BASE_URL", "https://ark.cn-beijing.volces.com/api/v3"),
+		BytedanceModel:   getEnv("BYTEDANCE_MODEL", ""),
 		SiliconFlowAPIKey: getEnv("SILICONFLOW_API_KEY", ""),
 		SiliconFlowBaseURL: getEnv("SILICONFLOW_BASE_URL", "https://api.siliconflow.cn/v1"),
+		AIProvidersFile:   getEnv("AI_PROVIDERS_FILE", ""),
+		AIPromptsDir:      getEnv("AI_PROMPTS_DIR", ""),
+		AIModelCatalogFile: getEnv("AI_MODEL_CATALOG_FILE", ""),
+		AIRoutePolicy:      getEnv("AI_ROUTE_POLICY", ""),
+		
+		// AI服务熔断配置
+		AICircuitFailureThreshold: getEnvAsInt("AI_CIRCUIT_FAILURE_THRESHOLD", 5),
+		AICircuitErrorRate:        getEnvAsFloat("AI_CIRCUIT_ERROR_RATE", 0.5),
+		AICircuitMinRequests:      getEnvAsInt("AI_CIRCUIT_MIN_REQUESTS", 10),
+		AICircuitWindowSize:       getEnvAsInt("AI_CIRCUIT_WINDOW_SIZE", 50),
+		AICircuitOpenSeconds:      getEnvAsInt("AI_CIRCUIT_OPEN_SECONDS", 30),
+
+		AIAnonymousDailyTokenQuota: getEnvAsInt64("AI_ANONYMOUS_DAILY_TOKEN_QUOTA", 5000),
+
+		AICacheEnabled:    getEnvAsBool("AI_CACHE_ENABLED", true),
+		AICacheTTLSeconds: getEnvAsInt("AI_CACHE_TTL_SECONDS", 86400),
+
+		AIStructuredMaxRepairs: getEnvAsInt("AI_STRUCTURED_MAX_REPAIRS", 2),
+
+		AIConversationContextTokens: getEnvAsInt("AI_CONVERSATION_CONTEXT_TOKENS", 6000),
+
+		AIToolMaxRounds: getEnvAsInt("AI_TOOL_MAX_ROUNDS", 5),
+
+		AIEmbeddingProvider: getEnv("AI_EMBEDDING_PROVIDER", ""),
+
+		AIDailyBudget:          getEnvAsFloat("AI_DAILY_BUDGET", 0),
+		AIProviderDailyBudgets: getEnvStringSlice("AI_PROVIDER_DAILY_BUDGETS", []string{}),
+		AIBudgetCurrency:       getEnv("AI_BUDGET_CURRENCY", "USD"),
+		AIExchangeRates:        getEnvStringSlice("AI_EXCHANGE_RATES", []string{}),
+
+		AIMockMode:         getEnv("AI_MOCK_MODE", ""),
+		AIMockFixturesFile: getEnv("AI_MOCK_FIXTURES_FILE", ""),
+		AIMockLatencyMs:    getEnvAsInt("AI_MOCK_LATENCY_MS", 0),
+		AIMockErrorRate:    getEnvAsFloat("AI_MOCK_ERROR_RATE", 0),
+
+		ModerationEnabled:              getEnvAsBool("MODERATION_ENABLED", true),
+		ModerationRulesFile:            getEnv("MODERATION_RULES_FILE", ""),
+		ModerationActions:              getEnvStringSlice("MODERATION_ACTIONS", []string{}),
+		ModerationClassifierEnabled:    getEnvAsBool("MODERATION_CLASSIFIER_ENABLED", false),
+		ModerationClassifierMinScore:   getEnvAsFloat("MODERATION_CLASSIFIER_MIN_SCORE", 0.7),
+		ModerationClassifierFailClosed: getEnvAsBool("MODERATION_CLASSIFIER_FAIL_CLOSED", false),
+
+		JobWorkers:             getEnvAsInt("JOB_WORKERS", 4),
+		JobMaxAttempts:         getEnvAsInt("JOB_MAX_ATTEMPTS", 3),
+		JobRetryBackoffSeconds: getEnvAsInt("JOB_RETRY_BACKOFF_SECONDS", 5),
+		JobMaxBackoffSeconds:   getEnvAsInt("JOB_MAX_BACKOFF_SECONDS", 300),
+		JobLeaseSeconds:        getEnvAsInt("JOB_LEASE_SECONDS", 60),
+		JobRetentionHours:      getEnvAsInt("JOB_RETENTION_HOURS", 168),
+
+		CrawlerUserAgent:          getEnv("CRAWLER_USER_AGENT", "QAToolBox-Crawler/1.0"),
+		CrawlerWorkers:            getEnvAsInt("CRAWLER_WORKERS", 4),
+		CrawlerMaxPages:           getEnvAsInt("CRAWLER_MAX_PAGES", 500),
+		CrawlerTimeoutSeconds:     getEnvAsInt("CRAWLER_TIMEOUT_SECONDS", 30),
+		CrawlerMaxBodyBytes:       getEnvAsInt64("CRAWLER_MAX_BODY_BYTES", 5242880), // 5MB
+		CrawlerRobotsCacheMinutes: getEnvAsInt("CRAWLER_ROBOTS_CACHE_MINUTES", 60),
+		CrawlerAllowedNetworks:    getEnvStringSlice("CRAWLER_ALLOWED_NETWORKS", nil),
+
+		SchedulerEnabled:            getEnvAsBool("SCHEDULER_ENABLED", true),
+		SchedulerPollSeconds:        getEnvAsInt("SCHEDULER_POLL_SECONDS", 15),
+		SchedulerLeaderTTLSeconds:   getEnvAsInt("SCHEDULER_LEADER_TTL_SECONDS", 45),
+		SchedulerMinIntervalSeconds: getEnvAsInt("SCHEDULER_MIN_INTERVAL_SECONDS", 60),
 		
 		// 地图和位置服务
 		AmapAPIKey:  getEnv("AMAP_API_KEY", ""),
@@ -219,6 +385,20 @@ func Load() *Config {
 		UploadDir:        getEnv("UPLOAD_DIR", "./uploads"),
 		MaxFileSize:      getEnvAsInt64("MAX_FILE_SIZE", 10485760), // 10MB
 		AllowedFileTypes: getEnvStringSlice("ALLOWED_FILE_TYPES", []string{"jpg", "jpeg", "png", "gif", "pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx"}),
+
+		StorageBackend:       getEnv("STORAGE_BACKEND", "local"),
+		StorageSigningKey:    getEnv("STORAGE_SIGNING_KEY", ""),
+		StorageURLTTLSeconds: getEnvAsInt("STORAGE_URL_TTL_SECONDS", 3600),
+		S3Endpoint:           getEnv("S3_ENDPOINT", ""),
+		S3Region:             getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:             getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:        getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey:    getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3UsePathStyle:       getEnvAsBool("S3_USE_PATH_STYLE", true),
+
+		ConversionToolsEnabled:   getEnvAsBool("CONVERSION_TOOLS_ENABLED", true),
+		ConversionFontFile:       getEnv("CONVERSION_FONT_FILE", ""),
+		ConversionTimeoutSeconds: getEnvAsInt("CONVERSION_TIMEOUT_SECONDS", 120),
 		
 		// 日志配置
 		LogLevel:      getEnv("LOG_LEVEL", "info"),
@@ -269,6 +449,15 @@ func getEnvAsInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -91,6 +91,53 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthMiddleware 可选认证中间件，携带有效令牌时设置用户信息，否则按匿名请求继续
+func OptionalAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" || tokenString == c.GetHeader("Authorization") {
+			c.Next()
+			return
+		}
+
+		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(jwtSecret), nil
+		})
+		if err == nil && token.Valid {
+			if claims, ok := token.Claims.(*JWTClaims); ok {
+				c.Set("user_id", claims.UserID)
+				c.Set("email", claims.Email)
+				c.Set("username", claims.Username)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// AdminMiddleware 管理员权限中间件，需在AuthMiddleware之后使用
+func AdminMiddleware(adminEmails []string) gin.HandlerFunc {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		admins[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+
+	return func(c *gin.Context) {
+		if !admins[strings.ToLower(c.GetString("email"))] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "需要管理员权限",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // GenerateJWT 生成JWT令牌
 func GenerateJWT(userID, email, username, jwtSecret string) (string, error) {
 	claims := JWTClaims{
@@ -161,7 +161,7 @@ type TaskComment struct {
 	TaskID      string    `json:"task_id" db:"task_id"`
 	UserID      string    `json:"user_id" db:"user_id"`
 	Content     string    `json:"content" db:"content"`
-	Attachments []string  `json:"attachments" db:"attachments"`
+	Attachments []string  `json:"attachments" db:"attachments"` // 已上传文件的引用 file:<id>，不保存外部地址
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -171,8 +171,9 @@ type TaskComment struct {
 // PDFConversionRequest PDF转换请求
 type PDFConversionRequest struct {
 	UserID       string `json:"user_id"`
-	SourceFileURL string `json:"source_file_url" validate:"required"`
-	SourceFormat string `json:"source_format" validate:"required"`
+	SourceFileURL string `json:"source_file_url"`
+	SourceFileID string `json:"source_file_id"` // 已上传文件的ID，优先于source_file_url
+	SourceFormat string `json:"source_format"`
 	TargetFormat string `json:"target_format" validate:"required"`
 	Options      map[string]interface{} `json:"options"`
 }
@@ -189,6 +190,7 @@ type PDFConversionResponse struct {
 	FileSize      int        `json:"file_size" db:"file_size"`
 	PageCount     int        `json:"page_count" db:"page_count"`
 	ErrorMessage  string     `json:"error_message" db:"error_message"`
+	JobID         string     `json:"job_id,omitempty" db:"job_id"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
 }
@@ -208,6 +210,11 @@ type CrawlerTask struct {
 	DelayMs      int                    `json:"delay_ms" db:"delay_ms"`
 	FollowLinks  bool                   `json:"follow_links" db:"follow_links"`
 	RespectRobots bool                  `json:"respect_robots" db:"respect_robots"`
+	JobID        string                 `json:"job_id,omitempty" db:"job_id"`
+	PagesCrawled int                    `json:"pages_crawled" db:"pages_crawled"`
+	PagesFailed  int                    `json:"pages_failed" db:"pages_failed"`
+	PagesSkipped int                    `json:"pages_skipped" db:"pages_skipped"`
+	PagesQueued  int                    `json:"pages_queued" db:"pages_queued"`
 	StartedAt    *time.Time             `json:"started_at" db:"started_at"`
 	CompletedAt  *time.Time             `json:"completed_at" db:"completed_at"`
 	CreatedAt    time.Time              `json:"created_at" db:"created_at"`
@@ -226,6 +233,46 @@ type CrawlerResult struct {
 	CrawledAt    time.Time              `json:"crawled_at" db:"crawled_at"`
 }
 
+// CrawlerSnapshot 监控模式下页面的快照，内容不变时只更新checked_at
+type CrawlerSnapshot struct {
+	ID          string      `json:"id" db:"id"`
+	TaskID      string      `json:"task_id" db:"task_id"`
+	URL         string      `json:"url" db:"url"`
+	StatusCode  int         `json:"status_code" db:"status_code"`
+	Data        interface{} `json:"data,omitempty" db:"data"`
+	Text        string      `json:"text,omitempty" db:"text"`
+	ContentHash string      `json:"content_hash" db:"content_hash"`
+	CapturedAt  time.Time   `json:"captured_at" db:"captured_at"`
+	CheckedAt   time.Time   `json:"checked_at" db:"checked_at"`
+}
+
+// CrawlerChange 页面与上一个快照相比的变化
+type CrawlerChange struct {
+	ID                 string               `json:"id" db:"id"`
+	TaskID             string               `json:"task_id" db:"task_id"`
+	URL                string               `json:"url" db:"url"`
+	SnapshotID         string               `json:"snapshot_id" db:"snapshot_id"`
+	PreviousSnapshotID string               `json:"previous_snapshot_id,omitempty" db:"previous_snapshot_id"`
+	ChangeType         string               `json:"change_type" db:"change_type"` // added 或 changed
+	StatusFrom         int                  `json:"status_from" db:"status_from"`
+	StatusTo           int                  `json:"status_to" db:"status_to"`
+	Fields             []CrawlerFieldChange `json:"fields" db:"fields"`
+	FieldCount         int                  `json:"field_count" db:"field_count"` // Fields只保存前若干条
+	TextChanged        bool                 `json:"text_changed" db:"text_changed"`
+	TextDiff           string               `json:"text_diff,omitempty" db:"text_diff"`
+	Alert              bool                 `json:"alert" db:"alert"` // 涉及监控的字段，需要通知
+	Notified           bool                 `json:"notified" db:"notified"`
+	DetectedAt         time.Time            `json:"detected_at" db:"detected_at"`
+}
+
+// CrawlerFieldChange 提取数据中一个字段的变化，Path如 products[0].price
+type CrawlerFieldChange struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"` // added、removed 或 changed
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
 // ==================== API测试相关模型 ====================
 
 // APITestSuite API测试套件
@@ -238,10 +285,24 @@ type APITestSuite struct {
 	Headers     map[string]interface{} `json:"headers" db:"headers"`
 	Variables   map[string]interface{} `json:"variables" db:"variables"`
 	Status      string                 `json:"status" db:"status"`
+	Tags        []string               `json:"tags" db:"tags"`
+	CaseCount   int                    `json:"case_count" db:"case_count"`
+	Cases       []APITestCase          `json:"cases,omitempty" db:"-"`
 	CreatedAt   time.Time              `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at" db:"updated_at"`
 }
 
+// APITestSuiteRequest 创建或修改测试套件，修改时未提供的字段保持不变
+type APITestSuiteRequest struct {
+	Name        *string                `json:"name"`
+	Description *string                `json:"description"`
+	BaseURL     *string                `json:"base_url"`
+	Headers     map[string]interface{} `json:"headers"`
+	Variables   map[string]interface{} `json:"variables"`
+	Status      *string                `json:"status"`
+	Tags        []string               `json:"tags"`
+}
+
 // APITestCase API测试用例
 type APITestCase struct {
 	ID              string                 `json:"id" db:"id"`
@@ -256,7 +317,36 @@ type APITestCase struct {
 	ExpectedStatus  int                    `json:"expected_status" db:"expected_status"`
 	Timeout         int                    `json:"timeout" db:"timeout"`
 	Enabled         bool                   `json:"enabled" db:"enabled"`
+	Position        int                    `json:"position" db:"position"` // 在套件中的执行顺序，从0开始
+	Tags            []string               `json:"tags" db:"tags"`
 	CreatedAt       time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// APITestCaseRequest 创建或修改测试用例，修改时未提供的字段保持不变
+type APITestCaseRequest struct {
+	Name           *string                `json:"name"`
+	Method         *string                `json:"method"`
+	Endpoint       *string                `json:"endpoint"`
+	Headers        map[string]interface{} `json:"headers"`
+	Params         map[string]interface{} `json:"params"`
+	Body           map[string]interface{} `json:"body"`
+	Assertions     map[string]interface{} `json:"assertions"`
+	ExpectedStatus *int                   `json:"expected_status"`
+	Timeout        *int                   `json:"timeout"`
+	Enabled        *bool                  `json:"enabled"`
+	Position       *int                   `json:"position"` // 为空时创建在末尾
+	Tags           []string               `json:"tags"`
+}
+
+// APITestCaseOrderRequest 调整用例顺序，CaseIDs须包含套件的全部用例
+type APITestCaseOrderRequest struct {
+	CaseIDs []string `json:"case_ids" binding:"required"`
+}
+
+// APITestSuiteCloneRequest 复制测试套件，Name为空时在原名称后加"(副本)"
+type APITestSuiteCloneRequest struct {
+	Name string `json:"name"`
 }
 
 // APITestResult API测试结果
@@ -273,6 +363,50 @@ type APITestResult struct {
 	ExecutedAt      time.Time              `json:"executed_at" db:"executed_at"`
 }
 
+// ==================== 定时任务相关模型 ====================
+
+// Schedule 按cron表达式定时执行爬虫任务或API测试套件
+type Schedule struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	TargetType string     `json:"target_type" db:"target_type"` // crawler_task 或 api_test_suite
+	TargetID   string     `json:"target_id" db:"target_id"`
+	CronExpr   string     `json:"cron" db:"cron_expr"`
+	Timezone   string     `json:"timezone" db:"timezone"`
+	Enabled    bool       `json:"enabled" db:"enabled"`
+	NextRunAt  *time.Time `json:"next_run_at" db:"next_run_at"`
+	LastRunAt  *time.Time `json:"last_run_at" db:"last_run_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ScheduleRequest 创建或修改定时任务的请求，修改时只更新传入的字段
+type ScheduleRequest struct {
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	CronExpr   string `json:"cron"`
+	Timezone   string `json:"timezone"`
+	Enabled    *bool  `json:"enabled"`
+}
+
+// ScheduleRun 定时任务的一次执行记录，Changed表示结果与同一目标的上一次执行不同
+type ScheduleRun struct {
+	ID          string                 `json:"id" db:"id"`
+	ScheduleID  string                 `json:"schedule_id" db:"schedule_id"`
+	TargetType  string                 `json:"target_type" db:"target_type"`
+	TargetID    string                 `json:"target_id" db:"target_id"`
+	Trigger     string                 `json:"trigger" db:"trigger_type"` // schedule 或 manual
+	Status      string                 `json:"status" db:"status"`
+	JobID       string                 `json:"job_id,omitempty" db:"job_id"`
+	Summary     map[string]interface{} `json:"summary" db:"summary"`
+	Changed     bool                   `json:"changed" db:"changed"`
+	Changes     map[string]interface{} `json:"changes,omitempty" db:"changes"`
+	Error       string                 `json:"error,omitempty" db:"error"`
+	ScheduledAt time.Time              `json:"scheduled_at" db:"scheduled_at"`
+	StartedAt   *time.Time             `json:"started_at" db:"started_at"`
+	FinishedAt  *time.Time             `json:"finished_at" db:"finished_at"`
+}
+
 // ==================== 代码审查相关模型 ====================
 
 // CodeReview 代码审查
@@ -362,6 +496,8 @@ type MembershipPlan struct {
 	MaxApps     int     `json:"max_apps"`
 	Features    []string `json:"features"`
 	IsActive    bool    `json:"is_active"`
+	AIDailyTokenQuota   *int64 `json:"ai_daily_token_quota"`   // 每日AI token配额，nil表示不限
+	AIMonthlyTokenQuota *int64 `json:"ai_monthly_token_quota"` // 每月AI token配额，nil表示不限
 }
 
 // Subscription 订阅
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+// 百度千帆模型名与对话接口路径的对应关系，未列出的模型直接使用模型名作为路径
+var baiduModelEndpoints = map[string]string{
+	"ernie-4.0-8k":     "completions_pro",
+	"ernie-3.5-8k":     "completions",
+	"ernie-speed-128k": "ernie-speed-128k",
+	"ernie-speed-8k":   "ernie_speed",
+	"ernie-lite-8k":    "ernie-lite-8k",
+	"ernie-tiny-8k":    "ernie-tiny-8k",
+}
+
+// 百度千帆错误码
+const (
+	baiduErrTokenInvalid   = 110
+	baiduErrTokenExpired   = 111
+	baiduErrQPSLimit       = 18
+	baiduErrDailyLimit     = 17
+	baiduErrClusterLimit   = 4
+	baiduErrTPMLimit       = 336501
+	baiduErrRPMLimit       = 336502
+	baiduErrInvalidParam   = 336003
+	baiduErrNoPermission   = 6
+	baiduErrNoServiceOpen  = 336000
+	baiduTokenRefreshAhead = 5 * time.Minute
+)
+
+// 百度千帆客户端（文心一言，API Key + Secret Key换取access_token）
+type BaiduClient struct {
+	*BaseAIClient
+	secretKey string
+
+	tokenMu     sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+func NewBaiduClient(cfg *config.Config, spec AIProviderSpec) *BaiduClient {
+	return &BaiduClient{
+		BaseAIClient: NewBaseAIClient(cfg, spec),
+		secretKey:    cfg.BaiduSecretKey,
+	}
+}
+
+// 千帆的temperature取值范围为 (0, 1]，0 按最小值发送
+const baiduMinTemperature = 0.01
+
+// 千帆请求体，system消息需要单独传递
+type baiduChatRequest struct {
+	Messages        []AIMessage `json:"messages"`
+	System          string      `json:"system,omitempty"`
+	Temperature     float64     `json:"temperature"`
+	MaxOutputTokens int         `json:"max_output_tokens,omitempty"`
+	Stream          bool        `json:"stream,omitempty"`
+}
+
+// 千帆响应（流式与非流式结构相同）
+type baiduChatResponse struct {
+	ID           string  `json:"id"`
+	Result       string  `json:"result"`
+	IsEnd        bool    `json:"is_end"`
+	FinishReason string  `json:"finish_reason"`
+	Usage        AIUsage `json:"usage"`
+	ErrorCode    int     `json:"error_code"`
+	ErrorMsg     string  `json:"error_msg"`
+}
+
+type baiduTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *BaiduClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
+	model := c.resolveModel(req.Model)
+
+	chatResp, err := c.chat(ctx, req, model)
+	if err != nil {
+		// access_token失效时刷新后重试一次
+		if isBaiduTokenError(err) {
+			c.invalidateToken()
+			chatResp, err = c.chat(ctx, req, model)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newAIResponse(chatResp.ID, model, chatResp.Result, chatResp.FinishReason, chatResp.Usage), nil
+}
+
+func (c *BaiduClient) GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error) {
+	model := c.resolveModel(req.Model)
+
+	stream, err := c.chatStream(ctx, req, model)
+	if err != nil && isBaiduTokenError(err) {
+		c.invalidateToken()
+		stream, err = c.chatStream(ctx, req, model)
+	}
+	return stream, err
+}
+
+func (c *BaiduClient) IsAvailable() bool {
+	return c.apiKey != "" && c.secretKey != ""
+}
+
+func (c *BaiduClient) chat(ctx context.Context, req *AIRequest, model string) (*baiduChatResponse, error) {
+	httpReq, err := c.newChatRequest(ctx, req, model, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAIStatusError(resp.StatusCode, string(body))
+	}
+
+	var chatResp baiduChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, newAIMalformedError(err)
+	}
+	if chatResp.ErrorCode != 0 {
+		return nil, baiduAPIError(chatResp.ErrorCode, chatResp.ErrorMsg)
+	}
+
+	return &chatResp, nil
+}
+
+func (c *BaiduClient) chatStream(ctx context.Context, req *AIRequest, model string) (<-chan AIStreamChunk, error) {
+	httpReq, err := c.newChatRequest(ctx, req, model, true)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(ctx context.Context, body io.Reader, chunks chan<- AIStreamChunk) error {
+		return scanSSEData(body, func(data string) (bool, error) {
+			var payload baiduChatResponse
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				return false, newAIMalformedError(err)
+			}
+			if payload.ErrorCode != 0 {
+				return false, baiduAPIError(payload.ErrorCode, payload.ErrorMsg)
+			}
+
+			chunk := AIStreamChunk{ID: payload.ID, Model: model, Delta: payload.Result}
+			if payload.IsEnd {
+				chunk.FinishReason = payload.FinishReason
+				if chunk.FinishReason == "" {
+					chunk.FinishReason = "stop"
+				}
+				usage := payload.Usage
+				chunk.Usage = &usage
+			}
+
+			if err := sendStreamChunk(ctx, chunks, chunk); err != nil {
+				return false, err
+			}
+			return payload.IsEnd, nil
+		})
+	}
+
+	// 出错时千帆返回200和普通JSON
+	checkBody := func(body []byte) error {
+		var chatResp baiduChatResponse
+		if err := json.Unmarshal(body, &chatResp); err != nil {
+			return newAIMalformedError(err)
+		}
+		if chatResp.ErrorCode != 0 {
+			return baiduAPIError(chatResp.ErrorCode, chatResp.ErrorMsg)
+		}
+		return nil
+	}
+
+	return c.doStream(httpReq, parse, checkBody)
+}
+
+func (c *BaiduClient) newChatRequest(ctx context.Context, req *AIRequest, model string, stream bool) (*http.Request, error) {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chatReq := baiduChatRequest{
+		Temperature:     math.Min(math.Max(req.Temperature, baiduMinTemperature), 1),
+		MaxOutputTokens: req.MaxTokens,
+		Stream:          stream,
+	}
+	for _, msg := range req.Messages {
+		// 千帆只接受user/assistant交替的消息，system提示单独传递
+		if msg.Role == "system" {
+			if chatReq.System != "" {
+				chatReq.System += "\n"
+			}
+			chatReq.System += msg.Content
+			continue
+		}
+		chatReq.Messages = append(chatReq.Messages, msg)
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	endpoint, ok := baiduModelEndpoints[model]
+	if !ok {
+		endpoint = model
+	}
+	chatURL := fmt.Sprintf("%s/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/%s?access_token=%s",
+		c.baseURL, endpoint, url.QueryEscape(token))
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", chatURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return httpReq, nil
+}
+
+// getAccessToken 获取缓存的access_token，过期前自动刷新
+func (c *BaiduClient) getAccessToken(ctx context.Context) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	if c.accessToken != "" && time.Now().Before(c.tokenExpiry) {
+		return c.accessToken, nil
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "client_credentials")
+	params.Set("client_id", c.apiKey)
+	params.Set("client_secret", c.secretKey)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/oauth/2.0/token?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("获取百度access_token失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	var tokenResp baiduTokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", newAIStatusError(resp.StatusCode, string(body))
+		}
+		return "", newAIMalformedError(err)
+	}
+	if tokenResp.Error != "" || tokenResp.AccessToken == "" {
+		// 密钥错误时返回 invalid_client
+		return "", newAIVendorError(AIErrorAuth, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+
+	expiresIn := time.Duration(tokenResp.ExpiresIn) * time.Second
+	if expiresIn > baiduTokenRefreshAhead {
+		expiresIn -= baiduTokenRefreshAhead
+	}
+	c.accessToken = tokenResp.AccessToken
+	c.tokenExpiry = time.Now().Add(expiresIn)
+
+	return c.accessToken, nil
+}
+
+func (c *BaiduClient) invalidateToken() {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.accessToken = ""
+}
+
+// 将千帆错误码映射为错误类型
+func baiduAPIError(code int, message string) error {
+	kind := AIErrorUpstream
+	switch code {
+	case baiduErrTokenInvalid, baiduErrTokenExpired, baiduErrNoPermission, baiduErrNoServiceOpen:
+		kind = AIErrorAuth
+	case baiduErrQPSLimit, baiduErrDailyLimit, baiduErrClusterLimit, baiduErrTPMLimit, baiduErrRPMLimit:
+		kind = AIErrorRateLimited
+	case baiduErrInvalidParam:
+		kind = AIErrorBadRequest
+	}
+	return newAIVendorError(kind, strconv.Itoa(code), message)
+}
+
+func isBaiduTokenError(err error) bool {
+	var providerErr *AIProviderError
+	if !errors.As(err, &providerErr) {
+		return false
+	}
+	return providerErr.Code == strconv.Itoa(baiduErrTokenInvalid) || providerErr.Code == strconv.Itoa(baiduErrTokenExpired)
+}
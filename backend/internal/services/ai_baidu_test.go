@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+// fakeBaiduServer 模拟千帆的token和对话接口，chatErrors依次作为每次对话调用的error_code（0表示成功）
+type fakeBaiduServer struct {
+	*httptest.Server
+	tokenCalls int32
+	chatCalls  int32
+	chatTokens []string
+	chatErrors []int
+}
+
+func newFakeBaiduServer(t *testing.T, chatErrors ...int) *fakeBaiduServer {
+	fake := &fakeBaiduServer{chatErrors: chatErrors}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oauth/2.0/token":
+			n := atomic.AddInt32(&fake.tokenCalls, 1)
+			if r.URL.Query().Get("client_id") != "api-key" || r.URL.Query().Get("client_secret") != "secret-key" {
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "unknown client id"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": fmt.Sprintf("token-%d", n), "expires_in": 2592000})
+		case strings.HasPrefix(r.URL.Path, "/rpc/2.0/ai_custom/v1/wenxinworkshop/chat/"):
+			n := int(atomic.AddInt32(&fake.chatCalls, 1))
+			fake.chatTokens = append(fake.chatTokens, r.URL.Query().Get("access_token"))
+			if n <= len(fake.chatErrors) && fake.chatErrors[n-1] != 0 {
+				json.NewEncoder(w).Encode(map[string]interface{}{"error_code": fake.chatErrors[n-1], "error_msg": "failed"})
+				return
+			}
+			w.Write([]byte(`{"id":"as-1","result":"你好！","is_end":true,"usage":{"prompt_tokens":2,"completion_tokens":3,"total_tokens":5}}`))
+		default:
+			t.Errorf("unexpected request: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	return fake
+}
+
+func newTestBaiduClient(baseURL, secretKey string) *BaiduClient {
+	return NewBaiduClient(&config.Config{BaiduSecretKey: secretKey}, AIProviderSpec{
+		Name:         AIServiceBaidu,
+		Protocol:     AIProtocolBaidu,
+		BaseURL:      baseURL,
+		APIKey:       "api-key",
+		DefaultModel: "ernie-speed-8k",
+	})
+}
+
+func TestBaiduClientAccessToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		chatErrors     []int
+		calls          int
+		wantErrKind    AIErrorKind
+		wantTokenCalls int32
+		wantChatTokens []string
+	}{
+		{
+			name:           "token cached across calls",
+			calls:          3,
+			wantTokenCalls: 1,
+			wantChatTokens: []string{"token-1", "token-1", "token-1"},
+		},
+		{
+			name:           "refresh on invalid token",
+			chatErrors:     []int{baiduErrTokenInvalid},
+			calls:          1,
+			wantTokenCalls: 2,
+			wantChatTokens: []string{"token-1", "token-2"},
+		},
+		{
+			name:           "refresh on expired token",
+			chatErrors:     []int{0, baiduErrTokenExpired},
+			calls:          2,
+			wantTokenCalls: 2,
+			wantChatTokens: []string{"token-1", "token-1", "token-2"},
+		},
+		{
+			name:           "refresh only once",
+			chatErrors:     []int{baiduErrTokenExpired, baiduErrTokenExpired},
+			calls:          1,
+			wantErrKind:    AIErrorAuth,
+			wantTokenCalls: 2,
+			wantChatTokens: []string{"token-1", "token-2"},
+		},
+		{
+			name:           "no refresh on rate limit",
+			chatErrors:     []int{baiduErrQPSLimit},
+			calls:          1,
+			wantErrKind:    AIErrorRateLimited,
+			wantTokenCalls: 1,
+			wantChatTokens: []string{"token-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeBaiduServer(t, tt.chatErrors...)
+			defer server.Close()
+			client := newTestBaiduClient(server.URL, "secret-key")
+
+			var err error
+			for i := 0; i < tt.calls; i++ {
+				var resp *AIResponse
+				resp, err = client.GenerateText(context.Background(), &AIRequest{
+					Messages: []AIMessage{{Role: "system", Content: "简短回答"}, {Role: "user", Content: "你好"}},
+				})
+				if err == nil && (resp.Choices[0].Message.Content != "你好！" || resp.Usage.TotalTokens != 5) {
+					t.Errorf("unexpected response: %+v", resp)
+				}
+			}
+
+			if tt.wantErrKind == "" && err != nil {
+				t.Fatalf("GenerateText() error = %v", err)
+			}
+			if tt.wantErrKind != "" {
+				var providerErr *AIProviderError
+				if !errors.As(err, &providerErr) || providerErr.Kind != tt.wantErrKind {
+					t.Fatalf("GenerateText() error = %v, want kind %s", err, tt.wantErrKind)
+				}
+			}
+			if got := atomic.LoadInt32(&server.tokenCalls); got != tt.wantTokenCalls {
+				t.Errorf("token requests = %d, want %d", got, tt.wantTokenCalls)
+			}
+			if strings.Join(server.chatTokens, ",") != strings.Join(tt.wantChatTokens, ",") {
+				t.Errorf("chat tokens = %v, want %v", server.chatTokens, tt.wantChatTokens)
+			}
+		})
+	}
+}
+
+func TestBaiduClientTokenExpiry(t *testing.T) {
+	server := newFakeBaiduServer(t)
+	defer server.Close()
+	client := newTestBaiduClient(server.URL, "secret-key")
+
+	ctx := context.Background()
+	if token, err := client.getAccessToken(ctx); err != nil || token != "token-1" {
+		t.Fatalf("getAccessToken() = %q, %v", token, err)
+	}
+	// 有效期扣除了提前刷新的时间
+	if remaining := time.Until(client.tokenExpiry); remaining > 2592000*time.Second-baiduTokenRefreshAhead {
+		t.Errorf("token expiry not shortened: %v", remaining)
+	}
+
+	client.tokenExpiry = time.Now().Add(-time.Second)
+	if token, err := client.getAccessToken(ctx); err != nil || token != "token-2" {
+		t.Fatalf("getAccessToken() after expiry = %q, %v", token, err)
+	}
+}
+
+func TestBaiduClientInvalidCredentials(t *testing.T) {
+	server := newFakeBaiduServer(t)
+	defer server.Close()
+
+	_, err := newTestBaiduClient(server.URL, "wrong").GenerateText(context.Background(), &AIRequest{
+		Messages: []AIMessage{{Role: "user", Content: "你好"}},
+	})
+	var providerErr *AIProviderError
+	if !errors.As(err, &providerErr) || providerErr.Kind != AIErrorAuth || providerErr.Code != "invalid_client" {
+		t.Fatalf("GenerateText() error = %v, want auth error invalid_client", err)
+	}
+	if server.chatCalls != 0 {
+		t.Errorf("chat called %d times without a token", server.chatCalls)
+	}
+}
+
+func TestBaiduAPIError(t *testing.T) {
+	tests := []struct {
+		code      int
+		kind      AIErrorKind
+		retryable bool
+	}{
+		{baiduErrTokenInvalid, AIErrorAuth, false},
+		{baiduErrTokenExpired, AIErrorAuth, false},
+		{baiduErrNoPermission, AIErrorAuth, false},
+		{baiduErrNoServiceOpen, AIErrorAuth, false},
+		{baiduErrQPSLimit, AIErrorRateLimited, true},
+		{baiduErrDailyLimit, AIErrorRateLimited, true},
+		{baiduErrClusterLimit, AIErrorRateLimited, true},
+		{baiduErrTPMLimit, AIErrorRateLimited, true},
+		{baiduErrRPMLimit, AIErrorRateLimited, true},
+		{baiduErrInvalidParam, AIErrorBadRequest, false},
+		{336100, AIErrorUpstream, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.code), func(t *testing.T) {
+			var providerErr *AIProviderError
+			if !errors.As(baiduAPIError(tt.code, "failed"), &providerErr) {
+				t.Fatal("baiduAPIError() did not return *AIProviderError")
+			}
+			if providerErr.Kind != tt.kind || providerErr.Retryable != tt.retryable || providerErr.Code != strconv.Itoa(tt.code) {
+				t.Errorf("got kind=%s retryable=%v code=%s, want kind=%s retryable=%v",
+					providerErr.Kind, providerErr.Retryable, providerErr.Code, tt.kind, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestBaiduClientTemperature(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature float64
+		want        float64
+	}{
+		{"explicit zero sent as minimum", 0, baiduMinTemperature},
+		{"in range", 0.7, 0.7},
+		{"above range", 1.5, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/oauth/2.0/token" {
+					w.Write([]byte(`{"access_token":"token-1","expires_in":2592000}`))
+					return
+				}
+				var body baiduChatRequest
+				json.NewDecoder(r.Body).Decode(&body)
+				if body.Temperature != tt.want {
+					t.Errorf("temperature = %v, want %v", body.Temperature, tt.want)
+				}
+				w.Write([]byte(`{"id":"as-1","result":"ok","is_end":true}`))
+			}))
+			defer server.Close()
+
+			_, err := newTestBaiduClient(server.URL, "secret-key").GenerateText(context.Background(), &AIRequest{
+				Messages:    []AIMessage{{Role: "user", Content: "你好"}},
+				Temperature: tt.temperature,
+			})
+			if err != nil {
+				t.Fatalf("GenerateText() error = %v", err)
+			}
+		})
+	}
+}
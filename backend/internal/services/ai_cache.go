@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"qa-toolbox-backend/internal/database"
+)
+
+// 响应缓存命中情况，写入AIResponse.Cache
+const (
+	AICacheHit  = "hit"
+	AICacheMiss = "miss"
+)
+
+const aiCacheKeyPrefix = "ai_cache:"
+
+// AIResponseCache 基于Redis的确定性请求响应缓存
+//
+// 只缓存temperature为0的非流式请求，相同的规范化请求内容返回相同结果
+type AIResponseCache struct {
+	redis *database.RedisClient
+	ttl   time.Duration
+}
+
+func NewAIResponseCache(redis *database.RedisClient, ttl time.Duration) *AIResponseCache {
+	return &AIResponseCache{
+		redis: redis,
+		ttl:   ttl,
+	}
+}
+
+// Cacheable 请求是否可以缓存，带工具的请求结果依赖工具返回的实时数据，不缓存
+func (c *AIResponseCache) Cacheable(req *AIRequest) bool {
+	return req.Temperature <= 0 && !req.Stream && len(req.Tools) == 0
+}
+
+// Get 读取model（provider/model）对该请求缓存的响应，未命中或读取失败时返回nil
+func (c *AIResponseCache) Get(ctx context.Context, req *AIRequest, model string) *AIResponse {
+	data, err := c.redis.Get(ctx, aiCacheKey(req, model)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("读取AI响应缓存失败: %v", err)
+		}
+		return nil
+	}
+
+	var resp AIResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		log.Printf("解析AI响应缓存失败: %v", err)
+		return nil
+	}
+	return &resp
+}
+
+// Set 写入model（provider/model）生成的响应，失败时只记录日志
+func (c *AIResponseCache) Set(ctx context.Context, req *AIRequest, model string, resp *AIResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("序列化AI响应缓存失败: %v", err)
+		return
+	}
+	if err := c.redis.Set(context.WithoutCancel(ctx), aiCacheKey(req, model), data, c.ttl).Err(); err != nil {
+		log.Printf("写入AI响应缓存失败: %v", err)
+	}
+}
+
+// aiCacheKey 由实际调用的模型和规范化后的消息、长度限制、输出格式计算缓存键
+//
+// 使用路由解析后的模型而不是请求中的模型，auto或不同策略选中不同模型时不会共用缓存
+func aiCacheKey(req *AIRequest, model string) string {
+	normalized := struct {
+		Model          string      `json:"model"`
+		Messages       []AIMessage `json:"messages"`
+		MaxTokens      int         `json:"max_tokens"`
+		ResponseFormat string      `json:"response_format,omitempty"`
+	}{
+		Model:     strings.ToLower(strings.TrimSpace(model)),
+		MaxTokens: req.MaxTokens,
+	}
+	if req.ResponseFormat != nil {
+		normalized.ResponseFormat = req.ResponseFormat.Type
+	}
+	for _, msg := range req.Messages {
+		normalized.Messages = append(normalized.Messages, AIMessage{
+			Role:    strings.ToLower(strings.TrimSpace(msg.Role)),
+			Content: normalizeCacheContent(msg.Content),
+		})
+	}
+
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return aiCacheKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// normalizeCacheContent 统一换行符并去掉行尾空白，避免仅格式不同的输入无法命中
+func normalizeCacheContent(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
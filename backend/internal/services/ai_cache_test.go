@@ -0,0 +1,85 @@
+package services
+
+import "testing"
+
+func TestAICacheKey(t *testing.T) {
+	const resolved = "deepseek/deepseek-chat"
+	base := func() *AIRequest {
+		return &AIRequest{
+			Model:     AIModelAuto,
+			Messages:  []AIMessage{{Role: "user", Content: "分析这段代码"}},
+			MaxTokens: 2000,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		model    string
+		mutate   func(req *AIRequest)
+		wantSame bool
+	}{
+		{
+			name:     "whitespace normalized",
+			model:    " DeepSeek/DeepSeek-Chat ",
+			mutate:   func(req *AIRequest) { req.Messages[0].Content = "分析这段代码  \r\n" },
+			wantSame: true,
+		},
+		{
+			name:     "same resolved model for a different policy",
+			model:    resolved,
+			mutate:   func(req *AIRequest) { req.Policy = AIRouteCheapest },
+			wantSame: true,
+		},
+		{
+			name:   "different resolved model",
+			model:  "qwen/qwen-turbo",
+			mutate: func(req *AIRequest) {},
+		},
+		{
+			name:   "different content",
+			model:  resolved,
+			mutate: func(req *AIRequest) { req.Messages[0].Content = "生成测试用例" },
+		},
+		{
+			name:   "different max tokens",
+			model:  resolved,
+			mutate: func(req *AIRequest) { req.MaxTokens = 1000 },
+		},
+		{
+			name:   "json response format",
+			model:  resolved,
+			mutate: func(req *AIRequest) { req.ResponseFormat = &AIResponseFormat{Type: "json_object"} },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base()
+			tt.mutate(req)
+			if same := aiCacheKey(req, tt.model) == aiCacheKey(base(), resolved); same != tt.wantSame {
+				t.Errorf("same key = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestAIClientManagerRouteModel(t *testing.T) {
+	m := newTestAIClientManager(t, "default:\n  content: ok\n")
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{"default model", "", "mock/mock-primary"},
+		{"explicit model", "mock-large", "mock/mock-large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := aiRoute{client: m.clients[AIServiceMock], model: tt.model}
+			if got := m.routeModel(route); got != tt.want {
+				t.Errorf("routeModel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
 )
 
 // AI服务类型
@@ -30,19 +33,35 @@ const (
 )
 
 // AI请求结构
+//
+// Model 可以是 provider/model（只调用指定服务）、模型名或 auto，见 AIClientManager.routes
 type AIRequest struct {
 	Model       string                 `json:"model"`
 	Messages    []AIMessage           `json:"messages"`
-	Temperature float64               `json:"temperature,omitempty"`
+	Temperature float64               `json:"temperature"` // 0 表示确定性输出，同样发送给服务
 	MaxTokens   int                   `json:"max_tokens,omitempty"`
 	Stream      bool                  `json:"stream,omitempty"`
+	ResponseFormat *AIResponseFormat  `json:"response_format,omitempty"`
+	Tools       []AITool              `json:"tools,omitempty"`
+	ToolChoice  string                `json:"tool_choice,omitempty"` // auto、none 或 required
+	Policy      AIRoutePolicy         `json:"-"` // 未指定模型时选择模型的策略，为空时使用 AI_ROUTE_POLICY
 	Extra       map[string]interface{} `json:"-"`
 }
 
+// 输出格式，json_object 要求模型只输出JSON对象（OpenAI兼容接口）
+type AIResponseFormat struct {
+	Type string `json:"type"`
+}
+
 // AI消息结构
+//
+// 模型请求调用工具时，assistant消息带有ToolCalls；工具结果以role为tool、ToolCallID对应调用ID的消息返回
 type AIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string       `json:"role"`
+	Content    string       `json:"content"`
+	ToolCalls  []AIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string       `json:"tool_call_id,omitempty"`
+	Name       string       `json:"name,omitempty"`
 }
 
 // AI响应结构
@@ -51,698 +70,627 @@ type AIResponse struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	Model   string `json:"model"`
-	Choices []struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Choices []AIChoice `json:"choices"`
+	Usage   AIUsage    `json:"usage"`
+	Cache   string     `json:"cache,omitempty"` // 启用响应缓存时为 hit 或 miss
+}
+
+// AI辅助功能的生成结果
+type AIResult struct {
+	Content string  `json:"content"`
+	Model   string  `json:"model"`
+	Usage   AIUsage `json:"usage"`
+	Cache   string     `json:"cache,omitempty"`
+	Prompt  *PromptRef `json:"prompt,omitempty"` // 使用的提示词模板版本
+}
+
+// AI响应中的候选结果
+type AIChoice struct {
+	Index        int       `json:"index"`
+	Message      AIMessage `json:"message"`
+	FinishReason string    `json:"finish_reason"`
+}
+
+// AI用量统计
+type AIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// 将各服务的原生响应统一为单条候选结果的AIResponse
+func newAIResponse(id, model, content, finishReason string, usage AIUsage) *AIResponse {
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+	return &AIResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []AIChoice{
+			{
+				Index:        0,
+				Message:      AIMessage{Role: "assistant", Content: content},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: usage,
+	}
 }
 
 // AI客户端接口
 type AIClient interface {
 	GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error)
+	GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error)
 	GetServiceType() AIServiceType
 	IsAvailable() bool
 }
 
 // AI客户端管理器
 type AIClientManager struct {
-	clients map[AIServiceType]AIClient
-	config  *config.Config
-}
-
-// 创建AI客户端管理器
-func NewAIClientManager(cfg *config.Config) *AIClientManager {
+	clients     map[AIServiceType]AIClient
+	specs       map[AIServiceType]AIProviderSpec
+	health      map[AIServiceType]*ProviderHealth
+	priority    []AIServiceType
+	usage       *AIUsageService
+	costs       *AICostService
+	moderation  *ModerationService
+	cache       *AIResponseCache
+	prompts     *PromptLibrary
+	embedder    *LocalEmbedder
+	catalog     *AIModelCatalog
+	routePolicy AIRoutePolicy
+	config      *config.Config
+}
+
+// 创建AI客户端管理器，db为nil时不计量用量也不检查配额，redis为nil时不缓存响应
+func NewAIClientManager(db *database.DB, redis *database.RedisClient, cfg *config.Config) *AIClientManager {
 	manager := &AIClientManager{
-		clients: make(map[AIServiceType]AIClient),
-		config:  cfg,
+		clients:  make(map[AIServiceType]AIClient),
+		specs:    make(map[AIServiceType]AIProviderSpec),
+		health:   make(map[AIServiceType]*ProviderHealth),
+		embedder: NewLocalEmbedder(),
+		config:   cfg,
 	}
-	
-	// 初始化所有可用的AI客户端
-	manager.initClients()
-	
-	return manager
-}
-
-// 初始化所有AI客户端
-func (m *AIClientManager) initClients() {
-	// DeepSeek客户端
-	if m.config.DeepSeekAPIKey != "" {
-		m.clients[AIServiceDeepSeek] = NewDeepSeekClient(m.config)
+	if db != nil {
+		manager.usage = NewAIUsageService(db, cfg.AIAnonymousDailyTokenQuota)
 	}
-	
-	// AIMLAPI客户端
-	if m.config.AIMLAPIKey != "" {
-		m.clients[AIServiceAIMLAPI] = NewAIMLAPIClient(m.config)
+	if redis != nil && cfg.AICacheEnabled {
+		manager.cache = NewAIResponseCache(redis, time.Duration(cfg.AICacheTTLSeconds)*time.Second)
 	}
 	
-	// 腾讯混元客户端
-	if m.config.TencentSecretID != "" && m.config.TencentSecretKey != "" {
-		m.clients[AIServiceTencent] = NewTencentClient(m.config)
+	manager.prompts = NewPromptLibrary(db, cfg.AIPromptsDir)
+	if err := manager.prompts.Reload(context.Background()); err != nil {
+		log.Printf("加载提示词模板失败，部分模板不可用: %v", err)
 	}
 	
-	// Groq客户端
-	if m.config.GroqAPIKey != "" {
-		m.clients[AIServiceGroq] = NewGroqClient(m.config)
+	catalog, err := LoadAIModelCatalog(cfg.AIModelCatalogFile)
+	if err != nil {
+		log.Printf("加载模型目录失败，仅使用内置目录: %v", err)
 	}
-	
-	// AI Tools客户端
-	if m.config.AIToolsAPIKey != "" {
-		m.clients[AIServiceAITools] = NewAIToolsClient(m.config)
+	if catalog == nil {
+		catalog = &AIModelCatalog{}
 	}
-	
-	// Together AI客户端
-	if m.config.TogetherAPIKey != "" {
-		m.clients[AIServiceTogether] = NewTogetherClient(m.config)
+	manager.catalog = catalog
+	if db != nil {
+		manager.costs = NewAICostService(db, catalog, cfg)
 	}
-	
-	// OpenRouter客户端
-	if m.config.OpenRouterAPIKey != "" {
-		m.clients[AIServiceOpenRouter] = NewOpenRouterClient(m.config)
+	manager.moderation = NewModerationService(db, manager, cfg)
+	if manager.routePolicy, err = ParseAIRoutePolicy(cfg.AIRoutePolicy); err != nil {
+		log.Printf("AI_ROUTE_POLICY配置错误，使用默认策略: %v", err)
 	}
 	
-	// 讯飞星火客户端
-	if m.config.XunfeiAPIKey != "" && m.config.XunfeiAppID != "" {
-		m.clients[AIServiceXunfei] = NewXunfeiClient(m.config)
+	specs, err := LoadAIProviderSpecs(cfg)
+	if err != nil {
+		log.Printf("加载AI服务配置失败，仅使用内置服务: %v", err)
+		specs = applyAIMockMode(cfg, normalizeAIProviderSpecs(builtinAIProviders(cfg)))
 	}
 	
-	// 百度千帆客户端
-	if m.config.BaiduAPIKey != "" && m.config.BaiduSecretKey != "" {
-		m.clients[AIServiceBaidu] = NewBaiduClient(m.config)
-	}
+	// 初始化所有可用的AI客户端
+	manager.initClients(specs)
+	manager.initHealth()
 	
-	// 字节扣子客户端
-	if m.config.BytedanceAPIKey != "" {
-		m.clients[AIServiceBytedance] = NewBytedanceClient(m.config)
+	return manager
+}
+
+// 按服务定义初始化AI客户端（specs已按优先级排序）
+func (m *AIClientManager) initClients(specs []AIProviderSpec) {
+	for _, spec := range specs {
+		if !spec.IsEnabled() {
+			continue
+		}
+		
+		factory, ok := aiProviderFactories[spec.Protocol]
+		if !ok {
+			log.Printf("AI服务 %s 使用了未知协议: %s", spec.Name, spec.Protocol)
+			continue
+		}
+		
+		// 只注册已配置密钥的服务
+		client := factory(m.config, spec)
+		if !client.IsAvailable() {
+			continue
+		}
+		
+		m.clients[spec.Name] = client
+		m.specs[spec.Name] = spec
+		m.priority = append(m.priority, spec.Name)
+	}
+}
+
+// GetProviderSpec 获取服务定义
+func (m *AIClientManager) GetProviderSpec(serviceType AIServiceType) (AIProviderSpec, bool) {
+	spec, ok := m.specs[serviceType]
+	return spec, ok
+}
+
+// 为每个客户端创建熔断器
+func (m *AIClientManager) initHealth() {
+	breakerConfig := CircuitBreakerConfig{
+		FailureThreshold:   m.config.AICircuitFailureThreshold,
+		ErrorRateThreshold: m.config.AICircuitErrorRate,
+		MinRequests:        m.config.AICircuitMinRequests,
+		WindowSize:         m.config.AICircuitWindowSize,
+		OpenTimeout:        time.Duration(m.config.AICircuitOpenSeconds) * time.Second,
 	}
 	
-	// 硅基流动客户端
-	if m.config.SiliconFlowAPIKey != "" {
-		m.clients[AIServiceSiliconFlow] = NewSiliconFlowClient(m.config)
+	for serviceType := range m.clients {
+		m.health[serviceType] = NewProviderHealth(serviceType, breakerConfig)
 	}
 }
 
-// 获取可用的AI客户端（按优先级）
+// 获取可用的AI客户端（按静态优先级和健康分数排序，跳过已熔断的服务）
 func (m *AIClientManager) GetAvailableClients() []AIClient {
 	var clients []AIClient
+	scores := make(map[AIServiceType]float64)
 	
-	// 按优先级排序
-	priority := []AIServiceType{
-		AIServiceTencent,     // 最高优先级 - 腾讯混元，国内稳定
-		AIServiceDeepSeek,    // 第二优先级 - DeepSeek，功能强大
-		AIServiceAIMLAPI,     // 第三优先级 - 聚合服务
-		AIServiceAITools,     // 无需登录
-		AIServiceGroq,        // 免费额度大
-		AIServiceXunfei,      // 完全免费
-		AIServiceBaidu,       // 免费额度
-		AIServiceBytedance,   // 开发者免费
-		AIServiceSiliconFlow, // 免费额度
-		AIServiceTogether,    // 有免费额度
-		AIServiceOpenRouter,  // 聚合多个模型
+	for i, serviceType := range m.priority {
+		client, exists := m.clients[serviceType]
+		if !exists || !client.IsAvailable() {
+			continue
+		}
+		health := m.health[serviceType]
+		if !health.Ready() {
+			continue
+		}
+		clients = append(clients, client)
+		scores[serviceType] = health.Score(i)
+		// 超出预算的服务排在其他服务之后，降级的服务之间价格低的优先
+		if m.costs != nil && m.costs.Demoted(serviceType, m.providerPaid(serviceType)) {
+			scores[serviceType] += aiBudgetPenalty + m.providerPrice(serviceType)
+		}
 	}
 	
-	for _, serviceType := range priority {
-		if client, exists := m.clients[serviceType]; exists && client.IsAvailable() {
-			clients = append(clients, client)
+	sortClientsByHealth(clients, scores)
+	
+	return clients
+}
+
+// GetProviderHealth 获取所有已配置服务的健康状态
+func (m *AIClientManager) GetProviderHealth() []ProviderHealthSnapshot {
+	var snapshots []ProviderHealthSnapshot
+	
+	for i, serviceType := range m.priority {
+		if health, exists := m.health[serviceType]; exists {
+			snapshots = append(snapshots, health.Snapshot(i))
 		}
 	}
 	
-	return clients
+	return snapshots
 }
 
 // 生成文本（自动选择最佳可用服务）
 func (m *AIClientManager) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	clients := m.GetAvailableClients()
+	req, err := m.moderateRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	
+	routes, err := m.routes(req)
+	if err != nil {
+		return nil, err
+	}
 	
-	if len(clients) == 0 {
-		return nil, fmt.Errorf("没有可用的AI服务")
+	// 命中缓存不消耗token，也不计入配额（缓存的内容已经审核过）
+	// 缓存按首选路由解析出的模型查找，与该模型实际生成时写入的键一致
+	cacheable := m.cache != nil && m.cache.Cacheable(req)
+	if cacheable {
+		if cached := m.cache.Get(ctx, req, m.routeModel(routes[0])); cached != nil {
+			cached.Cache = AICacheHit
+			return cached, nil
+		}
 	}
 	
-	// 尝试使用第一个可用的客户端
-	for _, client := range clients {
-		resp, err := client.GenerateText(ctx, req)
+	reservation, err := m.reserveQuota(ctx, estimateReservedTokens(req))
+	if err != nil {
+		return nil, err
+	}
+	// 成功时按实际用量结算，其余情况释放预占的配额
+	defer reservation.Release(ctx)
+	
+	multiErr := &AIMultiError{}
+	for _, route := range routes {
+		client := route.client
+		serviceType := client.GetServiceType()
+		if len(req.Tools) > 0 && !m.specs[serviceType].SupportsTools() {
+			multiErr.Errors = append(multiErr.Errors, newAIUnsupportedError(serviceType, "服务不支持工具调用，跳过调用"))
+			continue
+		}
+		health := m.health[serviceType]
+		if !health.Allow() {
+			multiErr.Errors = append(multiErr.Errors, newAICircuitOpenError(serviceType))
+			continue
+		}
+		
+		start := time.Now()
+		resp, err := client.GenerateText(ctx, route.request(req))
 		if err == nil {
+			health.RecordSuccess(time.Since(start))
+			content := ""
+			if len(resp.Choices) > 0 {
+				content = resp.Choices[0].Message.Content
+			}
+			m.recordUsage(ctx, reservation, serviceType, req, resp.Model, content, &resp.Usage)
+			if err := m.moderateResponse(ctx, resp); err != nil {
+				return nil, err
+			}
+			if cacheable {
+				if content != "" {
+					m.cache.Set(ctx, req, m.routeModel(route), resp)
+				}
+				resp.Cache = AICacheMiss
+			}
 			return resp, nil
 		}
-		// 如果失败，尝试下一个客户端
+		
+		// 调用方取消不计入服务故障
+		if ctx.Err() != nil {
+			health.Release()
+			return nil, ctx.Err()
+		}
+		health.RecordFailure(time.Since(start), err)
+		// 如果失败，记录原因并尝试下一个客户端
+		multiErr.Errors = append(multiErr.Errors, classifyAIError(serviceType, err, time.Since(start)))
 	}
 	
-	return nil, fmt.Errorf("所有AI服务都不可用")
+	return nil, multiErr
 }
 
-// GenerateTestCases 生成测试用例
-func (m *AIClientManager) GenerateTestCases(code, language, testType string) (string, error) {
-	prompt := fmt.Sprintf(`
-请为以下%s代码生成%s测试用例：
-
-代码：
-%s
-
-要求：
-1. 生成完整的测试用例代码
-2. 包含边界条件测试
-3. 包含异常情况测试
-4. 使用适当的测试框架
-5. 代码要有注释说明
-
-请直接返回测试用例代码，不要其他解释。
-`, language, testType, code)
-
-	req := &AIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []AIMessage{
-			{Role: "system", Content: "你是一个专业的软件测试工程师，擅长生成高质量的测试用例。"},
-			{Role: "user", Content: prompt},
-		},
-		Temperature: 0.7,
-		MaxTokens:   2000,
+// 流式生成文本（只在建立流之前进行故障转移）
+func (m *AIClientManager) GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error) {
+	if len(req.Tools) > 0 {
+		return nil, fmt.Errorf("流式输出不支持工具调用")
 	}
-
-	ctx := context.Background()
-	resp, err := m.GenerateText(ctx, req)
+	req, err := m.moderateRequest(ctx, req)
 	if err != nil {
-		return "", fmt.Errorf("生成测试用例失败: %w", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("AI响应中没有生成内容")
-	}
-
-	return resp.Choices[0].Message.Content, nil
-}
-
-// AnalyzeCode 分析代码
-func (m *AIClientManager) AnalyzeCode(code, language string) (string, error) {
-	prompt := fmt.Sprintf(`
-请分析以下%s代码：
-
-代码：
-%s
-
-请从以下方面进行分析：
-1. 代码质量和可读性
-2. 潜在的安全问题
-3. 性能优化建议
-4. 代码规范问题
-5. 改进建议
-
-请提供详细的分析报告。
-`, language, code)
-
-	req := &AIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []AIMessage{
-			{Role: "system", Content: "你是一个资深的代码审查专家，擅长发现代码中的问题和改进点。"},
-			{Role: "user", Content: prompt},
-		},
-		Temperature: 0.3,
-		MaxTokens:   3000,
+		return nil, err
 	}
-
-	ctx := context.Background()
-	resp, err := m.GenerateText(ctx, req)
+	routes, err := m.routes(req)
 	if err != nil {
-		return "", fmt.Errorf("代码分析失败: %w", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("AI响应中没有生成内容")
+		return nil, err
 	}
-
-	return resp.Choices[0].Message.Content, nil
-}
-
-// GenerateContent 生成内容
-func (m *AIClientManager) GenerateContent(contentType, topic, requirements string) (string, error) {
-	prompt := fmt.Sprintf(`
-请生成%s内容：
-
-主题：%s
-要求：%s
-
-请生成高质量的内容，符合要求。
-`, contentType, topic, requirements)
-
-	req := &AIRequest{
-		Model: "gpt-3.5-turbo",
-		Messages: []AIMessage{
-			{Role: "system", Content: "你是一个专业的内容创作专家，擅长各种类型的内容创作。"},
-			{Role: "user", Content: prompt},
-		},
-		Temperature: 0.8,
-		MaxTokens:   2000,
-	}
-
-	ctx := context.Background()
-	resp, err := m.GenerateText(ctx, req)
+	reservation, err := m.reserveQuota(ctx, estimateReservedTokens(req))
 	if err != nil {
-		return "", fmt.Errorf("内容生成失败: %w", err)
+		return nil, err
 	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("AI响应中没有生成内容")
+	
+	multiErr := &AIMultiError{}
+	for _, route := range routes {
+		client := route.client
+		serviceType := client.GetServiceType()
+		health := m.health[serviceType]
+		if !health.Allow() {
+			multiErr.Errors = append(multiErr.Errors, newAICircuitOpenError(serviceType))
+			continue
+		}
+		
+		start := time.Now()
+		stream, err := client.GenerateTextStream(ctx, route.request(req))
+		if err == nil {
+			// 流中断时不记录用量，也释放预占的配额
+			onDone := func(completed bool, model, content string, usage *AIUsage) {
+				if !completed {
+					reservation.Release(ctx)
+					return
+				}
+				m.recordUsage(ctx, reservation, serviceType, req, model, content, usage)
+			}
+			return m.moderateStream(ctx, monitorStream(ctx, stream, health, start, onDone)), nil
+		}
+		
+		if ctx.Err() != nil {
+			health.Release()
+			reservation.Release(ctx)
+			return nil, ctx.Err()
+		}
+		health.RecordFailure(time.Since(start), err)
+		// 流尚未开始，可以安全地切换到下一个客户端
+		multiErr.Errors = append(multiErr.Errors, classifyAIError(serviceType, err, time.Since(start)))
 	}
-
-	return resp.Choices[0].Message.Content, nil
+	
+	reservation.Release(ctx)
+	return nil, multiErr
 }
 
-// 基础HTTP客户端
-type BaseAIClient struct {
-	config     *config.Config
-	httpClient *http.Client
-	baseURL    string
-	apiKey     string
-	serviceType AIServiceType
+// reserveQuota 检查调用方的AI用量配额并预占估算的token数，未启用计量时返回nil
+func (m *AIClientManager) reserveQuota(ctx context.Context, tokens int) (*AIQuotaReservation, error) {
+	if m.usage == nil {
+		return nil, nil
+	}
+	return m.usage.Reserve(ctx, AIUsageScopeFrom(ctx), int64(tokens))
 }
 
-// 创建基础HTTP客户端
-func NewBaseAIClient(cfg *config.Config, baseURL, apiKey string, serviceType AIServiceType) *BaseAIClient {
-	return &BaseAIClient{
-		config:     cfg,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		baseURL:    baseURL,
-		apiKey:     apiKey,
-		serviceType: serviceType,
+// estimateReservedTokens 调用前预占的token数：提示词按文本估算，回复按MaxTokens，未设置时按aiReservedCompletionTokens
+func estimateReservedTokens(req *AIRequest) int {
+	completion := req.MaxTokens
+	if completion <= 0 {
+		completion = aiReservedCompletionTokens
 	}
+	return estimateAIUsage(req.Messages, "").PromptTokens + completion
 }
 
-// 发送HTTP请求
-func (c *BaseAIClient) sendRequest(ctx context.Context, endpoint string, req *AIRequest) (*AIResponse, error) {
-	url := c.baseURL + endpoint
-	
-	// 构建请求体
-	reqBody, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("序列化请求失败: %w", err)
+// recordUsage 记录调用用量并结算预占的配额，服务未返回用量时按文本估算
+func (m *AIClientManager) recordUsage(ctx context.Context, reservation *AIQuotaReservation, serviceType AIServiceType, req *AIRequest, model, content string, usage *AIUsage) {
+	if m.usage == nil {
+		return
 	}
 	
-	// 创建HTTP请求
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
+	estimated := usage == nil || usage.TotalTokens == 0
+	if estimated {
+		estimate := estimateAIUsage(req.Messages, content)
+		usage = &estimate
 	}
-	
-	// 设置请求头
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
-	
-	// 发送请求
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+	if model == "" {
+		model = req.Model
 	}
-	defer resp.Body.Close()
 	
-	// 读取响应
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
-	}
-	
-	// 检查HTTP状态码
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API请求失败: %d %s", resp.StatusCode, string(respBody))
-	}
-	
-	// 解析响应
-	var aiResp AIResponse
-	if err := json.Unmarshal(respBody, &aiResp); err != nil {
-		return nil, fmt.Errorf("解析响应失败: %w", err)
+	reservation.Settle(ctx, int64(usage.TotalTokens))
+	m.usage.Record(ctx, AIUsageScopeFrom(ctx), serviceType, model, *usage, estimated)
+	if m.costs != nil {
+		m.costs.Record(ctx, AIUsageScopeFrom(ctx), serviceType, model, *usage, estimated)
 	}
-	
-	return &aiResp, nil
-}
-
-// DeepSeek客户端
-type DeepSeekClient struct {
-	*BaseAIClient
 }
 
-func NewDeepSeekClient(cfg *config.Config) *DeepSeekClient {
-	return &DeepSeekClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.DeepSeekBaseURL, cfg.DeepSeekAPIKey, AIServiceDeepSeek),
+// GetUsageSummary 获取用户的AI用量与配额
+func (m *AIClientManager) GetUsageSummary(ctx context.Context, userID string) (*AIUsageSummary, error) {
+	if m.usage == nil {
+		return nil, fmt.Errorf("未启用AI用量统计")
 	}
+	return m.usage.GetUsageSummary(ctx, userID)
 }
 
-func (c *DeepSeekClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
-}
-
-func (c *DeepSeekClient) GetServiceType() AIServiceType {
-	return AIServiceDeepSeek
-}
-
-func (c *DeepSeekClient) IsAvailable() bool {
-	return c.apiKey != ""
-}
-
-// AIMLAPI客户端
-type AIMLAPIClient struct {
-	*BaseAIClient
-}
-
-func NewAIMLAPIClient(cfg *config.Config) *AIMLAPIClient {
-	return &AIMLAPIClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.AIMLAPIBaseURL, cfg.AIMLAPIKey, AIServiceAIMLAPI),
+// GenerateTestCases 生成测试用例
+func (m *AIClientManager) GenerateTestCases(ctx context.Context, code, language, testType string) (*AIResult, error) {
+	result, err := m.generateFromPrompt(WithAIFeature(ctx, AIFeatureTestGeneration), PromptTestGeneration, map[string]interface{}{
+		"code":      code,
+		"language":  language,
+		"test_type": testType,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成测试用例失败: %w", err)
 	}
-}
-
-func (c *AIMLAPIClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
-}
-
-func (c *AIMLAPIClient) GetServiceType() AIServiceType {
-	return AIServiceAIMLAPI
-}
-
-func (c *AIMLAPIClient) IsAvailable() bool {
-	return c.apiKey != ""
-}
 
-// Groq客户端
-type GroqClient struct {
-	*BaseAIClient
+	return result, nil
 }
 
-func NewGroqClient(cfg *config.Config) *GroqClient {
-	return &GroqClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.GroqBaseURL, cfg.GroqAPIKey, AIServiceGroq),
+// AnalyzeCode 分析代码
+func (m *AIClientManager) AnalyzeCode(ctx context.Context, code, language string) (*AIResult, error) {
+	result, err := m.generateFromPrompt(WithAIFeature(ctx, AIFeatureCodeAnalysis), PromptCodeAnalysis, map[string]interface{}{
+		"code":     code,
+		"language": language,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("代码分析失败: %w", err)
 	}
-}
-
-func (c *GroqClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
-}
-
-func (c *GroqClient) GetServiceType() AIServiceType {
-	return AIServiceGroq
-}
 
-func (c *GroqClient) IsAvailable() bool {
-	return c.apiKey != ""
+	return result, nil
 }
 
-// AI Tools客户端
-type AIToolsClient struct {
-	*BaseAIClient
-}
-
-func NewAIToolsClient(cfg *config.Config) *AIToolsClient {
-	return &AIToolsClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.AIToolsBaseURL, cfg.AIToolsAPIKey, AIServiceAITools),
+// GenerateContent 生成内容
+func (m *AIClientManager) GenerateContent(ctx context.Context, contentType, topic, requirements string) (*AIResult, error) {
+	result, err := m.generateFromPrompt(WithAIFeature(ctx, AIFeatureCreativeWriting), PromptContentGeneration, map[string]interface{}{
+		"content_type": contentType,
+		"topic":        topic,
+		"requirements": requirements,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("内容生成失败: %w", err)
 	}
-}
 
-func (c *AIToolsClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
+	return result, nil
 }
 
-func (c *AIToolsClient) GetServiceType() AIServiceType {
-	return AIServiceAITools
+// Prompts 提示词模板库
+func (m *AIClientManager) Prompts() *PromptLibrary {
+	return m.prompts
 }
 
-func (c *AIToolsClient) IsAvailable() bool {
-	return c.apiKey != ""
+// selectPrompt 按调用方语言选择模板版本，同一用户固定落在同一个A/B版本上
+func (m *AIClientManager) selectPrompt(ctx context.Context, name string) (*PromptTemplate, error) {
+	scope := AIUsageScopeFrom(ctx)
+	bucketKey := scope.UserID
+	if bucketKey == "" {
+		bucketKey = scope.ClientIP
+	}
+	return m.prompts.Select(name, AILocaleFrom(ctx), bucketKey)
 }
 
-// Together AI客户端
-type TogetherClient struct {
-	*BaseAIClient
-}
+// generateFromPrompt 按调用方语言选择模板版本并生成，结果中记录所用的模板版本
+func (m *AIClientManager) generateFromPrompt(ctx context.Context, name string, vars map[string]interface{}) (*AIResult, error) {
+	tpl, err := m.selectPrompt(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	req, err := tpl.Render(vars)
+	if err != nil {
+		return nil, err
+	}
 
-func NewTogetherClient(cfg *config.Config) *TogetherClient {
-	return &TogetherClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.TogetherBaseURL, cfg.TogetherAPIKey, AIServiceTogether),
+	resp, err := m.GenerateText(ctx, req)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (c *TogetherClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
+	result, err := newAIResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	result.Prompt = tpl.Ref()
+	return result, nil
 }
 
-func (c *TogetherClient) GetServiceType() AIServiceType {
-	return AIServiceTogether
-}
+// newAIResult 提取AI响应中的生成内容
+func newAIResult(resp *AIResponse) (*AIResult, error) {
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("AI响应中没有生成内容")
+	}
 
-func (c *TogetherClient) IsAvailable() bool {
-	return c.apiKey != ""
+	return &AIResult{
+		Content: resp.Choices[0].Message.Content,
+		Model:   resp.Model,
+		Usage:   resp.Usage,
+		Cache:   resp.Cache,
+	}, nil
 }
 
-// OpenRouter客户端
-type OpenRouterClient struct {
-	*BaseAIClient
+// 基础HTTP客户端
+type BaseAIClient struct {
+	config     *config.Config
+	httpClient *http.Client
+	streamClient *http.Client
+	spec       AIProviderSpec
+	baseURL    string
+	apiKey     string
+	serviceType AIServiceType
 }
 
-func NewOpenRouterClient(cfg *config.Config) *OpenRouterClient {
-	return &OpenRouterClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.OpenRouterBaseURL, cfg.OpenRouterAPIKey, AIServiceOpenRouter),
+// 创建基础HTTP客户端
+func NewBaseAIClient(cfg *config.Config, spec AIProviderSpec) *BaseAIClient {
+	return &BaseAIClient{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		// 流式响应可能持续很久，只限制等待响应头的时间，整体生命周期由ctx控制
+		streamClient: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: 30 * time.Second,
+		}},
+		spec:       spec,
+		baseURL:    strings.TrimRight(spec.BaseURL, "/"),
+		apiKey:     spec.APIKey,
+		serviceType: spec.Name,
 	}
 }
 
-func (c *OpenRouterClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
-}
-
-func (c *OpenRouterClient) GetServiceType() AIServiceType {
-	return AIServiceOpenRouter
+func (c *BaseAIClient) GetServiceType() AIServiceType {
+	return c.serviceType
 }
 
-func (c *OpenRouterClient) IsAvailable() bool {
-	return c.apiKey != ""
+// 流式生成文本（OpenAI兼容接口的默认实现）
+func (c *BaseAIClient) GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error) {
+	return c.sendStreamRequest(ctx, "/chat/completions", req)
 }
 
-// 腾讯混元客户端
-type TencentClient struct {
-	*BaseAIClient
+// 确定实际使用的模型：未指定或服务不支持时使用默认模型
+func (c *BaseAIClient) resolveModel(model string) string {
+	if c.spec.DefaultModel == "" {
+		return model
+	}
+	if model == "" || !c.spec.HasModel(model) {
+		return c.spec.DefaultModel
+	}
+	return model
 }
 
-func NewTencentClient(cfg *config.Config) *TencentClient {
-	return &TencentClient{
-		BaseAIClient: NewBaseAIClient(cfg, "https://hunyuan.tencentcloudapi.com", cfg.TencentSecretKey, AIServiceTencent),
+// 按服务定义的认证方式设置请求头
+func (c *BaseAIClient) setAuthHeader(httpReq *http.Request) {
+	header := c.spec.AuthHeader
+	switch c.spec.AuthStyle {
+	case AIAuthNone:
+		return
+	case AIAuthAPIKey:
+		if header == "" {
+			header = "api-key"
+		}
+		httpReq.Header.Set(header, c.apiKey)
+	case AIAuthXAPIKey:
+		if header == "" {
+			header = "X-API-Key"
+		}
+		httpReq.Header.Set(header, c.apiKey)
+	default:
+		if header == "" {
+			header = "Authorization"
+		}
+		httpReq.Header.Set(header, "Bearer "+c.apiKey)
 	}
 }
 
-func (c *TencentClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	// 腾讯混元API实现 - 使用OpenAI兼容接口
-	apiKey := c.config.TencentSecretKey
-	
-	if apiKey == "" {
-		return nil, fmt.Errorf("腾讯混元API密钥未配置")
-	}
-	
-	// API配置 - 使用OpenAI兼容接口
-	endpoint := "https://api.hunyuan.cloud.tencent.com/v1/chat/completions"
+// 发送HTTP请求
+func (c *BaseAIClient) sendRequest(ctx context.Context, endpoint string, req *AIRequest) (*AIResponse, error) {
+	url := c.baseURL + endpoint
 	
-	// 构建请求体 - OpenAI兼容格式
-	payload := map[string]interface{}{
-		"model": "hunyuan-lite",
-		"messages": req.Messages,
-		"temperature": req.Temperature,
-		"max_tokens": req.MaxTokens,
-		"stream": false,
-	}
+	modelReq := *req
+	modelReq.Model = c.resolveModel(req.Model)
 	
-	payloadJSON, err := json.Marshal(payload)
+	// 构建请求体
+	reqBody, err := json.Marshal(&modelReq)
 	if err != nil {
-		return nil, fmt.Errorf("序列化请求体失败: %w", err)
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 	
 	// 创建HTTP请求
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(payloadJSON))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
 	
-	// 设置请求头 - OpenAI兼容格式
+	// 设置请求头
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	c.setAuthHeader(httpReq)
 	
 	// 发送请求
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("请求失败: %w", err)
+		return nil, fmt.Errorf("发送请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 	
-	body, err := io.ReadAll(resp.Body)
+	// 读取响应
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("读取响应失败: %w", err)
 	}
 	
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API请求失败 (状态码: %d): %s", resp.StatusCode, string(body))
-	}
-	
-	// 解析腾讯混元响应 - OpenAI兼容格式
-	var tencentResp struct {
-		Choices []struct {
-			Message struct {
-				Role    string `json:"role"`
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-		Usage struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		} `json:"usage"`
-		Error struct {
-			Message string `json:"message"`
-		} `json:"error"`
-	}
-	
-	if err := json.Unmarshal(body, &tencentResp); err != nil {
-		return nil, fmt.Errorf("解析响应失败: %w", err)
-	}
-	
-	if tencentResp.Error.Message != "" {
-		return nil, fmt.Errorf("API错误: %s", tencentResp.Error.Message)
-	}
-	
-	if len(tencentResp.Choices) == 0 {
-		return nil, fmt.Errorf("API返回空响应")
+	// 检查HTTP状态码
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAIStatusError(resp.StatusCode, string(respBody))
 	}
 	
-	// 转换为标准响应格式
-	choice := tencentResp.Choices[0]
-	aiResp := &AIResponse{
-		ID:      fmt.Sprintf("tencent-%d", time.Now().Unix()),
-		Object:  "chat.completion",
-		Created: time.Now().Unix(),
-		Model:   "hunyuan-lite",
-		Choices: []struct {
-			Index   int `json:"index"`
-			Message struct {
-				Role    string `json:"role"`
-				Content string `json:"content"`
-			} `json:"message"`
-			FinishReason string `json:"finish_reason"`
-		}{
-			{
-				Index: 0,
-				Message: struct {
-					Role    string `json:"role"`
-					Content string `json:"content"`
-				}{
-					Role:    choice.Message.Role,
-					Content: choice.Message.Content,
-				},
-				FinishReason: "stop",
-			},
-		},
-		Usage: tencentResp.Usage,
+	// 解析响应
+	var aiResp AIResponse
+	if err := json.Unmarshal(respBody, &aiResp); err != nil {
+		return nil, newAIMalformedError(err)
 	}
 	
-	return aiResp, nil
-}
-
-
-func (c *TencentClient) GetServiceType() AIServiceType {
-	return AIServiceTencent
-}
-
-func (c *TencentClient) IsAvailable() bool {
-	return c.apiKey != "" && c.config.TencentSecretID != ""
-}
-
-// 讯飞星火客户端
-type XunfeiClient struct {
-	*BaseAIClient
-}
-
-func NewXunfeiClient(cfg *config.Config) *XunfeiClient {
-	return &XunfeiClient{
-		BaseAIClient: NewBaseAIClient(cfg, "https://spark-api.xf-yun.com", cfg.XunfeiAPIKey, AIServiceXunfei),
-	}
-}
-
-func (c *XunfeiClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	// 讯飞星火需要特殊的认证方式
-	return nil, fmt.Errorf("讯飞星火客户端暂未实现")
-}
-
-func (c *XunfeiClient) GetServiceType() AIServiceType {
-	return AIServiceXunfei
-}
-
-func (c *XunfeiClient) IsAvailable() bool {
-	return c.apiKey != "" && c.config.XunfeiAppID != ""
-}
-
-// 百度千帆客户端
-type BaiduClient struct {
-	*BaseAIClient
-}
-
-func NewBaiduClient(cfg *config.Config) *BaiduClient {
-	return &BaiduClient{
-		BaseAIClient: NewBaseAIClient(cfg, "https://aip.baidubce.com", cfg.BaiduAPIKey, AIServiceBaidu),
-	}
-}
-
-func (c *BaiduClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	// 百度千帆需要特殊的认证方式
-	return nil, fmt.Errorf("百度千帆客户端暂未实现")
-}
-
-func (c *BaiduClient) GetServiceType() AIServiceType {
-	return AIServiceBaidu
-}
-
-func (c *BaiduClient) IsAvailable() bool {
-	return c.apiKey != "" && c.config.BaiduSecretKey != ""
-}
-
-// 字节扣子客户端
-type BytedanceClient struct {
-	*BaseAIClient
-}
-
-func NewBytedanceClient(cfg *config.Config) *BytedanceClient {
-	return &BytedanceClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.BytedanceBaseURL, cfg.BytedanceAPIKey, AIServiceBytedance),
-	}
-}
-
-func (c *BytedanceClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
-	return c.sendRequest(ctx, "/chat/completions", req)
-}
-
-func (c *BytedanceClient) GetServiceType() AIServiceType {
-	return AIServiceBytedance
-}
-
-func (c *BytedanceClient) IsAvailable() bool {
-	return c.apiKey != ""
+	return &aiResp, nil
 }
 
-// 硅基流动客户端
-type SiliconFlowClient struct {
+// OpenAI兼容客户端，适用于所有提供 /chat/completions 接口的服务
+type OpenAICompatibleClient struct {
 	*BaseAIClient
 }
 
-func NewSiliconFlowClient(cfg *config.Config) *SiliconFlowClient {
-	return &SiliconFlowClient{
-		BaseAIClient: NewBaseAIClient(cfg, cfg.SiliconFlowBaseURL, cfg.SiliconFlowAPIKey, AIServiceSiliconFlow),
+func NewOpenAICompatibleClient(cfg *config.Config, spec AIProviderSpec) *OpenAICompatibleClient {
+	return &OpenAICompatibleClient{
+		BaseAIClient: NewBaseAIClient(cfg, spec),
 	}
 }
 
-func (c *SiliconFlowClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
+func (c *OpenAICompatibleClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
 	return c.sendRequest(ctx, "/chat/completions", req)
 }
 
-func (c *SiliconFlowClient) GetServiceType() AIServiceType {
-	return AIServiceSiliconFlow
-}
-
-func (c *SiliconFlowClient) IsAvailable() bool {
-	return c.apiKey != ""
+func (c *OpenAICompatibleClient) IsAvailable() bool {
+	return c.baseURL != "" && (c.apiKey != "" || c.spec.AuthStyle == AIAuthNone)
 }
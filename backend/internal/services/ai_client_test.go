@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+const testMockProviders = `
+providers:
+  - name: mock
+    protocol: mock
+    default_model: mock-primary
+    priority: 1
+  - name: mock-backup
+    protocol: mock
+    default_model: mock-backup
+    priority: 2
+`
+
+// newTestAIClientManager 只包含两个模拟服务的管理器，fixtures为模拟服务的脚本文件内容
+func newTestAIClientManager(t *testing.T, fixtures string) *AIClientManager {
+	t.Helper()
+	dir := t.TempDir()
+	providersFile := filepath.Join(dir, "providers.yaml")
+	fixturesFile := filepath.Join(dir, "fixtures.yaml")
+	if err := os.WriteFile(providersFile, []byte(testMockProviders), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fixturesFile, []byte(fixtures), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewAIClientManager(nil, nil, &config.Config{
+		AIProvidersFile:           providersFile,
+		AIMockMode:                AIMockModeOnly,
+		AIMockFixturesFile:        fixturesFile,
+		AICircuitFailureThreshold: 3,
+		AICircuitOpenSeconds:      30,
+	})
+	if len(manager.priority) != 2 {
+		t.Fatalf("configured services = %v, want [mock mock-backup]", manager.priority)
+	}
+	return manager
+}
+
+func mockClient(t *testing.T, m *AIClientManager, service AIServiceType) *MockAIClient {
+	t.Helper()
+	client, ok := m.clients[service].(*MockAIClient)
+	if !ok {
+		t.Fatalf("service %s is not a mock client", service)
+	}
+	return client
+}
+
+func testAIRequest() *AIRequest {
+	return &AIRequest{Messages: []AIMessage{{Role: "user", Content: "你好"}}}
+}
+
+func TestAIClientManagerFailover(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixtures    string
+		wantContent string
+		wantService AIServiceType
+		wantKinds   []AIErrorKind
+	}{
+		{
+			name: "primary succeeds",
+			fixtures: `
+default:
+  content: primary
+fixtures:
+  - service: mock-backup
+    match: "."
+    content: backup
+`,
+			wantContent: "primary",
+			wantService: AIServiceMock,
+		},
+		{
+			name: "falls over on upstream error",
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 500}
+  - service: mock-backup
+    match: "."
+    content: backup
+`,
+			wantContent: "backup",
+			wantService: "mock-backup",
+		},
+		{
+			name: "falls over on network error",
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {kind: network}
+  - service: mock-backup
+    match: "."
+    content: backup
+`,
+			wantContent: "backup",
+			wantService: "mock-backup",
+		},
+		{
+			name: "all services fail",
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 429}
+  - service: mock-backup
+    match: "."
+    error: {status: 502}
+`,
+			wantKinds: []AIErrorKind{AIErrorRateLimited, AIErrorUpstream},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestAIClientManager(t, tt.fixtures)
+
+			resp, err := m.GenerateText(context.Background(), testAIRequest())
+			if tt.wantKinds != nil {
+				var multiErr *AIMultiError
+				if !errors.As(err, &multiErr) {
+					t.Fatalf("GenerateText() error = %v, want *AIMultiError", err)
+				}
+				if len(multiErr.Errors) != len(tt.wantKinds) {
+					t.Fatalf("provider errors = %+v, want kinds %v", multiErr.Errors, tt.wantKinds)
+				}
+				for i, kind := range tt.wantKinds {
+					if multiErr.Errors[i].Kind != kind {
+						t.Errorf("provider error %d kind = %s, want %s", i, multiErr.Errors[i].Kind, kind)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateText() error = %v", err)
+			}
+			if got := resp.Choices[0].Message.Content; got != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+			if calls := mockClient(t, m, tt.wantService).Calls(); calls != 1 {
+				t.Errorf("%s calls = %d, want 1", tt.wantService, calls)
+			}
+		})
+	}
+}
+
+func TestAIClientManagerCircuitBreaker(t *testing.T) {
+	m := newTestAIClientManager(t, `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 503}
+    fail_times: 3
+  - service: mock-backup
+    match: "."
+    content: backup
+`)
+	// 缩短熔断时间，避免测试等待
+	m.health[AIServiceMock] = NewProviderHealth(AIServiceMock, CircuitBreakerConfig{
+		FailureThreshold: 3,
+		OpenTimeout:      50 * time.Millisecond,
+	})
+	health := m.health[AIServiceMock]
+	primary := mockClient(t, m, AIServiceMock)
+	ctx := context.Background()
+	pinned := func() *AIRequest {
+		req := testAIRequest()
+		req.Model = "mock/mock-primary"
+		return req
+	}
+
+	// 连续失败达到阈值后熔断
+	for i := 0; i < 3; i++ {
+		if _, err := m.GenerateText(ctx, pinned()); err == nil {
+			t.Fatalf("call %d succeeded, want injected failure", i)
+		}
+	}
+	if state := health.Snapshot(0).State; state != CircuitOpen {
+		t.Fatalf("state after failures = %s, want %s", state, CircuitOpen)
+	}
+
+	// 熔断期间不再调用该服务
+	_, err := m.GenerateText(ctx, pinned())
+	var multiErr *AIMultiError
+	if !errors.As(err, &multiErr) || !multiErr.AllOfKind(AIErrorCircuitOpen) {
+		t.Fatalf("GenerateText() while open error = %v, want circuit_open", err)
+	}
+	if calls := primary.Calls(); calls != 3 {
+		t.Errorf("primary calls while open = %d, want 3", calls)
+	}
+
+	// 未指定服务时由备用服务响应
+	resp, err := m.GenerateText(ctx, testAIRequest())
+	if err != nil || resp.Choices[0].Message.Content != "backup" {
+		t.Fatalf("failover while open: resp = %+v, err = %v", resp, err)
+	}
+	if health.Ready() {
+		t.Error("open circuit reported ready before the cooldown")
+	}
+
+	// 冷却后进入半开状态，只放行一个探测请求
+	time.Sleep(60 * time.Millisecond)
+	if !health.Ready() {
+		t.Fatal("circuit not ready after the cooldown")
+	}
+	if !health.Allow() {
+		t.Fatal("half-open circuit rejected the probe")
+	}
+	if state := health.Snapshot(0).State; state != CircuitHalfOpen {
+		t.Fatalf("state after cooldown = %s, want %s", state, CircuitHalfOpen)
+	}
+	if health.Allow() {
+		t.Error("half-open circuit allowed a second concurrent probe")
+	}
+	health.Release()
+
+	// 探测成功后恢复
+	resp, err = m.GenerateText(ctx, pinned())
+	if err != nil {
+		t.Fatalf("GenerateText() after cooldown error = %v", err)
+	}
+	if primary.Calls() != 4 || resp.Model != "mock-primary" {
+		t.Errorf("probe not sent to primary: calls = %d, model = %s", primary.Calls(), resp.Model)
+	}
+	if state := health.Snapshot(0).State; state != CircuitClosed {
+		t.Errorf("state after successful probe = %s, want %s", state, CircuitClosed)
+	}
+}
+
+func TestAIClientManagerHalfOpenProbeFailure(t *testing.T) {
+	m := newTestAIClientManager(t, `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 500}
+`)
+	m.health[AIServiceMock] = NewProviderHealth(AIServiceMock, CircuitBreakerConfig{
+		FailureThreshold: 1,
+		OpenTimeout:      20 * time.Millisecond,
+	})
+	ctx := context.Background()
+	req := testAIRequest()
+	req.Model = "mock/mock-primary"
+
+	m.GenerateText(ctx, req)
+	time.Sleep(30 * time.Millisecond)
+	m.GenerateText(ctx, req)
+
+	// 半开探测失败后重新熔断
+	snapshot := m.health[AIServiceMock].Snapshot(0)
+	if snapshot.State != CircuitOpen || snapshot.TotalFailures != 2 {
+		t.Errorf("snapshot = %+v, want open after the failed probe", snapshot)
+	}
+}
+
+func TestAIRequestTemperatureJSON(t *testing.T) {
+	// OpenAI兼容接口直接发送AIRequest，显式的0不能被省略
+	data, err := json.Marshal(&AIRequest{Model: "gpt-4o-mini", Temperature: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"temperature":0`) {
+		t.Errorf("request body = %s, want temperature 0", data)
+	}
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"qa-toolbox-backend/internal/database"
+)
+
+// ErrConversationNotFound 对话不存在或不属于当前用户
+var ErrConversationNotFound = errors.New("对话不存在")
+
+// 每条消息除正文外的格式开销（角色、分隔符等）
+const aiMessageOverheadTokens = 4
+
+// 自动生成的对话标题长度
+const conversationTitleLength = 30
+
+// 摘要放在system消息中的前缀
+var conversationSummaryPrefixes = map[string]string{
+	"zh": "以下是此前对话的摘要：\n%s",
+	"en": "Summary of the earlier conversation:\n%s",
+}
+
+// AIConversation 服务端保存的多轮对话
+//
+// SummarizedSeq之前（含）的消息已经压缩进Summary，构建上下文时不再发送原文
+type AIConversation struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	Title         string    `json:"title"`
+	Model         string    `json:"model,omitempty"`
+	SystemPrompt  string    `json:"system_prompt,omitempty"`
+	Summary       string    `json:"summary,omitempty"`
+	SummarizedSeq int       `json:"summarized_seq"`
+	MessageCount  int       `json:"message_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// AIConversationMessage 对话中的一条消息，Seq在对话内从1递增
+type AIConversationMessage struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	Seq            int       `json:"seq"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	Model          string    `json:"model,omitempty"`
+	Tokens         int       `json:"tokens"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ConversationService 多轮对话的保存与上下文管理
+type ConversationService struct {
+	db            *database.DB
+	ai            *AIClientManager
+	contextTokens int
+}
+
+func NewConversationService(db *database.DB, ai *AIClientManager, contextTokens int) *ConversationService {
+	return &ConversationService{
+		db:            db,
+		ai:            ai,
+		contextTokens: contextTokens,
+	}
+}
+
+// Create 创建对话，标题为空时取第一条用户消息
+func (s *ConversationService) Create(ctx context.Context, userID, title, model, systemPrompt string) (*AIConversation, error) {
+	conv := &AIConversation{
+		ID:           generateUUID(),
+		UserID:       userID,
+		Title:        strings.TrimSpace(title),
+		Model:        model,
+		SystemPrompt: systemPrompt,
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO ai_conversations (id, user_id, title, model, system_prompt, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING created_at, updated_at
+	`, conv.ID, userID, conv.Title, model, systemPrompt).Scan(&conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("创建对话失败: %w", err)
+	}
+
+	return conv, nil
+}
+
+// List 按最近更新时间列出用户的对话
+func (s *ConversationService) List(ctx context.Context, userID string, page, perPage int) ([]AIConversation, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+
+	var total int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ai_conversations WHERE user_id = $1", userID).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询对话数量失败: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, title, COALESCE(model, ''), COALESCE(system_prompt, ''), COALESCE(summary, ''),
+		       summarized_seq, message_count, created_at, updated_at
+		FROM ai_conversations
+		WHERE user_id = $1
+		ORDER BY updated_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询对话列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []AIConversation{}
+	for rows.Next() {
+		var conv AIConversation
+		if err := rows.Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.Model, &conv.SystemPrompt, &conv.Summary,
+			&conv.SummarizedSeq, &conv.MessageCount, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("读取对话失败: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询对话列表失败: %w", err)
+	}
+
+	return conversations, total, nil
+}
+
+// Get 获取用户的一个对话
+func (s *ConversationService) Get(ctx context.Context, userID, id string) (*AIConversation, error) {
+	var conv AIConversation
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, title, COALESCE(model, ''), COALESCE(system_prompt, ''), COALESCE(summary, ''),
+		       summarized_seq, message_count, created_at, updated_at
+		FROM ai_conversations
+		WHERE id = $1 AND user_id = $2
+	`, id, userID).Scan(&conv.ID, &conv.UserID, &conv.Title, &conv.Model, &conv.SystemPrompt, &conv.Summary,
+		&conv.SummarizedSeq, &conv.MessageCount, &conv.CreatedAt, &conv.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrConversationNotFound
+		}
+		return nil, fmt.Errorf("查询对话失败: %w", err)
+	}
+	return &conv, nil
+}
+
+// GetMessages 获取Seq大于afterSeq的消息，用于在其他设备上恢复或增量同步对话
+func (s *ConversationService) GetMessages(ctx context.Context, userID, id string, afterSeq, limit int) ([]AIConversationMessage, error) {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	if limit < 1 {
+		limit = 200
+	}
+	return s.loadMessages(ctx, id, afterSeq, limit)
+}
+
+// Rename 修改对话标题
+func (s *ConversationService) Rename(ctx context.Context, userID, id, title string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE ai_conversations SET title = $1, updated_at = NOW()
+		WHERE id = $2 AND user_id = $3
+	`, strings.TrimSpace(title), id, userID)
+	if err != nil {
+		return fmt.Errorf("重命名对话失败: %w", err)
+	}
+	return conversationAffected(result)
+}
+
+// Delete 删除对话及其全部消息
+func (s *ConversationService) Delete(ctx context.Context, userID, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM ai_conversations WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("删除对话失败: %w", err)
+	}
+	return conversationAffected(result)
+}
+
+// Send 将新消息追加到对话并生成回复
+//
+// req.Messages只包含本轮新增的消息，历史由服务端按token预算补全。
+// 生成成功后新消息和回复一起保存，失败时不保存，客户端可以直接重试。
+// tools不为nil时允许模型调用其中的工具，中间的工具调用消息不保存
+func (s *ConversationService) Send(ctx context.Context, userID, id string, req *AIRequest, tools *AIToolRegistry) (*AIResponse, []AIToolInvocation, error) {
+	conv, aiReq, err := s.prepare(ctx, userID, id, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp *AIResponse
+	var invocations []AIToolInvocation
+	if tools != nil {
+		resp, invocations, err = s.ai.GenerateWithTools(ctx, aiReq, tools)
+	} else {
+		resp, err = s.ai.GenerateText(ctx, aiReq)
+	}
+	if err != nil {
+		return nil, invocations, err
+	}
+
+	content := ""
+	if len(resp.Choices) > 0 {
+		content = resp.Choices[0].Message.Content
+	}
+	if err := s.appendTurn(ctx, conv, req.Messages, content, resp.Model); err != nil {
+		return nil, invocations, err
+	}
+
+	return resp, invocations, nil
+}
+
+// SendStream 流式生成回复，流正常结束后保存本轮消息
+func (s *ConversationService) SendStream(ctx context.Context, userID, id string, req *AIRequest) (<-chan AIStreamChunk, error) {
+	conv, aiReq, err := s.prepare(ctx, userID, id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := s.ai.GenerateTextStream(ctx, aiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan AIStreamChunk)
+	go func() {
+		defer close(out)
+
+		var model string
+		var content strings.Builder
+		for chunk := range stream {
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// 客户端断开，不保存不完整的回复
+				for range stream {
+				}
+				return
+			}
+			if chunk.Err != nil {
+				for range stream {
+				}
+				return
+			}
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			content.WriteString(chunk.Delta)
+		}
+
+		// 在关闭流之前保存，客户端收到结束事件时即可从其他设备看到本轮消息
+		if err := s.appendTurn(context.WithoutCancel(ctx), conv, req.Messages, content.String(), model); err != nil {
+			log.Printf("保存对话消息失败: %v", err)
+		}
+	}()
+	return out, nil
+}
+
+// prepare 校验本轮消息并构建发送给模型的完整请求
+func (s *ConversationService) prepare(ctx context.Context, userID, id string, req *AIRequest) (*AIConversation, *AIRequest, error) {
+	if len(req.Messages) == 0 {
+		return nil, nil, fmt.Errorf("消息不能为空")
+	}
+
+	conv, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	messages, err := s.buildContext(ctx, conv, req.Messages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aiReq := *req
+	aiReq.Messages = messages
+	if (aiReq.Model == "" || aiReq.Model == "auto") && conv.Model != "" {
+		aiReq.Model = conv.Model
+	}
+	return conv, &aiReq, nil
+}
+
+// buildContext 在token预算内拼接 system提示词 + 摘要 + 最近的历史消息 + 本轮消息
+//
+// 历史放不下时，把较早的消息连同已有摘要压缩成新摘要，只保留约一半预算的最近消息，
+// 这样之后几轮对话不需要每次都重新生成摘要。摘要失败时直接丢弃较早的消息
+func (s *ConversationService) buildContext(ctx context.Context, conv *AIConversation, pending []AIMessage) ([]AIMessage, error) {
+	history, err := s.loadMessages(ctx, conv.ID, conv.SummarizedSeq, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := messagesTokens(pending) + estimateTokens(conv.SystemPrompt) + estimateTokens(conv.Summary) + aiMessageOverheadTokens
+	start := fitHistory(history, s.contextTokens-reserved)
+
+	if start > 0 {
+		keepFrom := fitHistory(history, s.contextTokens/2-reserved)
+		summary, err := s.summarize(ctx, conv.Summary, history[:keepFrom])
+		if err != nil {
+			log.Printf("生成对话摘要失败，丢弃较早的消息: %v", err)
+		} else {
+			conv.Summary = summary
+			conv.SummarizedSeq = history[keepFrom-1].Seq
+			_, err := s.db.ExecContext(ctx, `
+				UPDATE ai_conversations SET summary = $1, summarized_seq = $2 WHERE id = $3
+			`, conv.Summary, conv.SummarizedSeq, conv.ID)
+			if err != nil {
+				return nil, fmt.Errorf("保存对话摘要失败: %w", err)
+			}
+			start = keepFrom
+		}
+	}
+
+	var messages []AIMessage
+	system := conv.SystemPrompt
+	if conv.Summary != "" {
+		prefix := conversationSummaryPrefixes[localeFor(conversationSummaryPrefixes, AILocaleFrom(ctx))]
+		system = strings.TrimSpace(system + "\n\n" + fmt.Sprintf(prefix, conv.Summary))
+	}
+	if system != "" {
+		messages = append(messages, AIMessage{Role: "system", Content: system})
+	}
+	for _, msg := range history[start:] {
+		messages = append(messages, AIMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return append(messages, pending...), nil
+}
+
+// summarize 将已有摘要和一段历史消息合并为新摘要
+func (s *ConversationService) summarize(ctx context.Context, previous string, messages []AIConversationMessage) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		transcript.WriteString(msg.Role)
+		transcript.WriteString(": ")
+		transcript.WriteString(msg.Content)
+		transcript.WriteString("\n")
+	}
+
+	result, err := s.ai.generateFromPrompt(WithAIFeature(ctx, AIFeatureChat), PromptConversationSummary, map[string]interface{}{
+		"summary":    previous,
+		"transcript": strings.TrimSpace(transcript.String()),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(result.Content)
+	if summary == "" {
+		return "", fmt.Errorf("摘要为空")
+	}
+	return summary, nil
+}
+
+// appendTurn 在一个事务中保存本轮消息和模型回复
+func (s *ConversationService) appendTurn(ctx context.Context, conv *AIConversation, pending []AIMessage, reply, model string) error {
+	messages := append(append([]AIMessage{}, pending...), AIMessage{Role: "assistant", Content: reply})
+	// 与发送给模型时一致，保存打码后的用户消息，避免后续轮次把原文带给模型
+	if moderation := s.ai.Moderation(); moderation != nil {
+		for i := range messages {
+			if messages[i].Role == "user" {
+				messages[i].Content = moderation.Redact(messages[i].Content)
+			}
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("保存对话消息失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 通过计数分配Seq，同一对话的并发写入在这一行上串行
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE ai_conversations
+		SET message_count = message_count + $1,
+		    title = CASE WHEN title = '' THEN $2 ELSE title END,
+		    updated_at = NOW()
+		WHERE id = $3
+		RETURNING message_count
+	`, len(messages), conversationTitle(pending), conv.ID).Scan(&count)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrConversationNotFound
+		}
+		return fmt.Errorf("保存对话消息失败: %w", err)
+	}
+
+	seq := count - len(messages)
+	for _, msg := range messages {
+		seq++
+		var msgModel interface{}
+		if msg.Role == "assistant" && model != "" {
+			msgModel = model
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ai_conversation_messages (id, conversation_id, seq, role, content, model, tokens, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		`, generateUUID(), conv.ID, seq, msg.Role, msg.Content, msgModel, estimateTokens(msg.Content))
+		if err != nil {
+			return fmt.Errorf("保存对话消息失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("保存对话消息失败: %w", err)
+	}
+	conv.MessageCount = count
+	return nil
+}
+
+// loadMessages 按Seq顺序读取消息，limit为0时不限制
+func (s *ConversationService) loadMessages(ctx context.Context, id string, afterSeq, limit int) ([]AIConversationMessage, error) {
+	query := `
+		SELECT id, conversation_id, seq, role, content, COALESCE(model, ''), tokens, created_at
+		FROM ai_conversation_messages
+		WHERE conversation_id = $1 AND seq > $2
+		ORDER BY seq
+	`
+	args := []interface{}{id, afterSeq}
+	if limit > 0 {
+		query += " LIMIT $3"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询对话消息失败: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []AIConversationMessage{}
+	for rows.Next() {
+		var msg AIConversationMessage
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Seq, &msg.Role, &msg.Content, &msg.Model, &msg.Tokens, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("读取对话消息失败: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询对话消息失败: %w", err)
+	}
+	return messages, nil
+}
+
+// fitHistory 从最新的消息往前保留，返回预算内能保留的第一条消息的下标
+func fitHistory(history []AIConversationMessage, budget int) int {
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		used += history[i].Tokens + aiMessageOverheadTokens
+		if used > budget {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func messagesTokens(messages []AIMessage) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateTokens(msg.Content) + aiMessageOverheadTokens
+	}
+	return total
+}
+
+// conversationTitle 取第一条用户消息的开头作为标题
+func conversationTitle(messages []AIMessage) string {
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		title := []rune(strings.Join(strings.Fields(msg.Content), " "))
+		if len(title) > conversationTitleLength {
+			title = append(title[:conversationTitleLength], '…')
+		}
+		return string(title)
+	}
+	return ""
+}
+
+func conversationAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %w", err)
+	}
+	if affected == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
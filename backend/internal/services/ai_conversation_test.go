@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFitHistory(t *testing.T) {
+	// 每条消息10 tokens，加上开销共14
+	history := make([]AIConversationMessage, 5)
+	for i := range history {
+		history[i] = AIConversationMessage{Seq: i + 1, Tokens: 10}
+	}
+
+	tests := []struct {
+		budget int
+		want   int
+	}{
+		{100, 0},
+		{70, 0},
+		{69, 1},
+		{28, 3},
+		{13, 5},
+		{-5, 5},
+	}
+	for _, tt := range tests {
+		if got := fitHistory(history, tt.budget); got != tt.want {
+			t.Errorf("fitHistory(budget %d) = %d, want %d", tt.budget, got, tt.want)
+		}
+	}
+	if got := fitHistory(nil, 10); got != 0 {
+		t.Errorf("fitHistory(nil) = %d, want 0", got)
+	}
+}
+
+func TestConversationBuildContext(t *testing.T) {
+	const convID = "conv-1"
+	// 6条历史消息，每条10 tokens；本轮消息和开销共10 tokens
+	var rows [][]driver.Value
+	for seq := 1; seq <= 6; seq++ {
+		role := "user"
+		if seq%2 == 0 {
+			role = "assistant"
+		}
+		rows = append(rows, []driver.Value{fmt.Sprintf("m%d", seq), convID, int64(seq), role, fmt.Sprintf("消息%d", seq), "", int64(10), time.Now()})
+	}
+	pending := []AIMessage{{Role: "user", Content: "你好"}}
+
+	tests := []struct {
+		name          string
+		contextTokens int
+		fixtures      string
+		wantHistory   []string
+		wantSummary   string
+		wantSeq       int
+	}{
+		{
+			name:          "history within budget",
+			contextTokens: 100,
+			fixtures:      "default:\n  content: 不应调用\n",
+			wantHistory:   []string{"消息1", "消息2", "消息3", "消息4", "消息5", "消息6"},
+		},
+		{
+			// 完整预算只能保留3条，摘要后只保留一半预算内的1条
+			name:          "older messages summarized",
+			contextTokens: 60,
+			fixtures:      "default:\n  content: 之前聊了消息1到消息5\n",
+			wantHistory:   []string{"消息6"},
+			wantSummary:   "之前聊了消息1到消息5",
+			wantSeq:       5,
+		},
+		{
+			name:          "summary failure drops older messages",
+			contextTokens: 60,
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 500}
+  - service: mock-backup
+    match: "."
+    error: {status: 500}
+`,
+			wantHistory: []string{"消息4", "消息5", "消息6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, db := newFakeUsageDB(func(query string, args []interface{}) [][]driver.Value {
+				if !strings.HasPrefix(query, "SELECT id, conversation_id, seq") {
+					t.Errorf("unexpected query %q", query)
+					return nil
+				}
+				var out [][]driver.Value
+				for _, row := range rows {
+					if row[2].(int64) > args[1].(int64) {
+						out = append(out, row)
+					}
+				}
+				return out
+			})
+			m := newTestAIClientManager(t, tt.fixtures)
+			s := NewConversationService(db, m, tt.contextTokens)
+			conv := &AIConversation{ID: convID}
+
+			messages, err := s.buildContext(context.Background(), conv, pending)
+			if err != nil {
+				t.Fatalf("buildContext() error = %v", err)
+			}
+
+			var history []string
+			for _, msg := range messages[:len(messages)-1] {
+				if msg.Role == "system" {
+					if tt.wantSummary == "" || !strings.Contains(msg.Content, tt.wantSummary) {
+						t.Errorf("system message = %q", msg.Content)
+					}
+					continue
+				}
+				history = append(history, msg.Content)
+			}
+			if !reflect.DeepEqual(history, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", history, tt.wantHistory)
+			}
+			if last := messages[len(messages)-1]; !reflect.DeepEqual(last, pending[0]) {
+				t.Errorf("last message = %+v, want the pending message", last)
+			}
+
+			// 摘要成功时保存摘要和已摘要的位置
+			if conv.Summary != tt.wantSummary || conv.SummarizedSeq != tt.wantSeq {
+				t.Errorf("summary = %q at seq %d, want %q at %d", conv.Summary, conv.SummarizedSeq, tt.wantSummary, tt.wantSeq)
+			}
+			var saved int
+			for _, exec := range f.execs {
+				if strings.HasPrefix(exec.query, "UPDATE ai_conversations SET summary") {
+					saved++
+					if exec.args[0] != tt.wantSummary || exec.args[1] != int64(tt.wantSeq) {
+						t.Errorf("saved summary args = %v", exec.args)
+					}
+				}
+			}
+			if (saved == 1) != (tt.wantSummary != "") || saved > 1 {
+				t.Errorf("summary saved %d times", saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+)
+
+// 价格表的默认币种
+const defaultAICurrency = "USD"
+
+// 成本保留的小数位数，与 ai_cost_ledger.cost 的 NUMERIC(16,8) 一致
+const aiCostScale = 1e8
+
+// 超出预算的服务在调度分数上的惩罚，保证排在所有未超预算的服务之后
+const aiBudgetPenalty = 100
+
+// AICostEntry 一次调用的成本
+type AICostEntry struct {
+	Provider         AIServiceType `json:"provider"`
+	Model            string        `json:"model"`
+	Feature          string        `json:"feature"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	InputPrice       float64       `json:"input_price"`
+	OutputPrice      float64       `json:"output_price"`
+	Cost             float64       `json:"cost"`
+	Currency         string        `json:"currency"`
+	Priced           bool          `json:"priced"` // 模型不在价格表中时为false，成本记为0
+}
+
+// AICostDaily 每日成本汇总，Cost已换算为预算币种
+type AICostDaily struct {
+	Day         string        `json:"day"`
+	Provider    AIServiceType `json:"provider"`
+	Feature     string        `json:"feature"`
+	Cost        float64       `json:"cost"`
+	Requests    int64         `json:"requests"`
+	TotalTokens int64         `json:"total_tokens"`
+}
+
+// AIProviderBudget 服务当日花费和预算
+type AIProviderBudget struct {
+	Provider AIServiceType `json:"provider"`
+	Spent    float64       `json:"spent"`
+	Budget   float64       `json:"budget,omitempty"`
+	Demoted  bool          `json:"demoted"`
+}
+
+// AIBudgetStatus 当日预算使用情况
+type AIBudgetStatus struct {
+	Day         string             `json:"day"`
+	Currency    string             `json:"currency"`
+	DailyBudget float64            `json:"daily_budget,omitempty"`
+	Spent       float64            `json:"spent"`
+	OverBudget  bool               `json:"over_budget"`
+	Providers   []AIProviderBudget `json:"providers"`
+}
+
+// AICostService AI调用成本记账和预算告警
+//
+// 每次调用按模型目录中的价格写入成本明细并累加到当日汇总。当日总花费超过 AI_DAILY_BUDGET 时，
+// 所有付费服务降到免费服务之后；单个服务超过 AI_PROVIDER_DAILY_BUDGETS 中的预算时只降级该服务。
+// 首次超出预算时给管理员发送通知
+type AICostService struct {
+	db              *database.DB
+	catalog         *AIModelCatalog
+	currency        string
+	rates           map[string]float64
+	dailyBudget     float64
+	providerBudgets map[AIServiceType]float64
+	adminEmails     []string
+
+	mu      sync.Mutex
+	day     string
+	spend   map[AIServiceType]float64
+	alerted map[string]bool
+}
+
+func NewAICostService(db *database.DB, catalog *AIModelCatalog, cfg *config.Config) *AICostService {
+	currency := strings.ToUpper(cfg.AIBudgetCurrency)
+	if currency == "" {
+		currency = defaultAICurrency
+	}
+	return &AICostService{
+		db:              db,
+		catalog:         catalog,
+		currency:        currency,
+		rates:           parseAIExchangeRates(cfg.AIExchangeRates),
+		dailyBudget:     cfg.AIDailyBudget,
+		providerBudgets: parseAIProviderBudgets(cfg.AIProviderDailyBudgets),
+		adminEmails:     cfg.AdminEmails,
+		spend:           make(map[AIServiceType]float64),
+		alerted:         make(map[string]bool),
+	}
+}
+
+// Price 计算一次调用的成本
+func (s *AICostService) Price(provider AIServiceType, model string, usage AIUsage) AICostEntry {
+	entry := AICostEntry{
+		Provider:         provider,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Currency:         s.currency,
+	}
+
+	info, ok := s.lookupPrice(provider, model)
+	if !ok {
+		return entry
+	}
+	entry.Priced = true
+	entry.InputPrice = info.InputPrice
+	entry.OutputPrice = info.OutputPrice
+	entry.Currency = info.Currency
+	entry.Cost = roundAICost((float64(usage.PromptTokens)*info.InputPrice + float64(usage.CompletionTokens)*info.OutputPrice) / 1e6)
+	return entry
+}
+
+// roundAICost 按数据库精度四舍五入，保证明细和汇总累加的是同一个值
+func roundAICost(cost float64) float64 {
+	return math.Round(cost*aiCostScale) / aiCostScale
+}
+
+// lookupPrice 服务返回的模型名可能带有版本后缀（如 gpt-3.5-turbo-0125），精确匹配不到时按前缀匹配
+//
+// 前缀之后必须是版本分隔符，避免 gpt-4o 按 gpt-4 的价格计费
+func (s *AICostService) lookupPrice(provider AIServiceType, model string) (AIModelInfo, bool) {
+	if info, ok := s.catalog.Lookup(provider, model); ok {
+		return info, true
+	}
+	var best AIModelInfo
+	for _, info := range s.catalog.models {
+		if info.Provider != provider || len(info.Model) <= len(best.Model) || !strings.HasPrefix(model, info.Model) {
+			continue
+		}
+		if suffix := model[len(info.Model):]; strings.IndexByte("-:@", suffix[0]) >= 0 {
+			best = info
+		}
+	}
+	return best, best.Model != ""
+}
+
+// Record 写入成本明细并累加当日汇总，计费失败不影响本次调用
+func (s *AICostService) Record(ctx context.Context, scope AIUsageScope, provider AIServiceType, model string, usage AIUsage, estimated bool) {
+	ctx = context.WithoutCancel(ctx)
+	entry := s.Price(provider, model, usage)
+	entry.Feature = scope.Feature
+	if entry.Feature == "" {
+		entry.Feature = AIFeatureChat
+	}
+
+	var userID interface{}
+	if scope.UserID != "" {
+		userID = scope.UserID
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO ai_cost_ledger (id, user_id, provider, model, feature, prompt_tokens, completion_tokens,
+			input_price, output_price, cost, currency, priced, estimated, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW())
+	`, generateUUID(), userID, string(provider), model, entry.Feature, entry.PromptTokens, entry.CompletionTokens,
+		entry.InputPrice, entry.OutputPrice, entry.Cost, entry.Currency, entry.Priced, estimated)
+	if err != nil {
+		log.Printf("记录AI成本失败: %v", err)
+		return
+	}
+
+	dayStart, _ := usagePeriodStarts(time.Now())
+	day := dayStart.Format("2006-01-02")
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO ai_cost_daily (day, provider, feature, cost, requests, total_tokens, updated_at)
+		VALUES ($1, $2, $3, $4, 1, $5, NOW())
+		ON CONFLICT (day, provider, feature) DO UPDATE SET
+			cost = ai_cost_daily.cost + EXCLUDED.cost,
+			requests = ai_cost_daily.requests + 1,
+			total_tokens = ai_cost_daily.total_tokens + EXCLUDED.total_tokens,
+			updated_at = NOW()
+	`, day, string(provider), entry.Feature, s.convert(entry.Cost, entry.Currency), usage.TotalTokens)
+	if err != nil {
+		log.Printf("汇总AI成本失败: %v", err)
+		return
+	}
+
+	if err := s.refresh(ctx, day); err != nil {
+		log.Printf("读取AI当日花费失败: %v", err)
+		return
+	}
+	s.checkBudgets(ctx, day)
+}
+
+// convert 换算为预算币种，没有配置汇率时按原值计入
+func (s *AICostService) convert(amount float64, currency string) float64 {
+	if amount == 0 || strings.EqualFold(currency, s.currency) {
+		return amount
+	}
+	rate, ok := s.rates[strings.ToUpper(currency)]
+	if !ok {
+		log.Printf("缺少 %s 到 %s 的汇率，成本按原值计入", currency, s.currency)
+		return amount
+	}
+	return roundAICost(amount * rate)
+}
+
+// refresh 从汇总表读取当日各服务的花费（多实例共享）
+func (s *AICostService) refresh(ctx context.Context, day string) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT provider, COALESCE(SUM(cost), 0) FROM ai_cost_daily WHERE day = $1 GROUP BY provider
+	`, day)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	spend := make(map[AIServiceType]float64)
+	for rows.Next() {
+		var provider string
+		var cost float64
+		if err := rows.Scan(&provider, &cost); err != nil {
+			return err
+		}
+		spend[AIServiceType(provider)] = cost
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.day != day {
+		s.day = day
+		s.alerted = make(map[string]bool)
+	}
+	s.spend = spend
+	s.mu.Unlock()
+	return nil
+}
+
+// checkBudgets 首次超出总预算或服务预算时通知管理员
+func (s *AICostService) checkBudgets(ctx context.Context, day string) {
+	s.mu.Lock()
+	var alerts []string
+	var messages []string
+	total := s.totalLocked()
+	if s.dailyBudget > 0 && total >= s.dailyBudget && !s.alerted["total"] {
+		s.alerted["total"] = true
+		alerts = append(alerts, fmt.Sprintf("AI成本超出每日预算 %s", day))
+		messages = append(messages, fmt.Sprintf("%s 的AI调用花费 %.4f %s，已超过每日预算 %.2f %s，付费服务已降级到免费服务之后。",
+			day, total, s.currency, s.dailyBudget, s.currency))
+	}
+	for provider, budget := range s.providerBudgets {
+		spent := s.spend[provider]
+		key := "provider:" + string(provider)
+		if budget > 0 && spent >= budget && !s.alerted[key] {
+			s.alerted[key] = true
+			alerts = append(alerts, fmt.Sprintf("AI服务 %s 超出每日预算 %s", provider, day))
+			messages = append(messages, fmt.Sprintf("%s 的 %s 花费 %.4f %s，已超过该服务的每日预算 %.2f %s，该服务已降级。",
+				day, provider, spent, s.currency, budget, s.currency))
+		}
+	}
+	s.mu.Unlock()
+
+	for i := range alerts {
+		if err := s.notifyAdmins(ctx, alerts[i], messages[i]); err != nil {
+			log.Printf("发送AI预算告警失败: %v", err)
+		}
+	}
+}
+
+// notifyAdmins 给管理员写入系统通知，同一标题每天只通知一次（多实例时以数据库为准）
+func (s *AICostService) notifyAdmins(ctx context.Context, title, content string) error {
+	log.Printf("%s: %s", title, content)
+	if len(s.adminEmails) == 0 {
+		return nil
+	}
+
+	dayStart, _ := usagePeriodStarts(time.Now())
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM notifications WHERE title = $1 AND type = 'system' AND created_at >= $2)
+	`, title, dayStart).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("查询通知失败: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM users WHERE email = ANY($1)`, pq.Array(s.adminEmails))
+	if err != nil {
+		return fmt.Errorf("查询管理员失败: %w", err)
+	}
+	var adminIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("读取管理员失败: %w", err)
+		}
+		adminIDs = append(adminIDs, id)
+	}
+	rows.Close()
+
+	for _, adminID := range adminIDs {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO notifications (id, user_id, title, content, type, created_at)
+			VALUES ($1, $2, $3, $4, 'system', NOW())
+		`, generateUUID(), adminID, title, content)
+		if err != nil {
+			return fmt.Errorf("创建通知失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// Demoted 服务是否因超出预算需要降级，paid表示服务的默认模型是否收费
+func (s *AICostService) Demoted(provider AIServiceType, paid bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.demotedLocked(provider, paid)
+}
+
+func (s *AICostService) demotedLocked(provider AIServiceType, paid bool) bool {
+	if !s.isTodayLocked() {
+		return false
+	}
+	if budget := s.providerBudgets[provider]; budget > 0 && s.spend[provider] >= budget {
+		return true
+	}
+	return paid && s.dailyBudget > 0 && s.totalLocked() >= s.dailyBudget
+}
+
+// BudgetStatus 当日花费和预算
+func (s *AICostService) BudgetStatus(ctx context.Context, paid func(AIServiceType) bool) (*AIBudgetStatus, error) {
+	dayStart, _ := usagePeriodStarts(time.Now())
+	day := dayStart.Format("2006-01-02")
+	if err := s.refresh(ctx, day); err != nil {
+		return nil, fmt.Errorf("读取AI当日花费失败: %w", err)
+	}
+
+	s.mu.Lock()
+	status := &AIBudgetStatus{
+		Day:         day,
+		Currency:    s.currency,
+		DailyBudget: s.dailyBudget,
+		Spent:       s.totalLocked(),
+	}
+	status.OverBudget = s.dailyBudget > 0 && status.Spent >= s.dailyBudget
+	providers := make(map[AIServiceType]bool)
+	for provider := range s.spend {
+		providers[provider] = true
+	}
+	for provider := range s.providerBudgets {
+		providers[provider] = true
+	}
+	for provider := range providers {
+		status.Providers = append(status.Providers, AIProviderBudget{
+			Provider: provider,
+			Spent:    s.spend[provider],
+			Budget:   s.providerBudgets[provider],
+			Demoted:  s.demotedLocked(provider, paid(provider)),
+		})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(status.Providers, func(i, j int) bool {
+		return status.Providers[i].Spent > status.Providers[j].Spent
+	})
+	return status, nil
+}
+
+// DailySpend 按天、服务和功能汇总的花费，from和to为包含的日期
+func (s *AICostService) DailySpend(ctx context.Context, from, to time.Time) ([]AICostDaily, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT day, provider, feature, cost, requests, total_tokens
+		FROM ai_cost_daily
+		WHERE day >= $1 AND day <= $2
+		ORDER BY day DESC, cost DESC
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("查询AI成本失败: %w", err)
+	}
+	defer rows.Close()
+
+	costs := []AICostDaily{}
+	for rows.Next() {
+		var item AICostDaily
+		var day time.Time
+		var provider string
+		if err := rows.Scan(&day, &provider, &item.Feature, &item.Cost, &item.Requests, &item.TotalTokens); err != nil {
+			return nil, fmt.Errorf("读取AI成本失败: %w", err)
+		}
+		item.Day = day.Format("2006-01-02")
+		item.Provider = AIServiceType(provider)
+		costs = append(costs, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询AI成本失败: %w", err)
+	}
+	return costs, nil
+}
+
+func (s *AICostService) totalLocked() float64 {
+	var total float64
+	for _, cost := range s.spend {
+		total += cost
+	}
+	return total
+}
+
+// isTodayLocked 缓存的花费是否属于今天，跨天后在下一次记账前不降级
+func (s *AICostService) isTodayLocked() bool {
+	dayStart, _ := usagePeriodStarts(time.Now())
+	return s.day == dayStart.Format("2006-01-02")
+}
+
+// parseAIExchangeRates 解析 "CNY=0.14,EUR=1.08"，值为1单位该币种折合的预算币种
+func parseAIExchangeRates(items []string) map[string]float64 {
+	rates := make(map[string]float64)
+	for key, value := range parseKeyValues(items) {
+		rates[strings.ToUpper(key)] = value
+	}
+	return rates
+}
+
+// parseAIProviderBudgets 解析 "deepseek=5,aimlapi=10"
+func parseAIProviderBudgets(items []string) map[AIServiceType]float64 {
+	budgets := make(map[AIServiceType]float64)
+	for key, value := range parseKeyValues(items) {
+		budgets[AIServiceType(key)] = value
+	}
+	return budgets
+}
+
+func parseKeyValues(items []string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, item := range items {
+		key, raw, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			log.Printf("忽略无法解析的配置项: %s", item)
+			continue
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values
+}
+
+// BudgetStatus 当日AI花费、预算和被降级的服务
+func (m *AIClientManager) BudgetStatus(ctx context.Context) (*AIBudgetStatus, error) {
+	if m.costs == nil {
+		return nil, fmt.Errorf("未启用AI成本统计")
+	}
+	return m.costs.BudgetStatus(ctx, m.providerPaid)
+}
+
+// DailyCosts 按天、服务和功能汇总的AI花费
+func (m *AIClientManager) DailyCosts(ctx context.Context, from, to time.Time) ([]AICostDaily, error) {
+	if m.costs == nil {
+		return nil, fmt.Errorf("未启用AI成本统计")
+	}
+	return m.costs.DailySpend(ctx, from, to)
+}
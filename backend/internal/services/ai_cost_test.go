@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+func newTestAICostService(t *testing.T, query func(string, []interface{}) [][]driver.Value) (*AICostService, *fakeUsageDB) {
+	t.Helper()
+	if query == nil {
+		query = func(string, []interface{}) [][]driver.Value { return nil }
+	}
+	f, db := newFakeUsageDB(query)
+	catalog := &AIModelCatalog{models: []AIModelInfo{
+		{Provider: "deepseek", Model: "deepseek-chat", InputPrice: 0.27, OutputPrice: 1.1, Currency: "USD"},
+		{Provider: "aimlapi", Model: "gpt-3.5-turbo", InputPrice: 0.5, OutputPrice: 1.5, Currency: "USD"},
+		{Provider: "aimlapi", Model: "gpt-4", InputPrice: 30, OutputPrice: 60, Currency: "USD"},
+		{Provider: "aimlapi", Model: "gpt-4-turbo", InputPrice: 10, OutputPrice: 30, Currency: "USD"},
+		{Provider: "tencent", Model: "hunyuan-pro", InputPrice: 0.123456, OutputPrice: 1, Currency: "CNY"},
+	}}
+	service := NewAICostService(db, catalog, &config.Config{AIExchangeRates: []string{"CNY=0.14"}})
+	return service, f
+}
+
+func TestAICostPriceLookup(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  AIServiceType
+		model     string
+		usage     AIUsage
+		wantModel string // 匹配到的价格条目，为空表示未定价
+		wantCost  float64
+	}{
+		{
+			name:      "exact match",
+			provider:  "deepseek",
+			model:     "deepseek-chat",
+			usage:     AIUsage{PromptTokens: 1000, CompletionTokens: 500},
+			wantModel: "deepseek-chat",
+			wantCost:  0.00082,
+		},
+		{
+			name:      "version suffix",
+			provider:  "aimlapi",
+			model:     "gpt-3.5-turbo-0125",
+			usage:     AIUsage{PromptTokens: 2000, CompletionTokens: 1000},
+			wantModel: "gpt-3.5-turbo",
+			wantCost:  0.0025,
+		},
+		{
+			name:      "longest prefix wins",
+			provider:  "aimlapi",
+			model:     "gpt-4-turbo-2024-04-09",
+			usage:     AIUsage{PromptTokens: 1000},
+			wantModel: "gpt-4-turbo",
+			wantCost:  0.01,
+		},
+		{
+			name:      "colon suffix",
+			provider:  "aimlapi",
+			model:     "gpt-4:latest",
+			usage:     AIUsage{CompletionTokens: 1000},
+			wantModel: "gpt-4",
+			wantCost:  0.06,
+		},
+		{
+			name:     "prefix without separator",
+			provider: "aimlapi",
+			model:    "gpt-4o",
+			usage:    AIUsage{PromptTokens: 1000},
+		},
+		{
+			name:     "other provider",
+			provider: "groq",
+			model:    "deepseek-chat",
+			usage:    AIUsage{PromptTokens: 1000},
+		},
+		{
+			name:     "unknown model",
+			provider: "deepseek",
+			model:    "deepseek-reasoner",
+			usage:    AIUsage{PromptTokens: 1000},
+		},
+	}
+
+	service, _ := newTestAICostService(t, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := service.Price(tt.provider, tt.model, tt.usage)
+			if entry.Priced != (tt.wantModel != "") {
+				t.Fatalf("priced = %v, want %v", entry.Priced, tt.wantModel != "")
+			}
+			if tt.wantModel != "" {
+				info, _ := service.catalog.Lookup(tt.provider, tt.wantModel)
+				if entry.InputPrice != info.InputPrice || entry.OutputPrice != info.OutputPrice {
+					t.Errorf("prices = %v/%v, want %s's %v/%v", entry.InputPrice, entry.OutputPrice, tt.wantModel, info.InputPrice, info.OutputPrice)
+				}
+			}
+			if entry.Cost != tt.wantCost {
+				t.Errorf("cost = %v, want %v", entry.Cost, tt.wantCost)
+			}
+			if entry.Model != tt.model || entry.Provider != tt.provider {
+				t.Errorf("entry = %s/%s, want the requested %s/%s", entry.Provider, entry.Model, tt.provider, tt.model)
+			}
+		})
+	}
+}
+
+func TestAICostRounding(t *testing.T) {
+	service, _ := newTestAICostService(t, nil)
+
+	tests := []struct {
+		name  string
+		usage AIUsage
+		want  float64
+	}{
+		// 0.123456/百万token，单个token为1.23456e-7，保留8位小数
+		{name: "rounds down", usage: AIUsage{PromptTokens: 1}, want: 0.00000012},
+		{name: "rounds up", usage: AIUsage{PromptTokens: 5}, want: 0.00000062},
+		{name: "large call", usage: AIUsage{PromptTokens: 123456, CompletionTokens: 7}, want: 0.01524838},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := service.Price("tencent", "hunyuan-pro", tt.usage)
+			if entry.Cost != tt.want {
+				t.Errorf("cost = %v, want %v", entry.Cost, tt.want)
+			}
+			if entry.Currency != "CNY" {
+				t.Errorf("currency = %s, want the catalog's CNY", entry.Currency)
+			}
+		})
+	}
+
+	// 换算后的金额同样按数据库精度保留
+	if got := service.convert(0.00000123, "CNY"); got != 0.00000017 {
+		t.Errorf("convert CNY = %v, want 0.00000017", got)
+	}
+	if got := service.convert(0.1, "usd"); got != 0.1 {
+		t.Errorf("convert USD = %v, want unchanged 0.1", got)
+	}
+	if got := service.convert(0.1, "EUR"); got != 0.1 {
+		t.Errorf("convert without a rate = %v, want unchanged 0.1", got)
+	}
+}
+
+func TestAICostRecordLedger(t *testing.T) {
+	service, f := newTestAICostService(t, func(query string, args []interface{}) [][]driver.Value {
+		if strings.HasPrefix(query, "SELECT provider") {
+			return [][]driver.Value{{"tencent", 0.00086416}}
+		}
+		return nil
+	})
+	scope := AIUsageScope{UserID: "u1", Feature: AIFeatureTestGeneration}
+
+	usage := AIUsage{PromptTokens: 50000, TotalTokens: 50000}
+	service.Record(context.Background(), scope, "tencent", "hunyuan-pro", usage, false)
+
+	if len(f.execs) != 2 {
+		t.Fatalf("execs = %d, want ledger and daily inserts", len(f.execs))
+	}
+	ledger, daily := f.execs[0], f.execs[1]
+	if !strings.HasPrefix(ledger.query, "INSERT INTO ai_cost_ledger") || !strings.HasPrefix(daily.query, "INSERT INTO ai_cost_daily") {
+		t.Fatalf("queries = %q, %q", ledger.query, daily.query)
+	}
+
+	// 明细按价格币种记录，汇总换算为预算币种
+	if cost, currency := ledger.args[9], ledger.args[10]; cost != 0.0061728 || currency != "CNY" {
+		t.Errorf("ledger cost = %v %v, want 0.0061728 CNY", cost, currency)
+	}
+	if feature := ledger.args[4]; feature != AIFeatureTestGeneration {
+		t.Errorf("ledger feature = %v, want %s", feature, AIFeatureTestGeneration)
+	}
+	if cost := daily.args[3]; cost != 0.00086419 {
+		t.Errorf("daily cost = %v, want 0.00086419 USD", cost)
+	}
+
+	service.mu.Lock()
+	spent := service.spend["tencent"]
+	service.mu.Unlock()
+	if spent != 0.00086416 {
+		t.Errorf("cached spend = %v, want the daily total 0.00086416", spent)
+	}
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 本地向量化的模型名和维度
+const (
+	LocalEmbeddingModel      = "local-hash-256"
+	localEmbeddingDimensions = 256
+)
+
+// aiEmbeddingBatchSize 单次向量化请求的最大文本数，常见服务的上限在几十到上千之间
+const aiEmbeddingBatchSize = 64
+
+// AI_EMBEDDING_PROVIDER 取值，local 表示始终使用本地向量化
+const AIEmbeddingProviderLocal = "local"
+
+// AIEmbeddingClient 支持文本向量化的AI客户端
+type AIEmbeddingClient interface {
+	Embed(ctx context.Context, model string, inputs []string) (*AIEmbeddingResult, error)
+}
+
+// AIEmbeddingResult 向量化结果，Vectors与输入一一对应
+//
+// 不同模型的向量不能相互比较，保存和检索时需要带上Model
+type AIEmbeddingResult struct {
+	Model   string      `json:"model"`
+	Vectors [][]float32 `json:"vectors"`
+	Usage   AIUsage     `json:"usage"`
+}
+
+// OpenAI兼容的向量化请求和响应
+type aiEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type aiEmbeddingResponse struct {
+	Model string `json:"model"`
+	Data  []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage AIUsage `json:"usage"`
+}
+
+// Embed 调用 /embeddings 接口，model为空时使用服务定义的向量模型
+//
+// 输入较多时按aiEmbeddingBatchSize分批请求，结果按输入顺序合并，用量累加
+func (c *OpenAICompatibleClient) Embed(ctx context.Context, model string, inputs []string) (*AIEmbeddingResult, error) {
+	if model == "" {
+		model = c.spec.EmbeddingModel
+	}
+
+	result := &AIEmbeddingResult{
+		Model:   model,
+		Vectors: make([][]float32, 0, len(inputs)),
+	}
+	for start := 0; start < len(inputs); start += aiEmbeddingBatchSize {
+		end := start + aiEmbeddingBatchSize
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		vectors, usage, err := c.embedBatch(ctx, model, inputs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		result.Vectors = append(result.Vectors, vectors...)
+		result.Usage.PromptTokens += usage.PromptTokens
+		result.Usage.CompletionTokens += usage.CompletionTokens
+		result.Usage.TotalTokens += usage.TotalTokens
+	}
+
+	// 同一模型的向量维度必须一致，否则无法相互比较
+	for i, vector := range result.Vectors {
+		if len(vector) != len(result.Vectors[0]) {
+			return nil, newAIMalformedError(fmt.Errorf("向量维度不一致: 第%d个为%d维，第1个为%d维", i+1, len(vector), len(result.Vectors[0])))
+		}
+	}
+	return result, nil
+}
+
+// embedBatch 发送一批向量化请求，返回与输入一一对应的向量
+func (c *OpenAICompatibleClient) embedBatch(ctx context.Context, model string, inputs []string) ([][]float32, AIUsage, error) {
+	reqBody, err := json.Marshal(aiEmbeddingRequest{Model: model, Input: inputs})
+	if err != nil {
+		return nil, AIUsage{}, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/embeddings", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, AIUsage{}, fmt.Errorf("创建请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	c.setAuthHeader(httpReq)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, AIUsage{}, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, AIUsage{}, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, AIUsage{}, newAIStatusError(resp.StatusCode, string(respBody))
+	}
+
+	var embeddingResp aiEmbeddingResponse
+	if err := json.Unmarshal(respBody, &embeddingResp); err != nil {
+		return nil, AIUsage{}, newAIMalformedError(err)
+	}
+	if len(embeddingResp.Data) != len(inputs) {
+		return nil, AIUsage{}, newAIMalformedError(fmt.Errorf("返回%d个向量，期望%d个", len(embeddingResp.Data), len(inputs)))
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, item := range embeddingResp.Data {
+		if item.Index < 0 || item.Index >= len(inputs) {
+			return nil, AIUsage{}, newAIMalformedError(fmt.Errorf("向量序号越界: %d", item.Index))
+		}
+		if vectors[item.Index] != nil {
+			return nil, AIUsage{}, newAIMalformedError(fmt.Errorf("向量序号重复: %d", item.Index))
+		}
+		if len(item.Embedding) == 0 {
+			return nil, AIUsage{}, newAIMalformedError(fmt.Errorf("第%d个向量为空", item.Index+1))
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, embeddingResp.Usage, nil
+}
+
+// LocalEmbedder 本地确定性向量化（特征哈希），不依赖外部服务
+//
+// 英文按单词和字符三元组、中日韩文字按单字和相邻两字取特征，语义能力有限，
+// 适用于没有配置向量服务的环境和测试
+type LocalEmbedder struct {
+	dimensions int
+}
+
+func NewLocalEmbedder() *LocalEmbedder {
+	return &LocalEmbedder{
+		dimensions: localEmbeddingDimensions,
+	}
+}
+
+func (e *LocalEmbedder) Embed(ctx context.Context, model string, inputs []string) (*AIEmbeddingResult, error) {
+	result := &AIEmbeddingResult{
+		Model:   LocalEmbeddingModel,
+		Vectors: make([][]float32, len(inputs)),
+	}
+	for i, input := range inputs {
+		result.Vectors[i] = e.vector(input)
+	}
+	return result, nil
+}
+
+func (e *LocalEmbedder) vector(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+	for _, feature := range embeddingFeatures(text) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		// 最高位决定符号，减少哈希冲突带来的偏差
+		if sum&0x80000000 != 0 {
+			vector[int(sum%uint32(e.dimensions))]--
+		} else {
+			vector[int(sum%uint32(e.dimensions))]++
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector
+}
+
+// embeddingFeatures 提取文本特征
+func embeddingFeatures(text string) []string {
+	var features []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		features = append(features, "w:"+w)
+		padded := []rune("^" + w + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			features = append(features, "t:"+string(padded[i:i+3]))
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		for i, r := range cjk {
+			features = append(features, "c:"+string(r))
+			if i+1 < len(cjk) {
+				features = append(features, "b:"+string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return features
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// Embed 文本向量化
+//
+// model为空时使用第一个可用的向量服务，指定时只使用该模型以保证向量可比。
+// 没有配置向量服务、配置为本地或指定本地模型时使用本地向量化
+func (m *AIClientManager) Embed(ctx context.Context, model string, inputs []string) (*AIEmbeddingResult, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("向量化的文本不能为空")
+	}
+
+	if model == LocalEmbeddingModel || (model == "" && !m.hasEmbeddingProvider()) {
+		return m.embedder.Embed(ctx, model, inputs)
+	}
+
+	reserved := 0
+	for _, input := range inputs {
+		reserved += estimateTokens(input)
+	}
+	reservation, err := m.reserveQuota(ctx, reserved)
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release(ctx)
+
+	multiErr := &AIMultiError{}
+	for _, client := range m.GetAvailableClients() {
+		serviceType := client.GetServiceType()
+		spec := m.specs[serviceType]
+		embeddingClient, ok := client.(AIEmbeddingClient)
+		if !ok || spec.EmbeddingModel == "" || (model != "" && spec.EmbeddingModel != model) {
+			continue
+		}
+		health := m.health[serviceType]
+		if !health.Allow() {
+			multiErr.Errors = append(multiErr.Errors, newAICircuitOpenError(serviceType))
+			continue
+		}
+
+		start := time.Now()
+		result, err := embeddingClient.Embed(ctx, spec.EmbeddingModel, inputs)
+		if err == nil {
+			health.RecordSuccess(time.Since(start))
+			m.recordEmbeddingUsage(ctx, reservation, serviceType, result, inputs)
+			return result, nil
+		}
+
+		if ctx.Err() != nil {
+			health.Release()
+			return nil, ctx.Err()
+		}
+		health.RecordFailure(time.Since(start), err)
+		multiErr.Errors = append(multiErr.Errors, classifyAIError(serviceType, err, time.Since(start)))
+	}
+
+	if len(multiErr.Errors) == 0 {
+		return nil, fmt.Errorf("没有提供向量模型 %s 的服务", model)
+	}
+	return nil, multiErr
+}
+
+// hasEmbeddingProvider 是否配置了可用的向量服务
+func (m *AIClientManager) hasEmbeddingProvider() bool {
+	if m.config.AIEmbeddingProvider == AIEmbeddingProviderLocal {
+		return false
+	}
+	for serviceType, client := range m.clients {
+		if _, ok := client.(AIEmbeddingClient); ok && m.specs[serviceType].EmbeddingModel != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// recordEmbeddingUsage 记录向量化用量，服务未返回用量时按输入估算
+func (m *AIClientManager) recordEmbeddingUsage(ctx context.Context, reservation *AIQuotaReservation, serviceType AIServiceType, result *AIEmbeddingResult, inputs []string) {
+	if m.usage == nil {
+		return
+	}
+
+	usage := result.Usage
+	estimated := usage.TotalTokens == 0
+	if estimated {
+		for _, input := range inputs {
+			usage.PromptTokens += estimateTokens(input)
+		}
+		usage.TotalTokens = usage.PromptTokens
+	}
+	reservation.Settle(ctx, int64(usage.TotalTokens))
+	m.usage.Record(ctx, AIUsageScopeFrom(ctx), serviceType, result.Model, usage, estimated)
+	if m.costs != nil {
+		m.costs.Record(ctx, AIUsageScopeFrom(ctx), serviceType, result.Model, usage, estimated)
+	}
+}
+
+// cosineSimilarity 余弦相似度，维度不同或存在零向量时返回0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
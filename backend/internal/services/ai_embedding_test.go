@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+// embeddingServer 模拟OpenAI兼容的 /embeddings 接口
+//
+// 每个输入返回 [批次序号, 输入序号] 两维向量，respond可以改写响应内容
+type embeddingServer struct {
+	mu      sync.Mutex
+	batches [][]string
+	respond func(batch int, resp *aiEmbeddingResponse)
+}
+
+func newEmbeddingTestClient(t *testing.T, s *embeddingServer) *OpenAICompatibleClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		var req aiEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		batch := len(s.batches)
+		s.batches = append(s.batches, req.Input)
+		s.mu.Unlock()
+
+		resp := aiEmbeddingResponse{Model: req.Model}
+		// 倒序返回，验证按index还原顺序
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{Index: i, Embedding: []float32{float32(batch), float32(i)}})
+		}
+		resp.Usage = AIUsage{PromptTokens: len(req.Input), TotalTokens: len(req.Input)}
+		if s.respond != nil {
+			s.respond(batch, &resp)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewOpenAICompatibleClient(&config.Config{}, AIProviderSpec{
+		Name:           "embed-test",
+		BaseURL:        server.URL,
+		AuthStyle:      AIAuthNone,
+		EmbeddingModel: "embed-model",
+	})
+}
+
+func embeddingInputs(n int) []string {
+	inputs := make([]string, n)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("text-%d", i)
+	}
+	return inputs
+}
+
+func TestOpenAICompatibleEmbedBatching(t *testing.T) {
+	s := &embeddingServer{}
+	client := newEmbeddingTestClient(t, s)
+	n := aiEmbeddingBatchSize*2 + 5
+
+	result, err := client.Embed(context.Background(), "", embeddingInputs(n))
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+
+	wantSizes := []int{aiEmbeddingBatchSize, aiEmbeddingBatchSize, 5}
+	if len(s.batches) != len(wantSizes) {
+		t.Fatalf("requests = %d, want %d", len(s.batches), len(wantSizes))
+	}
+	for i, size := range wantSizes {
+		if len(s.batches[i]) != size {
+			t.Errorf("batch %d size = %d, want %d", i, len(s.batches[i]), size)
+		}
+	}
+	if first := s.batches[1][0]; first != fmt.Sprintf("text-%d", aiEmbeddingBatchSize) {
+		t.Errorf("second batch starts with %q", first)
+	}
+
+	if result.Model != "embed-model" {
+		t.Errorf("model = %q, want embed-model", result.Model)
+	}
+	if len(result.Vectors) != n {
+		t.Fatalf("vectors = %d, want %d", len(result.Vectors), n)
+	}
+	for i, vector := range result.Vectors {
+		batch, index := i/aiEmbeddingBatchSize, i%aiEmbeddingBatchSize
+		if vector[0] != float32(batch) || vector[1] != float32(index) {
+			t.Errorf("vector %d = %v, want [%d %d]", i, vector, batch, index)
+		}
+	}
+	if result.Usage.TotalTokens != n || result.Usage.PromptTokens != n {
+		t.Errorf("usage = %+v, want %d tokens summed across batches", result.Usage, n)
+	}
+}
+
+func TestOpenAICompatibleEmbedMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  int
+		respond func(batch int, resp *aiEmbeddingResponse)
+		wantErr string
+	}{
+		{
+			name:   "dimension mismatch within a batch",
+			inputs: 3,
+			respond: func(batch int, resp *aiEmbeddingResponse) {
+				resp.Data[0].Embedding = []float32{1, 2, 3}
+			},
+			wantErr: "向量维度不一致",
+		},
+		{
+			name:   "dimension mismatch across batches",
+			inputs: aiEmbeddingBatchSize + 1,
+			respond: func(batch int, resp *aiEmbeddingResponse) {
+				if batch == 1 {
+					resp.Data[0].Embedding = []float32{1}
+				}
+			},
+			wantErr: "向量维度不一致",
+		},
+		{
+			name:   "missing vector",
+			inputs: 3,
+			respond: func(batch int, resp *aiEmbeddingResponse) {
+				resp.Data = resp.Data[1:]
+			},
+			wantErr: "返回2个向量，期望3个",
+		},
+		{
+			name:   "duplicate index",
+			inputs: 2,
+			respond: func(batch int, resp *aiEmbeddingResponse) {
+				resp.Data[0].Index = resp.Data[1].Index
+			},
+			wantErr: "向量序号重复",
+		},
+		{
+			name:   "index out of range",
+			inputs: 2,
+			respond: func(batch int, resp *aiEmbeddingResponse) {
+				resp.Data[0].Index = 5
+			},
+			wantErr: "向量序号越界",
+		},
+		{
+			name:   "empty vector",
+			inputs: 2,
+			respond: func(batch int, resp *aiEmbeddingResponse) {
+				resp.Data[0].Embedding = nil
+			},
+			wantErr: "向量为空",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newEmbeddingTestClient(t, &embeddingServer{respond: tt.respond})
+
+			_, err := client.Embed(context.Background(), "", embeddingInputs(tt.inputs))
+			var providerErr *AIProviderError
+			if !errors.As(err, &providerErr) || providerErr.Kind != AIErrorMalformed {
+				t.Fatalf("Embed() error = %v, want malformed", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Embed() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalEmbedderDimensions(t *testing.T) {
+	result, err := NewLocalEmbedder().Embed(context.Background(), "", []string{"登录失败", "login failed", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, vector := range result.Vectors {
+		if len(vector) != localEmbeddingDimensions {
+			t.Errorf("vector %d dimensions = %d, want %d", i, len(vector), localEmbeddingDimensions)
+		}
+	}
+	if sim := cosineSimilarity(result.Vectors[0], result.Vectors[0]); sim < 0.999 {
+		t.Errorf("self similarity = %f, want 1", sim)
+	}
+	if sim := cosineSimilarity(result.Vectors[0], []float32{1, 0}); sim != 0 {
+		t.Errorf("similarity across dimensions = %f, want 0", sim)
+	}
+	if sim := cosineSimilarity(result.Vectors[0], result.Vectors[2]); sim != 0 {
+		t.Errorf("similarity with the zero vector = %f, want 0", sim)
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNoAIService 没有配置或没有可调度的AI服务
+var ErrNoAIService = errors.New("没有可用的AI服务")
+
+// AIErrorKind AI调用失败的类型
+type AIErrorKind string
+
+const (
+	AIErrorRateLimited AIErrorKind = "rate_limited"
+	AIErrorAuth        AIErrorKind = "auth"
+	AIErrorTimeout     AIErrorKind = "timeout"
+	AIErrorMalformed   AIErrorKind = "malformed_response"
+	AIErrorBadRequest  AIErrorKind = "bad_request"
+	AIErrorUpstream    AIErrorKind = "upstream"
+	AIErrorNetwork     AIErrorKind = "network"
+	AIErrorCircuitOpen AIErrorKind = "circuit_open"
+	AIErrorUnsupported AIErrorKind = "unsupported"
+	AIErrorUnknown     AIErrorKind = "unknown"
+)
+
+// 错误信息中保留的上游响应体长度
+const maxAIErrorBody = 512
+
+// AIProviderError 单个AI服务的调用失败信息
+type AIProviderError struct {
+	Service    AIServiceType `json:"service"`
+	Kind       AIErrorKind   `json:"kind"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Code       string        `json:"code,omitempty"`
+	LatencyMs  int64         `json:"latency_ms"`
+	Retryable  bool          `json:"retryable"`
+	Message    string        `json:"message"`
+	Err        error         `json:"-"`
+}
+
+func (e *AIProviderError) Error() string {
+	if e.Service == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Service, e.Message)
+}
+
+func (e *AIProviderError) Unwrap() error {
+	return e.Err
+}
+
+// AIMultiError 故障转移过程中每个服务的失败信息
+type AIMultiError struct {
+	Errors []*AIProviderError `json:"providers"`
+}
+
+func (e *AIMultiError) Error() string {
+	if len(e.Errors) == 0 {
+		return "所有AI服务都不可用"
+	}
+
+	parts := make([]string, 0, len(e.Errors))
+	for _, providerErr := range e.Errors {
+		part := fmt.Sprintf("%s(%s", providerErr.Service, providerErr.Kind)
+		if providerErr.StatusCode != 0 {
+			part += fmt.Sprintf(" %d", providerErr.StatusCode)
+		}
+		parts = append(parts, part+")")
+	}
+	return "所有AI服务都不可用: " + strings.Join(parts, ", ")
+}
+
+func (e *AIMultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, providerErr := range e.Errors {
+		errs[i] = providerErr
+	}
+	return errs
+}
+
+// Retryable 是否有服务稍后重试可能成功
+func (e *AIMultiError) Retryable() bool {
+	for _, providerErr := range e.Errors {
+		if providerErr.Retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// AllOfKind 是否所有服务都因同一原因失败
+func (e *AIMultiError) AllOfKind(kind AIErrorKind) bool {
+	if len(e.Errors) == 0 {
+		return false
+	}
+	for _, providerErr := range e.Errors {
+		if providerErr.Kind != kind {
+			return false
+		}
+	}
+	return true
+}
+
+// newAIStatusError 根据上游HTTP状态码创建错误
+func newAIStatusError(statusCode int, body string) error {
+	if len(body) > maxAIErrorBody {
+		body = body[:maxAIErrorBody] + "..."
+	}
+
+	kind := AIErrorUpstream
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		kind = AIErrorRateLimited
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		kind = AIErrorAuth
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		kind = AIErrorTimeout
+	case statusCode >= 400 && statusCode < 500:
+		kind = AIErrorBadRequest
+	}
+
+	return &AIProviderError{
+		Kind:       kind,
+		StatusCode: statusCode,
+		Retryable:  isRetryableAIError(kind),
+		Message:    fmt.Sprintf("API请求失败: %d %s", statusCode, body),
+	}
+}
+
+// newAIMalformedError 创建响应格式错误
+func newAIMalformedError(err error) error {
+	return &AIProviderError{
+		Kind:      AIErrorMalformed,
+		Retryable: true,
+		Message:   fmt.Sprintf("解析响应失败: %v", err),
+		Err:       err,
+	}
+}
+
+// newAIVendorError 根据服务返回的业务错误码创建错误
+func newAIVendorError(kind AIErrorKind, code, message string) error {
+	return &AIProviderError{
+		Kind:      kind,
+		Code:      code,
+		Retryable: isRetryableAIError(kind),
+		Message:   fmt.Sprintf("API错误 (%s): %s", code, message),
+	}
+}
+
+// classifyAIError 将客户端返回的错误归类并补充服务和耗时信息
+func classifyAIError(service AIServiceType, err error, latency time.Duration) *AIProviderError {
+	var providerErr *AIProviderError
+	if errors.As(err, &providerErr) {
+		classified := *providerErr
+		classified.Service = service
+		classified.LatencyMs = latency.Milliseconds()
+		return &classified
+	}
+
+	kind := AIErrorUnknown
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		kind = AIErrorTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			kind = AIErrorTimeout
+		} else {
+			kind = AIErrorNetwork
+		}
+	}
+
+	return &AIProviderError{
+		Service:   service,
+		Kind:      kind,
+		LatencyMs: latency.Milliseconds(),
+		Retryable: isRetryableAIError(kind),
+		Message:   err.Error(),
+		Err:       err,
+	}
+}
+
+// newAICircuitOpenError 服务已熔断，本次未尝试
+func newAICircuitOpenError(service AIServiceType) *AIProviderError {
+	return &AIProviderError{
+		Service:   service,
+		Kind:      AIErrorCircuitOpen,
+		Retryable: true,
+		Message:   "服务已熔断，跳过调用",
+	}
+}
+
+// newAIUnsupportedError 服务不支持本次请求需要的能力，本次未尝试
+func newAIUnsupportedError(service AIServiceType, message string) *AIProviderError {
+	return &AIProviderError{
+		Service: service,
+		Kind:    AIErrorUnsupported,
+		Message: message,
+	}
+}
+
+func isRetryableAIError(kind AIErrorKind) bool {
+	switch kind {
+	case AIErrorRateLimited, AIErrorTimeout, AIErrorMalformed, AIErrorUpstream, AIErrorNetwork, AIErrorCircuitOpen:
+		return true
+	default:
+		return false
+	}
+}
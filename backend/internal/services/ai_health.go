@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakerConfig 熔断器参数
+type CircuitBreakerConfig struct {
+	FailureThreshold   int           // 连续失败多少次后熔断
+	ErrorRateThreshold float64       // 滚动窗口错误率达到多少后熔断
+	MinRequests        int           // 计算错误率所需的最少样本数
+	WindowSize         int           // 滚动窗口大小
+	OpenTimeout        time.Duration // 熔断后多久进入半开状态
+}
+
+// 调用结果样本
+type callOutcome struct {
+	success bool
+	latency time.Duration
+}
+
+// ProviderHealth 单个AI服务的熔断器和滚动统计
+type ProviderHealth struct {
+	mu sync.Mutex
+
+	service AIServiceType
+	cfg     CircuitBreakerConfig
+
+	state               CircuitState
+	openedAt            time.Time
+	probing             bool
+	consecutiveFailures int
+
+	window []callOutcome
+	next   int
+	count  int
+
+	totalRequests int64
+	totalFailures int64
+	lastError     string
+	lastErrorAt   time.Time
+}
+
+// ProviderHealthSnapshot 健康状态快照
+type ProviderHealthSnapshot struct {
+	Service             AIServiceType `json:"service"`
+	State               CircuitState  `json:"state"`
+	ErrorRate           float64       `json:"error_rate"`
+	AvgLatencyMs        int64         `json:"avg_latency_ms"`
+	SampleSize          int           `json:"sample_size"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	TotalRequests       int64         `json:"total_requests"`
+	TotalFailures       int64         `json:"total_failures"`
+	LastError           string        `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time    `json:"last_error_at,omitempty"`
+	RetryAt             *time.Time    `json:"retry_at,omitempty"`
+	Score               float64       `json:"score"`
+}
+
+// NewProviderHealth 创建服务健康状态
+func NewProviderHealth(service AIServiceType, cfg CircuitBreakerConfig) *ProviderHealth {
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = 50
+	}
+	return &ProviderHealth{
+		service: service,
+		cfg:     cfg,
+		state:   CircuitClosed,
+		window:  make([]callOutcome, cfg.WindowSize),
+	}
+}
+
+// Ready 是否可以参与调度（不占用半开探测名额）
+func (h *ProviderHealth) Ready() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.state {
+	case CircuitOpen:
+		return time.Since(h.openedAt) >= h.cfg.OpenTimeout
+	case CircuitHalfOpen:
+		return !h.probing
+	default:
+		return true
+	}
+}
+
+// Allow 是否允许本次调用；半开状态下只放行一个探测请求
+func (h *ProviderHealth) Allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch h.state {
+	case CircuitOpen:
+		if time.Since(h.openedAt) < h.cfg.OpenTimeout {
+			return false
+		}
+		h.state = CircuitHalfOpen
+		h.probing = true
+		return true
+	case CircuitHalfOpen:
+		if h.probing {
+			return false
+		}
+		h.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess 记录一次成功调用
+func (h *ProviderHealth) RecordSuccess(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.record(callOutcome{success: true, latency: latency})
+	h.consecutiveFailures = 0
+	if h.state == CircuitHalfOpen {
+		h.state = CircuitClosed
+	}
+	h.probing = false
+}
+
+// RecordFailure 记录一次失败调用，必要时打开熔断器
+func (h *ProviderHealth) RecordFailure(latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.record(callOutcome{success: false, latency: latency})
+	h.totalFailures++
+	h.consecutiveFailures++
+	if err != nil {
+		h.lastError = err.Error()
+	}
+	h.lastErrorAt = time.Now()
+
+	switch h.state {
+	case CircuitHalfOpen:
+		// 探测失败，重新熔断
+		h.trip()
+	case CircuitClosed:
+		errorRate, _ := h.stats()
+		if (h.cfg.FailureThreshold > 0 && h.consecutiveFailures >= h.cfg.FailureThreshold) ||
+			(h.cfg.ErrorRateThreshold > 0 && h.count >= h.cfg.MinRequests && errorRate >= h.cfg.ErrorRateThreshold) {
+			h.trip()
+		}
+	}
+	h.probing = false
+}
+
+// Release 放弃本次调用（如调用方取消），归还半开探测名额
+func (h *ProviderHealth) Release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probing = false
+}
+
+// Snapshot 获取当前状态快照
+func (h *ProviderHealth) Snapshot(priority int) ProviderHealthSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	errorRate, avgLatency := h.stats()
+	snapshot := ProviderHealthSnapshot{
+		Service:             h.service,
+		State:               h.state,
+		ErrorRate:           errorRate,
+		AvgLatencyMs:        avgLatency.Milliseconds(),
+		SampleSize:          h.count,
+		ConsecutiveFailures: h.consecutiveFailures,
+		TotalRequests:       h.totalRequests,
+		TotalFailures:       h.totalFailures,
+		LastError:           h.lastError,
+		Score:               h.score(priority),
+	}
+	if !h.lastErrorAt.IsZero() {
+		lastErrorAt := h.lastErrorAt
+		snapshot.LastErrorAt = &lastErrorAt
+	}
+	if h.state == CircuitOpen {
+		retryAt := h.openedAt.Add(h.cfg.OpenTimeout)
+		snapshot.RetryAt = &retryAt
+	}
+	return snapshot
+}
+
+// Score 调度分数，越小越优先
+func (h *ProviderHealth) Score(priority int) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.score(priority)
+}
+
+// 静态优先级加上错误率和延迟惩罚：
+// 错误率每10%后移一位，平均延迟每5秒后移一位
+func (h *ProviderHealth) score(priority int) float64 {
+	errorRate, avgLatency := h.stats()
+	return float64(priority) + errorRate*10 + avgLatency.Seconds()/5
+}
+
+func (h *ProviderHealth) trip() {
+	h.state = CircuitOpen
+	h.openedAt = time.Now()
+}
+
+func (h *ProviderHealth) record(outcome callOutcome) {
+	h.totalRequests++
+	h.window[h.next] = outcome
+	h.next = (h.next + 1) % len(h.window)
+	if h.count < len(h.window) {
+		h.count++
+	}
+}
+
+// 滚动窗口内的错误率和平均延迟
+func (h *ProviderHealth) stats() (float64, time.Duration) {
+	if h.count == 0 {
+		return 0, 0
+	}
+
+	var failures int
+	var totalLatency time.Duration
+	for i := 0; i < h.count; i++ {
+		outcome := h.window[i]
+		if !outcome.success {
+			failures++
+		}
+		totalLatency += outcome.latency
+	}
+
+	return float64(failures) / float64(h.count), totalLatency / time.Duration(h.count)
+}
+
+// sortClientsByHealth 按健康分数对客户端排序，分数相同时保持静态优先级
+func sortClientsByHealth(clients []AIClient, scores map[AIServiceType]float64) {
+	sort.SliceStable(clients, func(i, j int) bool {
+		return scores[clients[i].GetServiceType()] < scores[clients[j].GetServiceType()]
+	})
+}
+
+// monitorStream 转发流式片段，并在流结束时记录调用结果；流结束或中断时都会调用onDone，completed表示是否正常结束
+func monitorStream(ctx context.Context, stream <-chan AIStreamChunk, health *ProviderHealth, start time.Time, onDone func(completed bool, model, content string, usage *AIUsage)) <-chan AIStreamChunk {
+	out := make(chan AIStreamChunk)
+	go func() {
+		defer close(out)
+
+		var model string
+		var content strings.Builder
+		var usage *AIUsage
+		completed := false
+		if onDone != nil {
+			defer func() {
+				onDone(completed, model, content.String(), usage)
+			}()
+		}
+		for chunk := range stream {
+			if chunk.Err != nil {
+				if ctx.Err() != nil {
+					health.Release()
+				} else {
+					health.RecordFailure(time.Since(start), chunk.Err)
+				}
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				health.Release()
+				// 排空上游，避免其goroutine阻塞
+				for range stream {
+				}
+				return
+			}
+			if chunk.Err != nil {
+				return
+			}
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			content.WriteString(chunk.Delta)
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+		}
+		health.RecordSuccess(time.Since(start))
+		completed = true
+	}()
+	return out
+}
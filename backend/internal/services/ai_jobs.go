@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JobTypeAIGenerate 异步AI生成任务
+const JobTypeAIGenerate = "ai.generate"
+
+// 单次AI生成任务的超时时间
+const aiGenerateJobTimeout = 5 * time.Minute
+
+// AIGenerateJob 异步AI生成任务的参数
+//
+// 入队时从ctx中记录调用方、功能模块和语言，worker执行时恢复，保证计量、配额和提示词选择与同步调用一致
+type AIGenerateJob struct {
+	Request        AIRequest     `json:"request"`
+	Policy         AIRoutePolicy `json:"policy,omitempty"`
+	ConversationID string        `json:"conversation_id,omitempty"`
+	Tools          []string      `json:"tools,omitempty"`
+	UserID         string        `json:"user_id,omitempty"`
+	ClientIP       string        `json:"client_ip,omitempty"`
+	Feature        string        `json:"feature,omitempty"`
+	Locale         string        `json:"locale,omitempty"`
+}
+
+// NewAIGenerateJob 根据请求和ctx中的调用信息创建任务参数
+func NewAIGenerateJob(ctx context.Context, req *AIRequest, conversationID string, tools []string) *AIGenerateJob {
+	scope := AIUsageScopeFrom(ctx)
+	request := *req
+	request.Stream = false
+	return &AIGenerateJob{
+		Request:        request,
+		Policy:         req.Policy,
+		ConversationID: conversationID,
+		Tools:          tools,
+		UserID:         scope.UserID,
+		ClientIP:       scope.ClientIP,
+		Feature:        scope.Feature,
+		Locale:         AILocaleFrom(ctx),
+	}
+}
+
+// AIGenerateJobResult 异步AI生成任务的结果
+type AIGenerateJobResult struct {
+	ID             string             `json:"id"`
+	ConversationID string             `json:"conversation_id,omitempty"`
+	Model          string             `json:"model"`
+	Content        string             `json:"content"`
+	Usage          AIUsage            `json:"usage"`
+	Cache          string             `json:"cache,omitempty"`
+	ToolCalls      []AIToolInvocation `json:"tool_calls,omitempty"`
+}
+
+// RegisterAIJobs 注册异步AI生成任务
+func RegisterAIJobs(jobs *JobQueue, ai *AIClientManager, conversations *ConversationService, tools *AIToolRegistry) {
+	jobs.Register(JobTypeAIGenerate, func(ctx context.Context, job *Job, progress JobProgress) (interface{}, error) {
+		var payload AIGenerateJob
+		if err := job.DecodePayload(&payload); err != nil {
+			return nil, err
+		}
+
+		ctx = WithAIUsageScope(ctx, payload.UserID, payload.ClientIP)
+		ctx = WithAIFeature(ctx, payload.Feature)
+		ctx = WithAILocale(ctx, payload.Locale)
+
+		req := payload.Request
+		req.Policy = payload.Policy
+
+		var registry *AIToolRegistry
+		if len(payload.Tools) > 0 {
+			var err error
+			if registry, err = tools.Subset(payload.Tools); err != nil {
+				return nil, PermanentJobError(err)
+			}
+		}
+
+		progress(10, "正在生成")
+		var resp *AIResponse
+		var invocations []AIToolInvocation
+		var err error
+		switch {
+		case payload.ConversationID != "":
+			resp, invocations, err = conversations.Send(ctx, payload.UserID, payload.ConversationID, &req, registry)
+		case registry != nil:
+			resp, invocations, err = ai.GenerateWithTools(ctx, &req, registry)
+		default:
+			resp, err = ai.GenerateText(ctx, &req)
+		}
+		if err != nil {
+			return nil, aiJobError(err)
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("LLM服务返回空响应")
+		}
+
+		return &AIGenerateJobResult{
+			ID:             resp.ID,
+			ConversationID: payload.ConversationID,
+			Model:          resp.Model,
+			Content:        resp.Choices[0].Message.Content,
+			Usage:          resp.Usage,
+			Cache:          resp.Cache,
+			ToolCalls:      invocations,
+		}, nil
+	}, JobOptions{Timeout: aiGenerateJobTimeout})
+}
+
+// aiJobError 只有服务暂时不可用和超时才重试，配额、审核、路由等错误重试也不会成功
+func aiJobError(err error) error {
+	var multiErr *AIMultiError
+	if errors.As(err, &multiErr) && multiErr.Retryable() {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return PermanentJobError(err)
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"qa-toolbox-backend/internal/config"
+)
+
+// AIServiceMock 内置的模拟AI服务
+const AIServiceMock AIServiceType = "mock"
+
+// AI_MOCK_MODE 取值
+const (
+	AIMockModeFallback = "fallback" // 作为其他服务都失败时的备选
+	AIMockModeOnly     = "only"     // 只使用模拟服务，不访问网络
+)
+
+// 流式输出时每个片段的字数
+const mockStreamChunkRunes = 8
+
+// MockAIFixture 模拟服务的一条脚本化响应
+//
+// 匹配顺序：PromptHash精确匹配优先，其次按文件顺序匹配Match正则，都不匹配时使用默认响应
+type MockAIFixture struct {
+	Name         string       `yaml:"name"`
+	Service      string       `yaml:"service"`     // 只对该名称的模拟服务生效，为空时对所有模拟服务生效
+	PromptHash   string       `yaml:"prompt_hash"` // 见 MockPromptHash
+	Match        string       `yaml:"match"`       // 匹配全部消息内容的正则
+	Model        string       `yaml:"model"`       // 只匹配请求该模型的调用
+	Content      string       `yaml:"content"`
+	ToolCalls    []AIToolCall `yaml:"tool_calls"`
+	FinishReason string       `yaml:"finish_reason"`
+	LatencyMs    int          `yaml:"latency_ms"` // 为0时使用 AI_MOCK_LATENCY_MS
+	Error        *MockAIError `yaml:"error"`
+	FailTimes    int          `yaml:"fail_times"` // 大于0时只有前N次匹配返回Error，之后正常响应
+
+	re    *regexp.Regexp
+	calls int
+}
+
+// MockAIError 注入的错误
+type MockAIError struct {
+	Kind    string `yaml:"kind"`   // network、malformed，为空时按Status返回上游错误
+	Status  int    `yaml:"status"` // 上游HTTP状态码，默认500
+	Message string `yaml:"message"`
+}
+
+type mockAIFixturesFile struct {
+	Default  *MockAIFixture  `yaml:"default"`
+	Fixtures []MockAIFixture `yaml:"fixtures"`
+}
+
+// MockAIClient 按脚本化响应回复的模拟AI服务，不访问网络，用于离线开发和测试
+//
+// 没有匹配的脚本时回复包含提示词哈希的确定性内容，并在日志中输出哈希，方便补充脚本
+type MockAIClient struct {
+	spec      AIProviderSpec
+	latency   time.Duration
+	errorRate float64
+
+	mu       sync.Mutex
+	fixtures []*MockAIFixture
+	fallback *MockAIFixture
+	calls    int
+}
+
+func NewMockAIClient(cfg *config.Config, spec AIProviderSpec) *MockAIClient {
+	client := &MockAIClient{
+		spec:      spec,
+		latency:   time.Duration(cfg.AIMockLatencyMs) * time.Millisecond,
+		errorRate: cfg.AIMockErrorRate,
+	}
+	if cfg.AIMockFixturesFile != "" {
+		if err := client.LoadFixtures(cfg.AIMockFixturesFile); err != nil {
+			log.Printf("加载模拟AI服务脚本失败: %v", err)
+		}
+	}
+	return client
+}
+
+// LoadFixtures 从YAML文件加载脚本，替换已有脚本
+func (c *MockAIClient) LoadFixtures(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取脚本文件失败: %w", err)
+	}
+
+	var file mockAIFixturesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析脚本文件失败: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fixtures = nil
+	c.fallback = file.Default
+	for i := range file.Fixtures {
+		if err := c.addFixture(file.Fixtures[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddFixture 添加一条脚本，排在已有脚本之后
+func (c *MockAIClient) AddFixture(fixture MockAIFixture) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addFixture(fixture)
+}
+
+func (c *MockAIClient) addFixture(fixture MockAIFixture) error {
+	if fixture.Service != "" && fixture.Service != string(c.spec.Name) {
+		return nil
+	}
+	if fixture.Match != "" {
+		re, err := regexp.Compile(fixture.Match)
+		if err != nil {
+			return fmt.Errorf("脚本 %s 的正则不合法: %w", fixture.Name, err)
+		}
+		fixture.re = re
+	}
+	c.fixtures = append(c.fixtures, &fixture)
+	return nil
+}
+
+// Calls 已处理的请求数
+func (c *MockAIClient) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func (c *MockAIClient) GetServiceType() AIServiceType {
+	return c.spec.Name
+}
+
+func (c *MockAIClient) IsAvailable() bool {
+	return true
+}
+
+func (c *MockAIClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
+	fixture, hash, err := c.respond(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	prompt := mockPromptText(req.Messages)
+	resp := newAIResponse("mock-"+hash[:16], c.model(req), fixture.Content, fixture.FinishReason, AIUsage{})
+	if len(fixture.ToolCalls) > 0 {
+		resp.Choices[0].Message.ToolCalls = fixture.ToolCalls
+		if fixture.FinishReason == "" {
+			resp.Choices[0].FinishReason = "tool_calls"
+		}
+	}
+	resp.Usage.PromptTokens = estimateTokens(prompt)
+	resp.Usage.CompletionTokens = estimateTokens(fixture.Content)
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens + resp.Usage.CompletionTokens
+	return resp, nil
+}
+
+func (c *MockAIClient) GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error) {
+	fixture, hash, err := c.respond(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	id := "mock-" + hash[:16]
+	model := c.model(req)
+	usage := AIUsage{
+		PromptTokens:     estimateTokens(mockPromptText(req.Messages)),
+		CompletionTokens: estimateTokens(fixture.Content),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	finishReason := fixture.FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	content := []rune(fixture.Content)
+	chunks := make(chan AIStreamChunk)
+	go func() {
+		defer close(chunks)
+		send := func(chunk AIStreamChunk) bool {
+			select {
+			case chunks <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for start := 0; start < len(content); start += mockStreamChunkRunes {
+			end := start + mockStreamChunkRunes
+			if end > len(content) {
+				end = len(content)
+			}
+			if !send(AIStreamChunk{ID: id, Model: model, Delta: string(content[start:end])}) {
+				return
+			}
+		}
+		send(AIStreamChunk{ID: id, Model: model, FinishReason: finishReason, Usage: &usage})
+	}()
+
+	return chunks, nil
+}
+
+// respond 选出本次请求的脚本，并按脚本注入延迟和错误
+func (c *MockAIClient) respond(ctx context.Context, req *AIRequest) (*MockAIFixture, string, error) {
+	hash := MockPromptHash(req.Messages)
+
+	c.mu.Lock()
+	c.calls++
+	fixture := c.match(req, hash)
+	fail := false
+	if fixture.Error != nil {
+		fixture.calls++
+		fail = fixture.FailTimes <= 0 || fixture.calls <= fixture.FailTimes
+	}
+	c.mu.Unlock()
+
+	latency := c.latency
+	if fixture.LatencyMs > 0 {
+		latency = time.Duration(fixture.LatencyMs) * time.Millisecond
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, hash, ctx.Err()
+		}
+	}
+
+	if fail {
+		return nil, hash, fixture.Error.err()
+	}
+	if c.errorRate > 0 && rand.Float64() < c.errorRate {
+		return nil, hash, newAIStatusError(503, "模拟服务随机注入的错误")
+	}
+	return fixture, hash, nil
+}
+
+// match 调用时需持有锁
+func (c *MockAIClient) match(req *AIRequest, hash string) *MockAIFixture {
+	for _, fixture := range c.fixtures {
+		if fixture.PromptHash == hash && fixture.matchesModel(req.Model) {
+			return fixture
+		}
+	}
+
+	prompt := mockPromptText(req.Messages)
+	for _, fixture := range c.fixtures {
+		if fixture.re != nil && fixture.re.MatchString(prompt) && fixture.matchesModel(req.Model) {
+			return fixture
+		}
+	}
+
+	log.Printf("模拟AI服务 %s 没有匹配的脚本，prompt_hash: %s", c.spec.Name, hash)
+	if c.fallback != nil {
+		return c.fallback
+	}
+	return &MockAIFixture{Content: "模拟响应 " + hash[:12]}
+}
+
+func (f *MockAIFixture) matchesModel(model string) bool {
+	return f.Model == "" || f.Model == model
+}
+
+func (c *MockAIClient) model(req *AIRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	if c.spec.DefaultModel != "" {
+		return c.spec.DefaultModel
+	}
+	return string(c.spec.Name)
+}
+
+func (e *MockAIError) err() error {
+	message := e.Message
+	if message == "" {
+		message = "模拟服务注入的错误"
+	}
+	switch e.Kind {
+	case string(AIErrorNetwork):
+		return &AIProviderError{
+			Kind:      AIErrorNetwork,
+			Retryable: true,
+			Message:   fmt.Sprintf("发送请求失败: %s", message),
+		}
+	case "malformed", string(AIErrorMalformed):
+		return newAIMalformedError(fmt.Errorf("%s", message))
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = 500
+	}
+	return newAIStatusError(status, message)
+}
+
+// MockPromptHash 请求消息的哈希，用作脚本的prompt_hash
+//
+// 依次拼接每条消息的 role、换行、content、换行后取SHA-256的十六进制
+func MockPromptHash(messages []AIMessage) string {
+	h := sha256.New()
+	for _, msg := range messages {
+		h.Write([]byte(msg.Role + "\n" + msg.Content + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// mockPromptText 正则匹配的文本，每条消息一行 "role: content"
+func mockPromptText(messages []AIMessage) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		b.WriteString(msg.Role + ": " + msg.Content + "\n")
+	}
+	return b.String()
+}
+
+// applyAIMockMode 按 AI_MOCK_MODE 注册模拟服务，only 模式下移除其他服务
+func applyAIMockMode(cfg *config.Config, specs []AIProviderSpec) []AIProviderSpec {
+	switch cfg.AIMockMode {
+	case AIMockModeFallback, AIMockModeOnly:
+	case "":
+		return specs
+	default:
+		log.Printf("未知的AI_MOCK_MODE: %s，不启用模拟AI服务", cfg.AIMockMode)
+		return specs
+	}
+
+	hasMock := false
+	for _, spec := range specs {
+		if spec.Name == AIServiceMock {
+			hasMock = true
+			break
+		}
+	}
+	if !hasMock {
+		specs = append(specs, AIProviderSpec{
+			Name:         AIServiceMock,
+			Protocol:     AIProtocolMock,
+			DefaultModel: "mock-model",
+			Priority:     1000,
+			AuthStyle:    AIAuthNone,
+			Description:  "模拟AI服务，按脚本化响应回复",
+		})
+	}
+
+	if cfg.AIMockMode == AIMockModeFallback {
+		return specs
+	}
+	mocks := specs[:0]
+	for _, spec := range specs {
+		if spec.Protocol == AIProtocolMock {
+			mocks = append(mocks, spec)
+		}
+	}
+	return mocks
+}
@@ -0,0 +1,616 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+	"qa-toolbox-backend/internal/database"
+)
+
+// 内置提示词模板
+//
+//go:embed prompts/*.yaml
+var builtinPromptFiles embed.FS
+
+// 提示词模板名称
+const (
+	PromptTestGeneration      = "test-generation"
+	PromptTestCaseList        = "test-case-list"
+	PromptCodeAnalysis        = "code-analysis"
+	PromptContentGeneration   = "content-generation"
+	PromptConversationSummary = "conversation-summary"
+	PromptModerationClassify  = "moderation-classify"
+)
+
+// 找不到请求语言的模板时使用的语言
+const defaultPromptLocale = "zh"
+
+// 模板来源，优先级 db > file > builtin
+const (
+	PromptSourceBuiltin = "builtin"
+	PromptSourceFile    = "file"
+	PromptSourceDB      = "db"
+)
+
+// PromptTemplate 提示词模板的一个版本
+//
+// 同一名称和语言下可以有多个版本，按Weight分流做A/B测试，Weight为0的版本不参与分流
+type PromptTemplate struct {
+	Name        string   `yaml:"name" json:"name"`
+	Version     string   `yaml:"version" json:"version"`
+	Locale      string   `yaml:"locale" json:"locale"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Model       string   `yaml:"model" json:"model,omitempty"` // 模型提示，服务不支持时使用其默认模型
+	Temperature float64  `yaml:"temperature" json:"temperature"`
+	MaxTokens   int      `yaml:"max_tokens" json:"max_tokens"`
+	Variables   []string `yaml:"variables" json:"variables"`
+	System      string   `yaml:"system" json:"system"`
+	User        string   `yaml:"user" json:"user"`
+	Weight      int      `yaml:"weight" json:"weight"`
+	Source      string   `yaml:"-" json:"source"`
+
+	system *template.Template
+	user   *template.Template
+}
+
+// PromptRef 本次生成使用的模板版本，随响应返回
+type PromptRef struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Locale  string `json:"locale"`
+}
+
+// 提示词文件格式
+type promptTemplatesFile struct {
+	Templates []*PromptTemplate `yaml:"templates"`
+}
+
+// compile 解析模板文本
+func (t *PromptTemplate) compile() error {
+	if t.Name == "" || t.Version == "" || t.Locale == "" {
+		return fmt.Errorf("提示词模板缺少name、version或locale")
+	}
+	if strings.TrimSpace(t.User) == "" {
+		return fmt.Errorf("提示词模板 %s 缺少user内容", t.key())
+	}
+
+	t.Locale = normalizeLocale(t.Locale)
+
+	var err error
+	if t.system, err = template.New(t.key() + "/system").Option("missingkey=error").Parse(t.System); err != nil {
+		return fmt.Errorf("解析提示词模板 %s 失败: %w", t.key(), err)
+	}
+	if t.user, err = template.New(t.key() + "/user").Option("missingkey=error").Parse(t.User); err != nil {
+		return fmt.Errorf("解析提示词模板 %s 失败: %w", t.key(), err)
+	}
+	return nil
+}
+
+// Render 使用变量渲染模板，生成AI请求
+func (t *PromptTemplate) Render(vars map[string]interface{}) (*AIRequest, error) {
+	for _, name := range t.Variables {
+		if _, ok := vars[name]; !ok {
+			return nil, fmt.Errorf("提示词模板 %s 缺少变量: %s", t.key(), name)
+		}
+	}
+
+	var system, user bytes.Buffer
+	if err := t.system.Execute(&system, vars); err != nil {
+		return nil, fmt.Errorf("渲染提示词模板 %s 失败: %w", t.key(), err)
+	}
+	if err := t.user.Execute(&user, vars); err != nil {
+		return nil, fmt.Errorf("渲染提示词模板 %s 失败: %w", t.key(), err)
+	}
+
+	var messages []AIMessage
+	if content := strings.TrimSpace(system.String()); content != "" {
+		messages = append(messages, AIMessage{Role: "system", Content: content})
+	}
+	messages = append(messages, AIMessage{Role: "user", Content: strings.TrimSpace(user.String())})
+
+	return &AIRequest{
+		Model:       t.Model,
+		Messages:    messages,
+		Temperature: t.Temperature,
+		MaxTokens:   t.MaxTokens,
+	}, nil
+}
+
+// Ref 模板版本引用
+func (t *PromptTemplate) Ref() *PromptRef {
+	return &PromptRef{Name: t.Name, Version: t.Version, Locale: t.Locale}
+}
+
+func (t *PromptTemplate) key() string {
+	return t.Name + "@" + t.Version + "/" + t.Locale
+}
+
+// PromptLibrary 提示词模板库
+type PromptLibrary struct {
+	db  *database.DB
+	dir string
+
+	mu        sync.RWMutex
+	templates map[string]*PromptTemplate // key() -> 模板
+}
+
+func NewPromptLibrary(db *database.DB, dir string) *PromptLibrary {
+	return &PromptLibrary{
+		db:        db,
+		dir:       dir,
+		templates: make(map[string]*PromptTemplate),
+	}
+}
+
+// Reload 依次加载内置模板、模板目录和数据库中的模板，后加载的覆盖同名同版本的模板
+func (l *PromptLibrary) Reload(ctx context.Context) error {
+	templates := make(map[string]*PromptTemplate)
+	add := func(list []*PromptTemplate, source string) {
+		for _, tpl := range list {
+			tpl.Source = source
+			templates[tpl.key()] = tpl
+		}
+	}
+
+	builtin, err := readBuiltinPrompts()
+	if err != nil {
+		return err
+	}
+	add(builtin, PromptSourceBuiltin)
+
+	var loadErr error
+	if l.dir != "" {
+		files, err := readPromptDir(l.dir)
+		if err != nil {
+			loadErr = err
+		} else {
+			add(files, PromptSourceFile)
+		}
+	}
+
+	if l.db != nil {
+		stored, err := l.loadFromDB(ctx)
+		if err != nil {
+			loadErr = err
+		} else {
+			add(stored, PromptSourceDB)
+		}
+	}
+
+	l.mu.Lock()
+	l.templates = templates
+	l.mu.Unlock()
+
+	return loadErr
+}
+
+// Select 按语言选择模板版本，多个版本时按权重分流
+//
+// 相同的分流键（通常是用户ID）总是落在同一个版本上；分流键为空时随机选择
+func (l *PromptLibrary) Select(name, locale, bucketKey string) (*PromptTemplate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, candidate := range localeFallbacks(locale) {
+		versions := l.versions(name, candidate)
+		if len(versions) == 0 {
+			continue
+		}
+
+		total := 0
+		for _, tpl := range versions {
+			total += tpl.Weight
+		}
+		if total == 0 {
+			continue
+		}
+
+		var point int
+		if bucketKey == "" {
+			point = rand.Intn(total)
+		} else {
+			h := fnv.New32a()
+			h.Write([]byte(name + ":" + bucketKey))
+			point = int(h.Sum32() % uint32(total))
+		}
+
+		for _, tpl := range versions {
+			if point < tpl.Weight {
+				return tpl, nil
+			}
+			point -= tpl.Weight
+		}
+	}
+
+	return nil, fmt.Errorf("未找到提示词模板: %s (%s)", name, locale)
+}
+
+// List 列出所有模板，按名称、语言、版本排序
+func (l *PromptLibrary) List() []*PromptTemplate {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	list := make([]*PromptTemplate, 0, len(l.templates))
+	for _, tpl := range l.templates {
+		list = append(list, tpl)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Locale != b.Locale {
+			return a.Locale < b.Locale
+		}
+		return lessPromptVersion(a.Version, b.Version)
+	})
+	return list
+}
+
+// Save 保存模板版本到数据库（同名同版本同语言时覆盖）
+func (l *PromptLibrary) Save(ctx context.Context, tpl *PromptTemplate) error {
+	if l.db == nil {
+		return fmt.Errorf("未配置数据库，无法保存提示词模板")
+	}
+	if err := tpl.compile(); err != nil {
+		return err
+	}
+	if err := savePromptTemplate(ctx, l.db, tpl); err != nil {
+		return err
+	}
+
+	tpl.Source = PromptSourceDB
+	l.mu.Lock()
+	l.templates[tpl.key()] = tpl
+	l.mu.Unlock()
+
+	return nil
+}
+
+// savePromptTemplate 写入一个模板版本，q可以是数据库或事务
+func savePromptTemplate(ctx context.Context, q interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, tpl *PromptTemplate) error {
+	variables, err := json.Marshal(tpl.Variables)
+	if err != nil {
+		return fmt.Errorf("序列化模板变量失败: %w", err)
+	}
+
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO prompt_templates (id, name, version, locale, description, model, temperature,
+			max_tokens, variables, system_prompt, user_prompt, weight, is_active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, TRUE, NOW(), NOW())
+		ON CONFLICT (name, version, locale) DO UPDATE SET
+			description = EXCLUDED.description, model = EXCLUDED.model,
+			temperature = EXCLUDED.temperature, max_tokens = EXCLUDED.max_tokens,
+			variables = EXCLUDED.variables, system_prompt = EXCLUDED.system_prompt,
+			user_prompt = EXCLUDED.user_prompt, weight = EXCLUDED.weight,
+			is_active = TRUE, updated_at = NOW()
+	`, generateUUID(), tpl.Name, tpl.Version, tpl.Locale, tpl.Description, tpl.Model, tpl.Temperature,
+		tpl.MaxTokens, variables, tpl.System, tpl.User, tpl.Weight)
+	if err != nil {
+		return fmt.Errorf("保存提示词模板失败: %w", err)
+	}
+	return nil
+}
+
+// SetWeights 调整同一模板各版本的分流权重，未列出的版本权重置为0
+//
+// 内置或文件中的模板会连同新权重一起保存到数据库。所有版本在同一事务中写入，
+// 失败时不会留下只更新了部分版本的权重
+func (l *PromptLibrary) SetWeights(ctx context.Context, name, locale string, weights map[string]int) error {
+	locale = normalizeLocale(locale)
+
+	l.mu.RLock()
+	versions := l.versions(name, locale)
+	l.mu.RUnlock()
+	if len(versions) == 0 {
+		return fmt.Errorf("未找到提示词模板: %s (%s)", name, locale)
+	}
+
+	known := make(map[string]bool, len(versions))
+	total := 0
+	for _, tpl := range versions {
+		known[tpl.Version] = true
+		total += weights[tpl.Version]
+	}
+	for version, weight := range weights {
+		if !known[version] {
+			return fmt.Errorf("提示词模板 %s 不存在版本: %s", name, version)
+		}
+		if weight < 0 {
+			return fmt.Errorf("权重不能为负数")
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("至少需要一个版本的权重大于0")
+	}
+
+	if l.db == nil {
+		return fmt.Errorf("未配置数据库，无法保存提示词模板")
+	}
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("保存提示词模板失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	updated := make([]*PromptTemplate, 0, len(versions))
+	for _, tpl := range versions {
+		copied := *tpl
+		copied.Weight = weights[tpl.Version]
+		if err := copied.compile(); err != nil {
+			return err
+		}
+		if err := savePromptTemplate(ctx, tx, &copied); err != nil {
+			return err
+		}
+		copied.Source = PromptSourceDB
+		updated = append(updated, &copied)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("保存提示词模板失败: %w", err)
+	}
+
+	l.mu.Lock()
+	for _, tpl := range updated {
+		l.templates[tpl.key()] = tpl
+	}
+	l.mu.Unlock()
+
+	return nil
+}
+
+// versions 同名同语言的所有版本（调用方需持有锁）
+func (l *PromptLibrary) versions(name, locale string) []*PromptTemplate {
+	var versions []*PromptTemplate
+	for _, tpl := range l.templates {
+		if tpl.Name == name && tpl.Locale == locale {
+			versions = append(versions, tpl)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return lessPromptVersion(versions[i].Version, versions[j].Version)
+	})
+	return versions
+}
+
+// lessPromptVersion 版本排序，等价的版本号（如 1.0 与 1.0.0）按原字符串排序以保证顺序稳定
+func lessPromptVersion(a, b string) bool {
+	if c := comparePromptVersions(a, b); c != 0 {
+		return c < 0
+	}
+	return a < b
+}
+
+// comparePromptVersions 按语义化版本比较两个版本号，返回-1、0或1
+//
+// 可以带v前缀，各段按数字比较（1.10 > 1.9），缺少的段视为0；带预发布标识的版本
+// 低于对应的正式版本（2.0-beta < 2.0）；+之后的构建信息不参与比较；非数字段按字符串比较
+func comparePromptVersions(a, b string) int {
+	coreA, preA := splitPromptVersion(a)
+	coreB, preB := splitPromptVersion(b)
+	if c := compareVersionSegments(coreA, coreB, true); c != 0 {
+		return c
+	}
+
+	switch {
+	case preA == nil && preB == nil:
+		return 0
+	case preA == nil:
+		return 1
+	case preB == nil:
+		return -1
+	}
+	return compareVersionSegments(preA, preB, false)
+}
+
+func splitPromptVersion(version string) (core, pre []string) {
+	version = strings.TrimSpace(version)
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	if i := strings.IndexByte(version, '+'); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.IndexByte(version, '-'); i >= 0 {
+		pre = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
+	return strings.Split(version, "."), pre
+}
+
+// compareVersionSegments 逐段比较；padZero时缺少的段视为0，否则段数少的较小（预发布标识的规则）
+func compareVersionSegments(a, b []string, padZero bool) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if !padZero {
+			if i >= len(a) {
+				return -1
+			}
+			if i >= len(b) {
+				return 1
+			}
+		}
+
+		x, y := "0", "0"
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if c := compareVersionSegment(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareVersionSegment 两段都是数字时按数值比较，数字段低于非数字段，其余按字符串比较
+func compareVersionSegment(x, y string) int {
+	nx, errX := strconv.ParseUint(x, 10, 64)
+	ny, errY := strconv.ParseUint(y, 10, 64)
+	switch {
+	case errX == nil && errY == nil:
+		switch {
+		case nx < ny:
+			return -1
+		case nx > ny:
+			return 1
+		}
+		return 0
+	case errX == nil:
+		return -1
+	case errY == nil:
+		return 1
+	}
+	return strings.Compare(x, y)
+}
+
+func (l *PromptLibrary) loadFromDB(ctx context.Context) ([]*PromptTemplate, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT name, version, locale, COALESCE(description, ''), COALESCE(model, ''), temperature,
+			max_tokens, variables, COALESCE(system_prompt, ''), user_prompt, weight
+		FROM prompt_templates
+		WHERE is_active = TRUE
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("查询提示词模板失败: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []*PromptTemplate
+	for rows.Next() {
+		tpl := &PromptTemplate{}
+		var variables []byte
+		if err := rows.Scan(&tpl.Name, &tpl.Version, &tpl.Locale, &tpl.Description, &tpl.Model, &tpl.Temperature,
+			&tpl.MaxTokens, &variables, &tpl.System, &tpl.User, &tpl.Weight); err != nil {
+			return nil, fmt.Errorf("读取提示词模板失败: %w", err)
+		}
+		if len(variables) > 0 {
+			if err := json.Unmarshal(variables, &tpl.Variables); err != nil {
+				return nil, fmt.Errorf("解析模板变量失败: %w", err)
+			}
+		}
+		if err := tpl.compile(); err != nil {
+			// 单个模板有误时跳过，不影响其他模板
+			log.Printf("跳过数据库中的提示词模板: %v", err)
+			continue
+		}
+		templates = append(templates, tpl)
+	}
+
+	return templates, rows.Err()
+}
+
+func readBuiltinPrompts() ([]*PromptTemplate, error) {
+	entries, err := builtinPromptFiles.ReadDir("prompts")
+	if err != nil {
+		return nil, fmt.Errorf("读取内置提示词模板失败: %w", err)
+	}
+
+	var templates []*PromptTemplate
+	for _, entry := range entries {
+		data, err := builtinPromptFiles.ReadFile("prompts/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("读取内置提示词模板失败: %w", err)
+		}
+		list, err := parsePromptFile(data, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, list...)
+	}
+	return templates, nil
+}
+
+func readPromptDir(dir string) ([]*PromptTemplate, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("读取提示词模板目录失败: %w", err)
+	}
+
+	var templates []*PromptTemplate
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取提示词模板文件失败: %w", err)
+		}
+		list, err := parsePromptFile(data, path)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, list...)
+	}
+	return templates, nil
+}
+
+func parsePromptFile(data []byte, name string) ([]*PromptTemplate, error) {
+	var file promptTemplatesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析提示词模板文件 %s 失败: %w", name, err)
+	}
+	for _, tpl := range file.Templates {
+		if err := tpl.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return file.Templates, nil
+}
+
+type aiLocaleKey struct{}
+
+// WithAILocale 在ctx中设置提示词语言（如Accept-Language头）
+func WithAILocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, aiLocaleKey{}, locale)
+}
+
+// AILocaleFrom 读取ctx中的提示词语言
+func AILocaleFrom(ctx context.Context) string {
+	locale, _ := ctx.Value(aiLocaleKey{}).(string)
+	return locale
+}
+
+// normalizeLocale 规范化语言标签，如 "en_US" -> "en-us"，"zh-CN,zh;q=0.9" -> "zh-cn"
+func normalizeLocale(locale string) string {
+	locale = strings.TrimSpace(strings.SplitN(locale, ",", 2)[0])
+	locale = strings.TrimSpace(strings.SplitN(locale, ";", 2)[0])
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// localeFallbacks 语言的候选列表：完整标签、主语言、默认语言
+func localeFallbacks(locale string) []string {
+	locale = normalizeLocale(locale)
+
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, locale[:i])
+		}
+	}
+	return append(candidates, defaultPromptLocale)
+}
+
+// localeFor 按语言回退顺序在按语言区分的文案中选择可用的语言
+func localeFor[T any](texts map[string]T, locale string) string {
+	for _, candidate := range localeFallbacks(locale) {
+		if _, ok := texts[candidate]; ok {
+			return candidate
+		}
+	}
+	return defaultPromptLocale
+}
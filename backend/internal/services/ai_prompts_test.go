@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComparePromptVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.9", "1.10", -1},
+		{"2", "10", -1},
+		{"v1.2", "1.2", 0},
+		{"1.0", "1.0.0", 0},
+		{"1.0.1", "1.0", 1},
+		{"2.0-beta", "2.0", -1},
+		{"2.0-alpha", "2.0-beta", -1},
+		{"2.0-beta.2", "2.0-beta.11", -1},
+		{"2.0-beta", "2.0-beta.1", -1},
+		{"2.0-rc.1", "1.9", 1},
+		{"1.0+build.5", "1.0", 0},
+		{"1.2", "1.x", -1},
+		{"exp-a", "exp-b", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			if got := comparePromptVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("comparePromptVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := comparePromptVersions(tt.b, tt.a); got != -tt.want {
+				t.Errorf("comparePromptVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptLibraryVersionsOrder(t *testing.T) {
+	l := NewPromptLibrary(nil, "")
+	for _, version := range []string{"1.10", "1.9", "2.0-beta", "1.0.0", "1.0", "2.0"} {
+		tpl := &PromptTemplate{Name: "demo", Version: version, Locale: "zh", Weight: 1}
+		l.templates[tpl.key()] = tpl
+	}
+
+	var got []string
+	for _, tpl := range l.versions("demo", "zh") {
+		got = append(got, tpl.Version)
+	}
+	want := []string{"1.0", "1.0.0", "1.9", "1.10", "2.0-beta", "2.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("versions() = %v, want %v", got, want)
+	}
+
+	got = got[:0]
+	for _, tpl := range l.List() {
+		got = append(got, tpl.Version)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+}
+
+func TestPromptLibrarySetWeightsInvalid(t *testing.T) {
+	l := NewPromptLibrary(nil, "")
+	for _, version := range []string{"1", "2"} {
+		tpl := &PromptTemplate{Name: "demo", Version: version, Locale: "zh", Weight: 1}
+		l.templates[tpl.key()] = tpl
+	}
+
+	tests := []struct {
+		name    string
+		prompt  string
+		weights map[string]int
+		wantErr string
+	}{
+		{"unknown template", "missing", map[string]int{"1": 1}, "未找到提示词模板"},
+		{"unknown version", "demo", map[string]int{"3": 1}, "不存在版本"},
+		{"negative weight", "demo", map[string]int{"1": 2, "2": -1}, "不能为负数"},
+		{"all zero", "demo", map[string]int{"1": 0}, "至少需要一个版本"},
+		{"no database", "demo", map[string]int{"1": 1}, "未配置数据库"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.SetWeights(context.Background(), tt.prompt, "zh", tt.weights)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SetWeights() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 失败时内存中的权重不变
+	for _, tpl := range l.versions("demo", "zh") {
+		if tpl.Weight != 1 {
+			t.Errorf("version %s weight = %d, want 1", tpl.Version, tpl.Weight)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+	"qa-toolbox-backend/internal/config"
+)
+
+// AIAuthStyle API密钥的传递方式
+type AIAuthStyle string
+
+const (
+	AIAuthBearer  AIAuthStyle = "bearer"    // Authorization: Bearer <key>
+	AIAuthAPIKey  AIAuthStyle = "api-key"   // api-key: <key>（Azure风格）
+	AIAuthXAPIKey AIAuthStyle = "x-api-key" // X-API-Key: <key>
+	AIAuthNone    AIAuthStyle = "none"      // 无需认证（如本地模型服务）
+)
+
+// 服务协议，决定使用哪个客户端实现
+const (
+	AIProtocolOpenAI  = "openai"
+	AIProtocolTencent = "tencent"
+	AIProtocolXunfei  = "xunfei"
+	AIProtocolBaidu   = "baidu"
+	AIProtocolMock    = "mock" // 模拟服务，见 AI_MOCK_MODE
+)
+
+// AIProviderSpec AI服务的声明式定义
+type AIProviderSpec struct {
+	Name           AIServiceType `yaml:"name" json:"name"`
+	Protocol       string        `yaml:"protocol" json:"protocol"`
+	BaseURL        string        `yaml:"base_url" json:"base_url"`
+	APIKeyEnv      string        `yaml:"api_key_env" json:"api_key_env,omitempty"`
+	APIKey         string        `yaml:"-" json:"-"`
+	DefaultModel   string        `yaml:"default_model" json:"default_model"`
+	Models         []string      `yaml:"models" json:"models,omitempty"`
+	EmbeddingModel string        `yaml:"embedding_model" json:"embedding_model,omitempty"` // 为空表示不提供向量化
+	Priority       int           `yaml:"priority" json:"priority"`
+	AuthStyle      AIAuthStyle   `yaml:"auth_style" json:"auth_style"`
+	AuthHeader     string        `yaml:"auth_header" json:"auth_header,omitempty"`
+	Description    string        `yaml:"description" json:"description,omitempty"`
+	Enabled        *bool         `yaml:"enabled" json:"-"`
+	ToolCalling    *bool         `yaml:"tool_calling" json:"-"` // 未配置时按协议判断
+	StreamDone     *bool         `yaml:"stream_done" json:"-"`  // 流式响应是否以 data: [DONE] 结束，未配置时视为是
+}
+
+// AI服务配置文件格式
+type aiProvidersFile struct {
+	Providers []AIProviderSpec `yaml:"providers"`
+}
+
+// AIProviderFactory 根据服务定义创建客户端
+type AIProviderFactory func(cfg *config.Config, spec AIProviderSpec) AIClient
+
+var aiProviderFactories = map[string]AIProviderFactory{
+	AIProtocolOpenAI: func(cfg *config.Config, spec AIProviderSpec) AIClient {
+		return NewOpenAICompatibleClient(cfg, spec)
+	},
+	AIProtocolTencent: func(cfg *config.Config, spec AIProviderSpec) AIClient {
+		return NewTencentClient(cfg, spec)
+	},
+	AIProtocolXunfei: func(cfg *config.Config, spec AIProviderSpec) AIClient {
+		return NewXunfeiClient(cfg, spec)
+	},
+	AIProtocolBaidu: func(cfg *config.Config, spec AIProviderSpec) AIClient {
+		return NewBaiduClient(cfg, spec)
+	},
+	AIProtocolMock: func(cfg *config.Config, spec AIProviderSpec) AIClient {
+		return NewMockAIClient(cfg, spec)
+	},
+}
+
+// RegisterAIProtocol 注册新的服务协议实现
+func RegisterAIProtocol(protocol string, factory AIProviderFactory) {
+	aiProviderFactories[protocol] = factory
+}
+
+// IsEnabled 服务是否启用（未配置时默认启用）
+func (s AIProviderSpec) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// SupportsTools 服务是否支持工具调用，OpenAI兼容接口、混元和模拟服务默认支持
+func (s AIProviderSpec) SupportsTools() bool {
+	if s.ToolCalling != nil {
+		return *s.ToolCalling
+	}
+	return s.Protocol == AIProtocolOpenAI || s.Protocol == AIProtocolTencent || s.Protocol == AIProtocolMock
+}
+
+// SendsStreamDone 服务的流式响应是否以 [DONE] 结束，不发送的服务以结束原因判断响应完整
+func (s AIProviderSpec) SendsStreamDone() bool {
+	return s.StreamDone == nil || *s.StreamDone
+}
+
+// HasModel 服务是否支持指定模型（未声明模型列表时视为支持）
+func (s AIProviderSpec) HasModel(model string) bool {
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinAIProviders 内置服务，密钥和地址来自环境变量配置
+func builtinAIProviders(cfg *config.Config) []AIProviderSpec {
+	return []AIProviderSpec{
+		{
+			Name:         AIServiceTencent,
+			Protocol:     AIProtocolTencent,
+			BaseURL:      cfg.TencentBaseURL,
+			APIKey:       cfg.TencentSecretKey,
+			DefaultModel: "hunyuan-lite",
+			Models:       []string{"hunyuan-lite", "hunyuan-standard", "hunyuan-pro"},
+			Priority:     10, // 最高优先级 - 腾讯混元，国内稳定
+			Description:  "腾讯混元大模型，国内访问稳定",
+		},
+		{
+			Name:         AIServiceDeepSeek,
+			BaseURL:      cfg.DeepSeekBaseURL,
+			APIKey:       cfg.DeepSeekAPIKey,
+			DefaultModel: "deepseek-chat",
+			Models:       []string{"deepseek-chat", "deepseek-coder"},
+			Priority:     20, // 第二优先级 - DeepSeek，功能强大
+			Description:  "DeepSeek AI，功能强大",
+		},
+		{
+			Name:           AIServiceAIMLAPI,
+			BaseURL:        cfg.AIMLAPIBaseURL,
+			APIKey:         cfg.AIMLAPIKey,
+			DefaultModel:   "gpt-3.5-turbo",
+			Models:         []string{"gpt-3.5-turbo", "gpt-4", "claude-3"},
+			EmbeddingModel: "text-embedding-3-small",
+			Priority:       30, // 第三优先级 - 聚合服务
+			Description:    "AIMLAPI聚合服务，支持多种模型",
+		},
+		{
+			Name:         AIServiceAITools,
+			BaseURL:      cfg.AIToolsBaseURL,
+			APIKey:       cfg.AIToolsAPIKey,
+			DefaultModel: "gpt-3.5-turbo",
+			Priority:     40, // 无需登录
+			Description:  "AI Tools，兼容OpenAI接口",
+		},
+		{
+			Name:         AIServiceGroq,
+			BaseURL:      cfg.GroqBaseURL,
+			APIKey:       cfg.GroqAPIKey,
+			DefaultModel: "llama-3.1-8b-instant",
+			Priority:     50, // 免费额度大
+			Description:  "Groq高速推理",
+		},
+		{
+			Name:         AIServiceXunfei,
+			Protocol:     AIProtocolXunfei,
+			BaseURL:      cfg.XunfeiBaseURL,
+			APIKey:       cfg.XunfeiAPIKey,
+			DefaultModel: "generalv3.5",
+			Models:       []string{"lite", "generalv3", "pro-128k", "generalv3.5", "max-32k", "4.0Ultra"},
+			Priority:     60, // 完全免费
+			Description:  "讯飞星火认知大模型",
+		},
+		{
+			Name:         AIServiceBaidu,
+			Protocol:     AIProtocolBaidu,
+			BaseURL:      cfg.BaiduBaseURL,
+			APIKey:       cfg.BaiduAPIKey,
+			DefaultModel: "ernie-speed-128k",
+			Models:       []string{"ernie-speed-128k", "ernie-speed-8k", "ernie-lite-8k", "ernie-tiny-8k", "ernie-3.5-8k", "ernie-4.0-8k"},
+			Priority:     70, // 免费额度
+			Description:  "百度千帆文心大模型",
+		},
+		{
+			Name:         AIServiceBytedance,
+			BaseURL:      cfg.BytedanceBaseURL,
+			APIKey:       cfg.BytedanceAPIKey,
+			DefaultModel: cfg.BytedanceModel, // 火山方舟的模型名为推理接入点ID
+			Priority:     80,                 // 开发者免费
+			Description:  "字节火山方舟",
+		},
+		{
+			Name:           AIServiceSiliconFlow,
+			BaseURL:        cfg.SiliconFlowBaseURL,
+			APIKey:         cfg.SiliconFlowAPIKey,
+			DefaultModel:   "Qwen/Qwen2.5-7B-Instruct",
+			EmbeddingModel: "BAAI/bge-m3",
+			Priority:       90, // 免费额度
+			Description:    "硅基流动开源模型服务",
+		},
+		{
+			Name:           AIServiceTogether,
+			BaseURL:        cfg.TogetherBaseURL,
+			APIKey:         cfg.TogetherAPIKey,
+			DefaultModel:   "meta-llama/Llama-3-8b-chat-hf",
+			EmbeddingModel: "togethercomputer/m2-bert-80M-8k-retrieval",
+			Priority:       100, // 有免费额度
+			Description:    "Together AI开源模型服务",
+		},
+		{
+			Name:         AIServiceOpenRouter,
+			BaseURL:      cfg.OpenRouterBaseURL,
+			APIKey:       cfg.OpenRouterAPIKey,
+			DefaultModel: "openai/gpt-3.5-turbo",
+			Priority:     110, // 聚合多个模型
+			Description:  "OpenRouter聚合多个模型",
+		},
+	}
+}
+
+// LoadAIProviderSpecs 加载内置服务并合并配置文件中的定义，按优先级排序
+//
+// 配置文件中与内置服务同名的条目只覆盖其填写的字段，新名称则注册为新服务
+func LoadAIProviderSpecs(cfg *config.Config) ([]AIProviderSpec, error) {
+	specs := builtinAIProviders(cfg)
+
+	if cfg.AIProvidersFile != "" {
+		fileSpecs, err := readAIProvidersFile(cfg.AIProvidersFile)
+		if err != nil {
+			return nil, err
+		}
+		specs = mergeAIProviderSpecs(specs, fileSpecs)
+	}
+
+	return applyAIMockMode(cfg, normalizeAIProviderSpecs(specs)), nil
+}
+
+// 补全默认值、解析密钥环境变量并按优先级排序
+func normalizeAIProviderSpecs(specs []AIProviderSpec) []AIProviderSpec {
+	for i := range specs {
+		if specs[i].Protocol == "" {
+			specs[i].Protocol = AIProtocolOpenAI
+		}
+		if specs[i].AuthStyle == "" {
+			specs[i].AuthStyle = AIAuthBearer
+		}
+		if specs[i].APIKeyEnv != "" {
+			specs[i].APIKey = os.Getenv(specs[i].APIKeyEnv)
+		}
+	}
+
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specs[i].Priority < specs[j].Priority
+	})
+
+	return specs
+}
+
+func readAIProvidersFile(path string) ([]AIProviderSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取AI服务配置文件失败: %w", err)
+	}
+
+	var file aiProvidersFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析AI服务配置文件失败: %w", err)
+	}
+
+	for _, spec := range file.Providers {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("AI服务配置缺少name字段")
+		}
+		if spec.Protocol != "" {
+			if _, ok := aiProviderFactories[spec.Protocol]; !ok {
+				return nil, fmt.Errorf("AI服务 %s 使用了未知协议: %s", spec.Name, spec.Protocol)
+			}
+		}
+	}
+
+	return file.Providers, nil
+}
+
+func mergeAIProviderSpecs(base, overrides []AIProviderSpec) []AIProviderSpec {
+	index := make(map[AIServiceType]int, len(base))
+	for i, spec := range base {
+		index[spec.Name] = i
+	}
+
+	for _, override := range overrides {
+		i, exists := index[override.Name]
+		if !exists {
+			index[override.Name] = len(base)
+			base = append(base, override)
+			continue
+		}
+
+		spec := &base[i]
+		if override.Protocol != "" {
+			spec.Protocol = override.Protocol
+		}
+		if override.BaseURL != "" {
+			spec.BaseURL = override.BaseURL
+		}
+		if override.APIKeyEnv != "" {
+			spec.APIKeyEnv = override.APIKeyEnv
+		}
+		if override.DefaultModel != "" {
+			spec.DefaultModel = override.DefaultModel
+		}
+		if len(override.Models) > 0 {
+			spec.Models = override.Models
+		}
+		if override.EmbeddingModel != "" {
+			spec.EmbeddingModel = override.EmbeddingModel
+		}
+		if override.Priority != 0 {
+			spec.Priority = override.Priority
+		}
+		if override.AuthStyle != "" {
+			spec.AuthStyle = override.AuthStyle
+		}
+		if override.AuthHeader != "" {
+			spec.AuthHeader = override.AuthHeader
+		}
+		if override.Description != "" {
+			spec.Description = override.Description
+		}
+		if override.Enabled != nil {
+			spec.Enabled = override.Enabled
+		}
+		if override.ToolCalling != nil {
+			spec.ToolCalling = override.ToolCalling
+		}
+		if override.StreamDone != nil {
+			spec.StreamDone = override.StreamDone
+		}
+	}
+
+	return base
+}
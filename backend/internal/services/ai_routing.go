@@ -0,0 +1,390 @@
+package services
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 内置模型目录
+//
+//go:embed catalog/models.yaml
+var builtinModelCatalog embed.FS
+
+// AIModelAuto 不指定模型，由调度决定
+const AIModelAuto = "auto"
+
+// AIModelTierEmbedding 向量模型的等级，只用于计价，不参与对话模型的调度
+const AIModelTierEmbedding = "embedding"
+
+// ErrNoAIRoute 指定的服务或模型不可用，或没有满足上下文长度的模型
+var ErrNoAIRoute = errors.New("没有满足要求的模型")
+
+// AIRoutePolicy 选择模型的策略
+type AIRoutePolicy string
+
+const (
+	AIRouteDefault  AIRoutePolicy = ""         // 按服务优先级和健康状态，使用各服务的默认模型
+	AIRouteCheapest AIRoutePolicy = "cheapest" // 价格最低
+	AIRouteFastest  AIRoutePolicy = "fastest"  // 延迟最低，优先使用实际调用统计
+	AIRouteQuality  AIRoutePolicy = "quality"  // 能力评分最高
+)
+
+// ParseAIRoutePolicy 解析策略名称，空字符串为默认策略
+func ParseAIRoutePolicy(policy string) (AIRoutePolicy, error) {
+	switch p := AIRoutePolicy(strings.ToLower(strings.TrimSpace(policy))); p {
+	case AIRouteDefault, AIRouteCheapest, AIRouteFastest, AIRouteQuality:
+		return p, nil
+	}
+	return "", fmt.Errorf("未知的调度策略: %s", policy)
+}
+
+// AIModelInfo 模型目录中的一个模型
+type AIModelInfo struct {
+	Provider      AIServiceType `yaml:"provider" json:"provider"`
+	Model         string        `yaml:"model" json:"model"`
+	Tier          string        `yaml:"tier" json:"tier"`                 // 能力等级，同等级的模型视为可相互替代
+	InputPrice    float64       `yaml:"input_price" json:"input_price"`   // 美元/百万输入token
+	OutputPrice   float64       `yaml:"output_price" json:"output_price"` // 美元/百万输出token
+	ContextWindow int           `yaml:"context_window" json:"context_window"`
+	Quality       int           `yaml:"quality" json:"quality"`
+	LatencyMs     int           `yaml:"latency_ms" json:"latency_ms"`
+	Currency      string        `yaml:"currency" json:"currency"` // 价格币种，默认USD
+}
+
+// Ref 用于显式指定模型的 provider/model 字符串
+func (i AIModelInfo) Ref() string {
+	return string(i.Provider) + "/" + i.Model
+}
+
+type aiModelCatalogFile struct {
+	Models []AIModelInfo `yaml:"models"`
+}
+
+// AIModelCatalog 模型的价格、上下文长度和能力信息，用于按策略调度
+type AIModelCatalog struct {
+	models []AIModelInfo
+}
+
+// LoadAIModelCatalog 加载内置模型目录，path不为空时合并文件中的定义
+//
+// 文件中与内置模型 provider 和 model 相同的条目替换内置定义，其余追加
+func LoadAIModelCatalog(path string) (*AIModelCatalog, error) {
+	data, err := builtinModelCatalog.ReadFile("catalog/models.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("读取内置模型目录失败: %w", err)
+	}
+	models, err := parseAIModelCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &AIModelCatalog{models: models}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return catalog, fmt.Errorf("读取模型目录文件失败: %w", err)
+		}
+		overrides, err := parseAIModelCatalog(data)
+		if err != nil {
+			return catalog, err
+		}
+		catalog.merge(overrides)
+	}
+	return catalog, nil
+}
+
+func parseAIModelCatalog(data []byte) ([]AIModelInfo, error) {
+	var file aiModelCatalogFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析模型目录失败: %w", err)
+	}
+	for i, info := range file.Models {
+		if info.Provider == "" || info.Model == "" {
+			return nil, fmt.Errorf("模型目录条目缺少provider或model字段")
+		}
+		if info.Currency == "" {
+			file.Models[i].Currency = defaultAICurrency
+		}
+	}
+	return file.Models, nil
+}
+
+func (c *AIModelCatalog) merge(overrides []AIModelInfo) {
+	index := make(map[string]int, len(c.models))
+	for i, info := range c.models {
+		index[info.Ref()] = i
+	}
+	for _, info := range overrides {
+		if i, ok := index[info.Ref()]; ok {
+			c.models[i] = info
+			continue
+		}
+		index[info.Ref()] = len(c.models)
+		c.models = append(c.models, info)
+	}
+}
+
+// List 目录中的所有模型
+func (c *AIModelCatalog) List() []AIModelInfo {
+	return append([]AIModelInfo{}, c.models...)
+}
+
+// Lookup 查找服务的模型信息
+func (c *AIModelCatalog) Lookup(provider AIServiceType, model string) (AIModelInfo, bool) {
+	for _, info := range c.models {
+		if info.Provider == provider && info.Model == model {
+			return info, true
+		}
+	}
+	return AIModelInfo{}, false
+}
+
+func (c *AIModelCatalog) hasProvider(provider AIServiceType) bool {
+	for _, info := range c.models {
+		if info.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// aiRoute 一次调用尝试的服务和模型
+type aiRoute struct {
+	client AIClient
+	model  string
+}
+
+// routes 确定本次请求依次尝试的服务和模型
+//
+//   - provider/model：只调用指定服务的指定模型，不做故障转移
+//   - 目录中的模型名：先尝试提供该模型的服务，再按同等级的模型故障转移
+//   - 目录外的模型名：先尝试声明了该模型的服务，其余服务使用默认模型
+//   - 未指定模型：默认策略下按健康顺序使用各服务的默认模型；
+//     其他策略从目录中选出最优模型，并只在与其同等级的模型之间故障转移
+func (m *AIClientManager) routes(req *AIRequest) ([]aiRoute, error) {
+	if provider, model, ok := m.splitModelRef(req.Model); ok {
+		return m.pinnedRoute(provider, model)
+	}
+
+	clients := m.GetAvailableClients()
+	if len(clients) == 0 {
+		return nil, ErrNoAIService
+	}
+	order := make(map[AIServiceType]int, len(clients))
+	for i, client := range clients {
+		order[client.GetServiceType()] = i
+	}
+
+	policy := req.Policy
+	if policy == AIRouteDefault {
+		policy = m.routePolicy
+	}
+	model := req.Model
+	if model == AIModelAuto {
+		model = ""
+	}
+
+	needed := estimateRequestTokens(req)
+	fits := func(info AIModelInfo) bool {
+		return info.ContextWindow == 0 || info.ContextWindow >= needed
+	}
+
+	var primary []AIModelInfo
+	switch {
+	case model != "":
+		primary = m.availableModels(order, func(info AIModelInfo) bool { return info.Model == model })
+		if len(primary) == 0 {
+			return hintRoutes(clients, m.specs, model), nil
+		}
+		tier := primary[0].Tier
+		primary = filterModels(primary, fits)
+		equivalent := m.availableModels(order, func(info AIModelInfo) bool {
+			return info.Tier == tier && info.Model != model && fits(info)
+		})
+		m.sortModels(primary, policy, order)
+		m.sortModels(equivalent, policy, order)
+		primary = append(primary, equivalent...)
+	case policy != AIRouteDefault:
+		catalogued := m.availableModels(order, func(AIModelInfo) bool { return true })
+		if len(catalogued) == 0 {
+			// 可用服务都不在目录中，无法按策略选择
+			return hintRoutes(clients, m.specs, model), nil
+		}
+		primary = filterModels(catalogued, fits)
+		if len(primary) == 0 {
+			break
+		}
+		m.sortModels(primary, policy, order)
+		tier := primary[0].Tier
+		primary = filterModels(primary, func(info AIModelInfo) bool { return info.Tier == tier })
+	default:
+		return hintRoutes(clients, m.specs, model), nil
+	}
+
+	if len(primary) == 0 {
+		return nil, fmt.Errorf("%w: 请求约需%d token，超出可用模型的上下文长度", ErrNoAIRoute, needed)
+	}
+	routes := make([]aiRoute, 0, len(primary))
+	for _, info := range primary {
+		routes = append(routes, aiRoute{client: m.clients[info.Provider], model: info.Model})
+	}
+	return routes, nil
+}
+
+// routeModel 路由实际调用的 provider/model，未指定或服务不提供该模型时为服务的默认模型
+func (m *AIClientManager) routeModel(route aiRoute) string {
+	serviceType := route.client.GetServiceType()
+	spec := m.specs[serviceType]
+	model := route.model
+	if spec.DefaultModel != "" && (model == "" || !spec.HasModel(model)) {
+		model = spec.DefaultModel
+	}
+	return string(serviceType) + "/" + model
+}
+
+// splitModelRef 拆分 provider/model，前缀不是已知服务时整体视为模型名（模型名本身可能含有/）
+func (m *AIClientManager) splitModelRef(ref string) (AIServiceType, string, bool) {
+	i := strings.Index(ref, "/")
+	if i <= 0 {
+		return "", "", false
+	}
+	provider := AIServiceType(ref[:i])
+	if _, configured := m.specs[provider]; !configured && !m.catalog.hasProvider(provider) {
+		return "", "", false
+	}
+	return provider, ref[i+1:], true
+}
+
+func (m *AIClientManager) pinnedRoute(provider AIServiceType, model string) ([]aiRoute, error) {
+	client, ok := m.clients[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: 服务 %s 未配置", ErrNoAIRoute, provider)
+	}
+	if model != "" && !m.specs[provider].HasModel(model) {
+		return nil, fmt.Errorf("%w: 服务 %s 不提供模型 %s", ErrNoAIRoute, provider, model)
+	}
+	return []aiRoute{{client: client, model: model}}, nil
+}
+
+// availableModels 目录中由可用服务提供且满足条件的模型
+func (m *AIClientManager) availableModels(order map[AIServiceType]int, match func(AIModelInfo) bool) []AIModelInfo {
+	var models []AIModelInfo
+	for _, info := range m.catalog.models {
+		if _, ok := order[info.Provider]; !ok || info.Tier == AIModelTierEmbedding || !match(info) {
+			continue
+		}
+		if !m.specs[info.Provider].HasModel(info.Model) {
+			continue
+		}
+		models = append(models, info)
+	}
+	return models
+}
+
+func filterModels(models []AIModelInfo, keep func(AIModelInfo) bool) []AIModelInfo {
+	var kept []AIModelInfo
+	for _, info := range models {
+		if keep(info) {
+			kept = append(kept, info)
+		}
+	}
+	return kept
+}
+
+// sortModels 按策略排序，相同时按服务的健康顺序
+func (m *AIClientManager) sortModels(models []AIModelInfo, policy AIRoutePolicy, order map[AIServiceType]int) {
+	latency := make(map[string]int64, len(models))
+	if policy == AIRouteFastest {
+		for _, info := range models {
+			latency[info.Ref()] = m.observedLatencyMs(info)
+		}
+	}
+
+	sort.SliceStable(models, func(i, j int) bool {
+		a, b := models[i], models[j]
+		switch policy {
+		case AIRouteCheapest:
+			if ca, cb := a.InputPrice+a.OutputPrice, b.InputPrice+b.OutputPrice; ca != cb {
+				return ca < cb
+			}
+		case AIRouteFastest:
+			if la, lb := latency[a.Ref()], latency[b.Ref()]; la != lb {
+				return la < lb
+			}
+		case AIRouteQuality:
+			if a.Quality != b.Quality {
+				return a.Quality > b.Quality
+			}
+		}
+		return order[a.Provider] < order[b.Provider]
+	})
+}
+
+// observedLatencyMs 服务最近的平均延迟，没有调用记录时使用目录中的典型延迟
+func (m *AIClientManager) observedLatencyMs(info AIModelInfo) int64 {
+	if health, ok := m.health[info.Provider]; ok {
+		if snapshot := health.Snapshot(0); snapshot.SampleSize > 0 {
+			return snapshot.AvgLatencyMs
+		}
+	}
+	return int64(info.LatencyMs)
+}
+
+// hintRoutes 模型只作为提示：声明了该模型的服务优先，其余服务使用各自的默认模型
+func hintRoutes(clients []AIClient, specs map[AIServiceType]AIProviderSpec, model string) []aiRoute {
+	var preferred, others []aiRoute
+	for _, client := range clients {
+		spec := specs[client.GetServiceType()]
+		route := aiRoute{client: client, model: model}
+		if model != "" && len(spec.Models) > 0 && spec.HasModel(model) {
+			preferred = append(preferred, route)
+		} else {
+			others = append(others, route)
+		}
+	}
+	return append(preferred, others...)
+}
+
+// estimateRequestTokens 估算请求需要的上下文长度（输入加最大输出）
+func estimateRequestTokens(req *AIRequest) int {
+	tokens := req.MaxTokens
+	for _, msg := range req.Messages {
+		tokens += estimateTokens(msg.Content) + aiMessageOverheadTokens
+	}
+	return tokens
+}
+
+// providerPrice 服务默认模型的输入加输出单价，不在目录中时为0
+func (m *AIClientManager) providerPrice(serviceType AIServiceType) float64 {
+	info, ok := m.catalog.Lookup(serviceType, m.specs[serviceType].DefaultModel)
+	if !ok {
+		return 0
+	}
+	return info.InputPrice + info.OutputPrice
+}
+
+// providerPaid 服务的默认模型是否收费，用于超出预算时的降级
+func (m *AIClientManager) providerPaid(serviceType AIServiceType) bool {
+	return m.providerPrice(serviceType) > 0
+}
+
+// Catalog 模型目录
+func (m *AIClientManager) Catalog() *AIModelCatalog {
+	return m.catalog
+}
+
+// request 本次尝试使用的请求，模型与原请求相同时不复制
+func (r aiRoute) request(req *AIRequest) *AIRequest {
+	if r.model == req.Model {
+		return req
+	}
+	routed := *req
+	routed.Model = r.model
+	return &routed
+}
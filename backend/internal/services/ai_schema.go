@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONSchema JSON Schema的常用子集，用于约束和校验模型输出
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+}
+
+// ParseJSONSchema 解析JSON Schema文档
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	var schema JSONSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("解析JSON Schema失败: %w", err)
+	}
+	return &schema, nil
+}
+
+// JSONSchemaFor 根据Go类型生成JSON Schema
+//
+// 字段名取json标签，未标记omitempty的字段视为必填。可以用jsonschema标签补充约束，
+// 例如 `jsonschema:"enum=unit|integration,minimum=1,maximum=5,minItems=1,description=用例名称"`
+func JSONSchemaFor(v interface{}) *JSONSchema {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func (s *JSONSchema) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaForType(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &JSONSchema{Type: "string", Description: "RFC 3339 time"}
+	case t.Kind() == reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case t.Kind() == reflect.String:
+		return &JSONSchema{Type: "string"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaForType(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &JSONSchema{Type: "object"}
+	case t.Kind() == reflect.Struct:
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, omitempty := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+
+			prop := schemaForType(field.Type)
+			applySchemaTag(prop, field.Tag.Get("jsonschema"))
+			schema.Properties[name] = prop
+			if !omitempty {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	default:
+		return &JSONSchema{}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("json"), ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omitempty := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
+
+// applySchemaTag 解析jsonschema标签中的约束
+func applySchemaTag(schema *JSONSchema, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, item := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(item, "=")
+		switch key {
+		case "description":
+			schema.Description = value
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				schema.Enum = append(schema.Enum, v)
+			}
+		case "minimum", "maximum":
+			if n, err := strconv.ParseFloat(value, 64); err == nil {
+				if key == "minimum" {
+					schema.Minimum = &n
+				} else {
+					schema.Maximum = &n
+				}
+			}
+		case "minLength", "minItems", "maxItems":
+			if n, err := strconv.Atoi(value); err == nil {
+				switch key {
+				case "minLength":
+					schema.MinLength = &n
+				case "minItems":
+					schema.MinItems = &n
+				default:
+					schema.MaxItems = &n
+				}
+			}
+		}
+	}
+}
+
+// Validate 校验JSON值（json.Unmarshal到interface{}的结果），返回所有不符合的位置
+func (s *JSONSchema) Validate(value interface{}) []string {
+	var problems []string
+	s.validate("$", value, &problems)
+	return problems
+}
+
+func (s *JSONSchema) validate(path string, value interface{}, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && !jsonTypeMatches(s.Type, value) {
+		fail("应为%s，实际为%s", s.Type, jsonTypeOf(value))
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		matched := false
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("取值必须是 %v 之一", s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("不能小于%v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("不能大于%v", *s.Maximum)
+		}
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			fail("长度不能小于%d", *s.MinLength)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("至少需要%d项", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("最多%d项", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				fail("缺少必填字段 %s", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					fail("不允许的字段 %s", name)
+				}
+				continue
+			}
+			prop.validate(path+"."+name, v[name], problems)
+		}
+	}
+}
+
+func jsonTypeMatches(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeOf(value) == schemaType
+	}
+}
+
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	type item struct {
+		Name     string  `json:"name" jsonschema:"minLength=1"`
+		Priority string  `json:"priority" jsonschema:"enum=high|medium|low"`
+		Score    float64 `json:"score" jsonschema:"minimum=0,maximum=1"`
+		Note     string  `json:"note,omitempty"`
+	}
+	type suite struct {
+		Items []item `json:"items" jsonschema:"minItems=1"`
+	}
+	schema := JSONSchemaFor(&suite{})
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"valid", `{"items":[{"name":"登录","priority":"high","score":0.5}]}`, nil},
+		{"optional field omitted", `{"items":[{"name":"a","priority":"low","score":1,"note":"x"}]}`, nil},
+		{"missing required", `{"items":[{"name":"登录","score":0.5}]}`, []string{"$.items[0]: 缺少必填字段 priority"}},
+		{"wrong type", `{"items":{"name":"登录"}}`, []string{"$.items: 应为array，实际为object"}},
+		{"enum and range", `{"items":[{"name":"","priority":"urgent","score":2}]}`, []string{
+			"$.items[0].name: 长度不能小于1",
+			"$.items[0].priority: 取值必须是 [high medium low] 之一",
+			"$.items[0].score: 不能大于1",
+		}},
+		{"min items", `{"items":[]}`, []string{"$.items: 至少需要1项"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Validate(value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsedJSONSchemaValidate(t *testing.T) {
+	schema, err := ParseJSONSchema([]byte(`{
+		"type": "object",
+		"properties": {"count": {"type": "integer"}},
+		"required": ["count"],
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatalf("ParseJSONSchema() error = %v", err)
+	}
+
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{`{"count": 3}`, nil},
+		{`{"count": 3.5}`, []string{"$.count: 应为integer，实际为number"}},
+		{`{"count": 1, "extra": true}`, []string{"$: 不允许的字段 extra"}},
+		{`[]`, []string{"$: 应为object，实际为array"}},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		if got := schema.Validate(value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Validate(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateStructuredRepairsInvalidOutput(t *testing.T) {
+	type verdict struct {
+		Label string  `json:"label" jsonschema:"enum=pass|fail"`
+		Score float64 `json:"score" jsonschema:"minimum=0,maximum=1"`
+	}
+
+	tests := []struct {
+		name        string
+		fixtures    string
+		maxRepairs  int
+		wantCalls   int
+		wantErr     bool
+		wantProblem string
+	}{
+		{
+			// 修正请求中包含具体问题时才返回合法结果
+			name: "schema violation is fed back and retried",
+			fixtures: `
+fixtures:
+  - match: 'label: 取值必须是 \[pass fail\] 之一'
+    content: '{"label":"pass","score":0.9}'
+  - match: "."
+    content: '{"label":"maybe","score":0.9}'
+`,
+			maxRepairs: 2,
+			wantCalls:  2,
+		},
+		{
+			name: "invalid json is retried",
+			fixtures: `
+fixtures:
+  - match: "不是合法的JSON"
+    content: '{"label":"fail","score":0}'
+  - match: "."
+    content: '好的，结果是 {"label": '
+`,
+			maxRepairs: 1,
+			wantCalls:  2,
+		},
+		{
+			name: "gives up after the repairs are used",
+			fixtures: `
+default:
+  content: '{"label":"pass"}'
+`,
+			maxRepairs:  2,
+			wantCalls:   3,
+			wantErr:     true,
+			wantProblem: "$: 缺少必填字段 score",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestAIClientManager(t, tt.fixtures)
+			m.config.AIStructuredMaxRepairs = tt.maxRepairs
+			client := mockClient(t, m, "mock")
+
+			var out verdict
+			resp, err := m.GenerateStructured(context.Background(), testAIRequest(), nil, &out)
+			if client.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", client.calls, tt.wantCalls)
+			}
+
+			if tt.wantErr {
+				var structuredErr *AIStructuredError
+				if !errors.As(err, &structuredErr) || structuredErr.Attempts != tt.wantCalls || structuredErr.Raw != `{"label":"pass"}` {
+					t.Fatalf("GenerateStructured() error = %v, want AIStructuredError", err)
+				}
+				if !reflect.DeepEqual(structuredErr.Problems, []string{tt.wantProblem}) {
+					t.Errorf("problems = %q, want %q", structuredErr.Problems, tt.wantProblem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GenerateStructured() error = %v", err)
+			}
+			if out.Label == "" || resp.Usage.TotalTokens == 0 {
+				t.Errorf("out = %+v, usage = %+v", out, resp.Usage)
+			}
+		})
+	}
+}
+
+func TestGenerateStructuredWrappedRepair(t *testing.T) {
+	// 非对象的Schema包装在result字段中，直接返回数组时要求修正
+	m := newTestAIClientManager(t, `
+fixtures:
+  - match: "问题如下"
+    content: '{"result":["a","b"]}'
+  - match: "."
+    content: '["a","b"]'
+`)
+	m.config.AIStructuredMaxRepairs = 1
+
+	var out []string
+	if _, err := m.GenerateStructured(context.Background(), testAIRequest(), nil, &out); err != nil {
+		t.Fatalf("GenerateStructured() error = %v", err)
+	}
+	if !reflect.DeepEqual(out, []string{"a", "b"}) {
+		t.Errorf("out = %v", out)
+	}
+	if calls := mockClient(t, m, "mock").calls; calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// AIStreamChunk 流式输出的增量片段
+type AIStreamChunk struct {
+	ID           string   `json:"id,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Delta        string   `json:"delta"`
+	FinishReason string   `json:"finish_reason,omitempty"`
+	Usage        *AIUsage `json:"usage,omitempty"`
+	Err          error    `json:"-"`
+}
+
+// OpenAI兼容的流式数据块
+type aiStreamPayload struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *AIUsage `json:"usage"`
+}
+
+// 发送流式HTTP请求
+func (c *BaseAIClient) sendStreamRequest(ctx context.Context, endpoint string, req *AIRequest) (<-chan AIStreamChunk, error) {
+	streamReq := *req
+	streamReq.Stream = true
+	streamReq.Model = c.resolveModel(req.Model)
+	return c.postStream(ctx, c.baseURL+endpoint, &streamReq)
+}
+
+// 发送请求并将SSE响应解析为增量片段
+func (c *BaseAIClient) postStream(ctx context.Context, url string, payload interface{}) (<-chan AIStreamChunk, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	c.setAuthHeader(httpReq)
+
+	return c.doStream(httpReq, parseAIStream(c.spec.SendsStreamDone()), nil)
+}
+
+// aiStreamParser 将SSE响应体解析为增量片段
+type aiStreamParser func(ctx context.Context, body io.Reader, chunks chan<- AIStreamChunk) error
+
+// doStream 发送已构建好的流式请求
+//
+// 部分服务在出错时仍返回200和普通JSON，checkBody用于从非SSE响应中提取错误
+func (c *BaseAIClient) doStream(httpReq *http.Request, parse aiStreamParser, checkBody func([]byte) error) (<-chan AIStreamChunk, error) {
+	ctx := httpReq.Context()
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newAIStatusError(resp.StatusCode, string(respBody))
+	}
+
+	if checkBody != nil && !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("读取响应失败: %w", err)
+		}
+		if err := checkBody(respBody); err != nil {
+			return nil, err
+		}
+		return nil, newAIMalformedError(fmt.Errorf("服务未返回流式响应"))
+	}
+
+	chunks := make(chan AIStreamChunk)
+	go func() {
+		defer close(chunks)
+		defer resp.Body.Close()
+
+		if err := parse(ctx, resp.Body, chunks); err != nil {
+			select {
+			case chunks <- AIStreamChunk{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return chunks, nil
+}
+
+// ErrAIStreamTruncated 连接在流式响应的结束标记之前断开
+var ErrAIStreamTruncated = errors.New("流式响应未结束连接已断开")
+
+// newAIStreamTruncatedError 流式响应被截断，按网络错误处理，可以换其他服务重试
+func newAIStreamTruncatedError() error {
+	return &AIProviderError{
+		Kind:      AIErrorNetwork,
+		Retryable: true,
+		Message:   ErrAIStreamTruncated.Error(),
+		Err:       ErrAIStreamTruncated,
+	}
+}
+
+// scanSSEData 逐个读取SSE事件的 "data:" 内容，handle返回true时结束
+//
+// 同一事件的多行data以换行连接，注释行（以冒号开头）和其他字段忽略。
+// 连接在handle返回true之前结束时返回 ErrAIStreamTruncated
+func scanSSEData(body io.Reader, handle func(data string) (bool, error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data []string
+	dispatch := func() (bool, error) {
+		if len(data) == 0 {
+			return false, nil
+		}
+		event := strings.TrimSpace(strings.Join(data, "\n"))
+		data = data[:0]
+		if event == "" {
+			return false, nil
+		}
+		return handle(event)
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			// 空行表示事件结束
+			if done, err := dispatch(); err != nil || done {
+				return err
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		if field != "data" {
+			// 注释（心跳）、event、id等行不携带内容
+			continue
+		}
+		data = append(data, strings.TrimPrefix(value, " "))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取流式响应失败: %w", err)
+	}
+
+	// 最后一个事件后可能没有空行
+	done, err := dispatch()
+	if err != nil {
+		return err
+	}
+	if !done {
+		return newAIStreamTruncatedError()
+	}
+	return nil
+}
+
+// sendStreamChunk 发送片段，跳过既无内容也无结束信息的心跳块
+func sendStreamChunk(ctx context.Context, chunks chan<- AIStreamChunk, chunk AIStreamChunk) error {
+	if chunk.Delta == "" && chunk.FinishReason == "" && chunk.Usage == nil {
+		return nil
+	}
+
+	select {
+	case chunks <- chunk:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseAIStream 解析OpenAI风格的 "data:" 行，以 [DONE] 结束
+//
+// requireDone为false时服务不发送 [DONE]，收到结束原因后连接关闭也视为正常结束
+func parseAIStream(requireDone bool) aiStreamParser {
+	return func(ctx context.Context, body io.Reader, chunks chan<- AIStreamChunk) error {
+		finished := false
+		err := scanSSEData(body, func(data string) (bool, error) {
+			if data == "[DONE]" {
+				return true, nil
+			}
+
+			var payload aiStreamPayload
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				return false, newAIMalformedError(err)
+			}
+
+			chunk := AIStreamChunk{
+				ID:    payload.ID,
+				Model: payload.Model,
+				Usage: payload.Usage,
+			}
+			if len(payload.Choices) > 0 {
+				chunk.Delta = payload.Choices[0].Delta.Content
+				if payload.Choices[0].FinishReason != nil {
+					chunk.FinishReason = *payload.Choices[0].FinishReason
+				}
+			}
+			if chunk.FinishReason != "" {
+				finished = true
+			}
+
+			return false, sendStreamChunk(ctx, chunks, chunk)
+		})
+		if !requireDone && finished && errors.Is(err, ErrAIStreamTruncated) {
+			return nil
+		}
+		return err
+	}
+}
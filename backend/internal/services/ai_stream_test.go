@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// collectAIStream 解析SSE响应，返回收到的增量内容、结束原因和错误
+func collectAIStream(parse aiStreamParser, body string) (deltas []string, finish string, err error) {
+	chunks := make(chan AIStreamChunk)
+	done := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		// 每次只读一个字节，模拟data行被拆成多个网络包
+		done <- parse(context.Background(), iotest.OneByteReader(strings.NewReader(body)), chunks)
+	}()
+	for chunk := range chunks {
+		if chunk.Delta != "" {
+			deltas = append(deltas, chunk.Delta)
+		}
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+	}
+	return deltas, finish, <-done
+}
+
+func TestParseAIStream(t *testing.T) {
+	const (
+		hello = `data: {"choices":[{"delta":{"content":"你好"}}]}` + "\n\n"
+		world = `data: {"choices":[{"delta":{"content":"世界"}}]}` + "\n\n"
+		stop  = `data: {"choices":[{"delta":{},"finish_reason":"stop"}]}` + "\n\n"
+		done  = "data: [DONE]\n\n"
+	)
+
+	tests := []struct {
+		name        string
+		body        string
+		requireDone bool
+		wantDeltas  []string
+		wantFinish  string
+		wantErr     error
+	}{
+		{
+			name:        "done sentinel",
+			body:        hello + world + stop + done,
+			requireDone: true,
+			wantDeltas:  []string{"你好", "世界"},
+			wantFinish:  "stop",
+		},
+		{
+			name:        "data after done is ignored",
+			body:        hello + done + world,
+			requireDone: true,
+			wantDeltas:  []string{"你好"},
+		},
+		{
+			name:        "crlf and no space after colon",
+			body:        "data:" + `{"choices":[{"delta":{"content":"你好"}}]}` + "\r\n\r\ndata:[DONE]\r\n\r\n",
+			requireDone: true,
+			wantDeltas:  []string{"你好"},
+		},
+		{
+			name:        "comments and keep-alive lines",
+			body:        ": keep-alive\n\n" + hello + ":\n\nevent: ping\ndata:\n\n" + world + "id: 3\nretry: 1000\n\n" + done,
+			requireDone: true,
+			wantDeltas:  []string{"你好", "世界"},
+		},
+		{
+			name:        "multi-line event",
+			body:        "data: {\"choices\":[{\"delta\":\ndata: {\"content\":\"你好\"}}]}\n\n" + done,
+			requireDone: true,
+			wantDeltas:  []string{"你好"},
+		},
+		{
+			name:        "last event without blank line",
+			body:        hello + "data: [DONE]",
+			requireDone: true,
+			wantDeltas:  []string{"你好"},
+		},
+		{
+			name:        "truncated stream",
+			body:        hello + world,
+			requireDone: true,
+			wantDeltas:  []string{"你好", "世界"},
+			wantErr:     ErrAIStreamTruncated,
+		},
+		{
+			name:        "truncated after finish reason",
+			body:        hello + stop,
+			requireDone: true,
+			wantDeltas:  []string{"你好"},
+			wantFinish:  "stop",
+			wantErr:     ErrAIStreamTruncated,
+		},
+		{
+			name:       "provider without sentinel ends after finish reason",
+			body:       hello + stop,
+			wantDeltas: []string{"你好"},
+			wantFinish: "stop",
+		},
+		{
+			name:       "provider without sentinel truncated",
+			body:       hello,
+			wantDeltas: []string{"你好"},
+			wantErr:    ErrAIStreamTruncated,
+		},
+		{
+			name:        "empty response",
+			body:        "",
+			requireDone: true,
+			wantErr:     ErrAIStreamTruncated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas, finish, err := collectAIStream(parseAIStream(tt.requireDone), tt.body)
+			if !reflect.DeepEqual(deltas, tt.wantDeltas) || finish != tt.wantFinish {
+				t.Errorf("deltas = %q, finish = %q, want %q, %q", deltas, finish, tt.wantDeltas, tt.wantFinish)
+			}
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			// 截断按网络错误处理，可以重试
+			var providerErr *AIProviderError
+			if err != nil && (!errors.As(err, &providerErr) || providerErr.Kind != AIErrorNetwork || !providerErr.Retryable) {
+				t.Errorf("error = %#v, want a retryable network error", err)
+			}
+		})
+	}
+}
+
+func TestParseAIStreamMalformed(t *testing.T) {
+	_, _, err := collectAIStream(parseAIStream(true), "data: {\"choices\":\n\ndata: [DONE]\n\n")
+	var providerErr *AIProviderError
+	if !errors.As(err, &providerErr) || providerErr.Kind != AIErrorMalformed {
+		t.Errorf("error = %v, want malformed response", err)
+	}
+}
+
+func TestAIProviderSpecSendsStreamDone(t *testing.T) {
+	off := false
+	if !(AIProviderSpec{}).SendsStreamDone() {
+		t.Error("SendsStreamDone() = false by default")
+	}
+	if (AIProviderSpec{StreamDone: &off}).SendsStreamDone() {
+		t.Error("SendsStreamDone() = true with stream_done: false")
+	}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"qa-toolbox-backend/internal/models"
+)
+
+// AIStructuredError 多次修复后模型输出仍不符合Schema
+type AIStructuredError struct {
+	Attempts int      `json:"attempts"`
+	Problems []string `json:"problems"`
+	Raw      string   `json:"raw"`
+}
+
+func (e *AIStructuredError) Error() string {
+	return fmt.Sprintf("AI输出不符合JSON Schema（尝试%d次）: %s", e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// 结构化输出的提示语
+var structuredPrompts = map[string]struct {
+	instruction string
+	repair      string
+}{
+	"zh": {
+		instruction: "请只输出一个符合以下JSON Schema的JSON对象，不要使用Markdown代码块，也不要包含其他文字。\nJSON Schema:\n%s",
+		repair:      "上面的回复不符合要求的JSON Schema，问题如下：\n%s\n请只输出修正后的完整JSON对象，不要包含其他文字。",
+	},
+	"en": {
+		instruction: "Respond with a single JSON object that conforms to the JSON Schema below. Do not use Markdown code fences or add any other text.\nJSON Schema:\n%s",
+		repair:      "Your previous reply does not conform to the required JSON Schema:\n%s\nRespond with the corrected, complete JSON object only.",
+	},
+}
+
+// GenerateStructured 生成符合JSON Schema的结果并解析到out
+//
+// schema为nil时根据out的类型生成。模型输出无法解析或不符合Schema时，把问题反馈给模型重新生成，
+// 最多修复 AIStructuredMaxRepairs 次。返回的响应为最后一次调用，Usage为所有尝试的合计
+func (m *AIClientManager) GenerateStructured(ctx context.Context, req *AIRequest, schema *JSONSchema, out interface{}) (*AIResponse, error) {
+	if schema == nil {
+		schema = JSONSchemaFor(out)
+	}
+
+	// JSON模式只支持对象，其他类型包装在result字段中
+	wrapped := schema.Type != "object"
+	requestSchema := schema
+	if wrapped {
+		requestSchema = &JSONSchema{
+			Type:       "object",
+			Properties: map[string]*JSONSchema{"result": schema},
+			Required:   []string{"result"},
+		}
+	}
+
+	prompts := structuredPrompts[localeFor(structuredPrompts, AILocaleFrom(ctx))]
+	attemptReq := *req
+	attemptReq.ResponseFormat = &AIResponseFormat{Type: "json_object"}
+	attemptReq.Messages = withSystemInstruction(req.Messages, fmt.Sprintf(prompts.instruction, requestSchema.String()))
+
+	attempts := 1 + m.config.AIStructuredMaxRepairs
+	var total AIUsage
+	var problems []string
+	var content string
+	for attempt := 1; attempt <= attempts; attempt++ {
+		resp, err := m.GenerateText(ctx, &attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		total.PromptTokens += resp.Usage.PromptTokens
+		total.CompletionTokens += resp.Usage.CompletionTokens
+		total.TotalTokens += resp.Usage.TotalTokens
+
+		content = ""
+		if len(resp.Choices) > 0 {
+			content = resp.Choices[0].Message.Content
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(extractJSON(content)), &value); err != nil {
+			problems = []string{fmt.Sprintf("不是合法的JSON: %v", err)}
+		} else {
+			problems = requestSchema.Validate(value)
+		}
+
+		if len(problems) == 0 {
+			if wrapped {
+				value = value.(map[string]interface{})["result"]
+			}
+			if err := decodeJSONValue(value, out); err != nil {
+				problems = []string{err.Error()}
+			} else {
+				resp.Usage = total
+				return resp, nil
+			}
+		}
+
+		// 把错误反馈给模型，要求修正
+		attemptReq.Messages = append(attemptReq.Messages,
+			AIMessage{Role: "assistant", Content: content},
+			AIMessage{Role: "user", Content: fmt.Sprintf(prompts.repair, "- "+strings.Join(problems, "\n- "))},
+		)
+	}
+
+	return nil, &AIStructuredError{Attempts: attempts, Problems: problems, Raw: content}
+}
+
+// 模型生成的测试用例，转换为models.TestCase后保存
+type generatedTestCase struct {
+	Name        string   `json:"name" jsonschema:"minLength=1"`
+	Description string   `json:"description"`
+	Code        string   `json:"code" jsonschema:"minLength=1"`
+	Type        string   `json:"type" jsonschema:"enum=unit|integration|boundary|exception|performance|security|e2e"`
+	Tags        []string `json:"tags"`
+	Priority    int      `json:"priority" jsonschema:"minimum=1,maximum=5"`
+	IsAutomated bool     `json:"is_automated"`
+}
+
+type generatedTestSuite struct {
+	TestCases []generatedTestCase `json:"test_cases" jsonschema:"minItems=1"`
+}
+
+// GenerateTestCaseList 生成结构化的测试用例列表，结果可以直接保存
+func (m *AIClientManager) GenerateTestCaseList(ctx context.Context, req *models.TestGenerationRequest) ([]models.TestCase, *AIResult, error) {
+	ctx = WithAIFeature(ctx, AIFeatureTestGeneration)
+
+	tpl, err := m.selectPrompt(ctx, PromptTestCaseList)
+	if err != nil {
+		return nil, nil, err
+	}
+	aiReq, err := tpl.Render(map[string]interface{}{
+		"code":                      req.Code,
+		"language":                  req.Language,
+		"framework":                 req.Framework,
+		"test_type":                 req.TestType,
+		"description":               req.Description,
+		"include_edge_cases":        req.IncludeEdgeCases,
+		"include_performance_tests": req.IncludePerformanceTests,
+		"include_security_tests":    req.IncludeSecurityTests,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var suite generatedTestSuite
+	resp, err := m.GenerateStructured(ctx, aiReq, nil, &suite)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := newAIResult(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Prompt = tpl.Ref()
+
+	testCases := make([]models.TestCase, 0, len(suite.TestCases))
+	for _, generated := range suite.TestCases {
+		testCases = append(testCases, models.TestCase{
+			ID:          uuid.New().String(),
+			Name:        generated.Name,
+			Description: generated.Description,
+			Code:        generated.Code,
+			Type:        generated.Type,
+			Tags:        generated.Tags,
+			Priority:    generated.Priority,
+			IsAutomated: generated.IsAutomated,
+			Metadata: map[string]interface{}{
+				"language":       req.Language,
+				"framework":      req.Framework,
+				"model":          result.Model,
+				"prompt_version": tpl.Version,
+			},
+		})
+	}
+
+	return testCases, result, nil
+}
+
+// withSystemInstruction 将说明追加到system消息中，没有system消息时插入到最前面
+//
+// 部分服务只接受位于开头的system消息
+func withSystemInstruction(messages []AIMessage, instruction string) []AIMessage {
+	result := append([]AIMessage{}, messages...)
+	if len(result) > 0 && result[0].Role == "system" {
+		result[0].Content += "\n\n" + instruction
+		return result
+	}
+	return append([]AIMessage{{Role: "system", Content: instruction}}, result...)
+}
+
+// extractJSON 从模型回复中取出JSON部分（去掉代码块标记和前后说明文字）
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	}
+
+	start := strings.IndexAny(content, "{[")
+	end := strings.LastIndexAny(content, "}]")
+	if start < 0 || end < start {
+		return content
+	}
+	return content[start : end+1]
+}
+
+// decodeJSONValue 将校验过的JSON值解码到目标类型
+func decodeJSONValue(value interface{}, out interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("序列化结构化结果失败: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析结构化结果失败: %w", err)
+	}
+	return nil
+}
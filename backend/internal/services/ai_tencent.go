@@ -0,0 +1,335 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+// 腾讯云API参数
+const (
+	tencentHunyuanService = "hunyuan"
+	tencentHunyuanAction  = "ChatCompletions"
+	tencentHunyuanVersion = "2023-09-01"
+	tencentTC3Algorithm   = "TC3-HMAC-SHA256"
+)
+
+// 腾讯混元客户端（腾讯云API 3.0，TC3-HMAC-SHA256签名）
+type TencentClient struct {
+	*BaseAIClient
+	secretID string
+	region   string
+	now      func() time.Time
+}
+
+func NewTencentClient(cfg *config.Config, spec AIProviderSpec) *TencentClient {
+	return &TencentClient{
+		BaseAIClient: NewBaseAIClient(cfg, spec),
+		secretID:     cfg.TencentSecretID,
+		region:       cfg.TencentRegion,
+		now:          time.Now,
+	}
+}
+
+// 混元请求体
+type tencentChatRequest struct {
+	Model       string           `json:"Model"`
+	Messages    []tencentMessage `json:"Messages"`
+	Stream      bool             `json:"Stream"`
+	Temperature float64          `json:"Temperature"`
+	Tools       []tencentTool    `json:"Tools,omitempty"`
+	ToolChoice  string           `json:"ToolChoice,omitempty"`
+}
+
+type tencentMessage struct {
+	Role       string            `json:"Role"`
+	Content    string            `json:"Content"`
+	ToolCalls  []tencentToolCall `json:"ToolCalls,omitempty"`
+	ToolCallID string            `json:"ToolCallId,omitempty"`
+}
+
+// 混元的工具定义，参数Schema为JSON字符串
+type tencentTool struct {
+	Type     string `json:"Type"`
+	Function struct {
+		Name        string `json:"Name"`
+		Description string `json:"Description,omitempty"`
+		Parameters  string `json:"Parameters"`
+	} `json:"Function"`
+}
+
+type tencentToolCall struct {
+	ID       string `json:"Id"`
+	Type     string `json:"Type"`
+	Function struct {
+		Name      string `json:"Name"`
+		Arguments string `json:"Arguments"`
+	} `json:"Function"`
+}
+
+type tencentUsage struct {
+	PromptTokens     int `json:"PromptTokens"`
+	CompletionTokens int `json:"CompletionTokens"`
+	TotalTokens      int `json:"TotalTokens"`
+}
+
+type tencentError struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+}
+
+// 混元非流式响应
+type tencentChatResponse struct {
+	Response struct {
+		RequestID string `json:"RequestId"`
+		ID        string `json:"Id"`
+		Choices   []struct {
+			Message      tencentMessage `json:"Message"`
+			FinishReason string         `json:"FinishReason"`
+		} `json:"Choices"`
+		Usage tencentUsage  `json:"Usage"`
+		Error *tencentError `json:"Error"`
+	} `json:"Response"`
+}
+
+// 混元流式数据块
+type tencentStreamPayload struct {
+	ID      string `json:"Id"`
+	Choices []struct {
+		Delta        tencentMessage `json:"Delta"`
+		FinishReason string         `json:"FinishReason"`
+	} `json:"Choices"`
+	Usage *tencentUsage `json:"Usage"`
+}
+
+func (c *TencentClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
+	model := c.resolveModel(req.Model)
+	httpReq, err := c.newSignedRequest(ctx, c.buildRequest(req, model, false))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAIStatusError(resp.StatusCode, string(body))
+	}
+
+	var chatResp tencentChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, newAIMalformedError(err)
+	}
+	if chatResp.Response.Error != nil {
+		return nil, tencentAPIError(chatResp.Response.Error)
+	}
+	if len(chatResp.Response.Choices) == 0 {
+		return nil, newAIMalformedError(fmt.Errorf("API返回空响应"))
+	}
+
+	choice := chatResp.Response.Choices[0]
+	aiResp := newAIResponse(chatResp.Response.ID, model, choice.Message.Content, choice.FinishReason, chatResp.Response.Usage.toAIUsage())
+	for _, call := range choice.Message.ToolCalls {
+		toolCall := AIToolCall{ID: call.ID, Type: call.Type}
+		toolCall.Function.Name = call.Function.Name
+		toolCall.Function.Arguments = call.Function.Arguments
+		aiResp.Choices[0].Message.ToolCalls = append(aiResp.Choices[0].Message.ToolCalls, toolCall)
+	}
+	return aiResp, nil
+}
+
+func (c *TencentClient) GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error) {
+	model := c.resolveModel(req.Model)
+	httpReq, err := c.newSignedRequest(ctx, c.buildRequest(req, model, true))
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(ctx context.Context, body io.Reader, chunks chan<- AIStreamChunk) error {
+		return scanSSEData(body, func(data string) (bool, error) {
+			var payload tencentStreamPayload
+			if err := json.Unmarshal([]byte(data), &payload); err != nil {
+				return false, newAIMalformedError(err)
+			}
+
+			chunk := AIStreamChunk{ID: payload.ID, Model: model}
+			if len(payload.Choices) > 0 {
+				chunk.Delta = payload.Choices[0].Delta.Content
+				chunk.FinishReason = payload.Choices[0].FinishReason
+			}
+			if chunk.FinishReason != "" && payload.Usage != nil {
+				usage := payload.Usage.toAIUsage()
+				chunk.Usage = &usage
+			}
+
+			// 混元没有 [DONE] 标记，以FinishReason作为结束
+			if err := sendStreamChunk(ctx, chunks, chunk); err != nil {
+				return false, err
+			}
+			return chunk.FinishReason != "", nil
+		})
+	}
+
+	// 出错时混元返回200和普通JSON
+	checkBody := func(body []byte) error {
+		var chatResp tencentChatResponse
+		if err := json.Unmarshal(body, &chatResp); err != nil {
+			return newAIMalformedError(err)
+		}
+		if chatResp.Response.Error != nil {
+			return tencentAPIError(chatResp.Response.Error)
+		}
+		return nil
+	}
+
+	return c.doStream(httpReq, parse, checkBody)
+}
+
+func (c *TencentClient) IsAvailable() bool {
+	return c.apiKey != "" && c.secretID != ""
+}
+
+func (c *TencentClient) buildRequest(req *AIRequest, model string, stream bool) *tencentChatRequest {
+	chatReq := &tencentChatRequest{
+		Model:       model,
+		Stream:      stream,
+		Temperature: req.Temperature,
+	}
+	for _, msg := range req.Messages {
+		message := tencentMessage{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID}
+		for _, call := range msg.ToolCalls {
+			toolCall := tencentToolCall{ID: call.ID, Type: call.Type}
+			toolCall.Function.Name = call.Function.Name
+			toolCall.Function.Arguments = call.Function.Arguments
+			message.ToolCalls = append(message.ToolCalls, toolCall)
+		}
+		chatReq.Messages = append(chatReq.Messages, message)
+	}
+	for _, tool := range req.Tools {
+		parameters := "{}"
+		if tool.Function.Parameters != nil {
+			parameters = tool.Function.Parameters.String()
+		}
+		tencentTool := tencentTool{Type: tool.Type}
+		tencentTool.Function.Name = tool.Function.Name
+		tencentTool.Function.Description = tool.Function.Description
+		tencentTool.Function.Parameters = parameters
+		chatReq.Tools = append(chatReq.Tools, tencentTool)
+	}
+	// 混元只支持 none 和 auto
+	if len(chatReq.Tools) > 0 && (req.ToolChoice == "none" || req.ToolChoice == "auto") {
+		chatReq.ToolChoice = req.ToolChoice
+	}
+	return chatReq
+}
+
+// 构建带TC3签名的请求
+func (c *TencentClient) newSignedRequest(ctx context.Context, payload *tencentChatRequest) (*http.Request, error) {
+	if c.apiKey == "" || c.secretID == "" {
+		return nil, fmt.Errorf("腾讯混元API密钥未配置")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求体失败: %w", err)
+	}
+
+	endpoint, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("解析服务地址失败: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	timestamp := c.now().Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-TC-Action", tencentHunyuanAction)
+	httpReq.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set("X-TC-Version", tencentHunyuanVersion)
+	if c.region != "" {
+		httpReq.Header.Set("X-TC-Region", c.region)
+	}
+	httpReq.Header.Set("Authorization", signTC3(c.secretID, c.apiKey, endpoint.Host, tencentHunyuanService, tencentHunyuanAction, body, timestamp))
+
+	return httpReq, nil
+}
+
+// signTC3 计算腾讯云API 3.0的Authorization头
+//
+// 签名头固定为 content-type;host;x-tc-action，与 newSignedRequest 设置的请求头一致
+func signTC3(secretID, secretKey, host, service, action string, payload []byte, timestamp int64) string {
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+
+	// 规范请求串
+	hashedPayload := sha256.Sum256(payload)
+	canonicalRequest := fmt.Sprintf(
+		"POST\n/\n\ncontent-type:application/json\nhost:%s\nx-tc-action:%s\n\ncontent-type;host;x-tc-action\n%s",
+		host, strings.ToLower(action), hex.EncodeToString(hashedPayload[:]),
+	)
+
+	// 待签名字符串
+	credentialScope := fmt.Sprintf("%s/%s/tc3_request", date, service)
+	hashedCanonicalRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := fmt.Sprintf("%s\n%d\n%s\n%s", tencentTC3Algorithm, timestamp, credentialScope, hex.EncodeToString(hashedCanonicalRequest[:]))
+
+	// 派生签名密钥并计算签名
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	return fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=content-type;host;x-tc-action, Signature=%s",
+		tencentTC3Algorithm, secretID, credentialScope, signature)
+}
+
+// hmacSHA256 计算HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// 将腾讯云错误码映射为错误类型
+func tencentAPIError(apiErr *tencentError) error {
+	kind := AIErrorUpstream
+	switch {
+	case strings.HasPrefix(apiErr.Code, "AuthFailure"), strings.HasPrefix(apiErr.Code, "UnauthorizedOperation"):
+		kind = AIErrorAuth
+	case strings.HasPrefix(apiErr.Code, "RequestLimitExceeded"), strings.HasPrefix(apiErr.Code, "LimitExceeded"):
+		kind = AIErrorRateLimited
+	case strings.HasPrefix(apiErr.Code, "InvalidParameter"), strings.HasPrefix(apiErr.Code, "MissingParameter"):
+		kind = AIErrorBadRequest
+	}
+	return newAIVendorError(kind, apiErr.Code, apiErr.Message)
+}
+
+func (u tencentUsage) toAIUsage() AIUsage {
+	return AIUsage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+func TestSignTC3(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		payload   string
+		timestamp int64
+		want      string
+	}{
+		{
+			name:      "fixed timestamp",
+			host:      "hunyuan.tencentcloudapi.com",
+			payload:   `{"Model":"hunyuan-lite"}`,
+			timestamp: 1700000000,
+			want: "TC3-HMAC-SHA256 Credential=AKIDEXAMPLE/2023-11-14/hunyuan/tc3_request, " +
+				"SignedHeaders=content-type;host;x-tc-action, " +
+				"Signature=5c45fe911e8660769b57c2c9da350ba8d34896f4694c260930bf83d372899931",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := signTC3("AKIDEXAMPLE", "SECRETEXAMPLE", tt.host, tencentHunyuanService, tencentHunyuanAction, []byte(tt.payload), tt.timestamp)
+			if got != tt.want {
+				t.Errorf("signTC3() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// 请求体或时间不同，签名必须不同
+	base := signTC3("AKIDEXAMPLE", "SECRETEXAMPLE", "hunyuan.tencentcloudapi.com", tencentHunyuanService, tencentHunyuanAction, []byte("{}"), 1700000000)
+	if other := signTC3("AKIDEXAMPLE", "SECRETEXAMPLE", "hunyuan.tencentcloudapi.com", tencentHunyuanService, tencentHunyuanAction, []byte("{ }"), 1700000000); other == base {
+		t.Error("signTC3() did not change with the payload")
+	}
+	if other := signTC3("AKIDEXAMPLE", "SECRETEXAMPLE", "hunyuan.tencentcloudapi.com", tencentHunyuanService, tencentHunyuanAction, []byte("{}"), 1700000001); other == base {
+		t.Error("signTC3() did not change with the timestamp")
+	}
+}
+
+func newTestTencentClient(baseURL string) *TencentClient {
+	cfg := &config.Config{TencentSecretID: "AKIDEXAMPLE", TencentRegion: "ap-guangzhou"}
+	client := NewTencentClient(cfg, AIProviderSpec{
+		Name:         AIServiceTencent,
+		Protocol:     AIProtocolTencent,
+		BaseURL:      baseURL,
+		APIKey:       "SECRETEXAMPLE",
+		DefaultModel: "hunyuan-lite",
+	})
+	client.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return client
+}
+
+func TestTencentClientGenerateText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u, _ := url.Parse("http://" + r.Host)
+		want := signTC3("AKIDEXAMPLE", "SECRETEXAMPLE", u.Host, tencentHunyuanService, tencentHunyuanAction, body, 1700000000)
+		if got := r.Header.Get("Authorization"); got != want {
+			t.Errorf("Authorization = %q, want %q", got, want)
+		}
+		for header, want := range map[string]string{
+			"X-TC-Action":    tencentHunyuanAction,
+			"X-TC-Version":   tencentHunyuanVersion,
+			"X-TC-Timestamp": strconv.Itoa(1700000000),
+			"X-TC-Region":    "ap-guangzhou",
+		} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("%s = %q, want %q", header, got, want)
+			}
+		}
+
+		var req tencentChatRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("invalid request body: %v", err)
+		}
+		if req.Model != "hunyuan-lite" || len(req.Messages) != 1 || req.Messages[0].Content != "你好" {
+			t.Errorf("unexpected request: %s", body)
+		}
+
+		w.Write([]byte(`{"Response":{"RequestId":"r1","Id":"chat-1","Choices":[{"Message":{"Role":"assistant","Content":"你好！"},"FinishReason":"stop"}],"Usage":{"PromptTokens":3,"CompletionTokens":2,"TotalTokens":5}}}`))
+	}))
+	defer server.Close()
+
+	resp, err := newTestTencentClient(server.URL).GenerateText(context.Background(), &AIRequest{
+		Messages: []AIMessage{{Role: "user", Content: "你好"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+	if resp.ID != "chat-1" || resp.Choices[0].Message.Content != "你好！" || resp.Usage.TotalTokens != 5 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestTencentAPIError(t *testing.T) {
+	tests := []struct {
+		code      string
+		kind      AIErrorKind
+		retryable bool
+	}{
+		{"AuthFailure.SignatureFailure", AIErrorAuth, false},
+		{"UnauthorizedOperation", AIErrorAuth, false},
+		{"RequestLimitExceeded", AIErrorRateLimited, true},
+		{"LimitExceeded.Qps", AIErrorRateLimited, true},
+		{"InvalidParameter", AIErrorBadRequest, false},
+		{"MissingParameter", AIErrorBadRequest, false},
+		{"InternalError", AIErrorUpstream, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"Response": map[string]interface{}{
+						"RequestId": "r1",
+						"Error":     map[string]string{"Code": tt.code, "Message": "failed"},
+					},
+				})
+			}))
+			defer server.Close()
+
+			_, err := newTestTencentClient(server.URL).GenerateText(context.Background(), &AIRequest{
+				Messages: []AIMessage{{Role: "user", Content: "hi"}},
+			})
+			var providerErr *AIProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("error = %v, want *AIProviderError", err)
+			}
+			if providerErr.Kind != tt.kind || providerErr.Retryable != tt.retryable || providerErr.Code != tt.code {
+				t.Errorf("got kind=%s retryable=%v code=%s, want kind=%s retryable=%v code=%s",
+					providerErr.Kind, providerErr.Retryable, providerErr.Code, tt.kind, tt.retryable, tt.code)
+			}
+		})
+	}
+}
+
+func TestTencentClientTemperature(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature float64
+	}{
+		{"explicit zero", 0},
+		{"default", 0.7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				if got, ok := body["Temperature"]; !ok || got != tt.temperature {
+					t.Errorf("Temperature = %v (sent %v), want %v", got, ok, tt.temperature)
+				}
+				w.Write([]byte(`{"Response":{"RequestId":"r1","Id":"chat-1","Choices":[{"Message":{"Role":"assistant","Content":"ok"},"FinishReason":"stop"}]}}`))
+			}))
+			defer server.Close()
+
+			_, err := newTestTencentClient(server.URL).GenerateText(context.Background(), &AIRequest{
+				Messages:    []AIMessage{{Role: "user", Content: "你好"}},
+				Temperature: tt.temperature,
+			})
+			if err != nil {
+				t.Fatalf("GenerateText() error = %v", err)
+			}
+		})
+	}
+}
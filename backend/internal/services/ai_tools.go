@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 单个工具的执行超时
+const aiToolTimeout = 15 * time.Second
+
+// 内置工具名称
+const (
+	AIToolGetWeather  = "get_weather"
+	AIToolGetWorkouts = "get_workouts"
+)
+
+// AITool 可供模型调用的工具定义（OpenAI function calling格式）
+type AITool struct {
+	Type     string     `json:"type"` // 目前只有 function
+	Function AIFunction `json:"function"`
+}
+
+// AIFunction 工具的名称、说明和参数Schema
+type AIFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  *JSONSchema `json:"parameters,omitempty"`
+}
+
+// AIToolCall 模型发起的一次工具调用
+type AIToolCall struct {
+	ID       string         `json:"id"`
+	Type     string         `json:"type"`
+	Function AIFunctionCall `json:"function"`
+}
+
+// AIFunctionCall 调用的工具名和JSON格式的参数
+type AIFunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// AIToolInvocation 工具循环中一次调用的执行记录，随响应返回
+type AIToolInvocation struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// AIToolFunc 工具的实现，返回值序列化为JSON后交给模型
+type AIToolFunc func(ctx context.Context, arguments json.RawMessage) (interface{}, error)
+
+type aiToolEntry struct {
+	tool AITool
+	run  AIToolFunc
+}
+
+// AIToolRegistry 允许模型调用的后端能力白名单，模型只能调用注册过的工具
+type AIToolRegistry struct {
+	tools map[string]*aiToolEntry
+}
+
+func NewAIToolRegistry() *AIToolRegistry {
+	return &AIToolRegistry{
+		tools: make(map[string]*aiToolEntry),
+	}
+}
+
+// Register 注册工具，parameters用于生成工具定义并在执行前校验参数
+func (r *AIToolRegistry) Register(name, description string, parameters *JSONSchema, run AIToolFunc) {
+	r.tools[name] = &aiToolEntry{
+		tool: AITool{
+			Type: "function",
+			Function: AIFunction{
+				Name:        name,
+				Description: description,
+				Parameters:  parameters,
+			},
+		},
+		run: run,
+	}
+}
+
+// RegisterAITool 注册参数类型为T的工具，参数Schema由T生成
+func RegisterAITool[T any](r *AIToolRegistry, name, description string, run func(ctx context.Context, args T) (interface{}, error)) {
+	var zero T
+	r.Register(name, description, JSONSchemaFor(zero), func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		var args T
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, fmt.Errorf("解析参数失败: %w", err)
+		}
+		return run(ctx, args)
+	})
+}
+
+// Definitions 按名称排序的工具定义
+func (r *AIToolRegistry) Definitions() []AITool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tools := make([]AITool, 0, len(names))
+	for _, name := range names {
+		tools = append(tools, r.tools[name].tool)
+	}
+	return tools
+}
+
+// Subset 选出本次请求允许使用的工具，包含未注册的名称时返回错误
+func (r *AIToolRegistry) Subset(names []string) (*AIToolRegistry, error) {
+	subset := NewAIToolRegistry()
+	for _, name := range names {
+		entry, ok := r.tools[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的工具: %s", name)
+		}
+		subset.tools[name] = entry
+	}
+	return subset, nil
+}
+
+// Invoke 执行一次工具调用，返回交给模型的结果内容
+//
+// 工具不存在、参数不合法或执行失败时，把错误信息作为结果返回，让模型自行调整
+func (r *AIToolRegistry) Invoke(ctx context.Context, call AIToolCall) (string, AIToolInvocation) {
+	start := time.Now()
+	invocation := AIToolInvocation{ID: call.ID, Name: call.Function.Name}
+
+	result, err := r.invoke(ctx, call, &invocation)
+	invocation.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		invocation.Error = err.Error()
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(data), invocation
+	}
+	return result, invocation
+}
+
+func (r *AIToolRegistry) invoke(ctx context.Context, call AIToolCall, invocation *AIToolInvocation) (string, error) {
+	entry, ok := r.tools[call.Function.Name]
+	if !ok {
+		return "", fmt.Errorf("工具 %s 不存在或未开放", call.Function.Name)
+	}
+
+	arguments := strings.TrimSpace(call.Function.Arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return "", fmt.Errorf("参数不是合法的JSON: %w", err)
+	}
+	invocation.Arguments = json.RawMessage(arguments)
+	if schema := entry.tool.Function.Parameters; schema != nil {
+		if problems := schema.Validate(value); len(problems) > 0 {
+			return "", fmt.Errorf("参数不符合要求: %s", strings.Join(problems, "; "))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, aiToolTimeout)
+	defer cancel()
+
+	result, err := entry.run(ctx, json.RawMessage(arguments))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("序列化工具结果失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// GenerateWithTools 允许模型调用tools中的工具，执行后把结果交回模型，直到模型给出回答
+//
+// 最多进行 AIToolMaxRounds 轮工具调用，最后一轮禁止调用工具以强制模型作答。
+// 返回的响应为最后一次调用，Usage为所有轮次的合计
+func (m *AIClientManager) GenerateWithTools(ctx context.Context, req *AIRequest, tools *AIToolRegistry) (*AIResponse, []AIToolInvocation, error) {
+	toolReq := *req
+	toolReq.Tools = tools.Definitions()
+	toolReq.Messages = append([]AIMessage{}, req.Messages...)
+
+	rounds := m.config.AIToolMaxRounds
+	var total AIUsage
+	invocations := []AIToolInvocation{}
+	for round := 0; round <= rounds; round++ {
+		if round == rounds {
+			toolReq.ToolChoice = "none"
+		}
+
+		resp, err := m.GenerateText(ctx, &toolReq)
+		if err != nil {
+			return nil, invocations, err
+		}
+		total.PromptTokens += resp.Usage.PromptTokens
+		total.CompletionTokens += resp.Usage.CompletionTokens
+		total.TotalTokens += resp.Usage.TotalTokens
+
+		if len(resp.Choices) == 0 || len(resp.Choices[0].Message.ToolCalls) == 0 {
+			resp.Usage = total
+			return resp, invocations, nil
+		}
+		// 最后一轮已禁止调用工具，不再执行模型仍然发起的调用
+		if round == rounds {
+			break
+		}
+
+		message := resp.Choices[0].Message
+		toolReq.Messages = append(toolReq.Messages, AIMessage{
+			Role:      "assistant",
+			Content:   message.Content,
+			ToolCalls: message.ToolCalls,
+		})
+		for _, call := range message.ToolCalls {
+			content, invocation := tools.Invoke(ctx, call)
+			invocations = append(invocations, invocation)
+			toolReq.Messages = append(toolReq.Messages, AIMessage{
+				Role:       "tool",
+				Content:    content,
+				ToolCallID: call.ID,
+				Name:       call.Function.Name,
+			})
+		}
+	}
+
+	return nil, invocations, fmt.Errorf("工具调用超过%d轮仍未得到回答", rounds)
+}
+
+// 天气查询参数
+type weatherToolArgs struct {
+	City string `json:"city" jsonschema:"minLength=1,description=城市名称，例如 Beijing 或 Shanghai"`
+}
+
+// 运动记录查询参数
+type workoutsToolArgs struct {
+	Limit int `json:"limit,omitempty" jsonschema:"minimum=1,maximum=50,description=返回最近的记录条数，默认10"`
+}
+
+// NewBackendAIToolRegistry 开放给模型的后端能力
+//
+// 需要用户数据的工具从ctx的调用方中取用户ID，模型无法指定查询其他用户
+func NewBackendAIToolRegistry(thirdParty *ThirdPartyClientManager, fitTracker *FitTrackerService) *AIToolRegistry {
+	registry := NewAIToolRegistry()
+
+	RegisterAITool(registry, AIToolGetWeather, "查询城市当前的天气，用于出行和活动规划",
+		func(ctx context.Context, args weatherToolArgs) (interface{}, error) {
+			return thirdParty.GetWeather(args.City)
+		})
+
+	RegisterAITool(registry, AIToolGetWorkouts, "查询当前用户最近的运动记录，用于运动指导",
+		func(ctx context.Context, args workoutsToolArgs) (interface{}, error) {
+			userID := AIUsageScopeFrom(ctx).UserID
+			if userID == "" {
+				return nil, fmt.Errorf("需要登录后才能查询运动记录")
+			}
+			limit := args.Limit
+			if limit == 0 {
+				limit = 10
+			}
+			workouts, total, err := fitTracker.GetWorkouts(userID, 1, limit)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"workouts": workouts,
+				"total":    total,
+			}, nil
+		})
+
+	return registry
+}
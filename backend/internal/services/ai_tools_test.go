@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testWeatherArgs struct {
+	City string `json:"city" jsonschema:"minLength=1"`
+}
+
+func newTestToolRegistry(calls *int) *AIToolRegistry {
+	tools := NewAIToolRegistry()
+	RegisterAITool(tools, AIToolGetWeather, "查询天气", func(ctx context.Context, args testWeatherArgs) (interface{}, error) {
+		*calls++
+		if args.City == "火星" {
+			return nil, errors.New("不支持的城市")
+		}
+		return map[string]interface{}{"city": args.City, "temp": 20}, nil
+	})
+	return tools
+}
+
+func TestAIToolRegistryInvoke(t *testing.T) {
+	calls := 0
+	tools := newTestToolRegistry(&calls)
+
+	tests := []struct {
+		name      string
+		call      AIFunctionCall
+		want      string
+		wantError string
+	}{
+		{"success", AIFunctionCall{Name: AIToolGetWeather, Arguments: `{"city":"北京"}`}, `{"city":"北京","temp":20}`, ""},
+		{"tool error", AIFunctionCall{Name: AIToolGetWeather, Arguments: `{"city":"火星"}`}, "", "不支持的城市"},
+		{"unknown tool", AIFunctionCall{Name: "drop_tables", Arguments: `{}`}, "", "工具 drop_tables 不存在或未开放"},
+		{"invalid json", AIFunctionCall{Name: AIToolGetWeather, Arguments: `{"city":`}, "", "参数不是合法的JSON"},
+		{"schema violation", AIFunctionCall{Name: AIToolGetWeather, Arguments: `{"city":""}`}, "", "参数不符合要求: $.city: 长度不能小于1"},
+		{"empty arguments", AIFunctionCall{Name: AIToolGetWeather}, "", "缺少必填字段 city"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, invocation := tools.Invoke(context.Background(), AIToolCall{ID: "call-1", Type: "function", Function: tt.call})
+			if invocation.ID != "call-1" || invocation.Name != tt.call.Name {
+				t.Errorf("invocation = %+v", invocation)
+			}
+			if tt.wantError == "" {
+				if content != tt.want || invocation.Error != "" {
+					t.Errorf("content = %s, error = %q, want %s", content, invocation.Error, tt.want)
+				}
+				return
+			}
+
+			// 错误作为结果交给模型
+			if !strings.Contains(invocation.Error, tt.wantError) {
+				t.Errorf("invocation error = %q, want %q", invocation.Error, tt.wantError)
+			}
+			var result map[string]string
+			if err := json.Unmarshal([]byte(content), &result); err != nil || result["error"] != invocation.Error {
+				t.Errorf("content = %s, want the error as JSON", content)
+			}
+		})
+	}
+
+	if calls != 2 {
+		t.Errorf("tool ran %d times, want 2 (invalid calls must not run)", calls)
+	}
+}
+
+func TestGenerateWithTools(t *testing.T) {
+	tests := []struct {
+		name            string
+		fixtures        string
+		rounds          int
+		wantErr         string
+		wantContent     string
+		wantModelCalls  int
+		wantInvocations []string // 各次调用的错误，空字符串表示成功
+	}{
+		{
+			name: "tool result answered",
+			fixtures: `
+fixtures:
+  - match: '"temp":20'
+    content: 北京20度
+  - match: "."
+    tool_calls:
+      - id: call-1
+        type: function
+        function: {name: get_weather, arguments: '{"city":"北京"}'}
+`,
+			rounds:          3,
+			wantContent:     "北京20度",
+			wantModelCalls:  2,
+			wantInvocations: []string{""},
+		},
+		{
+			name: "tool error is returned to the model",
+			fixtures: `
+fixtures:
+  - match: '不支持的城市'
+    content: 抱歉，无法查询火星天气
+  - match: "."
+    tool_calls:
+      - id: call-1
+        type: function
+        function: {name: get_weather, arguments: '{"city":"火星"}'}
+      - id: call-2
+        type: function
+        function: {name: delete_user, arguments: '{}'}
+`,
+			rounds:          3,
+			wantContent:     "抱歉，无法查询火星天气",
+			wantModelCalls:  2,
+			wantInvocations: []string{"不支持的城市", "工具 delete_user 不存在或未开放"},
+		},
+		{
+			// 第2轮结果返回后模型作答，最后一轮不再调用工具
+			name: "answers on the final round",
+			fixtures: `
+fixtures:
+  - match: '(?s)tool: .*tool: '
+    content: 两次查询都完成了
+  - match: "."
+    tool_calls:
+      - id: call-1
+        type: function
+        function: {name: get_weather, arguments: '{"city":"北京"}'}
+`,
+			rounds:          2,
+			wantContent:     "两次查询都完成了",
+			wantModelCalls:  3,
+			wantInvocations: []string{"", ""},
+		},
+		{
+			name: "iteration cap",
+			fixtures: `
+default:
+  tool_calls:
+    - id: call-1
+      type: function
+      function: {name: get_weather, arguments: '{"city":"北京"}'}
+`,
+			rounds:          2,
+			wantErr:         "工具调用超过2轮仍未得到回答",
+			wantModelCalls:  3,
+			wantInvocations: []string{"", ""},
+		},
+		{
+			name: "no tool rounds allowed",
+			fixtures: `
+default:
+  tool_calls:
+    - id: call-1
+      type: function
+      function: {name: get_weather, arguments: '{"city":"北京"}'}
+`,
+			rounds:         0,
+			wantErr:        "工具调用超过0轮仍未得到回答",
+			wantModelCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestAIClientManager(t, tt.fixtures)
+			m.config.AIToolMaxRounds = tt.rounds
+			toolCalls := 0
+
+			resp, invocations, err := m.GenerateWithTools(context.Background(), testAIRequest(), newTestToolRegistry(&toolCalls))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("GenerateWithTools() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("GenerateWithTools() error = %v", err)
+			} else if resp.Choices[0].Message.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", resp.Choices[0].Message.Content, tt.wantContent)
+			}
+
+			if calls := mockClient(t, m, "mock").calls; calls != tt.wantModelCalls {
+				t.Errorf("model calls = %d, want %d", calls, tt.wantModelCalls)
+			}
+			// 最后一轮禁止调用工具，模型仍发起的调用不执行
+			if len(invocations) != len(tt.wantInvocations) || toolCalls > len(invocations) {
+				t.Fatalf("invocations = %+v, tool ran %d times, want %d", invocations, toolCalls, len(tt.wantInvocations))
+			}
+			for i, want := range tt.wantInvocations {
+				if invocations[i].Error != want {
+					t.Errorf("invocation %d error = %q, want %q", i, invocations[i].Error, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"qa-toolbox-backend/internal/database"
+)
+
+// AI调用所属的功能模块
+const (
+	AIFeatureChat            = "chat"
+	AIFeatureTextGeneration  = "text-generation"
+	AIFeatureTestGeneration  = "test-generation"
+	AIFeatureCodeAnalysis    = "code-analysis"
+	AIFeatureCreativeWriting = "creative-writing"
+	AIFeatureEmbedding       = "embedding"
+	AIFeatureModeration      = "moderation"
+)
+
+// 未订阅会员的用户使用免费版配额
+const freeMembershipPlanID = "550e8400-e29b-41d4-a716-446655440001"
+
+// 请求未设置MaxTokens时为回复预占的token数，调用结束后按实际用量结算
+const aiReservedCompletionTokens = 1024
+
+// AIUsageScope 本次调用的计量归属
+type AIUsageScope struct {
+	UserID   string
+	ClientIP string
+	Feature  string
+}
+
+type aiUsageScopeKey struct{}
+
+// WithAIUsageScope 在ctx中设置调用的用户和来源
+func WithAIUsageScope(ctx context.Context, userID, clientIP string) context.Context {
+	scope := AIUsageScopeFrom(ctx)
+	scope.UserID = userID
+	scope.ClientIP = clientIP
+	return context.WithValue(ctx, aiUsageScopeKey{}, scope)
+}
+
+// WithAIFeature 在ctx中设置调用所属的功能模块
+func WithAIFeature(ctx context.Context, feature string) context.Context {
+	scope := AIUsageScopeFrom(ctx)
+	scope.Feature = feature
+	return context.WithValue(ctx, aiUsageScopeKey{}, scope)
+}
+
+// AIUsageScopeFrom 读取ctx中的计量归属
+func AIUsageScopeFrom(ctx context.Context) AIUsageScope {
+	if ctx == nil {
+		return AIUsageScope{}
+	}
+	scope, _ := ctx.Value(aiUsageScopeKey{}).(AIUsageScope)
+	return scope
+}
+
+// AIQuotaError 超出AI用量配额
+type AIQuotaError struct {
+	Period  string    `json:"period"` // daily 或 monthly
+	Limit   int64     `json:"limit"`
+	Used    int64     `json:"used"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+func (e *AIQuotaError) Error() string {
+	period := "今日"
+	if e.Period == "monthly" {
+		period = "本月"
+	}
+	return fmt.Sprintf("%sAI用量已达上限（%d/%d tokens），将于%s重置", period, e.Used, e.Limit, e.ResetAt.Format("2006-01-02 15:04"))
+}
+
+// AIUsageBreakdown 按维度汇总的用量
+type AIUsageBreakdown struct {
+	Key              string `json:"key"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// AIQuotaStatus 某个周期的配额使用情况，Limit为nil表示不限量
+type AIQuotaStatus struct {
+	Used      int64     `json:"used"`
+	Limit     *int64    `json:"limit"`
+	Remaining *int64    `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// AIUsageSummary 用户的AI用量汇总
+type AIUsageSummary struct {
+	Plan       string             `json:"plan"`
+	Daily      AIQuotaStatus      `json:"daily"`
+	Monthly    AIQuotaStatus      `json:"monthly"`
+	ByProvider []AIUsageBreakdown `json:"by_provider"`
+	ByFeature  []AIUsageBreakdown `json:"by_feature"`
+}
+
+// AIUsageService AI用量计量与配额
+type AIUsageService struct {
+	db                  *database.DB
+	anonymousDailyQuota int64
+}
+
+func NewAIUsageService(db *database.DB, anonymousDailyQuota int64) *AIUsageService {
+	return &AIUsageService{
+		db:                  db,
+		anonymousDailyQuota: anonymousDailyQuota,
+	}
+}
+
+// AIQuotaReservation 调用前预占的配额，调用结束后用Settle按实际用量结算，失败时用Release释放
+//
+// 为nil时表示不限量，所有方法都可以安全调用
+type AIQuotaReservation struct {
+	s        *AIUsageService
+	counters []aiUsageCounter
+	tokens   int64
+
+	once sync.Once
+}
+
+// aiUsageCounter 某个调用方在一个配额周期内的计数
+type aiUsageCounter struct {
+	scopeKey    string
+	period      string // daily 或 monthly
+	periodStart time.Time
+}
+
+// aiUsageLimit 需要检查的配额，condition和arg用于从用量记录中初始化计数
+type aiUsageLimit struct {
+	counter   aiUsageCounter
+	limit     int64
+	resetAt   time.Time
+	condition string
+	arg       interface{}
+}
+
+// Reserve 检查调用方的剩余配额并预占tokens
+//
+// 计数的检查和增加在一条语句中完成，并发的调用不会都看到同一个剩余量。
+// 周期内的用量未达到上限时就允许调用，因此最后一次调用可以超出上限
+func (s *AIUsageService) Reserve(ctx context.Context, scope AIUsageScope, tokens int64) (*AIQuotaReservation, error) {
+	limits, err := s.quotaLimits(ctx, scope, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	r := &AIQuotaReservation{s: s, tokens: tokens}
+	for _, limit := range limits {
+		reserved, used, err := s.reserveCounter(ctx, limit, tokens)
+		if err == nil && !reserved {
+			err = &AIQuotaError{Period: limit.counter.period, Limit: limit.limit, Used: used, ResetAt: limit.resetAt}
+		}
+		if err != nil {
+			// 已经预占的周期需要退回
+			r.Release(ctx)
+			return nil, err
+		}
+		r.counters = append(r.counters, limit.counter)
+	}
+	return r, nil
+}
+
+// Settle 按实际用量结算，多退少补；只有第一次结算或释放生效
+func (r *AIQuotaReservation) Settle(ctx context.Context, tokens int64) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		if delta := tokens - r.tokens; delta != 0 {
+			r.s.adjustCounters(ctx, r.counters, delta)
+		}
+	})
+}
+
+// Release 调用失败时释放预占的配额
+func (r *AIQuotaReservation) Release(ctx context.Context) {
+	r.Settle(ctx, 0)
+}
+
+// quotaLimits 调用方需要检查的配额：匿名调用按来源IP限制每日用量，用户按会员计划限制每日和每月用量
+func (s *AIUsageService) quotaLimits(ctx context.Context, scope AIUsageScope, now time.Time) ([]aiUsageLimit, error) {
+	dayStart, monthStart := usagePeriodStarts(now)
+
+	if scope.UserID == "" {
+		if s.anonymousDailyQuota <= 0 || scope.ClientIP == "" {
+			return nil, nil
+		}
+		return []aiUsageLimit{{
+			counter:   aiUsageCounter{scopeKey: "ip:" + scope.ClientIP, period: "daily", periodStart: dayStart},
+			limit:     s.anonymousDailyQuota,
+			resetAt:   dayStart.AddDate(0, 0, 1),
+			condition: "user_id IS NULL AND client_ip = $1",
+			arg:       scope.ClientIP,
+		}}, nil
+	}
+
+	_, dailyLimit, monthlyLimit, err := s.getPlanQuota(ctx, scope.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var limits []aiUsageLimit
+	if dailyLimit != nil {
+		limits = append(limits, aiUsageLimit{
+			counter:   aiUsageCounter{scopeKey: "user:" + scope.UserID, period: "daily", periodStart: dayStart},
+			limit:     *dailyLimit,
+			resetAt:   dayStart.AddDate(0, 0, 1),
+			condition: "user_id = $1",
+			arg:       scope.UserID,
+		})
+	}
+	if monthlyLimit != nil {
+		limits = append(limits, aiUsageLimit{
+			counter:   aiUsageCounter{scopeKey: "user:" + scope.UserID, period: "monthly", periodStart: monthStart},
+			limit:     *monthlyLimit,
+			resetAt:   monthStart.AddDate(0, 1, 0),
+			condition: "user_id = $1",
+			arg:       scope.UserID,
+		})
+	}
+	return limits, nil
+}
+
+// reserveCounter 计数未达到上限时增加tokens，返回是否预占成功和当前用量
+//
+// 周期内第一次调用时计数从用量记录汇总得到，之后只在计数上增减
+func (s *AIUsageService) reserveCounter(ctx context.Context, limit aiUsageLimit, tokens int64) (bool, int64, error) {
+	c := limit.counter
+	var used int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO ai_usage_counters (scope_key, period, period_start, used_tokens, updated_at)
+		SELECT $2, $3, $4, seed.used + $5, NOW() FROM (
+			SELECT COALESCE(SUM(total_tokens), 0) AS used FROM ai_usage_records
+			WHERE `+limit.condition+` AND created_at >= $4
+		) seed
+		WHERE seed.used < $6
+		ON CONFLICT (scope_key, period, period_start) DO UPDATE SET
+			used_tokens = ai_usage_counters.used_tokens + $5, updated_at = NOW()
+		WHERE ai_usage_counters.used_tokens < $6
+		RETURNING used_tokens
+	`, limit.arg, c.scopeKey, c.period, c.periodStart, tokens, limit.limit).Scan(&used)
+	if err == nil {
+		return true, used, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, 0, fmt.Errorf("检查AI配额失败: %w", err)
+	}
+
+	// 没有返回行说明已达到上限
+	err = s.db.QueryRowContext(ctx, `
+		SELECT used_tokens FROM ai_usage_counters
+		WHERE scope_key = $1 AND period = $2 AND period_start = $3
+	`, c.scopeKey, c.period, c.periodStart).Scan(&used)
+	if err == sql.ErrNoRows {
+		used, err = s.sumTokens(ctx, limit.condition, limit.arg, c.periodStart)
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("检查AI配额失败: %w", err)
+	}
+	return false, used, nil
+}
+
+// adjustCounters 结算时调整预占的计数
+func (s *AIUsageService) adjustCounters(ctx context.Context, counters []aiUsageCounter, delta int64) {
+	for _, c := range counters {
+		_, err := s.db.ExecContext(context.WithoutCancel(ctx), `
+			UPDATE ai_usage_counters SET used_tokens = GREATEST(used_tokens + $4, 0), updated_at = NOW()
+			WHERE scope_key = $1 AND period = $2 AND period_start = $3
+		`, c.scopeKey, c.period, c.periodStart, delta)
+		if err != nil {
+			// 结算失败不影响本次调用，计数以预占的估算值为准
+			log.Printf("结算AI配额失败: %v", err)
+		}
+	}
+}
+
+// Record 记录一次调用的用量，provider未返回用量时按文本长度估算
+func (s *AIUsageService) Record(ctx context.Context, scope AIUsageScope, provider AIServiceType, model string, usage AIUsage, estimated bool) {
+	var userID, clientIP interface{}
+	if scope.UserID != "" {
+		userID = scope.UserID
+	}
+	if scope.ClientIP != "" {
+		clientIP = scope.ClientIP
+	}
+	feature := scope.Feature
+	if feature == "" {
+		feature = AIFeatureChat
+	}
+
+	_, err := s.db.ExecContext(context.WithoutCancel(ctx), `
+		INSERT INTO ai_usage_records (id, user_id, client_ip, provider, model, feature,
+			prompt_tokens, completion_tokens, total_tokens, estimated, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+	`, generateUUID(), userID, clientIP, string(provider), model, feature,
+		usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, estimated)
+	if err != nil {
+		// 计量失败不影响本次调用
+		log.Printf("记录AI用量失败: %v", err)
+	}
+}
+
+// GetUsageSummary 获取用户本日、本月用量和配额
+func (s *AIUsageService) GetUsageSummary(ctx context.Context, userID string) (*AIUsageSummary, error) {
+	now := time.Now()
+	dayStart, monthStart := usagePeriodStarts(now)
+
+	planName, dailyLimit, monthlyLimit, err := s.getPlanQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyUsed, err := s.sumTokens(ctx, "user_id = $1", userID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+	monthlyUsed, err := s.sumTokens(ctx, "user_id = $1", userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &AIUsageSummary{
+		Plan:    planName,
+		Daily:   newQuotaStatus(dailyUsed, dailyLimit, dayStart.AddDate(0, 0, 1)),
+		Monthly: newQuotaStatus(monthlyUsed, monthlyLimit, monthStart.AddDate(0, 1, 0)),
+	}
+
+	summary.ByProvider, err = s.breakdown(ctx, "provider", userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+	summary.ByFeature, err = s.breakdown(ctx, "feature", userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// 获取用户当前生效的会员计划配额，没有有效订阅时使用免费版
+func (s *AIUsageService) getPlanQuota(ctx context.Context, userID string) (string, *int64, *int64, error) {
+	var name string
+	var daily, monthly sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT p.name, p.ai_daily_token_quota, p.ai_monthly_token_quota
+		FROM membership_plans p
+		WHERE p.id = COALESCE((
+			SELECT plan_id FROM subscriptions
+			WHERE user_id = $1 AND status = 'active' AND end_date > NOW()
+			ORDER BY end_date DESC LIMIT 1
+		), $2)
+	`, userID, freeMembershipPlanID).Scan(&name, &daily, &monthly)
+	if err == sql.ErrNoRows {
+		// 未配置会员计划时不限制
+		return "", nil, nil, nil
+	}
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("查询会员配额失败: %w", err)
+	}
+
+	return name, nullInt64Ptr(daily), nullInt64Ptr(monthly), nil
+}
+
+func (s *AIUsageService) sumTokens(ctx context.Context, condition string, arg interface{}, since time.Time) (int64, error) {
+	var total int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(total_tokens), 0) FROM ai_usage_records
+		WHERE `+condition+` AND created_at >= $2
+	`, arg, since).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("统计AI用量失败: %w", err)
+	}
+	return total, nil
+}
+
+func (s *AIUsageService) breakdown(ctx context.Context, column, userID string, since time.Time) ([]AIUsageBreakdown, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+column+`, COUNT(*), COALESCE(SUM(prompt_tokens), 0),
+			COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0)
+		FROM ai_usage_records
+		WHERE user_id = $1 AND created_at >= $2
+		GROUP BY `+column+`
+		ORDER BY 5 DESC
+	`, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("统计AI用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	items := []AIUsageBreakdown{}
+	for rows.Next() {
+		var item AIUsageBreakdown
+		if err := rows.Scan(&item.Key, &item.Requests, &item.PromptTokens, &item.CompletionTokens, &item.TotalTokens); err != nil {
+			return nil, fmt.Errorf("读取AI用量失败: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func usagePeriodStarts(now time.Time) (time.Time, time.Time) {
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return dayStart, monthStart
+}
+
+func newQuotaStatus(used int64, limit *int64, resetAt time.Time) AIQuotaStatus {
+	status := AIQuotaStatus{Used: used, Limit: limit, ResetAt: resetAt}
+	if limit != nil {
+		remaining := *limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		status.Remaining = &remaining
+	}
+	return status
+}
+
+func nullInt64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+// estimateAIUsage 服务未返回用量时估算token数：中日韩字符按1个token，其余按4个字符1个token
+func estimateAIUsage(messages []AIMessage, completion string) AIUsage {
+	var prompt int
+	for _, msg := range messages {
+		prompt += estimateTokens(msg.Content)
+	}
+	completionTokens := estimateTokens(completion)
+	return AIUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: completionTokens,
+		TotalTokens:      prompt + completionTokens,
+	}
+}
+
+func estimateTokens(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
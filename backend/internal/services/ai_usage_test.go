@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qa-toolbox-backend/internal/database"
+)
+
+// fakeUsageDB 按语句前缀返回预设结果的数据库，记录执行过的语句和参数
+//
+// exec不为nil时执行语句前调用，用于模拟数据变化；事务的提交和回滚都是空操作
+type fakeUsageDB struct {
+	mu    sync.Mutex
+	query func(query string, args []interface{}) [][]driver.Value
+	exec  func(query string, args []interface{})
+	execs []fakeUsageExec
+}
+
+type fakeUsageExec struct {
+	query string
+	args  []interface{}
+}
+
+func newFakeUsageDB(query func(query string, args []interface{}) [][]driver.Value) (*fakeUsageDB, *database.DB) {
+	f := &fakeUsageDB{query: query}
+	return f, &database.DB{DB: sql.OpenDB(f)}
+}
+
+func (f *fakeUsageDB) Connect(context.Context) (driver.Conn, error) { return fakeUsageConn{f}, nil }
+func (f *fakeUsageDB) Driver() driver.Driver                        { return nil }
+
+// updates 执行过的计数调整，返回每次调整的增量
+func (f *fakeUsageDB) updates() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deltas []int64
+	for _, exec := range f.execs {
+		if strings.HasPrefix(exec.query, "UPDATE ai_usage_counters") {
+			deltas = append(deltas, exec.args[3].(int64))
+		}
+	}
+	return deltas
+}
+
+func (f *fakeUsageDB) records() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, exec := range f.execs {
+		if strings.HasPrefix(exec.query, "INSERT INTO ai_usage_records") {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeUsageConn struct{ f *fakeUsageDB }
+
+func (c fakeUsageConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeUsageConn) Close() error                        { return nil }
+func (c fakeUsageConn) Begin() (driver.Tx, error)           { return fakeUsageTx{}, nil }
+
+type fakeUsageTx struct{}
+
+func (fakeUsageTx) Commit() error   { return nil }
+func (fakeUsageTx) Rollback() error { return nil }
+
+func (c fakeUsageConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeUsageRows{rows: c.f.query(strings.TrimSpace(query), namedValues(args))}, nil
+}
+
+func (c fakeUsageConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, values := strings.TrimSpace(query), namedValues(args)
+	if c.f.exec != nil {
+		c.f.exec(query, values)
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.execs = append(c.f.execs, fakeUsageExec{query: query, args: values})
+	return driver.RowsAffected(1), nil
+}
+
+func namedValues(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+type fakeUsageRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeUsageRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeUsageRows) Close() error { return nil }
+
+func (r *fakeUsageRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// usageQuotaQueries 会员计划每日1000、每月5000 tokens，counters为各周期当前的计数
+func usageQuotaQueries(counters map[string]int64) func(string, []interface{}) [][]driver.Value {
+	limits := map[string]int64{"daily": 1000, "monthly": 5000}
+	return func(query string, args []interface{}) [][]driver.Value {
+		switch {
+		case strings.HasPrefix(query, "SELECT p.name"):
+			return [][]driver.Value{{"免费版", limits["daily"], limits["monthly"]}}
+		case strings.HasPrefix(query, "INSERT INTO ai_usage_counters"):
+			period, tokens := args[2].(string), args[4].(int64)
+			if counters[period] >= limits[period] {
+				return nil
+			}
+			counters[period] += tokens
+			return [][]driver.Value{{counters[period]}}
+		case strings.HasPrefix(query, "SELECT used_tokens FROM ai_usage_counters"):
+			return [][]driver.Value{{counters[args[1].(string)]}}
+		}
+		return nil
+	}
+}
+
+func TestAIUsageServiceReserve(t *testing.T) {
+	scope := AIUsageScope{UserID: "user-1"}
+
+	t.Run("reserves every period and settles the difference", func(t *testing.T) {
+		counters := map[string]int64{"daily": 100, "monthly": 100}
+		f, db := newFakeUsageDB(usageQuotaQueries(counters))
+		s := NewAIUsageService(db, 0)
+
+		r, err := s.Reserve(context.Background(), scope, 300)
+		if err != nil {
+			t.Fatalf("Reserve() error = %v", err)
+		}
+		if counters["daily"] != 400 || counters["monthly"] != 400 {
+			t.Errorf("counters = %v, want 400 each", counters)
+		}
+
+		// 只有第一次结算生效
+		r.Settle(context.Background(), 120)
+		r.Release(context.Background())
+		r.Settle(context.Background(), 500)
+		if got := f.updates(); len(got) != 2 || got[0] != -180 || got[1] != -180 {
+			t.Errorf("counter updates = %v, want [-180 -180]", got)
+		}
+	})
+
+	t.Run("daily limit reached", func(t *testing.T) {
+		counters := map[string]int64{"daily": 1000, "monthly": 100}
+		f, db := newFakeUsageDB(usageQuotaQueries(counters))
+		s := NewAIUsageService(db, 0)
+
+		_, err := s.Reserve(context.Background(), scope, 300)
+		var quotaErr *AIQuotaError
+		if !errors.As(err, &quotaErr) || quotaErr.Period != "daily" || quotaErr.Used != 1000 || quotaErr.Limit != 1000 {
+			t.Fatalf("Reserve() error = %v, want daily AIQuotaError", err)
+		}
+		if got := f.updates(); len(got) != 0 {
+			t.Errorf("counter updates = %v, want none", got)
+		}
+	})
+
+	t.Run("monthly limit releases the daily reservation", func(t *testing.T) {
+		counters := map[string]int64{"daily": 100, "monthly": 5000}
+		f, db := newFakeUsageDB(usageQuotaQueries(counters))
+		s := NewAIUsageService(db, 0)
+
+		_, err := s.Reserve(context.Background(), scope, 300)
+		var quotaErr *AIQuotaError
+		if !errors.As(err, &quotaErr) || quotaErr.Period != "monthly" {
+			t.Fatalf("Reserve() error = %v, want monthly AIQuotaError", err)
+		}
+		if got := f.updates(); len(got) != 1 || got[0] != -300 {
+			t.Errorf("counter updates = %v, want [-300]", got)
+		}
+	})
+
+	t.Run("anonymous without quota is unlimited", func(t *testing.T) {
+		_, db := newFakeUsageDB(func(query string, _ []interface{}) [][]driver.Value {
+			t.Errorf("unexpected query %q", query)
+			return nil
+		})
+		r, err := NewAIUsageService(db, 0).Reserve(context.Background(), AIUsageScope{ClientIP: "1.2.3.4"}, 300)
+		if err != nil || r != nil {
+			t.Fatalf("Reserve() = %v, %v, want nil, nil", r, err)
+		}
+		// nil表示不限量，结算和释放都是空操作
+		r.Settle(context.Background(), 10)
+		r.Release(context.Background())
+	})
+}
+
+func TestAIClientManagerSettlesQuota(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixtures    string
+		wantErr     bool
+		wantRecords int
+	}{
+		{
+			name:        "success settles with actual usage",
+			fixtures:    "default:\n  content: primary\n",
+			wantRecords: 1,
+		},
+		{
+			name: "failure releases the reservation",
+			fixtures: `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 500}
+  - service: mock-backup
+    match: "."
+    error: {status: 500}
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestAIClientManager(t, tt.fixtures)
+			f, db := newFakeUsageDB(usageQuotaQueries(map[string]int64{}))
+			m.usage = NewAIUsageService(db, 0)
+
+			req := testAIRequest()
+			reserved := int64(estimateReservedTokens(req))
+			ctx := WithAIUsageScope(context.Background(), "user-1", "")
+			resp, err := m.GenerateText(ctx, req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			want := -reserved
+			if resp != nil {
+				want = int64(resp.Usage.TotalTokens) - reserved
+			}
+			if got := f.updates(); len(got) != 2 || got[0] != want || got[1] != want {
+				t.Errorf("counter updates = %v, want [%d %d]", got, want, want)
+			}
+			if got := f.records(); got != tt.wantRecords {
+				t.Errorf("usage records = %d, want %d", got, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestEstimateReservedTokens(t *testing.T) {
+	req := &AIRequest{Messages: []AIMessage{{Role: "user", Content: "你好世界"}}}
+	if got := estimateReservedTokens(req); got != 4+aiReservedCompletionTokens {
+		t.Errorf("estimateReservedTokens() = %d, want %d", got, 4+aiReservedCompletionTokens)
+	}
+	req.MaxTokens = 200
+	if got := estimateReservedTokens(req); got != 204 {
+		t.Errorf("estimateReservedTokens() with MaxTokens = %d, want 204", got)
+	}
+}
+
+func TestMonitorStreamOnDone(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []AIStreamChunk
+		wantCompleted bool
+		wantContent   string
+	}{
+		{
+			name:          "completed",
+			chunks:        []AIStreamChunk{{Model: "m", Delta: "你"}, {Delta: "好", Usage: &AIUsage{TotalTokens: 3}}},
+			wantCompleted: true,
+			wantContent:   "你好",
+		},
+		{
+			name:        "interrupted",
+			chunks:      []AIStreamChunk{{Model: "m", Delta: "你"}, {Err: errors.New("连接断开")}},
+			wantContent: "你",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := make(chan AIStreamChunk, len(tt.chunks))
+			for _, chunk := range tt.chunks {
+				stream <- chunk
+			}
+			close(stream)
+
+			calls := 0
+			var completed bool
+			var content string
+			out := monitorStream(context.Background(), stream, NewProviderHealth("mock", CircuitBreakerConfig{}), time.Now(), func(ok bool, _ string, c string, _ *AIUsage) {
+				calls++
+				completed, content = ok, c
+			})
+			for range out {
+			}
+
+			if calls != 1 || completed != tt.wantCompleted || content != tt.wantContent {
+				t.Errorf("onDone calls = %d, completed = %v, content = %q", calls, completed, content)
+			}
+		})
+	}
+}
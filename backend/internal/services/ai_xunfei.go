@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"qa-toolbox-backend/internal/config"
+)
+
+// 讯飞星火模型（domain）与WebSocket路径的对应关系
+var xunfeiModelPaths = map[string]string{
+	"lite":        "/v1.1/chat",
+	"generalv3":   "/v3.1/chat",
+	"pro-128k":    "/chat/pro-128k",
+	"generalv3.5": "/v3.5/chat",
+	"max-32k":     "/chat/max-32k",
+	"4.0Ultra":    "/v4.0/chat",
+}
+
+// 讯飞星火帧状态，2表示最后一帧
+const xunfeiStatusLast = 2
+
+// 部分星火版本的temperature取值范围为 (0, 1]，0 按最小值发送
+const xunfeiMinTemperature = 0.01
+
+// 讯飞星火客户端（WebSocket协议，HMAC-SHA256签名鉴权）
+type XunfeiClient struct {
+	*BaseAIClient
+	appID     string
+	apiSecret string
+	now       func() time.Time
+}
+
+func NewXunfeiClient(cfg *config.Config, spec AIProviderSpec) *XunfeiClient {
+	return &XunfeiClient{
+		BaseAIClient: NewBaseAIClient(cfg, spec),
+		appID:        cfg.XunfeiAppID,
+		apiSecret:    cfg.XunfeiAPISecret,
+		now:          time.Now,
+	}
+}
+
+// 星火请求帧
+type xunfeiRequest struct {
+	Header    xunfeiRequestHeader `json:"header"`
+	Parameter xunfeiParameter     `json:"parameter"`
+	Payload   xunfeiPayload       `json:"payload"`
+}
+
+type xunfeiRequestHeader struct {
+	AppID string `json:"app_id"`
+	UID   string `json:"uid,omitempty"`
+}
+
+type xunfeiParameter struct {
+	Chat xunfeiChatParams `json:"chat"`
+}
+
+type xunfeiChatParams struct {
+	Domain      string  `json:"domain"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+}
+
+type xunfeiPayload struct {
+	Message struct {
+		Text []AIMessage `json:"text"`
+	} `json:"message"`
+}
+
+// 星火响应帧
+type xunfeiResponse struct {
+	Header struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		SID     string `json:"sid"`
+		Status  int    `json:"status"`
+	} `json:"header"`
+	Payload struct {
+		Choices struct {
+			Status int `json:"status"`
+			Seq    int `json:"seq"`
+			Text   []struct {
+				Content string `json:"content"`
+				Role    string `json:"role"`
+				Index   int    `json:"index"`
+			} `json:"text"`
+		} `json:"choices"`
+		Usage *struct {
+			Text AIUsage `json:"text"`
+		} `json:"usage"`
+	} `json:"payload"`
+}
+
+func (r *xunfeiResponse) content() string {
+	var sb strings.Builder
+	for _, text := range r.Payload.Choices.Text {
+		sb.WriteString(text.Content)
+	}
+	return sb.String()
+}
+
+func (r *xunfeiResponse) isLast() bool {
+	return r.Header.Status == xunfeiStatusLast
+}
+
+func (c *XunfeiClient) GenerateText(ctx context.Context, req *AIRequest) (*AIResponse, error) {
+	model := c.resolveModel(req.Model)
+
+	ws, stop, err := c.open(ctx, req, model)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	var content strings.Builder
+	var sid string
+	var usage AIUsage
+	for {
+		frame, err := c.receive(ctx, ws)
+		if err != nil {
+			return nil, err
+		}
+
+		sid = frame.Header.SID
+		content.WriteString(frame.content())
+		if frame.Payload.Usage != nil {
+			usage = frame.Payload.Usage.Text
+		}
+		if frame.isLast() {
+			break
+		}
+	}
+
+	return newAIResponse(sid, model, content.String(), "stop", usage), nil
+}
+
+func (c *XunfeiClient) GenerateTextStream(ctx context.Context, req *AIRequest) (<-chan AIStreamChunk, error) {
+	model := c.resolveModel(req.Model)
+
+	ws, stop, err := c.open(ctx, req, model)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同步读取第一帧，鉴权和限流错误在建立流之前返回，便于故障转移
+	first, err := c.receive(ctx, ws)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+
+	chunks := make(chan AIStreamChunk)
+	go func() {
+		defer close(chunks)
+		defer stop()
+
+		frame := first
+		for {
+			chunk := AIStreamChunk{ID: frame.Header.SID, Model: model, Delta: frame.content()}
+			if frame.isLast() {
+				chunk.FinishReason = "stop"
+				if frame.Payload.Usage != nil {
+					usage := frame.Payload.Usage.Text
+					chunk.Usage = &usage
+				}
+			}
+			if err := sendStreamChunk(ctx, chunks, chunk); err != nil || frame.isLast() {
+				return
+			}
+
+			frame, err = c.receive(ctx, ws)
+			if err != nil {
+				select {
+				case chunks <- AIStreamChunk{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}()
+
+	return chunks, nil
+}
+
+func (c *XunfeiClient) IsAvailable() bool {
+	return c.apiKey != "" && c.appID != "" && c.apiSecret != ""
+}
+
+// open 建立鉴权后的WebSocket连接并发送请求帧，stop用于关闭连接
+func (c *XunfeiClient) open(ctx context.Context, req *AIRequest, model string) (*websocket.Conn, func(), error) {
+	if !c.IsAvailable() {
+		return nil, nil, fmt.Errorf("讯飞星火API密钥未配置")
+	}
+
+	path, ok := xunfeiModelPaths[model]
+	if !ok {
+		return nil, nil, newAIVendorError(AIErrorBadRequest, "model", "不支持的讯飞星火模型: "+model)
+	}
+
+	wsURL, err := signXunfeiURL(c.baseURL+path, c.apiKey, c.apiSecret, c.now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	origin := strings.Replace(strings.Replace(c.baseURL, "wss://", "https://", 1), "ws://", "http://", 1)
+	wsConfig, err := websocket.NewConfig(wsURL, origin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建WebSocket配置失败: %w", err)
+	}
+	wsConfig.Dialer = &net.Dialer{Timeout: 30 * time.Second}
+
+	ws, err := websocket.DialConfig(wsConfig)
+	if err != nil {
+		// 签名错误时握手返回401/403
+		if errors.Is(err, websocket.ErrBadStatus) {
+			return nil, nil, newAIVendorError(AIErrorAuth, "handshake", err.Error())
+		}
+		return nil, nil, fmt.Errorf("连接讯飞星火失败: %w", err)
+	}
+
+	// ctx取消时关闭连接，打断阻塞中的读取
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.Close()
+		case <-done:
+		}
+	}()
+	stop := func() {
+		close(done)
+		ws.Close()
+	}
+
+	frame := xunfeiRequest{
+		Header: xunfeiRequestHeader{AppID: c.appID},
+		Parameter: xunfeiParameter{Chat: xunfeiChatParams{
+			Domain:      model,
+			Temperature: math.Max(req.Temperature, xunfeiMinTemperature),
+			MaxTokens:   req.MaxTokens,
+		}},
+	}
+	frame.Payload.Message.Text = req.Messages
+
+	if err := websocket.JSON.Send(ws, frame); err != nil {
+		stop()
+		return nil, nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+
+	return ws, stop, nil
+}
+
+// receive 读取一帧并检查业务错误码
+func (c *XunfeiClient) receive(ctx context.Context, ws *websocket.Conn) (*xunfeiResponse, error) {
+	ws.SetReadDeadline(time.Now().Add(c.httpClient.Timeout))
+
+	var frame xunfeiResponse
+	if err := websocket.JSON.Receive(ws, &frame); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("读取讯飞星火响应失败: %w", err)
+	}
+	if frame.Header.Code != 0 {
+		return nil, xunfeiAPIError(frame.Header.Code, frame.Header.Message)
+	}
+
+	return &frame, nil
+}
+
+// signXunfeiURL 生成带鉴权参数的WebSocket地址
+//
+// 签名原文为 host、date 和请求行，使用APISecret做HMAC-SHA256
+func signXunfeiURL(rawURL, apiKey, apiSecret string, now time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("解析服务地址失败: %w", err)
+	}
+
+	date := now.UTC().Format(time.RFC1123)
+	date = strings.Replace(date, "UTC", "GMT", 1)
+
+	signatureOrigin := fmt.Sprintf("host: %s\ndate: %s\nGET %s HTTP/1.1", u.Host, date, u.Path)
+	mac := hmac.New(sha256.New, []byte(apiSecret))
+	mac.Write([]byte(signatureOrigin))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	authorizationOrigin := fmt.Sprintf(`api_key="%s", algorithm="hmac-sha256", headers="host date request-line", signature="%s"`,
+		apiKey, signature)
+
+	query := url.Values{}
+	query.Set("authorization", base64.StdEncoding.EncodeToString([]byte(authorizationOrigin)))
+	query.Set("date", date)
+	query.Set("host", u.Host)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// 将讯飞错误码映射为错误类型
+func xunfeiAPIError(code int, message string) error {
+	kind := AIErrorUpstream
+	switch {
+	case code == 11200, code == 10005:
+		kind = AIErrorAuth
+	case code >= 11201 && code <= 11203:
+		kind = AIErrorRateLimited
+	case code == 10013, code == 10014, code == 10019, code == 10907, code == 10163:
+		// 内容审核不通过或参数错误，换服务重试意义不大
+		kind = AIErrorBadRequest
+	}
+	return newAIVendorError(kind, strconv.Itoa(code), message)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"qa-toolbox-backend/internal/config"
+)
+
+func TestSignXunfeiURL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signed, err := signXunfeiURL("wss://spark-api.xf-yun.com/v1.1/chat", "apikey", "apisecret", now)
+	if err != nil {
+		t.Fatalf("signXunfeiURL() error = %v", err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("invalid signed url: %v", err)
+	}
+	tests := []struct {
+		param string
+		want  string
+	}{
+		{"host", "spark-api.xf-yun.com"},
+		{"date", "Tue, 14 Nov 2023 22:13:20 GMT"},
+		{"authorization", "YXBpX2tleT0iYXBpa2V5IiwgYWxnb3JpdGhtPSJobWFjLXNoYTI1NiIsIGhlYWRlcnM9Imhvc3QgZGF0ZSByZXF1ZXN0LWxpbmUiLCBzaWduYXR1cmU9Imh6bnlzdWNZUjZHeGlvV2Y0OEN3Tm1ETjJ6YkE5MjlOMnpOVDZJU09waUk9Ig=="},
+	}
+	for _, tt := range tests {
+		if got := u.Query().Get(tt.param); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.param, got, tt.want)
+		}
+	}
+	if u.Scheme != "wss" || u.Path != "/v1.1/chat" {
+		t.Errorf("signed url = %s, want same scheme and path", signed)
+	}
+}
+
+// verifyXunfeiSignature 按讯飞的规则校验握手请求中的签名
+func verifyXunfeiSignature(query url.Values, path, apiSecret string) error {
+	authorization, err := base64.StdEncoding.DecodeString(query.Get("authorization"))
+	if err != nil {
+		return err
+	}
+	origin := fmt.Sprintf("host: %s\ndate: %s\nGET %s HTTP/1.1", query.Get("host"), query.Get("date"), path)
+	mac := hmac.New(sha256.New, []byte(apiSecret))
+	mac.Write([]byte(origin))
+	want := `signature="` + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `"`
+	if !strings.Contains(string(authorization), want) {
+		return fmt.Errorf("authorization %q does not contain %s", authorization, want)
+	}
+	return nil
+}
+
+// newFakeXunfeiServer 进程内的星火WebSocket服务，收到请求帧后依次发送frames
+func newFakeXunfeiServer(t *testing.T, frames ...string) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		if err := verifyXunfeiSignature(ws.Request().URL.Query(), ws.Request().URL.Path, "apisecret"); err != nil {
+			t.Errorf("bad signature: %v", err)
+			return
+		}
+
+		var req xunfeiRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			t.Errorf("receive request: %v", err)
+			return
+		}
+		if req.Header.AppID != "app-id" || req.Parameter.Chat.Domain != "lite" || len(req.Payload.Message.Text) != 1 {
+			t.Errorf("unexpected request frame: %+v", req)
+		}
+		// 请求未指定temperature（即0）时按最小值发送
+		if req.Parameter.Chat.Temperature != xunfeiMinTemperature {
+			t.Errorf("temperature = %v, want %v", req.Parameter.Chat.Temperature, xunfeiMinTemperature)
+		}
+
+		for _, frame := range frames {
+			if err := websocket.Message.Send(ws, frame); err != nil {
+				t.Errorf("send frame: %v", err)
+				return
+			}
+		}
+	}))
+}
+
+func newTestXunfeiClient(serverURL string) *XunfeiClient {
+	cfg := &config.Config{XunfeiAppID: "app-id", XunfeiAPISecret: "apisecret"}
+	return NewXunfeiClient(cfg, AIProviderSpec{
+		Name:         AIServiceXunfei,
+		Protocol:     AIProtocolXunfei,
+		BaseURL:      "ws" + strings.TrimPrefix(serverURL, "http"),
+		APIKey:       "apikey",
+		DefaultModel: "lite",
+	})
+}
+
+func xunfeiFrame(status int, content string, usage bool) string {
+	frame := fmt.Sprintf(`{"header":{"code":0,"message":"Success","sid":"cht-1","status":%d},"payload":{"choices":{"status":%d,"seq":0,"text":[{"content":%q,"role":"assistant","index":0}]}`,
+		status, status, content)
+	if usage {
+		frame += `,"usage":{"text":{"prompt_tokens":4,"completion_tokens":6,"total_tokens":10}}`
+	}
+	return frame + `}}`
+}
+
+func TestXunfeiClientGenerateText(t *testing.T) {
+	server := newFakeXunfeiServer(t,
+		xunfeiFrame(0, "你好", false),
+		xunfeiFrame(1, "，我是", false),
+		xunfeiFrame(2, "星火。", true),
+	)
+	defer server.Close()
+
+	resp, err := newTestXunfeiClient(server.URL).GenerateText(context.Background(), &AIRequest{
+		Messages: []AIMessage{{Role: "user", Content: "你是谁"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateText() error = %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "你好，我是星火。" {
+		t.Errorf("content = %q", got)
+	}
+	if resp.ID != "cht-1" || resp.Model != "lite" || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp.Usage != (AIUsage{PromptTokens: 4, CompletionTokens: 6, TotalTokens: 10}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestXunfeiClientGenerateTextStream(t *testing.T) {
+	server := newFakeXunfeiServer(t,
+		xunfeiFrame(0, "你好", false),
+		xunfeiFrame(2, "。", true),
+	)
+	defer server.Close()
+
+	stream, err := newTestXunfeiClient(server.URL).GenerateTextStream(context.Background(), &AIRequest{
+		Messages: []AIMessage{{Role: "user", Content: "你是谁"}},
+	})
+	if err != nil {
+		t.Fatalf("GenerateTextStream() error = %v", err)
+	}
+	var deltas []string
+	var last AIStreamChunk
+	for chunk := range stream {
+		if chunk.Err != nil {
+			t.Fatalf("stream error: %v", chunk.Err)
+		}
+		deltas = append(deltas, chunk.Delta)
+		last = chunk
+	}
+	if strings.Join(deltas, "|") != "你好|。" || last.FinishReason != "stop" || last.Usage == nil || last.Usage.TotalTokens != 10 {
+		t.Errorf("deltas = %v, last = %+v", deltas, last)
+	}
+}
+
+func TestXunfeiClientErrorFrame(t *testing.T) {
+	server := newFakeXunfeiServer(t, `{"header":{"code":11200,"message":"AppIdNoAuthError","sid":"cht-2","status":2}}`)
+	defer server.Close()
+
+	_, err := newTestXunfeiClient(server.URL).GenerateText(context.Background(), &AIRequest{
+		Messages: []AIMessage{{Role: "user", Content: "你是谁"}},
+	})
+	var providerErr *AIProviderError
+	if !errors.As(err, &providerErr) || providerErr.Kind != AIErrorAuth || providerErr.Code != "11200" {
+		t.Fatalf("GenerateText() error = %v, want auth error 11200", err)
+	}
+}
+
+func TestXunfeiAPIError(t *testing.T) {
+	tests := []struct {
+		code      int
+		kind      AIErrorKind
+		retryable bool
+	}{
+		{10005, AIErrorAuth, false},
+		{11200, AIErrorAuth, false},
+		{11201, AIErrorRateLimited, true},
+		{11202, AIErrorRateLimited, true},
+		{11203, AIErrorRateLimited, true},
+		{10013, AIErrorBadRequest, false},
+		{10014, AIErrorBadRequest, false},
+		{10019, AIErrorBadRequest, false},
+		{10907, AIErrorBadRequest, false},
+		{10163, AIErrorBadRequest, false},
+		{10000, AIErrorUpstream, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.code), func(t *testing.T) {
+			var providerErr *AIProviderError
+			if !errors.As(xunfeiAPIError(tt.code, "failed"), &providerErr) {
+				t.Fatal("xunfeiAPIError() did not return *AIProviderError")
+			}
+			if providerErr.Kind != tt.kind || providerErr.Retryable != tt.retryable || providerErr.Code != strconv.Itoa(tt.code) {
+				t.Errorf("got kind=%s retryable=%v code=%s, want kind=%s retryable=%v",
+					providerErr.Kind, providerErr.Retryable, providerErr.Code, tt.kind, tt.retryable)
+			}
+		})
+	}
+}
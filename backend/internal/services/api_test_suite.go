@@ -0,0 +1,795 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"qa-toolbox-backend/internal/models"
+)
+
+const (
+	apiTestMaxTags      = 20
+	apiTestMaxTagLength = 50
+	apiTestMaxTimeout   = 300 // 秒
+)
+
+var (
+	ErrAPITestCaseNotFound = errors.New("测试用例不存在")
+	ErrInvalidAPITestSuite = errors.New("测试套件配置无效")
+	ErrInvalidAPITestCase  = errors.New("测试用例配置无效")
+	ErrInvalidAPITestOrder = errors.New("用例顺序无效")
+	apiTestSuiteStatuses   = map[string]bool{"active": true, "inactive": true, "archived": true}
+	apiTestCaseHTTPMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "DELETE": true, "PATCH": true, "HEAD": true, "OPTIONS": true}
+	apiTestCloneSuffix     = " (副本)"
+)
+
+const apiTestSuiteColumns = `id, user_id, name, COALESCE(description, ''), base_url, headers, variables, status,
+	COALESCE(tags, '{}'), (SELECT COUNT(*) FROM api_test_cases c WHERE c.suite_id = api_test_suites.id), created_at, updated_at`
+
+const apiTestCaseColumns = `id, suite_id, name, method, endpoint, headers, params, body, assertions,
+	COALESCE(expected_status, 0), COALESCE(timeout, 30), enabled, COALESCE(position, 0), COALESCE(tags, '{}'),
+	created_at, COALESCE(updated_at, created_at)`
+
+type rowScanner interface {
+	Scan(...interface{}) error
+}
+
+func scanAPITestSuite(row rowScanner) (*models.APITestSuite, error) {
+	var suite models.APITestSuite
+	var headers, variables []byte
+	var tags pq.StringArray
+	if err := row.Scan(&suite.ID, &suite.UserID, &suite.Name, &suite.Description, &suite.BaseURL, &headers,
+		&variables, &suite.Status, &tags, &suite.CaseCount, &suite.CreatedAt, &suite.UpdatedAt); err != nil {
+		return nil, err
+	}
+	suite.Tags = []string(tags)
+	if len(headers) > 0 {
+		if err := json.Unmarshal(headers, &suite.Headers); err != nil {
+			return nil, fmt.Errorf("解析测试套件失败: %w", err)
+		}
+	}
+	if len(variables) > 0 {
+		if err := json.Unmarshal(variables, &suite.Variables); err != nil {
+			return nil, fmt.Errorf("解析测试套件失败: %w", err)
+		}
+	}
+	return &suite, nil
+}
+
+func scanAPITestCase(row rowScanner) (*models.APITestCase, error) {
+	var testCase models.APITestCase
+	var headers, params, body, assertions []byte
+	var tags pq.StringArray
+	if err := row.Scan(&testCase.ID, &testCase.SuiteID, &testCase.Name, &testCase.Method, &testCase.Endpoint,
+		&headers, &params, &body, &assertions, &testCase.ExpectedStatus, &testCase.Timeout, &testCase.Enabled,
+		&testCase.Position, &tags, &testCase.CreatedAt, &testCase.UpdatedAt); err != nil {
+		return nil, err
+	}
+	testCase.Tags = []string(tags)
+	for _, field := range []struct {
+		data []byte
+		out  *map[string]interface{}
+	}{{headers, &testCase.Headers}, {params, &testCase.Params}, {body, &testCase.Body}, {assertions, &testCase.Assertions}} {
+		if len(field.data) > 0 {
+			if err := json.Unmarshal(field.data, field.out); err != nil {
+				return nil, fmt.Errorf("解析测试用例失败: %w", err)
+			}
+		}
+	}
+	return &testCase, nil
+}
+
+// normalizeAPITestTags 去掉首尾空白和重复的标签
+func normalizeAPITestTags(tags []string, invalid error) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > apiTestMaxTagLength {
+			return nil, fmt.Errorf("%w: 标签 %q 超过%d个字符", invalid, tag, apiTestMaxTagLength)
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) > apiTestMaxTags {
+		return nil, fmt.Errorf("%w: 标签不能超过%d个", invalid, apiTestMaxTags)
+	}
+	return out, nil
+}
+
+// applyAPITestSuiteRequest 把请求中提供的字段合并到套件并校验
+func applyAPITestSuiteRequest(suite *models.APITestSuite, req *models.APITestSuiteRequest) error {
+	if req.Name != nil {
+		suite.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		suite.Description = *req.Description
+	}
+	if req.BaseURL != nil {
+		suite.BaseURL = strings.TrimSpace(*req.BaseURL)
+	}
+	if req.Headers != nil {
+		suite.Headers = req.Headers
+	}
+	if req.Variables != nil {
+		suite.Variables = req.Variables
+	}
+	if req.Status != nil {
+		suite.Status = *req.Status
+	}
+	if req.Tags != nil {
+		tags, err := normalizeAPITestTags(req.Tags, ErrInvalidAPITestSuite)
+		if err != nil {
+			return err
+		}
+		suite.Tags = tags
+	}
+
+	if suite.Name == "" || utf8.RuneCountInString(suite.Name) > 200 {
+		return fmt.Errorf("%w: 名称不能为空且不超过200个字符", ErrInvalidAPITestSuite)
+	}
+	u, err := url.Parse(suite.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(suite.BaseURL) > 500 {
+		return fmt.Errorf("%w: base_url须为不超过500个字符的http(s)地址", ErrInvalidAPITestSuite)
+	}
+	if !apiTestSuiteStatuses[suite.Status] {
+		return fmt.Errorf("%w: status只能为active、inactive或archived", ErrInvalidAPITestSuite)
+	}
+	return nil
+}
+
+// applyAPITestCaseRequest 把请求中提供的字段合并到用例并校验
+func applyAPITestCaseRequest(testCase *models.APITestCase, req *models.APITestCaseRequest) error {
+	if req.Name != nil {
+		testCase.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Method != nil {
+		testCase.Method = strings.ToUpper(strings.TrimSpace(*req.Method))
+	}
+	if req.Endpoint != nil {
+		testCase.Endpoint = strings.TrimSpace(*req.Endpoint)
+	}
+	if req.Headers != nil {
+		testCase.Headers = req.Headers
+	}
+	if req.Params != nil {
+		testCase.Params = req.Params
+	}
+	if req.Body != nil {
+		testCase.Body = req.Body
+	}
+	if req.Assertions != nil {
+		testCase.Assertions = req.Assertions
+	}
+	if req.ExpectedStatus != nil {
+		testCase.ExpectedStatus = *req.ExpectedStatus
+	}
+	if req.Timeout != nil {
+		testCase.Timeout = *req.Timeout
+	}
+	if req.Enabled != nil {
+		testCase.Enabled = *req.Enabled
+	}
+	if req.Tags != nil {
+		tags, err := normalizeAPITestTags(req.Tags, ErrInvalidAPITestCase)
+		if err != nil {
+			return err
+		}
+		testCase.Tags = tags
+	}
+
+	if testCase.Name == "" || utf8.RuneCountInString(testCase.Name) > 200 {
+		return fmt.Errorf("%w: 名称不能为空且不超过200个字符", ErrInvalidAPITestCase)
+	}
+	if !apiTestCaseHTTPMethods[testCase.Method] {
+		return fmt.Errorf("%w: 不支持的请求方法 %q", ErrInvalidAPITestCase, testCase.Method)
+	}
+	if testCase.Endpoint == "" || len(testCase.Endpoint) > 500 {
+		return fmt.Errorf("%w: endpoint不能为空且不超过500个字符", ErrInvalidAPITestCase)
+	}
+	if testCase.ExpectedStatus < 100 || testCase.ExpectedStatus > 599 {
+		return fmt.Errorf("%w: expected_status须在100到599之间", ErrInvalidAPITestCase)
+	}
+	if testCase.Timeout < 1 || testCase.Timeout > apiTestMaxTimeout {
+		return fmt.Errorf("%w: timeout须在1到%d秒之间", ErrInvalidAPITestCase, apiTestMaxTimeout)
+	}
+	return nil
+}
+
+// apiTestCloneName 副本名称，超过200个字符时截断原名称
+func apiTestCloneName(name string) string {
+	limit := 200 - utf8.RuneCountInString(apiTestCloneSuffix)
+	if runes := []rune(name); len(runes) > limit {
+		name = string(runes[:limit])
+	}
+	return name + apiTestCloneSuffix
+}
+
+func marshalAPITestJSON(values ...map[string]interface{}) ([][]byte, error) {
+	out := make([][]byte, len(values))
+	for i, value := range values {
+		if value == nil {
+			value = map[string]interface{}{}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("序列化失败: %w", err)
+		}
+		out[i] = data
+	}
+	return out, nil
+}
+
+// CreateAPITestSuite 创建测试套件
+func (s *QAToolBoxService) CreateAPITestSuite(ctx context.Context, userID string, req *models.APITestSuiteRequest) (*models.APITestSuite, error) {
+	suite := &models.APITestSuite{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		Status: "active",
+		Tags:   []string{},
+	}
+	if err := applyAPITestSuiteRequest(suite, req); err != nil {
+		return nil, err
+	}
+	data, err := marshalAPITestJSON(suite.Headers, suite.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	suite.CreatedAt = time.Now()
+	suite.UpdatedAt = suite.CreatedAt
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO api_test_suites (id, user_id, name, description, base_url, headers, variables, status, tags, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, suite.ID, suite.UserID, suite.Name, suite.Description, suite.BaseURL, data[0], data[1], suite.Status,
+		pq.Array(suite.Tags), suite.CreatedAt, suite.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("创建测试套件失败: %w", err)
+	}
+	return suite, nil
+}
+
+// ListAPITestSuites 用户的测试套件，可按标签、状态和名称过滤
+func (s *QAToolBoxService) ListAPITestSuites(ctx context.Context, userID, tag, status, query string, page, perPage int) ([]models.APITestSuite, int, error) {
+	where := `user_id = $1`
+	args := []interface{}{userID}
+	if tag != "" {
+		args = append(args, tag)
+		where += fmt.Sprintf(` AND $%d = ANY(tags)`, len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(` AND status = $%d`, len(args))
+	}
+	if query != "" {
+		args = append(args, "%"+strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query)+"%")
+		where += fmt.Sprintf(` AND name ILIKE $%d`, len(args))
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_test_suites WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	}
+
+	args = append(args, perPage, (page-1)*perPage)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM api_test_suites WHERE %s
+		ORDER BY updated_at DESC, id
+		LIMIT $%d OFFSET $%d
+	`, apiTestSuiteColumns, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询测试套件失败: %w", err)
+	}
+	defer rows.Close()
+
+	suites := []models.APITestSuite{}
+	for rows.Next() {
+		suite, err := scanAPITestSuite(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("扫描测试套件失败: %w", err)
+		}
+		suites = append(suites, *suite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询测试套件失败: %w", err)
+	}
+	return suites, total, nil
+}
+
+// GetAPITestSuite 获取测试套件及其全部用例
+func (s *QAToolBoxService) GetAPITestSuite(ctx context.Context, userID, suiteID string) (*models.APITestSuite, error) {
+	suite, err := s.getAPITestSuite(ctx, userID, suiteID)
+	if err != nil {
+		return nil, err
+	}
+	suite.Cases, err = s.queryAPITestCases(ctx, s.db, suiteID, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return suite, nil
+}
+
+// getAPITestSuite 获取用户的测试套件
+func (s *QAToolBoxService) getAPITestSuite(ctx context.Context, userID, suiteID string) (*models.APITestSuite, error) {
+	if _, err := uuid.Parse(suiteID); err != nil {
+		return nil, ErrAPITestSuiteNotFound
+	}
+	suite, err := scanAPITestSuite(s.db.QueryRowContext(ctx,
+		`SELECT `+apiTestSuiteColumns+` FROM api_test_suites WHERE id = $1 AND user_id = $2`, suiteID, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITestSuiteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询测试套件失败: %w", err)
+	}
+	return suite, nil
+}
+
+// UpdateAPITestSuite 修改测试套件，未提供的字段保持不变
+func (s *QAToolBoxService) UpdateAPITestSuite(ctx context.Context, userID, suiteID string, req *models.APITestSuiteRequest) (*models.APITestSuite, error) {
+	suite, err := s.getAPITestSuite(ctx, userID, suiteID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyAPITestSuiteRequest(suite, req); err != nil {
+		return nil, err
+	}
+	data, err := marshalAPITestJSON(suite.Headers, suite.Variables)
+	if err != nil {
+		return nil, err
+	}
+
+	suite.UpdatedAt = time.Now()
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE api_test_suites
+		SET name = $1, description = $2, base_url = $3, headers = $4, variables = $5, status = $6, tags = $7, updated_at = $8
+		WHERE id = $9
+	`, suite.Name, suite.Description, suite.BaseURL, data[0], data[1], suite.Status, pq.Array(suite.Tags),
+		suite.UpdatedAt, suite.ID); err != nil {
+		return nil, fmt.Errorf("更新测试套件失败: %w", err)
+	}
+	return suite, nil
+}
+
+// DeleteAPITestSuite 删除测试套件，用例和测试结果一并删除
+func (s *QAToolBoxService) DeleteAPITestSuite(ctx context.Context, userID, suiteID string) error {
+	if _, err := uuid.Parse(suiteID); err != nil {
+		return ErrAPITestSuiteNotFound
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM api_test_suites WHERE id = $1 AND user_id = $2`, suiteID, userID)
+	if err != nil {
+		return fmt.Errorf("删除测试套件失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPITestSuiteNotFound
+	}
+	return nil
+}
+
+// CloneAPITestSuite 复制测试套件及其全部用例，用例保持原有顺序和启用状态
+func (s *QAToolBoxService) CloneAPITestSuite(ctx context.Context, userID, suiteID, name string) (*models.APITestSuite, error) {
+	source, err := s.getAPITestSuite(ctx, userID, suiteID)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = apiTestCloneName(source.Name)
+	}
+	if utf8.RuneCountInString(name) > 200 {
+		return nil, fmt.Errorf("%w: 名称不超过200个字符", ErrInvalidAPITestSuite)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("复制测试套件失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	cloneID := uuid.New().String()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO api_test_suites (id, user_id, name, description, base_url, headers, variables, status, tags, created_at, updated_at)
+		SELECT $1, user_id, $2, description, base_url, headers, variables, status, tags, $3, $3
+		FROM api_test_suites WHERE id = $4
+	`, cloneID, name, now, suiteID); err != nil {
+		return nil, fmt.Errorf("复制测试套件失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO api_test_cases (suite_id, name, method, endpoint, headers, params, body, assertions,
+			expected_status, timeout, enabled, position, tags, created_at, updated_at)
+		SELECT $1, name, method, endpoint, headers, params, body, assertions,
+			expected_status, timeout, enabled, position, tags, $2, $2
+		FROM api_test_cases WHERE suite_id = $3
+	`, cloneID, now, suiteID); err != nil {
+		return nil, fmt.Errorf("复制测试用例失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("复制测试套件失败: %w", err)
+	}
+
+	return s.GetAPITestSuite(ctx, userID, cloneID)
+}
+
+// queryAPITestCases 按执行顺序查询套件的用例，可按标签和启用状态过滤
+func (s *QAToolBoxService) queryAPITestCases(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, suiteID, tag string, enabled *bool) ([]models.APITestCase, error) {
+	where := `suite_id = $1`
+	args := []interface{}{suiteID}
+	if tag != "" {
+		args = append(args, tag)
+		where += fmt.Sprintf(` AND $%d = ANY(tags)`, len(args))
+	}
+	if enabled != nil {
+		args = append(args, *enabled)
+		where += fmt.Sprintf(` AND enabled = $%d`, len(args))
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT `+apiTestCaseColumns+` FROM api_test_cases WHERE `+where+`
+		ORDER BY position, created_at, id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询测试用例失败: %w", err)
+	}
+	defer rows.Close()
+
+	testCases := []models.APITestCase{}
+	for rows.Next() {
+		testCase, err := scanAPITestCase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描测试用例失败: %w", err)
+		}
+		testCases = append(testCases, *testCase)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询测试用例失败: %w", err)
+	}
+	return testCases, nil
+}
+
+// ListAPITestCases 套件的用例，按执行顺序排列
+func (s *QAToolBoxService) ListAPITestCases(ctx context.Context, userID, suiteID, tag string, enabled *bool) ([]models.APITestCase, error) {
+	if _, err := s.getAPITestSuite(ctx, userID, suiteID); err != nil {
+		return nil, err
+	}
+	return s.queryAPITestCases(ctx, s.db, suiteID, tag, enabled)
+}
+
+// GetAPITestCase 获取套件中的用例
+func (s *QAToolBoxService) GetAPITestCase(ctx context.Context, userID, suiteID, caseID string) (*models.APITestCase, error) {
+	if _, err := s.getAPITestSuite(ctx, userID, suiteID); err != nil {
+		return nil, err
+	}
+	return s.getAPITestCase(ctx, s.db, suiteID, caseID)
+}
+
+func (s *QAToolBoxService) getAPITestCase(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, suiteID, caseID string) (*models.APITestCase, error) {
+	if _, err := uuid.Parse(caseID); err != nil {
+		return nil, ErrAPITestCaseNotFound
+	}
+	testCase, err := scanAPITestCase(q.QueryRowContext(ctx,
+		`SELECT `+apiTestCaseColumns+` FROM api_test_cases WHERE id = $1 AND suite_id = $2`, caseID, suiteID))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITestCaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询测试用例失败: %w", err)
+	}
+	return testCase, nil
+}
+
+// lockAPITestSuite 在事务中锁定用户的套件，同一套件的用例排序操作串行执行，返回用例数
+func lockAPITestSuite(ctx context.Context, tx *sql.Tx, userID, suiteID string) (int, error) {
+	if _, err := uuid.Parse(suiteID); err != nil {
+		return 0, ErrAPITestSuiteNotFound
+	}
+	var id string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM api_test_suites WHERE id = $1 AND user_id = $2 FOR UPDATE`, suiteID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrAPITestSuiteNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询测试套件失败: %w", err)
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_test_cases WHERE suite_id = $1`, suiteID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("查询测试用例失败: %w", err)
+	}
+	return count, nil
+}
+
+// clampAPITestPosition 把位置限制在[0, max]内，未指定时取max
+func clampAPITestPosition(position *int, max int) int {
+	if position == nil || *position > max {
+		return max
+	}
+	if *position < 0 {
+		return 0
+	}
+	return *position
+}
+
+// CreateAPITestCase 在套件中创建用例，未指定position时排在末尾
+func (s *QAToolBoxService) CreateAPITestCase(ctx context.Context, userID, suiteID string, req *models.APITestCaseRequest) (*models.APITestCase, error) {
+	testCase := &models.APITestCase{
+		ID:             uuid.New().String(),
+		SuiteID:        suiteID,
+		Method:         "GET",
+		ExpectedStatus: 200,
+		Timeout:        30,
+		Enabled:        true,
+		Tags:           []string{},
+	}
+	if err := applyAPITestCaseRequest(testCase, req); err != nil {
+		return nil, err
+	}
+	data, err := marshalAPITestJSON(testCase.Headers, testCase.Params, testCase.Body, testCase.Assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建测试用例失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	count, err := lockAPITestSuite(ctx, tx, userID, suiteID)
+	if err != nil {
+		return nil, err
+	}
+	testCase.Position = clampAPITestPosition(req.Position, count)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_test_cases SET position = position + 1 WHERE suite_id = $1 AND position >= $2
+	`, suiteID, testCase.Position); err != nil {
+		return nil, fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+
+	testCase.CreatedAt = time.Now()
+	testCase.UpdatedAt = testCase.CreatedAt
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO api_test_cases (id, suite_id, name, method, endpoint, headers, params, body, assertions,
+			expected_status, timeout, enabled, position, tags, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`, testCase.ID, testCase.SuiteID, testCase.Name, testCase.Method, testCase.Endpoint, data[0], data[1], data[2], data[3],
+		testCase.ExpectedStatus, testCase.Timeout, testCase.Enabled, testCase.Position, pq.Array(testCase.Tags),
+		testCase.CreatedAt, testCase.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("创建测试用例失败: %w", err)
+	}
+	if err := touchAPITestSuite(ctx, tx, suiteID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("创建测试用例失败: %w", err)
+	}
+	return testCase, nil
+}
+
+// UpdateAPITestCase 修改用例，未提供的字段保持不变，提供position时移动到该位置
+func (s *QAToolBoxService) UpdateAPITestCase(ctx context.Context, userID, suiteID, caseID string, req *models.APITestCaseRequest) (*models.APITestCase, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("更新测试用例失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	count, err := lockAPITestSuite(ctx, tx, userID, suiteID)
+	if err != nil {
+		return nil, err
+	}
+	testCase, err := s.getAPITestCase(ctx, tx, suiteID, caseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyAPITestCaseRequest(testCase, req); err != nil {
+		return nil, err
+	}
+	data, err := marshalAPITestJSON(testCase.Headers, testCase.Params, testCase.Body, testCase.Assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Position != nil {
+		to := clampAPITestPosition(req.Position, count-1)
+		if err := moveAPITestCase(ctx, tx, suiteID, testCase.Position, to); err != nil {
+			return nil, err
+		}
+		testCase.Position = to
+	}
+
+	testCase.UpdatedAt = time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_test_cases
+		SET name = $1, method = $2, endpoint = $3, headers = $4, params = $5, body = $6, assertions = $7,
+			expected_status = $8, timeout = $9, enabled = $10, position = $11, tags = $12, updated_at = $13
+		WHERE id = $14
+	`, testCase.Name, testCase.Method, testCase.Endpoint, data[0], data[1], data[2], data[3],
+		testCase.ExpectedStatus, testCase.Timeout, testCase.Enabled, testCase.Position, pq.Array(testCase.Tags),
+		testCase.UpdatedAt, testCase.ID); err != nil {
+		return nil, fmt.Errorf("更新测试用例失败: %w", err)
+	}
+	if err := touchAPITestSuite(ctx, tx, suiteID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("更新测试用例失败: %w", err)
+	}
+	return testCase, nil
+}
+
+// moveAPITestCase 把from和to之间的用例整体移动一位，为移动到to的用例腾出位置
+func moveAPITestCase(ctx context.Context, tx *sql.Tx, suiteID string, from, to int) error {
+	var err error
+	switch {
+	case to < from:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE api_test_cases SET position = position + 1 WHERE suite_id = $1 AND position >= $2 AND position < $3
+		`, suiteID, to, from)
+	case to > from:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE api_test_cases SET position = position - 1 WHERE suite_id = $1 AND position > $2 AND position <= $3
+		`, suiteID, from, to)
+	}
+	if err != nil {
+		return fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPITestCase 删除用例，后面的用例依次前移
+func (s *QAToolBoxService) DeleteAPITestCase(ctx context.Context, userID, suiteID, caseID string) error {
+	if _, err := uuid.Parse(caseID); err != nil {
+		return ErrAPITestCaseNotFound
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("删除测试用例失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockAPITestSuite(ctx, tx, userID, suiteID); err != nil {
+		return err
+	}
+	var position int
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM api_test_cases WHERE id = $1 AND suite_id = $2 RETURNING COALESCE(position, 0)
+	`, caseID, suiteID).Scan(&position)
+	if err == sql.ErrNoRows {
+		return ErrAPITestCaseNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("删除测试用例失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_test_cases SET position = position - 1 WHERE suite_id = $1 AND position > $2
+	`, suiteID, position); err != nil {
+		return fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+	if err := touchAPITestSuite(ctx, tx, suiteID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("删除测试用例失败: %w", err)
+	}
+	return nil
+}
+
+// ReorderAPITestCases 按caseIDs的顺序重排套件的全部用例
+func (s *QAToolBoxService) ReorderAPITestCases(ctx context.Context, userID, suiteID string, caseIDs []string) ([]models.APITestCase, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockAPITestSuite(ctx, tx, userID, suiteID); err != nil {
+		return nil, err
+	}
+	current, err := s.queryAPITestCases(ctx, tx, suiteID, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(caseIDs) != len(current) {
+		return nil, fmt.Errorf("%w: 须包含套件的全部%d个用例", ErrInvalidAPITestOrder, len(current))
+	}
+	remaining := make(map[string]bool, len(current))
+	for _, testCase := range current {
+		remaining[testCase.ID] = true
+	}
+	for _, id := range caseIDs {
+		if !remaining[id] {
+			return nil, fmt.Errorf("%w: 用例 %s 不属于该套件或重复出现", ErrInvalidAPITestOrder, id)
+		}
+		delete(remaining, id)
+	}
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_test_cases SET position = array_position($1::text[], id::text) - 1, updated_at = $2
+		WHERE suite_id = $3
+	`, pq.Array(caseIDs), now, suiteID); err != nil {
+		return nil, fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+	if err := touchAPITestSuite(ctx, tx, suiteID); err != nil {
+		return nil, err
+	}
+	testCases, err := s.queryAPITestCases(ctx, tx, suiteID, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+	return testCases, nil
+}
+
+// CloneAPITestCase 复制用例，副本排在原用例之后
+func (s *QAToolBoxService) CloneAPITestCase(ctx context.Context, userID, suiteID, caseID string) (*models.APITestCase, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("复制测试用例失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockAPITestSuite(ctx, tx, userID, suiteID); err != nil {
+		return nil, err
+	}
+	source, err := s.getAPITestCase(ctx, tx, suiteID, caseID)
+	if err != nil {
+		return nil, err
+	}
+
+	position := source.Position + 1
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE api_test_cases SET position = position + 1 WHERE suite_id = $1 AND position >= $2
+	`, suiteID, position); err != nil {
+		return nil, fmt.Errorf("调整用例顺序失败: %w", err)
+	}
+
+	name := apiTestCloneName(source.Name)
+	cloneID := uuid.New().String()
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO api_test_cases (id, suite_id, name, method, endpoint, headers, params, body, assertions,
+			expected_status, timeout, enabled, position, tags, created_at, updated_at)
+		SELECT $1, suite_id, $2, method, endpoint, headers, params, body, assertions,
+			expected_status, timeout, enabled, $3, tags, $4, $4
+		FROM api_test_cases WHERE id = $5
+	`, cloneID, name, position, now, caseID); err != nil {
+		return nil, fmt.Errorf("复制测试用例失败: %w", err)
+	}
+	if err := touchAPITestSuite(ctx, tx, suiteID); err != nil {
+		return nil, err
+	}
+	testCase, err := s.getAPITestCase(ctx, tx, suiteID, cloneID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("复制测试用例失败: %w", err)
+	}
+	return testCase, nil
+}
+
+// touchAPITestSuite 用例变化后更新套件的updated_at
+func touchAPITestSuite(ctx context.Context, tx *sql.Tx, suiteID string) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE api_test_suites SET updated_at = $1 WHERE id = $2`, time.Now(), suiteID); err != nil {
+		return fmt.Errorf("更新测试套件失败: %w", err)
+	}
+	return nil
+}
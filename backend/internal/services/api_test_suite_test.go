@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeAPITestTable 在内存中模拟用例排序相关的语句
+type fakeAPITestTable struct {
+	t      *testing.T
+	mu     sync.Mutex
+	userID string
+	suites map[string]string // 套件ID -> 名称
+	cases  []*fakeAPITestCase
+}
+
+type fakeAPITestCase struct {
+	id, suiteID, name string
+	position          int
+	createdAt         time.Time
+}
+
+// newFakeAPITestTable 创建一个套件，names为按当前顺序排列的用例，positions为各用例保存的位置
+func newFakeAPITestTable(t *testing.T, positions []int, names ...string) (*fakeAPITestTable, *QAToolBoxService, string) {
+	tbl := &fakeAPITestTable{t: t, userID: "user-1", suites: map[string]string{}}
+	suiteID := uuid.New().String()
+	tbl.suites[suiteID] = "冒烟测试"
+	created := time.Now().Add(-time.Hour)
+	for i, name := range names {
+		tbl.cases = append(tbl.cases, &fakeAPITestCase{id: uuid.New().String(), suiteID: suiteID, name: name, position: positions[i], createdAt: created.Add(time.Duration(i) * time.Second)})
+	}
+
+	f, db := newFakeUsageDB(tbl.query)
+	f.exec = tbl.exec
+	return tbl, &QAToolBoxService{db: db}, suiteID
+}
+
+// order 套件的用例名称和位置，按位置排列
+func (tbl *fakeAPITestTable) order(suiteID string) ([]string, []int) {
+	tbl.mu.Lock()
+	defer tbl.mu.Unlock()
+	var names []string
+	var positions []int
+	for _, c := range tbl.sorted(suiteID) {
+		names = append(names, c.name)
+		positions = append(positions, c.position)
+	}
+	return names, positions
+}
+
+func (tbl *fakeAPITestTable) ids(suiteID string) []string {
+	tbl.mu.Lock()
+	defer tbl.mu.Unlock()
+	var ids []string
+	for _, c := range tbl.sorted(suiteID) {
+		ids = append(ids, c.id)
+	}
+	return ids
+}
+
+func (tbl *fakeAPITestTable) sorted(suiteID string) []*fakeAPITestCase {
+	var cases []*fakeAPITestCase
+	for _, c := range tbl.cases {
+		if c.suiteID == suiteID {
+			cases = append(cases, c)
+		}
+	}
+	sort.SliceStable(cases, func(i, j int) bool {
+		if cases[i].position != cases[j].position {
+			return cases[i].position < cases[j].position
+		}
+		return cases[i].createdAt.Before(cases[j].createdAt)
+	})
+	return cases
+}
+
+func (tbl *fakeAPITestTable) find(id string) *fakeAPITestCase {
+	for _, c := range tbl.cases {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *fakeAPITestCase) row() []driver.Value {
+	return []driver.Value{c.id, c.suiteID, c.name, "GET", "/health", nil, nil, nil, nil,
+		int64(200), int64(30), true, int64(c.position), "{}", c.createdAt, c.createdAt}
+}
+
+func (tbl *fakeAPITestTable) query(query string, args []interface{}) [][]driver.Value {
+	tbl.mu.Lock()
+	defer tbl.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT id FROM api_test_suites"):
+		if _, ok := tbl.suites[args[0].(string)]; ok && args[1] == tbl.userID {
+			return [][]driver.Value{{args[0]}}
+		}
+	case strings.HasPrefix(query, "SELECT "+apiTestSuiteColumns):
+		name, ok := tbl.suites[args[0].(string)]
+		if ok && args[1] == tbl.userID {
+			now := time.Now()
+			return [][]driver.Value{{args[0], tbl.userID, name, "", "", nil, nil, "active", "{}", int64(len(tbl.sorted(args[0].(string)))), now, now}}
+		}
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM api_test_cases"):
+		return [][]driver.Value{{int64(len(tbl.sorted(args[0].(string))))}}
+	case strings.HasPrefix(query, "SELECT "+apiTestCaseColumns+" FROM api_test_cases WHERE suite_id = $1"):
+		var rows [][]driver.Value
+		for _, c := range tbl.sorted(args[0].(string)) {
+			rows = append(rows, c.row())
+		}
+		return rows
+	case strings.HasPrefix(query, "SELECT "+apiTestCaseColumns+" FROM api_test_cases WHERE id = $1"):
+		if c := tbl.find(args[0].(string)); c != nil && c.suiteID == args[1] {
+			return [][]driver.Value{c.row()}
+		}
+	case strings.HasPrefix(query, "DELETE FROM api_test_cases"):
+		for i, c := range tbl.cases {
+			if c.id == args[0] && c.suiteID == args[1] {
+				tbl.cases = append(tbl.cases[:i], tbl.cases[i+1:]...)
+				return [][]driver.Value{{int64(c.position)}}
+			}
+		}
+	default:
+		tbl.t.Errorf("unexpected query %q", query)
+	}
+	return nil
+}
+
+func (tbl *fakeAPITestTable) exec(query string, args []interface{}) {
+	tbl.mu.Lock()
+	defer tbl.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "UPDATE api_test_suites SET updated_at"):
+	case strings.HasPrefix(query, "UPDATE api_test_cases SET position = position + 1 WHERE suite_id = $1 AND position >= $2"):
+		for _, c := range tbl.sorted(args[0].(string)) {
+			if c.position >= int(args[1].(int64)) {
+				c.position++
+			}
+		}
+	case strings.HasPrefix(query, "UPDATE api_test_cases SET position = position - 1 WHERE suite_id = $1 AND position > $2"):
+		for _, c := range tbl.sorted(args[0].(string)) {
+			if c.position > int(args[1].(int64)) {
+				c.position--
+			}
+		}
+	case strings.HasPrefix(query, "UPDATE api_test_cases SET position = array_position"):
+		ids := strings.Split(strings.Trim(args[0].(string), "{}"), ",")
+		for _, c := range tbl.sorted(args[2].(string)) {
+			c.position = -1
+			for i, id := range ids {
+				if strings.Trim(id, `"`) == c.id {
+					c.position = i
+				}
+			}
+		}
+	case strings.HasPrefix(query, "INSERT INTO api_test_suites"):
+		tbl.suites[args[0].(string)] = args[1].(string)
+	case strings.HasPrefix(query, "INSERT INTO api_test_cases (suite_id"):
+		// 复制套件的用例：保留位置，新用例的ID和创建时间由数据库生成
+		for _, c := range tbl.sorted(args[2].(string)) {
+			tbl.cases = append(tbl.cases, &fakeAPITestCase{id: uuid.New().String(), suiteID: args[0].(string), name: c.name, position: c.position, createdAt: args[1].(time.Time)})
+		}
+	case strings.HasPrefix(query, "INSERT INTO api_test_cases (id"):
+		source := tbl.find(args[4].(string))
+		tbl.cases = append(tbl.cases, &fakeAPITestCase{id: args[0].(string), suiteID: source.suiteID, name: args[1].(string), position: int(args[2].(int64)), createdAt: args[3].(time.Time)})
+	default:
+		tbl.t.Errorf("unexpected statement %q", query)
+	}
+}
+
+func TestReorderAPITestCases(t *testing.T) {
+	tbl, s, suiteID := newFakeAPITestTable(t, []int{0, 1, 2, 3}, "登录", "查询", "下单", "退出")
+	ids := tbl.ids(suiteID)
+
+	invalid := []struct {
+		name string
+		ids  []string
+	}{
+		{"missing case", []string{ids[3], ids[0], ids[1]}},
+		{"duplicate id", []string{ids[3], ids[0], ids[0], ids[1]}},
+		{"unknown id", []string{ids[3], ids[0], ids[1], uuid.New().String()}},
+		{"too many", append([]string{ids[2]}, ids...)},
+		{"empty", nil},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ReorderAPITestCases(context.Background(), "user-1", suiteID, tt.ids)
+			if !errors.Is(err, ErrInvalidAPITestOrder) {
+				t.Errorf("ReorderAPITestCases() error = %v, want ErrInvalidAPITestOrder", err)
+			}
+			if names, _ := tbl.order(suiteID); !reflect.DeepEqual(names, []string{"登录", "查询", "下单", "退出"}) {
+				t.Errorf("order changed to %v", names)
+			}
+		})
+	}
+
+	t.Run("another user's suite", func(t *testing.T) {
+		_, err := s.ReorderAPITestCases(context.Background(), "user-2", suiteID, ids)
+		if !errors.Is(err, ErrAPITestSuiteNotFound) {
+			t.Errorf("ReorderAPITestCases() error = %v, want ErrAPITestSuiteNotFound", err)
+		}
+	})
+
+	t.Run("reorders every case", func(t *testing.T) {
+		cases, err := s.ReorderAPITestCases(context.Background(), "user-1", suiteID, []string{ids[3], ids[1], ids[0], ids[2]})
+		if err != nil {
+			t.Fatalf("ReorderAPITestCases() error = %v", err)
+		}
+		var got []string
+		for i, c := range cases {
+			got = append(got, c.Name)
+			if c.Position != i {
+				t.Errorf("case %s position = %d, want %d", c.Name, c.Position, i)
+			}
+		}
+		if want := []string{"退出", "查询", "登录", "下单"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("order = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestReorderAPITestCasesClosesGaps(t *testing.T) {
+	// 旧数据中的位置可能不连续，重排后从0开始连续编号
+	tbl, s, suiteID := newFakeAPITestTable(t, []int{0, 3, 7}, "登录", "查询", "退出")
+	ids := tbl.ids(suiteID)
+
+	if _, err := s.ReorderAPITestCases(context.Background(), "user-1", suiteID, []string{ids[1], ids[2], ids[0]}); err != nil {
+		t.Fatalf("ReorderAPITestCases() error = %v", err)
+	}
+	names, positions := tbl.order(suiteID)
+	if !reflect.DeepEqual(names, []string{"查询", "退出", "登录"}) || !reflect.DeepEqual(positions, []int{0, 1, 2}) {
+		t.Errorf("order = %v at %v", names, positions)
+	}
+}
+
+func TestDeleteAPITestCaseRenumbers(t *testing.T) {
+	tbl, s, suiteID := newFakeAPITestTable(t, []int{0, 1, 2, 3}, "登录", "查询", "下单", "退出")
+	ids := tbl.ids(suiteID)
+
+	if err := s.DeleteAPITestCase(context.Background(), "user-1", suiteID, ids[1]); err != nil {
+		t.Fatalf("DeleteAPITestCase() error = %v", err)
+	}
+	names, positions := tbl.order(suiteID)
+	if !reflect.DeepEqual(names, []string{"登录", "下单", "退出"}) || !reflect.DeepEqual(positions, []int{0, 1, 2}) {
+		t.Errorf("order = %v at %v", names, positions)
+	}
+
+	// 删除最后一个不影响其他用例
+	if err := s.DeleteAPITestCase(context.Background(), "user-1", suiteID, ids[3]); err != nil {
+		t.Fatalf("DeleteAPITestCase() error = %v", err)
+	}
+	if _, positions := tbl.order(suiteID); !reflect.DeepEqual(positions, []int{0, 1}) {
+		t.Errorf("positions = %v", positions)
+	}
+
+	for _, id := range []string{ids[1], uuid.New().String(), "not-a-uuid"} {
+		if err := s.DeleteAPITestCase(context.Background(), "user-1", suiteID, id); !errors.Is(err, ErrAPITestCaseNotFound) {
+			t.Errorf("DeleteAPITestCase(%s) error = %v, want ErrAPITestCaseNotFound", id, err)
+		}
+	}
+}
+
+func TestCloneAPITestCaseKeepsOrder(t *testing.T) {
+	tbl, s, suiteID := newFakeAPITestTable(t, []int{0, 1, 2}, "登录", "查询", "退出")
+	ids := tbl.ids(suiteID)
+
+	clone, err := s.CloneAPITestCase(context.Background(), "user-1", suiteID, ids[1])
+	if err != nil {
+		t.Fatalf("CloneAPITestCase() error = %v", err)
+	}
+	if clone.Name != "查询"+apiTestCloneSuffix || clone.Position != 2 {
+		t.Errorf("clone = %q at %d", clone.Name, clone.Position)
+	}
+	// 副本紧跟在原用例之后，后面的用例依次后移
+	names, positions := tbl.order(suiteID)
+	if !reflect.DeepEqual(names, []string{"登录", "查询", "查询 (副本)", "退出"}) || !reflect.DeepEqual(positions, []int{0, 1, 2, 3}) {
+		t.Errorf("order = %v at %v", names, positions)
+	}
+}
+
+func TestCloneAPITestSuiteKeepsOrder(t *testing.T) {
+	tbl, s, suiteID := newFakeAPITestTable(t, []int{0, 1, 2}, "登录", "查询", "退出")
+	ids := tbl.ids(suiteID)
+	if _, err := s.ReorderAPITestCases(context.Background(), "user-1", suiteID, []string{ids[2], ids[0], ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	clone, err := s.CloneAPITestSuite(context.Background(), "user-1", suiteID, "")
+	if err != nil {
+		t.Fatalf("CloneAPITestSuite() error = %v", err)
+	}
+	if clone.ID == suiteID || clone.Name != "冒烟测试"+apiTestCloneSuffix || clone.CaseCount != 3 {
+		t.Errorf("clone = %+v", clone)
+	}
+
+	// 副本的用例同时创建，仍按原顺序排列
+	names, positions := tbl.order(clone.ID)
+	if !reflect.DeepEqual(names, []string{"退出", "登录", "查询"}) || !reflect.DeepEqual(positions, []int{0, 1, 2}) {
+		t.Errorf("clone order = %v at %v", names, positions)
+	}
+	cloneIDs := tbl.ids(clone.ID)
+	for _, id := range cloneIDs {
+		for _, original := range ids {
+			if id == original {
+				t.Errorf("clone shares case id %s with the original", id)
+			}
+		}
+	}
+	if names, _ := tbl.order(suiteID); !reflect.DeepEqual(names, []string{"退出", "登录", "查询"}) {
+		t.Errorf("original order = %v", names)
+	}
+}
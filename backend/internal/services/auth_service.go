@@ -5,7 +5,10 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,17 +17,30 @@ import (
 	"qa-toolbox-backend/internal/models"
 )
 
+// ErrInvalidUserUpdate 资料更新包含不允许修改的字段或无效的值
+var ErrInvalidUserUpdate = errors.New("invalid profile update")
+
+// userUpdateColumns 允许用户修改的资料字段及对应的列，avatar_file_id 转换为 avatar_url 保存
+var userUpdateColumns = map[string]string{
+	"first_name":     "first_name",
+	"last_name":      "last_name",
+	"username":       "username",
+	"avatar_file_id": "avatar_url",
+}
+
 type AuthService struct {
 	db        *database.DB
 	redis     *database.RedisClient
 	jwtSecret string
+	files     *FileService
 }
 
-func NewAuthService(db *database.DB, redis *database.RedisClient, jwtSecret string) *AuthService {
+func NewAuthService(db *database.DB, redis *database.RedisClient, jwtSecret string, files *FileService) *AuthService {
 	return &AuthService{
 		db:        db,
 		redis:     redis,
 		jwtSecret: jwtSecret,
+		files:     files,
 	}
 }
 
@@ -145,7 +161,7 @@ func (s *AuthService) Login(req *models.UserLoginRequest) (*models.UserResponse,
 		Username:             user.Username,
 		FirstName:            user.FirstName,
 		LastName:             user.LastName,
-		AvatarURL:            user.AvatarURL,
+		AvatarURL:            s.files.ResolveURL(context.Background(), user.ID, user.AvatarURL),
 		IsActive:             user.IsActive,
 		IsPremium:            user.IsPremium,
 		SubscriptionType:    user.SubscriptionType,
@@ -187,7 +203,7 @@ func (s *AuthService) GetUserByID(userID string) (*models.UserResponse, error) {
 		user.LastName = lastName.String
 	}
 	if avatarURL.Valid {
-		user.AvatarURL = avatarURL.String
+		user.AvatarURL = s.files.ResolveURL(context.Background(), userID, avatarURL.String)
 	}
 	if subscriptionExpiresAt.Valid {
 		user.SubscriptionExpiresAt = &subscriptionExpiresAt.Time
@@ -203,14 +219,36 @@ func (s *AuthService) GetUserByID(userID string) (*models.UserResponse, error) {
 }
 
 // UpdateUser 更新用户信息
+//
+// 只能修改 userUpdateColumns 中的字段，包含其他字段时返回 ErrInvalidUserUpdate。
+// 头像只能引用自己上传的图片，不接受直接提供的地址
 func (s *AuthService) UpdateUser(userID string, updates map[string]interface{}) (*models.UserResponse, error) {
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		if _, ok := userUpdateColumns[key]; !ok {
+			return nil, fmt.Errorf("%w: field %q cannot be updated", ErrInvalidUserUpdate, key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	// 构建更新查询
 	setParts := []string{}
 	args := []interface{}{}
 	argIndex := 1
 
-	for key, value := range updates {
-		setParts = append(setParts, fmt.Sprintf("%s = $%d", key, argIndex))
+	for _, key := range keys {
+		value := updates[key]
+		if key == "avatar_file_id" {
+			ref, err := s.avatarReference(userID, value)
+			if err != nil {
+				return nil, err
+			}
+			value = ref
+		} else if text, ok := value.(string); !ok || strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("%w: %s must be a non-empty string", ErrInvalidUserUpdate, key)
+		}
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", userUpdateColumns[key], argIndex))
 		args = append(args, value)
 		argIndex++
 	}
@@ -224,22 +262,47 @@ func (s *AuthService) UpdateUser(userID string, updates map[string]interface{})
 		WHERE id = $%d
 		RETURNING id, email, username, first_name, last_name, avatar_url, 
 		          is_active, is_premium, subscription_type, subscription_expires_at, created_at
-	`, fmt.Sprintf("%s", setParts[0]), argIndex)
+	`, strings.Join(setParts, ", "), argIndex)
 
 	args = append(args, userID)
 
 	user := &models.UserResponse{}
+	var avatarURL sql.NullString
 	err := s.db.QueryRow(query, args...).Scan(
-		&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &user.AvatarURL,
+		&user.ID, &user.Email, &user.Username, &user.FirstName, &user.LastName, &avatarURL,
 		&user.IsActive, &user.IsPremium, &user.SubscriptionType, &user.SubscriptionExpiresAt, &user.CreatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
+	user.AvatarURL = s.files.ResolveURL(context.Background(), userID, avatarURL.String)
 
 	return user, nil
 }
 
+// avatarReference 校验avatar_file_id并转换为保存的文件引用 file:<id>，空字符串表示清除头像
+func (s *AuthService) avatarReference(userID string, value interface{}) (interface{}, error) {
+	fileID, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: avatar_file_id must be a string", ErrInvalidUserUpdate)
+	}
+	if fileID == "" {
+		return nil, nil
+	}
+	if s.files == nil {
+		return nil, fmt.Errorf("file storage is not configured")
+	}
+
+	file, err := s.files.Get(context.Background(), userID, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avatar file: %w", err)
+	}
+	if !strings.HasPrefix(file.ContentType, "image/") {
+		return nil, fmt.Errorf("%w: avatar file must be an image", ErrInvalidUserUpdate)
+	}
+	return FileSourcePrefix + file.ID, nil
+}
+
 // ChangePassword 修改密码
 func (s *AuthService) ChangePassword(userID, oldPassword, newPassword string) error {
 	// 获取当前密码
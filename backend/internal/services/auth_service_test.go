@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuthServiceUpdateUserAvatar(t *testing.T) {
+	const (
+		userID  = "user-1"
+		imageID = "7d9f4c1e-52a4-4d6b-9a51-0f6f1b9a1c01"
+		textID  = "7d9f4c1e-52a4-4d6b-9a51-0f6f1b9a1c02"
+	)
+
+	var mu sync.Mutex
+	var updateQuery string
+	var updateArgs []interface{}
+	_, db := newFakeUsageDB(func(query string, args []interface{}) [][]driver.Value {
+		switch {
+		case strings.HasPrefix(query, "SELECT id, user_id, filename"):
+			contentType := map[string]string{imageID: "image/png", textID: "text/plain"}[args[0].(string)]
+			if contentType == "" || args[1] != userID {
+				return nil
+			}
+			return [][]driver.Value{{args[0], userID, "a", contentType, "png", int64(10), "sum", nil, "local", "key", time.Now()}}
+		case strings.HasPrefix(query, "UPDATE users SET"):
+			mu.Lock()
+			updateQuery, updateArgs = query, args
+			mu.Unlock()
+			var avatar driver.Value
+			for _, arg := range args {
+				if s, ok := arg.(string); ok && strings.HasPrefix(s, FileSourcePrefix) {
+					avatar = s
+				}
+			}
+			return [][]driver.Value{{userID, "a@example.com", "a", "张", "三", avatar, true, false, "free", nil, time.Now()}}
+		}
+		return nil
+	})
+	files := &FileService{db: db, signingKey: []byte("secret"), urlTTL: time.Hour}
+	auth := NewAuthService(db, nil, "secret", files)
+
+	t.Run("file reference", func(t *testing.T) {
+		user, err := auth.UpdateUser(userID, map[string]interface{}{"avatar_file_id": imageID, "first_name": "张"})
+		if err != nil {
+			t.Fatalf("UpdateUser() error = %v", err)
+		}
+		if !strings.Contains(updateQuery, "avatar_url = $") || !strings.Contains(updateQuery, "first_name = $") {
+			t.Errorf("query = %s", updateQuery)
+		}
+		if !strings.HasPrefix(user.AvatarURL, "/api/v1/files/"+imageID+"/content?expires=") {
+			t.Errorf("avatar url = %q, want a signed download url", user.AvatarURL)
+		}
+	})
+
+	t.Run("disallowed keys rejected", func(t *testing.T) {
+		for _, updates := range []map[string]interface{}{
+			{"avatar_url": "http://example.com/a.png"},
+			{"is_premium": true, "first_name": "张"},
+			{"subscription_type": "vip"},
+			{"role = 'admin', username": "a"},
+			{"first_name = 'x' WHERE 1=1; --": "a"},
+		} {
+			mu.Lock()
+			updateQuery = ""
+			mu.Unlock()
+			_, err := auth.UpdateUser(userID, updates)
+			if !errors.Is(err, ErrInvalidUserUpdate) {
+				t.Errorf("UpdateUser(%v) error = %v, want ErrInvalidUserUpdate", updates, err)
+			}
+			if updateQuery != "" {
+				t.Errorf("UpdateUser(%v) ran %s", updates, updateQuery)
+			}
+		}
+	})
+
+	t.Run("values must be strings", func(t *testing.T) {
+		for _, updates := range []map[string]interface{}{
+			{"username": 42.0},
+			{"first_name": "  "},
+			{"last_name": nil},
+		} {
+			if _, err := auth.UpdateUser(userID, updates); !errors.Is(err, ErrInvalidUserUpdate) {
+				t.Errorf("UpdateUser(%v) error = %v, want ErrInvalidUserUpdate", updates, err)
+			}
+		}
+	})
+
+	t.Run("columns from the allow list", func(t *testing.T) {
+		if _, err := auth.UpdateUser(userID, map[string]interface{}{"username": "new", "last_name": "三"}); err != nil {
+			t.Fatalf("UpdateUser() error = %v", err)
+		}
+		if !strings.Contains(updateQuery, "last_name = $1, username = $2") || len(updateArgs) != 3 {
+			t.Errorf("query = %s, args = %v", updateQuery, updateArgs)
+		}
+	})
+
+	t.Run("empty id clears the avatar", func(t *testing.T) {
+		user, err := auth.UpdateUser(userID, map[string]interface{}{"avatar_file_id": ""})
+		if err != nil {
+			t.Fatalf("UpdateUser() error = %v", err)
+		}
+		if len(updateArgs) != 2 || updateArgs[0] != nil || user.AvatarURL != "" {
+			t.Errorf("args = %v, avatar url = %q", updateArgs, user.AvatarURL)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		wantErr string
+	}{
+		{"not a string", 42.0, "must be a string"},
+		{"not an image", textID, "must be an image"},
+		{"unknown file", "7d9f4c1e-52a4-4d6b-9a51-0f6f1b9a1c03", ErrFileNotFound.Error()},
+		{"invalid id", "../etc/passwd", ErrFileNotFound.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.UpdateUser(userID, map[string]interface{}{"avatar_file_id": tt.value})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("UpdateUser() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("another user's file", func(t *testing.T) {
+		_, err := auth.UpdateUser("user-2", map[string]interface{}{"avatar_file_id": imageID})
+		if !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("UpdateUser() error = %v, want ErrFileNotFound", err)
+		}
+	})
+}
+
+func TestFileServiceResolveURL(t *testing.T) {
+	const fileID = "7d9f4c1e-52a4-4d6b-9a51-0f6f1b9a1c01"
+	_, db := newFakeUsageDB(func(query string, args []interface{}) [][]driver.Value {
+		if strings.HasPrefix(query, "SELECT id, user_id, filename") && args[0] == fileID && args[1] == "user-1" {
+			return [][]driver.Value{{fileID, "user-1", "a.png", "image/png", "png", int64(10), "sum", nil, "local", "key", time.Now()}}
+		}
+		return nil
+	})
+	files := &FileService{db: db, signingKey: []byte("secret"), urlTTL: time.Hour}
+
+	tests := []struct {
+		name   string
+		userID string
+		ref    string
+		want   string
+	}{
+		{"empty", "user-1", "", ""},
+		{"external url", "user-1", "https://cdn.example.com/a.png", "https://cdn.example.com/a.png"},
+		{"own file", "user-1", FileSourcePrefix + fileID, "/api/v1/files/" + fileID + "/content?expires="},
+		{"another user's file", "user-2", FileSourcePrefix + fileID, ""},
+		{"missing file", "user-1", FileSourcePrefix + "7d9f4c1e-52a4-4d6b-9a51-0f6f1b9a1c09", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := files.ResolveURL(context.Background(), tt.userID, tt.ref)
+			if !strings.HasPrefix(got, tt.want) || (tt.want == "" && got != "") {
+				t.Errorf("ResolveURL(%q) = %q, want prefix %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+
+	// 未配置文件服务时无法签发链接
+	var none *FileService
+	if got := none.ResolveURL(context.Background(), "user-1", FileSourcePrefix+fileID); got != "" {
+		t.Errorf("nil ResolveURL() = %q", got)
+	}
+}
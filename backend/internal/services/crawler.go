@@ -0,0 +1,714 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/models"
+)
+
+// 爬取范围
+const (
+	CrawlScopeHost   = "host"   // 只爬取与起始地址相同的主机
+	CrawlScopeDomain = "domain" // 包括同一域名下的子域名
+)
+
+const (
+	// 超过该长度的链接不加入待爬队列
+	maxCrawlURLLength = 2048
+	// robots.txt 的最大读取长度
+	maxRobotsSize = 512 * 1024
+	// 读取robots.txt网络失败时按允许处理，缓存时间较短以便尽快重试
+	robotsErrorTTL = time.Minute
+	// robots缓存超过该数量时清理过期条目
+	robotsCachePruneSize = 1000
+)
+
+// ErrInvalidCrawlerTask 爬虫任务的地址或配置无效
+var ErrInvalidCrawlerTask = errors.New("爬虫任务配置无效")
+
+// CrawlOptions 一次爬取的参数
+type CrawlOptions struct {
+	StartURL      string
+	MaxPages      int
+	MaxDepth      int // 0表示不限制深度
+	Delay         time.Duration
+	FollowLinks   bool
+	RespectRobots bool
+	Scope         string
+	Workers       int
+	Include       []*regexp.Regexp // 不为空时只跟随匹配的链接
+	Exclude       []*regexp.Regexp
+}
+
+// CrawledPage 抓取结果，Err不为空表示请求失败
+type CrawledPage struct {
+	URL          string
+	Depth        int
+	StatusCode   int
+	ResponseTime time.Duration
+	Header       http.Header
+	ContentType  string
+	Body         []byte
+	Links        []string
+	Canonical    string
+	Err          error
+	CrawledAt    time.Time
+
+	skipped bool
+}
+
+// IsHTML 响应是否为HTML页面
+func (p *CrawledPage) IsHTML() bool {
+	return p.ContentType == "text/html" || p.ContentType == "application/xhtml+xml"
+}
+
+// Failed 请求失败或返回错误状态码
+func (p *CrawledPage) Failed() bool {
+	return p.Err != nil || p.StatusCode >= 400
+}
+
+// CrawlProgress 爬取进度
+type CrawlProgress struct {
+	Crawled int `json:"pages_crawled"`
+	Failed  int `json:"pages_failed"`
+	Skipped int `json:"pages_skipped"` // robots.txt禁止或与已爬页面重复
+	Queued  int `json:"pages_queued"`
+}
+
+// Done 已处理的页面数
+func (p CrawlProgress) Done() int {
+	return p.Crawled + p.Failed
+}
+
+// Crawler 多页面爬虫，robots.txt缓存在所有任务间共享
+type Crawler struct {
+	client     *http.Client
+	robots     *robotsCache
+	userAgent  string
+	maxWorkers int
+	maxPages   int
+	maxBody    int64
+}
+
+func NewCrawler(cfg *config.Config) *Crawler {
+	client := newAddressGuard(cfg.CrawlerAllowedNetworks).HTTPClient(time.Duration(cfg.CrawlerTimeoutSeconds) * time.Second)
+	return &Crawler{
+		client:     client,
+		robots:     newRobotsCache(client, cfg.CrawlerUserAgent, time.Duration(cfg.CrawlerRobotsCacheMinutes)*time.Minute),
+		userAgent:  cfg.CrawlerUserAgent,
+		maxWorkers: cfg.CrawlerWorkers,
+		maxPages:   cfg.CrawlerMaxPages,
+		maxBody:    cfg.CrawlerMaxBodyBytes,
+	}
+}
+
+// MaxPages 单个任务最多爬取的页面数
+func (c *Crawler) MaxPages() int {
+	return c.maxPages
+}
+
+// HTTPClient 爬虫的HTTP客户端，同样不能访问内网地址，用于请求Webhook等用户提供的地址
+func (c *Crawler) HTTPClient() *http.Client {
+	return c.client
+}
+
+// crawlItem 待爬队列中的链接
+type crawlItem struct {
+	url   *url.URL
+	depth int
+}
+
+// Crawl 从起始地址开始按广度优先爬取
+//
+// 页面由固定数量的worker并发抓取，handle在调用方的goroutine中按完成顺序逐个调用，返回错误时停止爬取。
+// 链接按规范化后的地址去重，重定向或canonical指向已爬取页面的结果不会交给handle
+func (c *Crawler) Crawl(ctx context.Context, opts CrawlOptions, handle func(*CrawledPage, CrawlProgress) error) (CrawlProgress, error) {
+	var progress CrawlProgress
+	start, err := parseCrawlURL(opts.StartURL)
+	if err != nil {
+		return progress, err
+	}
+
+	maxPages := opts.MaxPages
+	if maxPages <= 0 || (c.maxPages > 0 && maxPages > c.maxPages) {
+		maxPages = c.maxPages
+	}
+	if !opts.FollowLinks {
+		maxPages = 1
+	}
+	workers := opts.Workers
+	if workers <= 0 || workers > c.maxWorkers {
+		workers = c.maxWorkers
+	}
+	if workers > maxPages {
+		workers = maxPages
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	throttle := newHostThrottle()
+	items := make(chan crawlItem)
+	pages := make(chan *CrawledPage)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				page := c.fetch(ctx, item, opts, throttle)
+				select {
+				case pages <- page:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	defer func() {
+		// 先取消再等待，提前返回时worker可能阻塞在发送结果上
+		cancel()
+		close(items)
+		wg.Wait()
+	}()
+
+	queue := []crawlItem{{url: start, depth: 0}}
+	queued := map[string]bool{canonicalURL(start): true}
+	fetched := map[string]bool{}
+	inflight := 0
+
+	for {
+		// 已抓取和正在抓取的页面达到上限后不再分发
+		var send chan crawlItem
+		var next crawlItem
+		if len(queue) > 0 && progress.Done()+inflight < maxPages {
+			send, next = items, queue[0]
+		}
+		if send == nil && inflight == 0 {
+			break
+		}
+
+		select {
+		case send <- next:
+			queue = queue[1:]
+			inflight++
+		case page := <-pages:
+			inflight--
+			if page.skipped {
+				progress.Skipped++
+				continue
+			}
+
+			// 重定向和canonical可能指向已爬取的页面
+			keys := []string{page.URL}
+			if page.Canonical != "" {
+				keys = append(keys, page.Canonical)
+			}
+			duplicate := false
+			for i, key := range keys {
+				if u, err := url.Parse(key); err == nil {
+					keys[i] = canonicalURL(u)
+				}
+				duplicate = duplicate || fetched[keys[i]]
+			}
+			if duplicate {
+				progress.Skipped++
+				continue
+			}
+			for _, key := range keys {
+				fetched[key] = true
+				queued[key] = true
+			}
+
+			if page.Failed() {
+				progress.Failed++
+			} else {
+				progress.Crawled++
+			}
+
+			if opts.FollowLinks && (opts.MaxDepth <= 0 || page.Depth < opts.MaxDepth) {
+				for _, link := range page.Links {
+					u, err := url.Parse(link)
+					if err != nil || !inCrawlScope(u, start, opts) {
+						continue
+					}
+					key := canonicalURL(u)
+					if queued[key] {
+						continue
+					}
+					queued[key] = true
+					queue = append(queue, crawlItem{url: u, depth: page.Depth + 1})
+				}
+			}
+			progress.Queued = len(queue)
+
+			if err := handle(page, progress); err != nil {
+				return progress, err
+			}
+		case <-ctx.Done():
+			return progress, ctx.Err()
+		}
+	}
+
+	progress.Queued = 0
+	return progress, nil
+}
+
+// fetch 检查robots.txt、等待限速后抓取页面
+func (c *Crawler) fetch(ctx context.Context, item crawlItem, opts CrawlOptions, throttle *hostThrottle) *CrawledPage {
+	u := item.url
+	page := &CrawledPage{URL: u.String(), Depth: item.depth}
+
+	delay := opts.Delay
+	if opts.RespectRobots {
+		robots := c.robots.get(ctx, u)
+		if robots != nil {
+			if !robots.TestAgent(u.EscapedPath()+queryPart(u), c.userAgent) {
+				page.skipped = true
+				return page
+			}
+			if group := robots.FindGroup(c.userAgent); group != nil && group.CrawlDelay > delay {
+				delay = group.CrawlDelay
+			}
+		}
+	}
+
+	if err := throttle.wait(ctx, u.Host, delay); err != nil {
+		page.Err = err
+		return page
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		page.Err = err
+		return page
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+
+	startTime := time.Now()
+	resp, err := c.client.Do(req)
+	page.CrawledAt = time.Now()
+	page.ResponseTime = time.Since(startTime)
+	if err != nil {
+		page.Err = err
+		return page
+	}
+	defer resp.Body.Close()
+
+	page.URL = resp.Request.URL.String()
+	page.StatusCode = resp.StatusCode
+	page.Header = resp.Header
+	page.ContentType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	reader := io.Reader(resp.Body)
+	if c.maxBody > 0 {
+		reader = io.LimitReader(resp.Body, c.maxBody)
+	}
+	page.Body, err = io.ReadAll(reader)
+	page.ResponseTime = time.Since(startTime)
+	if err != nil {
+		page.Err = fmt.Errorf("读取响应失败: %w", err)
+		return page
+	}
+
+	if page.IsHTML() {
+		var nofollow bool
+		page.Links, page.Canonical, nofollow = extractHTMLLinks(page.Body, resp.Request.URL, opts.RespectRobots)
+		if nofollow {
+			page.Links = nil
+		}
+	}
+	return page
+}
+
+// parseCrawlURL 解析起始地址，只支持http(s)
+func parseCrawlURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 地址无效: %v", ErrInvalidCrawlerTask, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: 只支持http(s)地址", ErrInvalidCrawlerTask)
+	}
+	return u, nil
+}
+
+// inCrawlScope 链接是否在爬取范围内并通过包含、排除规则
+func inCrawlScope(u, start *url.URL, opts CrawlOptions) bool {
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.String()) > maxCrawlURLLength {
+		return false
+	}
+
+	host, startHost := strings.ToLower(u.Hostname()), strings.ToLower(start.Hostname())
+	switch opts.Scope {
+	case CrawlScopeDomain:
+		base := strings.TrimPrefix(startHost, "www.")
+		if host != base && !strings.HasSuffix(host, "."+base) {
+			return false
+		}
+	default:
+		if host != startHost {
+			return false
+		}
+	}
+
+	link := u.String()
+	for _, pattern := range opts.Exclude {
+		if pattern.MatchString(link) {
+			return false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Include {
+		if pattern.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalURL 规范化地址用于去重：忽略大小写、默认端口、片段、跟踪参数和查询参数顺序
+func canonicalURL(u *url.URL) string {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.User = nil
+	c.Fragment, c.RawFragment = "", ""
+
+	host := strings.ToLower(c.Hostname())
+	if port := c.Port(); port != "" && !(c.Scheme == "http" && port == "80") && !(c.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	c.Host = host
+
+	if c.Path == "" {
+		c.Path = "/"
+	} else {
+		cleaned := path.Clean(c.Path)
+		if strings.HasSuffix(c.Path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		c.Path = cleaned
+	}
+	c.RawPath = ""
+
+	query := c.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	c.RawQuery = query.Encode()
+	return c.String()
+}
+
+func queryPart(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+// extractHTMLLinks 提取页面中的链接和canonical地址
+//
+// respectRobots为true时忽略rel=nofollow的链接，页面声明 meta robots nofollow 时返回nofollow
+func extractHTMLLinks(body []byte, pageURL *url.URL, respectRobots bool) ([]string, string, bool) {
+	base := pageURL
+	var links []string
+	var canonical string
+	var nofollow bool
+	seen := map[string]bool{}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		attr := func(name string) string {
+			for _, a := range token.Attr {
+				if a.Key == name {
+					return strings.TrimSpace(a.Val)
+				}
+			}
+			return ""
+		}
+		hasToken := func(value, want string) bool {
+			for _, field := range strings.Fields(strings.ToLower(value)) {
+				if strings.Trim(field, ",") == want {
+					return true
+				}
+			}
+			return false
+		}
+
+		switch token.DataAtom {
+		case atom.Base:
+			if href, err := base.Parse(attr("href")); err == nil && attr("href") != "" {
+				base = href
+			}
+		case atom.Link:
+			if hasToken(attr("rel"), "canonical") && attr("href") != "" {
+				if href, err := base.Parse(attr("href")); err == nil {
+					canonical = href.String()
+				}
+			}
+		case atom.Meta:
+			if respectRobots && strings.EqualFold(attr("name"), "robots") && hasToken(attr("content"), "nofollow") {
+				nofollow = true
+			}
+		case atom.A, atom.Area:
+			href := attr("href")
+			if href == "" || strings.HasPrefix(href, "#") || (respectRobots && hasToken(attr("rel"), "nofollow")) {
+				continue
+			}
+			u, err := base.Parse(href)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			u.Fragment = ""
+			if link := u.String(); !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+	return links, canonical, nofollow
+}
+
+// hostThrottle 同一主机的相邻请求至少间隔delay
+type hostThrottle struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostThrottle() *hostThrottle {
+	return &hostThrottle{next: map[string]time.Time{}}
+}
+
+func (t *hostThrottle) wait(ctx context.Context, host string, delay time.Duration) error {
+	host = strings.ToLower(host)
+	t.mu.Lock()
+	now := time.Now()
+	at := t.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	t.next[host] = at.Add(delay)
+	t.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// robotsCache 按 scheme://host 缓存robots.txt，同一主机并发请求只下载一次
+type robotsCache struct {
+	client    *http.Client
+	userAgent string
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	ready   chan struct{}
+	data    *robotstxt.RobotsData
+	expires time.Time
+}
+
+func newRobotsCache(client *http.Client, userAgent string, ttl time.Duration) *robotsCache {
+	return &robotsCache{
+		client:    client,
+		userAgent: userAgent,
+		ttl:       ttl,
+		entries:   map[string]*robotsEntry{},
+	}
+}
+
+// get 获取主机的robots.txt，ctx取消时返回nil
+func (c *robotsCache) get(ctx context.Context, u *url.URL) *robotstxt.RobotsData {
+	key := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	c.mu.Lock()
+	entry := c.entries[key]
+	if entry != nil && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		c.mu.Unlock()
+		select {
+		case <-entry.ready:
+			return entry.data
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if len(c.entries) >= robotsCachePruneSize {
+		now := time.Now()
+		for k, e := range c.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	entry = &robotsEntry{ready: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	data, ttl := c.fetch(ctx, key)
+	c.mu.Lock()
+	entry.data = data
+	entry.expires = time.Now().Add(ttl)
+	c.mu.Unlock()
+	close(entry.ready)
+	return data
+}
+
+// fetch 下载并解析robots.txt：4xx视为全部允许，5xx视为全部禁止，解析失败或网络错误按允许处理
+func (c *robotsCache) fetch(ctx context.Context, origin string) (*robotstxt.RobotsData, time.Duration) {
+	allowAll, _ := robotstxt.FromString("")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return allowAll, c.ttl
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Printf("获取 %s/robots.txt 失败: %v", origin, err)
+		return allowAll, robotsErrorTTL
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return allowAll, robotsErrorTTL
+	}
+	data, err := robotstxt.FromStatusAndBytes(resp.StatusCode, body)
+	if err != nil {
+		log.Printf("解析 %s/robots.txt 失败: %v", origin, err)
+		return allowAll, c.ttl
+	}
+	return data, c.ttl
+}
+
+// crawlerTaskConfig CrawlerTask.Config 中的爬取参数
+type crawlerTaskConfig struct {
+	Scope           string   `json:"scope"`
+	MaxDepth        int      `json:"max_depth"`
+	Concurrency     int      `json:"concurrency"`
+	IncludePatterns []string `json:"include_patterns"`
+	ExcludePatterns []string `json:"exclude_patterns"`
+
+	ExtractionRules []ExtractionRule    `json:"extraction_rules"`
+	Watch           *crawlerWatchConfig `json:"watch"`
+}
+
+// decodeCrawlerTaskConfig 解析CrawlerTask.Config
+func decodeCrawlerTaskConfig(task *models.CrawlerTask) (crawlerTaskConfig, error) {
+	var cfg crawlerTaskConfig
+	if len(task.Config) == 0 {
+		return cfg, nil
+	}
+	data, err := json.Marshal(task.Config)
+	if err != nil {
+		return cfg, fmt.Errorf("%w: %v", ErrInvalidCrawlerTask, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%w: %v", ErrInvalidCrawlerTask, err)
+	}
+	return cfg, nil
+}
+
+// compilePatterns 编译包含、排除规则
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 链接规则 %q 无效: %v", ErrInvalidCrawlerTask, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// parseCrawlOptions 从爬虫任务读取爬取参数并校验
+func parseCrawlOptions(task *models.CrawlerTask) (CrawlOptions, error) {
+	cfg, err := decodeCrawlerTaskConfig(task)
+	if err != nil {
+		return CrawlOptions{}, err
+	}
+
+	if _, err := parseCrawlURL(task.URL); err != nil {
+		return CrawlOptions{}, err
+	}
+	switch cfg.Scope {
+	case "":
+		cfg.Scope = CrawlScopeHost
+	case CrawlScopeHost, CrawlScopeDomain:
+	default:
+		return CrawlOptions{}, fmt.Errorf("%w: scope只能为host或domain", ErrInvalidCrawlerTask)
+	}
+	if task.DelayMs < 0 || cfg.MaxDepth < 0 || cfg.Concurrency < 0 {
+		return CrawlOptions{}, fmt.Errorf("%w: delay_ms、max_depth和concurrency不能为负数", ErrInvalidCrawlerTask)
+	}
+
+	include, err := compilePatterns(cfg.IncludePatterns)
+	if err != nil {
+		return CrawlOptions{}, err
+	}
+	exclude, err := compilePatterns(cfg.ExcludePatterns)
+	if err != nil {
+		return CrawlOptions{}, err
+	}
+
+	return CrawlOptions{
+		StartURL:      task.URL,
+		MaxPages:      task.MaxPages,
+		MaxDepth:      cfg.MaxDepth,
+		Delay:         time.Duration(task.DelayMs) * time.Millisecond,
+		FollowLinks:   task.FollowLinks,
+		RespectRobots: task.RespectRobots,
+		Scope:         cfg.Scope,
+		Workers:       cfg.Concurrency,
+		Include:       include,
+		Exclude:       exclude,
+	}, nil
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"qa-toolbox-backend/internal/models"
+)
+
+// 爬虫结果的导出格式
+const (
+	CrawlerExportCSV   = "csv"
+	CrawlerExportJSONL = "jsonl"
+	CrawlerExportXLSX  = "xlsx"
+)
+
+// Excel单元格最多保存的字符数
+const xlsxMaxCellLength = 32767
+
+var (
+	ErrCrawlerTaskNotFound     = errors.New("爬虫任务不存在")
+	ErrUnsupportedExportFormat = errors.New("不支持的导出格式")
+)
+
+// crawlerExportColumns 每行固定的列，Data展开后的列排在后面
+var crawlerExportColumns = []string{"url", "status_code", "response_time", "crawled_at"}
+
+var crawlerExportContentTypes = map[string]string{
+	CrawlerExportCSV:   "text/csv; charset=utf-8",
+	CrawlerExportJSONL: "application/x-ndjson; charset=utf-8",
+	CrawlerExportXLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// CrawlerExport 爬虫结果导出，WriteTo按行读取结果写出，不会一次性加载所有结果
+type CrawlerExport struct {
+	Filename    string
+	ContentType string
+
+	s      *QAToolBoxService
+	taskID string
+	format string
+}
+
+// GetCrawlerResults 分页获取爬虫任务的结果
+func (s *QAToolBoxService) GetCrawlerResults(ctx context.Context, userID, taskID string, page, perPage int) ([]models.CrawlerResult, int, error) {
+	if _, err := s.getUserCrawlerTaskName(ctx, userID, taskID); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM crawler_results WHERE task_id = $1`, taskID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, task_id, url, data, status_code, response_time, headers, crawled_at
+		FROM crawler_results
+		WHERE task_id = $1
+		ORDER BY crawled_at, id
+		LIMIT $2 OFFSET $3
+	`, taskID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询爬虫结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.CrawlerResult{}
+	for rows.Next() {
+		var result models.CrawlerResult
+		var data, headers []byte
+		if err := rows.Scan(&result.ID, &result.TaskID, &result.URL, &data, &result.StatusCode,
+			&result.ResponseTime, &headers, &result.CrawledAt); err != nil {
+			return nil, 0, fmt.Errorf("扫描爬虫结果失败: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &result.Data); err != nil {
+				return nil, 0, fmt.Errorf("解析爬虫结果失败: %w", err)
+			}
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &result.Headers); err != nil {
+				return nil, 0, fmt.Errorf("解析响应头失败: %w", err)
+			}
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询爬虫结果失败: %w", err)
+	}
+
+	return results, total, nil
+}
+
+// ExportCrawlerResults 校验任务和导出格式，返回的导出对象在写出时才读取结果
+func (s *QAToolBoxService) ExportCrawlerResults(ctx context.Context, userID, taskID, format string) (*CrawlerExport, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	contentType, ok := crawlerExportContentTypes[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedExportFormat, format)
+	}
+	name, err := s.getUserCrawlerTaskName(ctx, userID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = taskID
+	}
+
+	return &CrawlerExport{
+		Filename:    name + "." + format,
+		ContentType: contentType,
+		s:           s,
+		taskID:      taskID,
+		format:      format,
+	}, nil
+}
+
+// getUserCrawlerTaskName 确认任务属于该用户并返回任务名称
+func (s *QAToolBoxService) getUserCrawlerTaskName(ctx context.Context, userID, taskID string) (string, error) {
+	if _, err := uuid.Parse(taskID); err != nil {
+		return "", ErrCrawlerTaskNotFound
+	}
+	var name string
+	err := s.db.QueryRowContext(ctx, `SELECT name FROM crawler_tasks WHERE id = $1 AND user_id = $2`, taskID, userID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", ErrCrawlerTaskNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("查询爬虫任务失败: %w", err)
+	}
+	return name, nil
+}
+
+// crawlerExportRow 导出的一行结果
+type crawlerExportRow struct {
+	URL          string                 `json:"url"`
+	StatusCode   int                    `json:"status_code"`
+	ResponseTime int                    `json:"response_time"`
+	CrawledAt    time.Time              `json:"crawled_at"`
+	Data         map[string]interface{} `json:"data"`
+}
+
+// WriteTo 写出导出文件
+//
+// CSV和XLSX需要先确定表头，在同一个只读快照中读取两遍：第一遍只收集展开后的列名，第二遍写出数据
+func (e *CrawlerExport) WriteTo(ctx context.Context, w io.Writer) error {
+	tx, err := e.s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("开始导出失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if e.format == CrawlerExportJSONL {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return e.eachRow(ctx, tx, func(row *crawlerExportRow) error {
+			return encoder.Encode(row)
+		})
+	}
+
+	columnSet := map[string]bool{}
+	if err := e.eachRow(ctx, tx, func(row *crawlerExportRow) error {
+		for key := range flattenCrawlerData(row.Data) {
+			columnSet[key] = true
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	dataColumns := make([]string, 0, len(columnSet))
+	for key := range columnSet {
+		dataColumns = append(dataColumns, key)
+	}
+	sort.Strings(dataColumns)
+
+	header := append([]string{}, crawlerExportColumns...)
+	for _, key := range dataColumns {
+		// 与固定列重名时加上data.前缀
+		for _, column := range crawlerExportColumns {
+			if key == column {
+				key = "data." + key
+				break
+			}
+		}
+		header = append(header, key)
+	}
+	values := func(row *crawlerExportRow) []interface{} {
+		flat := flattenCrawlerData(row.Data)
+		record := make([]interface{}, 0, len(header))
+		record = append(record, row.URL, row.StatusCode, row.ResponseTime, row.CrawledAt.Format(time.RFC3339))
+		for _, key := range dataColumns {
+			record = append(record, flat[key])
+		}
+		return record
+	}
+
+	if e.format == CrawlerExportCSV {
+		return e.writeCSV(ctx, tx, w, header, values)
+	}
+	return e.writeXLSX(ctx, tx, w, header, values)
+}
+
+func (e *CrawlerExport) writeCSV(ctx context.Context, tx *sql.Tx, w io.Writer, header []string, values func(*crawlerExportRow) []interface{}) error {
+	// 带BOM以便Excel按UTF-8打开
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(header))
+	err := e.eachRow(ctx, tx, func(row *crawlerExportRow) error {
+		for i, value := range values(row) {
+			record[i] = csvCell(value)
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (e *CrawlerExport) writeXLSX(ctx context.Context, tx *sql.Tx, w io.Writer, header []string, values func(*crawlerExportRow) []interface{}) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("创建Excel失败: %w", err)
+	}
+	headerRow := make([]interface{}, len(header))
+	for i, name := range header {
+		headerRow[i] = name
+	}
+	if err := stream.SetRow("A1", headerRow); err != nil {
+		return fmt.Errorf("写入Excel失败: %w", err)
+	}
+
+	line := 1
+	err = e.eachRow(ctx, tx, func(row *crawlerExportRow) error {
+		line++
+		record := values(row)
+		for i, value := range record {
+			if s, ok := value.(string); ok && len(s) > xlsxMaxCellLength {
+				record[i] = truncateUTF8(s, xlsxMaxCellLength)
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, line)
+		if err != nil {
+			return err
+		}
+		if err := stream.SetRow(cell, record); err != nil {
+			return fmt.Errorf("写入Excel失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := stream.Flush(); err != nil {
+		return fmt.Errorf("写入Excel失败: %w", err)
+	}
+	if _, err := file.WriteTo(w); err != nil {
+		return fmt.Errorf("写入Excel失败: %w", err)
+	}
+	return nil
+}
+
+// eachRow 按爬取顺序逐行读取任务的结果
+func (e *CrawlerExport) eachRow(ctx context.Context, tx *sql.Tx, fn func(*crawlerExportRow) error) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT url, data, status_code, response_time, crawled_at
+		FROM crawler_results
+		WHERE task_id = $1
+		ORDER BY crawled_at, id
+	`, e.taskID)
+	if err != nil {
+		return fmt.Errorf("查询爬虫结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row crawlerExportRow
+		var data []byte
+		if err := rows.Scan(&row.URL, &data, &row.StatusCode, &row.ResponseTime, &row.CrawledAt); err != nil {
+			return fmt.Errorf("扫描爬虫结果失败: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &row.Data); err != nil {
+				return fmt.Errorf("解析爬虫结果失败: %w", err)
+			}
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("查询爬虫结果失败: %w", err)
+	}
+	return nil
+}
+
+// flattenCrawlerData 把嵌套的map展开为以点号连接的列，数组序列化为JSON放在一列中
+func flattenCrawlerData(data map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				flat[prefix] = nil
+			}
+			for key, child := range v {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				walk(key, child)
+			}
+		case []interface{}:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				flat[prefix] = fmt.Sprint(v)
+				return
+			}
+			flat[prefix] = string(encoded)
+		default:
+			flat[prefix] = v
+		}
+	}
+	if len(data) > 0 {
+		walk("", data)
+	}
+	return flat
+}
+
+// csvCell 转换为CSV单元格，以公式字符开头的文本加单引号，避免在Excel中被当作公式执行
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
+
+// truncateUTF8 按字节截断字符串，不截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFlattenCrawlerData(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "empty",
+			data: nil,
+			want: map[string]interface{}{},
+		},
+		{
+			name: "scalars",
+			data: map[string]interface{}{"title": "首页", "price": 12.5, "ok": true, "missing": nil},
+			want: map[string]interface{}{"title": "首页", "price": 12.5, "ok": true, "missing": nil},
+		},
+		{
+			name: "nested objects use dotted keys",
+			data: map[string]interface{}{
+				"product": map[string]interface{}{
+					"name":  "手机",
+					"price": map[string]interface{}{"amount": 1299.0, "currency": "CNY"},
+				},
+			},
+			want: map[string]interface{}{"product.name": "手机", "product.price.amount": 1299.0, "product.price.currency": "CNY"},
+		},
+		{
+			name: "lists encoded as json",
+			data: map[string]interface{}{
+				"tags":  []interface{}{"a", "b"},
+				"specs": []interface{}{map[string]interface{}{"key": "颜色", "value": "黑"}},
+				"empty": []interface{}{},
+			},
+			want: map[string]interface{}{
+				"tags":  `["a","b"]`,
+				"specs": `[{"key":"颜色","value":"黑"}]`,
+				"empty": `[]`,
+			},
+		},
+		{
+			name: "empty nested object kept as a column",
+			data: map[string]interface{}{"meta": map[string]interface{}{}},
+			want: map[string]interface{}{"meta": nil},
+		},
+		{
+			name: "extraction errors flattened",
+			data: map[string]interface{}{ExtractionErrorsKey: map[string]interface{}{"price": "不是数字"}},
+			want: map[string]interface{}{ExtractionErrorsKey + ".price": "不是数字"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flattenCrawlerData(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flattenCrawlerData() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, ""},
+		{"plain text", "hello", "hello"},
+		{"empty string", "", ""},
+		{"formula", "=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"plus", "+1+1", "'+1+1"},
+		{"minus", "-2+3", "'-2+3"},
+		{"at", "@SUM(A1)", "'@SUM(A1)"},
+		{"tab", "\t=1", "'\t=1"},
+		{"carriage return", "\r=1", "'\r=1"},
+		{"formula char not first", "a=b", "a=b"},
+		{"negative number stays numeric", -1.5, "-1.5"},
+		{"float without exponent", 1e21, "1000000000000000000000"},
+		{"int", 42, "42"},
+		{"int64", int64(7), "7"},
+		{"bool", true, "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvCell(tt.value); got != tt.want {
+				t.Errorf("csvCell(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"shorter", "abc", 5, "abc"},
+		{"exact", "abc", 3, "abc"},
+		{"ascii", "abcdef", 4, "abcd"},
+		{"rune boundary", "中文字", 6, "中文"},
+		{"inside a rune", "中文字", 7, "中文"},
+		{"inside the first rune", "中文", 2, ""},
+		{"mixed", "a中b", 3, "a"},
+		{"four byte rune", "😀x", 3, ""},
+		{"zero", "abc", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateUTF8(tt.s, tt.n)
+			if got != tt.want {
+				t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+			if !utf8.ValidString(got) || len(got) > tt.n {
+				t.Errorf("truncateUTF8(%q, %d) = %q is not a valid prefix", tt.s, tt.n, got)
+			}
+		})
+	}
+
+	long := strings.Repeat("测", xlsxMaxCellLength)
+	if got := truncateUTF8(long, xlsxMaxCellLength); len(got) > xlsxMaxCellLength || !utf8.ValidString(got) {
+		t.Errorf("truncated to %d bytes, valid = %v", len(got), utf8.ValidString(got))
+	}
+}
@@ -0,0 +1,439 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"qa-toolbox-backend/internal/models"
+)
+
+// 提取规则的取值方式
+const (
+	ExtractText      = "text"       // 文本内容，连续空白合并为一个空格
+	ExtractHTML      = "html"       // 元素内部的HTML
+	ExtractOuterHTML = "outer_html" // 包含元素本身的HTML
+	ExtractAttr      = "attr"       // 属性值
+)
+
+// 提取结果的类型
+const (
+	FieldTypeString = "string"
+	FieldTypeInt    = "int"
+	FieldTypeFloat  = "float"
+	FieldTypeBool   = "bool"
+)
+
+// ExtractionErrorsKey 提取结果中记录字段错误的键，值为字段名到错误信息的映射
+const ExtractionErrorsKey = "_errors"
+
+// 数值字段从文本中取第一个数字，允许千分位逗号，如 "¥1,299.00" 取 1299
+var extractNumberPattern = regexp.MustCompile(`[-+]?\d[\d,]*(?:\.\d+)?|[-+]?\.\d+`)
+
+// ExtractionRule 字段提取规则，CSS和XPath二选一
+//
+// 嵌套规则中CSS和XPath都为空时取当前元素本身
+type ExtractionRule struct {
+	Name        string           `json:"name"`
+	CSS         string           `json:"css,omitempty"`
+	XPath       string           `json:"xpath,omitempty"`
+	Extract     string           `json:"extract,omitempty"` // 默认为text
+	Attr        string           `json:"attr,omitempty"`
+	Multiple    bool             `json:"multiple,omitempty"` // 为true时返回所有匹配的列表，否则只取第一个
+	Type        string           `json:"type,omitempty"`     // 默认为string
+	Pattern     string           `json:"pattern,omitempty"`  // 对取到的值再做正则匹配，有分组时取第一个分组
+	AbsoluteURL bool             `json:"absolute_url,omitempty"`
+	Default     interface{}      `json:"default,omitempty"`
+	Required    bool             `json:"required,omitempty"`
+	Fields      []ExtractionRule `json:"fields,omitempty"` // 不为空时每个匹配的元素按子规则提取为对象
+}
+
+// extractionField 编译后的提取规则
+type extractionField struct {
+	ExtractionRule
+	css     cascadia.Selector
+	xpath   *xpath.Expr
+	pattern *regexp.Regexp
+	fields  []*extractionField
+}
+
+// HTMLExtractor 按提取规则从HTML页面中提取结构化数据
+type HTMLExtractor struct {
+	fields []*extractionField
+}
+
+// legacySelectorRules CrawlerTask.Selectors 中预置的选择器
+var legacySelectorRules = map[string]ExtractionRule{
+	"title":            {CSS: "title"},
+	"meta_description": {CSS: `meta[name="description" i]`, Extract: ExtractAttr, Attr: "content"},
+	"links": {CSS: "a[href]", Multiple: true, Fields: []ExtractionRule{
+		{Name: "url", Extract: ExtractAttr, Attr: "href"},
+		{Name: "text"},
+	}},
+	"images": {CSS: "img[src]", Multiple: true, Fields: []ExtractionRule{
+		{Name: "src", Extract: ExtractAttr, Attr: "src"},
+		{Name: "alt", Extract: ExtractAttr, Attr: "alt"},
+	}},
+	"text_content": {CSS: "body"},
+}
+
+// NewHTMLExtractor 编译提取规则，规则无效时返回ErrInvalidCrawlerTask
+func NewHTMLExtractor(rules []ExtractionRule) (*HTMLExtractor, error) {
+	fields, err := compileExtractionRules(rules, "", false)
+	if err != nil {
+		return nil, err
+	}
+	return &HTMLExtractor{fields: fields}, nil
+}
+
+// parseCrawlerExtractor 合并任务的选择器和提取规则，同名时以提取规则为准
+//
+// 选择器可以是预置名称（title、meta_description、links、images、text_content），其余按CSS选择器取第一个匹配的文本
+func parseCrawlerExtractor(task *models.CrawlerTask) (*HTMLExtractor, error) {
+	cfg, err := decodeCrawlerTaskConfig(task)
+	if err != nil {
+		return nil, err
+	}
+
+	defined := make(map[string]bool, len(cfg.ExtractionRules))
+	for _, rule := range cfg.ExtractionRules {
+		defined[rule.Name] = true
+	}
+	var rules []ExtractionRule
+	for _, selector := range task.Selectors {
+		selector = strings.TrimSpace(selector)
+		if selector == "" || defined[selector] {
+			continue
+		}
+		defined[selector] = true
+		rule, ok := legacySelectorRules[selector]
+		if !ok {
+			rule = ExtractionRule{CSS: selector}
+		}
+		rule.Name = selector
+		rules = append(rules, rule)
+	}
+
+	return NewHTMLExtractor(append(rules, cfg.ExtractionRules...))
+}
+
+// compileExtractionRules 校验并编译规则，prefix为嵌套规则的上级字段名
+func compileExtractionRules(rules []ExtractionRule, prefix string, nested bool) ([]*extractionField, error) {
+	fields := make([]*extractionField, 0, len(rules))
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		name := prefix + rule.Name
+		invalid := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%w: 提取规则 %q %s", ErrInvalidCrawlerTask, name, fmt.Sprintf(format, args...))
+		}
+
+		if strings.TrimSpace(rule.Name) == "" {
+			return nil, fmt.Errorf("%w: 提取规则缺少name", ErrInvalidCrawlerTask)
+		}
+		if rule.Name == ExtractionErrorsKey {
+			return nil, invalid("为保留名称")
+		}
+		if names[rule.Name] {
+			return nil, invalid("重复")
+		}
+		names[rule.Name] = true
+
+		field := &extractionField{ExtractionRule: rule}
+		switch {
+		case rule.CSS != "" && rule.XPath != "":
+			return nil, invalid("不能同时指定css和xpath")
+		case rule.CSS != "":
+			sel, err := cascadia.Compile(rule.CSS)
+			if err != nil {
+				return nil, invalid("的CSS选择器无效: %v", err)
+			}
+			field.css = sel
+		case rule.XPath != "":
+			expr, err := xpath.Compile(rule.XPath)
+			if err != nil {
+				return nil, invalid("的XPath无效: %v", err)
+			}
+			field.xpath = expr
+		case !nested:
+			return nil, invalid("缺少css或xpath")
+		}
+
+		if field.Extract == "" {
+			field.Extract = ExtractText
+		}
+		switch field.Extract {
+		case ExtractText, ExtractHTML, ExtractOuterHTML:
+		case ExtractAttr:
+			if field.Attr == "" {
+				return nil, invalid("取属性时需要指定attr")
+			}
+		default:
+			return nil, invalid("的extract只能为text、html、outer_html或attr")
+		}
+
+		if field.Type == "" {
+			field.Type = FieldTypeString
+		}
+		switch field.Type {
+		case FieldTypeString, FieldTypeInt, FieldTypeFloat, FieldTypeBool:
+		default:
+			return nil, invalid("的type只能为string、int、float或bool")
+		}
+
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, invalid("的pattern无效: %v", err)
+			}
+			field.pattern = re
+		}
+
+		if len(rule.Fields) > 0 {
+			children, err := compileExtractionRules(rule.Fields, name+".", true)
+			if err != nil {
+				return nil, err
+			}
+			field.fields = children
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Extract 解析HTML并提取所有字段，pageURL用于把相对地址转换为绝对地址
+//
+// 未匹配的字段取默认值，必填字段缺失或类型转换失败时记录在ExtractionErrorsKey中
+func (e *HTMLExtractor) Extract(body []byte, pageURL *url.URL) (map[string]interface{}, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("解析HTML失败: %w", err)
+	}
+
+	errs := map[string]string{}
+	data := extractFields(e.fields, doc, pageURL, "", errs)
+	if len(errs) > 0 {
+		data[ExtractionErrorsKey] = errs
+	}
+	return data, nil
+}
+
+// extractFields 在root范围内提取一组字段
+func extractFields(fields []*extractionField, root *html.Node, pageURL *url.URL, prefix string, errs map[string]string) map[string]interface{} {
+	data := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		name := prefix + field.Name
+		matches := field.match(root)
+
+		var values []interface{}
+		for _, match := range matches {
+			var value interface{}
+			if field.fields != nil {
+				if match.node == nil {
+					continue
+				}
+				value = extractFields(field.fields, match.node, pageURL, name+".", errs)
+			} else {
+				raw, ok := field.value(match, pageURL)
+				if !ok {
+					continue
+				}
+				converted, err := coerceFieldValue(raw, field.Type)
+				if err != nil {
+					errs[name] = err.Error()
+					continue
+				}
+				value = converted
+			}
+			values = append(values, value)
+			if !field.Multiple {
+				break
+			}
+		}
+
+		switch {
+		case field.Multiple && values == nil:
+			if field.Required {
+				errs[name] = "未找到匹配的内容"
+			}
+			values = []interface{}{}
+			if list, ok := field.Default.([]interface{}); ok {
+				values = list
+			}
+			data[field.Name] = values
+		case field.Multiple:
+			data[field.Name] = values
+		case values == nil:
+			if field.Required {
+				if _, failed := errs[name]; !failed {
+					errs[name] = "未找到匹配的内容"
+				}
+			}
+			data[field.Name] = field.Default
+		default:
+			data[field.Name] = values[0]
+		}
+	}
+	return data
+}
+
+// extractionMatch 匹配结果，XPath返回数字、字符串或布尔值时node为空
+type extractionMatch struct {
+	node  *html.Node
+	value string
+}
+
+// match 按选择器查找匹配项，未指定选择器时返回root本身
+func (f *extractionField) match(root *html.Node) []extractionMatch {
+	var nodes []*html.Node
+	switch {
+	case f.css != nil:
+		// 只匹配root的后代，不包括root本身
+		for child := root.FirstChild; child != nil; child = child.NextSibling {
+			nodes = append(nodes, f.css.MatchAll(child)...)
+		}
+	case f.xpath != nil:
+		switch result := f.xpath.Evaluate(htmlquery.CreateXPathNavigator(root)).(type) {
+		case *xpath.NodeIterator:
+			for result.MoveNext() {
+				nav := result.Current().(*htmlquery.NodeNavigator)
+				if nav.NodeType() == xpath.AttributeNode {
+					// 属性节点直接取值，html.Node无法表示属性
+					nodes = append(nodes, &html.Node{Type: html.TextNode, Data: nav.Value()})
+					continue
+				}
+				nodes = append(nodes, nav.Current())
+			}
+		case float64:
+			return []extractionMatch{{value: strconv.FormatFloat(result, 'f', -1, 64)}}
+		case string:
+			return []extractionMatch{{value: result}}
+		case bool:
+			return []extractionMatch{{value: strconv.FormatBool(result)}}
+		}
+	default:
+		nodes = []*html.Node{root}
+	}
+
+	matches := make([]extractionMatch, len(nodes))
+	for i, node := range nodes {
+		matches[i] = extractionMatch{node: node}
+	}
+	return matches
+}
+
+// value 按取值方式读取匹配项的值，属性不存在或pattern不匹配时返回false
+func (f *extractionField) value(match extractionMatch, pageURL *url.URL) (string, bool) {
+	var value string
+	node := match.node
+	switch {
+	case node == nil:
+		value = match.value
+	case node.Type == html.TextNode:
+		value = collapseWhitespace(node.Data)
+	case f.Extract == ExtractText:
+		value = nodeText(node)
+	case f.Extract == ExtractHTML:
+		var buf bytes.Buffer
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			html.Render(&buf, child)
+		}
+		value = strings.TrimSpace(buf.String())
+	case f.Extract == ExtractOuterHTML:
+		var buf bytes.Buffer
+		html.Render(&buf, node)
+		value = buf.String()
+	case f.Extract == ExtractAttr:
+		found := false
+		for _, attr := range node.Attr {
+			if strings.EqualFold(attr.Key, f.Attr) {
+				value, found = strings.TrimSpace(attr.Val), true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+
+	if f.pattern != nil {
+		groups := f.pattern.FindStringSubmatch(value)
+		if groups == nil {
+			return "", false
+		}
+		value = groups[0]
+		if len(groups) > 1 {
+			value = groups[1]
+		}
+	}
+
+	if f.AbsoluteURL && pageURL != nil && value != "" {
+		if ref, err := url.Parse(value); err == nil {
+			value = pageURL.ResolveReference(ref).String()
+		}
+	}
+	return value, true
+}
+
+// nodeText 元素的文本内容，忽略script和style
+func nodeText(node *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style):
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return collapseWhitespace(b.String())
+}
+
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// coerceFieldValue 把提取到的文本转换为规则指定的类型
+func coerceFieldValue(raw, fieldType string) (interface{}, error) {
+	switch fieldType {
+	case FieldTypeInt, FieldTypeFloat:
+		number := strings.ReplaceAll(extractNumberPattern.FindString(raw), ",", "")
+		if number == "" {
+			return nil, fmt.Errorf("%q 不是数字", raw)
+		}
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q 不是数字", raw)
+		}
+		if fieldType == FieldTypeFloat {
+			return f, nil
+		}
+		if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+			return nil, fmt.Errorf("%q 不是整数", raw)
+		}
+		return int64(f), nil
+	case FieldTypeBool:
+		switch strings.ToLower(strings.TrimSpace(raw)) {
+		case "true", "1", "yes", "y", "on", "是":
+			return true, nil
+		case "false", "0", "no", "n", "off", "否", "":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q 不是布尔值", raw)
+	}
+	return raw, nil
+}
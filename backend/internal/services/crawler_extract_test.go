@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"qa-toolbox-backend/internal/models"
+)
+
+const testProductPage = `<html><head><title> 商品  详情 </title><meta name="Description" content="旗舰手机"></head>
+<body>
+<h1 class="name">  iPhone
+   15 </h1>
+<span class="price">¥1,299.00</span>
+<span class="stock">库存: 12 件</span>
+<span class="rating">4.5 分</span>
+<span class="available">是</span>
+<a class="more" href="/items/2?ref=a">下一个</a>
+<ul>
+  <li class="spec"><b>颜色</b><i>黑色</i></li>
+  <li class="spec"><b>容量</b><i>256GB</i></li>
+</ul>
+<div class="desc"><p>第一段</p><script>track()</script></div>
+<span class="sku">SKU-00123</span>
+</body></html>`
+
+func TestHTMLExtractorExtract(t *testing.T) {
+	pageURL, _ := url.Parse("https://shop.example.com/items/1")
+
+	tests := []struct {
+		name    string
+		rule    ExtractionRule
+		want    interface{}
+		wantErr string
+	}{
+		{name: "text", rule: ExtractionRule{CSS: "h1.name"}, want: "iPhone 15"},
+		{name: "text skips script", rule: ExtractionRule{CSS: ".desc"}, want: "第一段"},
+		{name: "inner html", rule: ExtractionRule{CSS: ".desc", Extract: ExtractHTML}, want: "<p>第一段</p><script>track()</script>"},
+		{name: "outer html", rule: ExtractionRule{CSS: ".sku", Extract: ExtractOuterHTML}, want: `<span class="sku">SKU-00123</span>`},
+		{name: "attr case insensitive selector", rule: ExtractionRule{CSS: `meta[name="description" i]`, Extract: ExtractAttr, Attr: "content"}, want: "旗舰手机"},
+		{name: "absolute url", rule: ExtractionRule{CSS: "a.more", Extract: ExtractAttr, Attr: "href", AbsoluteURL: true}, want: "https://shop.example.com/items/2?ref=a"},
+		{name: "relative url", rule: ExtractionRule{CSS: "a.more", Extract: ExtractAttr, Attr: "href"}, want: "/items/2?ref=a"},
+		{name: "float with currency and thousands separator", rule: ExtractionRule{CSS: ".price", Type: FieldTypeFloat}, want: 1299.0},
+		{name: "int from whole float", rule: ExtractionRule{CSS: ".price", Type: FieldTypeInt}, want: int64(1299)},
+		{name: "int in text", rule: ExtractionRule{CSS: ".stock", Type: FieldTypeInt}, want: int64(12)},
+		{name: "bool", rule: ExtractionRule{CSS: ".available", Type: FieldTypeBool}, want: true},
+		{name: "pattern group", rule: ExtractionRule{CSS: ".sku", Pattern: `SKU-(\d+)`, Type: FieldTypeInt}, want: int64(123)},
+		{name: "pattern without group", rule: ExtractionRule{CSS: ".sku", Pattern: `\d+`}, want: "00123"},
+		{name: "pattern mismatch uses default", rule: ExtractionRule{CSS: ".sku", Pattern: `EAN-\d+`, Default: "none"}, want: "none"},
+		{name: "xpath text node", rule: ExtractionRule{XPath: "//h1/text()"}, want: "iPhone 15"},
+		{name: "xpath attribute", rule: ExtractionRule{XPath: "//meta/@content"}, want: "旗舰手机"},
+		{name: "xpath number", rule: ExtractionRule{XPath: "count(//li)", Type: FieldTypeInt}, want: int64(2)},
+		{name: "xpath boolean", rule: ExtractionRule{XPath: "count(//li) > 1", Type: FieldTypeBool}, want: true},
+		{
+			name: "multiple",
+			rule: ExtractionRule{CSS: "li.spec i", Multiple: true},
+			want: []interface{}{"黑色", "256GB"},
+		},
+		{
+			name: "nested fields",
+			rule: ExtractionRule{CSS: "li.spec", Multiple: true, Fields: []ExtractionRule{
+				{Name: "key", CSS: "b"},
+				{Name: "value", XPath: "./i"},
+				{Name: "raw"},
+			}},
+			want: []interface{}{
+				map[string]interface{}{"key": "颜色", "value": "黑色", "raw": "颜色 黑色"},
+				map[string]interface{}{"key": "容量", "value": "256GB", "raw": "容量 256GB"},
+			},
+		},
+		{name: "missing uses default", rule: ExtractionRule{CSS: ".missing", Default: "n/a"}, want: "n/a"},
+		{name: "missing list is empty", rule: ExtractionRule{CSS: ".missing", Multiple: true}, want: []interface{}{}},
+		{name: "missing attr", rule: ExtractionRule{CSS: "h1", Extract: ExtractAttr, Attr: "data-id"}, want: nil},
+		{name: "required missing", rule: ExtractionRule{CSS: ".missing", Required: true}, want: nil, wantErr: "未找到匹配的内容"},
+		{name: "not a number", rule: ExtractionRule{CSS: "title", Type: FieldTypeInt}, want: nil, wantErr: `"商品 详情" 不是数字`},
+		{name: "not an integer", rule: ExtractionRule{CSS: ".rating", Type: FieldTypeInt}, want: nil, wantErr: `"4.5 分" 不是整数`},
+		{name: "not a bool", rule: ExtractionRule{CSS: "h1", Type: FieldTypeBool, Required: true}, want: nil, wantErr: `"iPhone 15" 不是布尔值`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.Name = "field"
+			extractor, err := NewHTMLExtractor([]ExtractionRule{rule})
+			if err != nil {
+				t.Fatalf("NewHTMLExtractor() error = %v", err)
+			}
+			data, err := extractor.Extract([]byte(testProductPage), pageURL)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+
+			if got := data["field"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("field = %#v, want %#v", got, tt.want)
+			}
+			errs, _ := data[ExtractionErrorsKey].(map[string]string)
+			if errs["field"] != tt.wantErr {
+				t.Errorf("errors = %v, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTMLExtractorNestedErrors(t *testing.T) {
+	extractor, err := NewHTMLExtractor([]ExtractionRule{{
+		Name: "specs", CSS: "li.spec", Multiple: true,
+		Fields: []ExtractionRule{{Name: "size", CSS: "i", Type: FieldTypeInt}},
+	}})
+	if err != nil {
+		t.Fatalf("NewHTMLExtractor() error = %v", err)
+	}
+	data, _ := extractor.Extract([]byte(testProductPage), nil)
+
+	// 嵌套字段的错误以 上级.字段 记录
+	errs, _ := data[ExtractionErrorsKey].(map[string]string)
+	if errs["specs.size"] != `"黑色" 不是数字` {
+		t.Errorf("errors = %v", errs)
+	}
+	want := []interface{}{map[string]interface{}{"size": nil}, map[string]interface{}{"size": int64(256)}}
+	if !reflect.DeepEqual(data["specs"], want) {
+		t.Errorf("specs = %#v, want %#v", data["specs"], want)
+	}
+}
+
+func TestNewHTMLExtractorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []ExtractionRule
+	}{
+		{"missing name", []ExtractionRule{{CSS: "h1"}}},
+		{"reserved name", []ExtractionRule{{Name: ExtractionErrorsKey, CSS: "h1"}}},
+		{"duplicate name", []ExtractionRule{{Name: "a", CSS: "h1"}, {Name: "a", CSS: "h2"}}},
+		{"css and xpath", []ExtractionRule{{Name: "a", CSS: "h1", XPath: "//h1"}}},
+		{"no selector", []ExtractionRule{{Name: "a"}}},
+		{"invalid css", []ExtractionRule{{Name: "a", CSS: "h1[["}}},
+		{"invalid xpath", []ExtractionRule{{Name: "a", XPath: "//h1["}}},
+		{"attr without name", []ExtractionRule{{Name: "a", CSS: "a", Extract: ExtractAttr}}},
+		{"unknown extract", []ExtractionRule{{Name: "a", CSS: "a", Extract: "json"}}},
+		{"unknown type", []ExtractionRule{{Name: "a", CSS: "a", Type: "date"}}},
+		{"invalid pattern", []ExtractionRule{{Name: "a", CSS: "a", Pattern: "("}}},
+		{"invalid nested rule", []ExtractionRule{{Name: "a", CSS: "li", Fields: []ExtractionRule{{Name: "b", Type: "date"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTMLExtractor(tt.rules); !errors.Is(err, ErrInvalidCrawlerTask) {
+				t.Errorf("NewHTMLExtractor() error = %v, want ErrInvalidCrawlerTask", err)
+			}
+		})
+	}
+}
+
+func TestParseCrawlerExtractor(t *testing.T) {
+	task := &models.CrawlerTask{
+		Selectors: []string{"title", "meta_description", ".price", "name", " "},
+		Config:    map[string]interface{}{"extraction_rules": []interface{}{map[string]interface{}{"name": "name", "css": ".sku"}}},
+	}
+	extractor, err := parseCrawlerExtractor(task)
+	if err != nil {
+		t.Fatalf("parseCrawlerExtractor() error = %v", err)
+	}
+	data, _ := extractor.Extract([]byte(testProductPage), nil)
+
+	want := map[string]interface{}{
+		"title":            "商品 详情",
+		"meta_description": "旗舰手机",
+		".price":           "¥1,299.00",
+		"name":             "SKU-00123", // 与选择器同名时以提取规则为准
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("data = %#v, want %#v", data, want)
+	}
+}
+
+func TestCoerceFieldValue(t *testing.T) {
+	tests := []struct {
+		raw       string
+		fieldType string
+		want      interface{}
+		wantErr   bool
+	}{
+		{"  文本 ", FieldTypeString, "  文本 ", false},
+		{"42", FieldTypeInt, int64(42), false},
+		{"-7 ℃", FieldTypeInt, int64(-7), false},
+		{"+3", FieldTypeInt, int64(3), false},
+		{"1,234,567", FieldTypeInt, int64(1234567), false},
+		{"12.0", FieldTypeInt, int64(12), false},
+		{"12.5", FieldTypeInt, nil, true},
+		{"90071992547409930", FieldTypeInt, nil, true},
+		{"无", FieldTypeInt, nil, true},
+		{"约 .5 公斤", FieldTypeFloat, 0.5, false},
+		{"$3.14", FieldTypeFloat, 3.14, false},
+		{"-0.25", FieldTypeFloat, -0.25, false},
+		{"", FieldTypeFloat, nil, true},
+		{"Yes", FieldTypeBool, true, false},
+		{"on", FieldTypeBool, true, false},
+		{"是", FieldTypeBool, true, false},
+		{" 0 ", FieldTypeBool, false, false},
+		{"否", FieldTypeBool, false, false},
+		{"", FieldTypeBool, false, false},
+		{"maybe", FieldTypeBool, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fieldType+"/"+tt.raw, func(t *testing.T) {
+			got, err := coerceFieldValue(tt.raw, tt.fieldType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("coerceFieldValue(%q, %s) error = %v, wantErr %v", tt.raw, tt.fieldType, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coerceFieldValue(%q, %s) = %#v, want %#v", tt.raw, tt.fieldType, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress 目标解析到本机、内网或链路本地地址，爬虫和Webhook不允许访问
+var ErrBlockedAddress = errors.New("禁止访问本机或内网地址")
+
+// addressGuard 在建立连接时检查解析后的IP，DNS重绑定或重定向到内网同样会被拦截
+//
+// allowed为允许访问的网段，内网部署时通过 CRAWLER_ALLOWED_NETWORKS 放行
+type addressGuard struct {
+	allowed []*net.IPNet
+}
+
+// newAddressGuard 解析允许访问的网段，无效的网段记录日志后忽略
+func newAddressGuard(networks []string) *addressGuard {
+	guard := &addressGuard{}
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			log.Printf("忽略无效的允许网段 %q: %v", network, err)
+			continue
+		}
+		guard.allowed = append(guard.allowed, ipNet)
+	}
+	return guard
+}
+
+// Allowed IP是否允许访问
+func (g *addressGuard) Allowed(ip net.IP) bool {
+	for _, ipNet := range g.allowed {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return !isInternalIP(ip)
+}
+
+// control 作为net.Dialer.Control，在连接前检查目标地址
+func (g *addressGuard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if !g.Allowed(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	return nil
+}
+
+// HTTPClient 只能访问允许地址的HTTP客户端
+//
+// 不使用环境变量中的代理，经过代理时只能检查代理本身的地址
+func (g *addressGuard) HTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.control,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// isInternalIP 本机、私有网段（含100.64.0.0/10）、链路本地（含169.254.169.254元数据地址）、组播和未指定地址
+func isInternalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	return sharedAddressSpace.Contains(ip)
+}
+
+// 运营商级NAT地址段，部分云平台用于内部服务
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAddressGuardAllowed(t *testing.T) {
+	tests := []struct {
+		ip      string
+		allowed []string
+		want    bool
+	}{
+		{"93.184.216.34", nil, true},
+		{"2606:2800:220:1:248:1893:25c8:1946", nil, true},
+		{"127.0.0.1", nil, false},
+		{"::1", nil, false},
+		{"10.1.2.3", nil, false},
+		{"172.16.0.1", nil, false},
+		{"192.168.1.1", nil, false},
+		{"169.254.169.254", nil, false},
+		{"100.100.100.200", nil, false},
+		{"fd00::1", nil, false},
+		{"fe80::1", nil, false},
+		{"0.0.0.0", nil, false},
+		{"::ffff:127.0.0.1", nil, false},
+		{"224.0.0.1", nil, false},
+		{"10.1.2.3", []string{"10.0.0.0/8"}, true},
+		{"192.168.1.1", []string{"10.0.0.0/8"}, false},
+		{"127.0.0.1", []string{"invalid", "127.0.0.0/8"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := newAddressGuard(tt.allowed).Allowed(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("Allowed(%s) with %v = %v, want %v", tt.ip, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressGuardHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// 重定向到本机地址同样被拦截
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		allowed     []string
+		wantBlocked bool
+	}{
+		{"loopback blocked", server.URL, nil, true},
+		{"redirect blocked", redirect.URL, nil, true},
+		{"localhost name blocked", "http://localhost:" + serverPort(t, server), nil, true},
+		{"loopback allowed by config", server.URL, []string{"127.0.0.0/8", "::1/128"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newAddressGuard(tt.allowed).HTTPClient(5 * time.Second).Get(tt.url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if blocked := errors.Is(err, ErrBlockedAddress); blocked != tt.wantBlocked {
+				t.Errorf("Get(%s) error = %v, want blocked=%v", tt.url, err, tt.wantBlocked)
+			}
+			if !tt.wantBlocked && err != nil {
+				t.Errorf("Get(%s) error = %v", tt.url, err)
+			}
+		})
+	}
+}
+
+func serverPort(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
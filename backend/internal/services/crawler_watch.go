@@ -0,0 +1,818 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"qa-toolbox-backend/internal/models"
+)
+
+// 监控模式比较的内容
+const (
+	WatchModeData = "data" // 提取的数据，JSON响应为响应体
+	WatchModeText = "text" // 规范化后的页面文本
+	WatchModeBoth = "both"
+)
+
+// 页面变化的类型
+const (
+	CrawlerChangeAdded   = "added"   // 建立基线后新出现的页面
+	CrawlerChangeChanged = "changed" // 与上一个快照不同
+)
+
+const (
+	// 快照中保存的文本上限，超出部分不参与比较
+	crawlerWatchMaxTextBytes = 256 << 10
+	// 文本diff的上限
+	crawlerWatchMaxDiffBytes = 64 << 10
+	// 每个变化最多保存的字段变化数
+	crawlerWatchMaxFieldChanges = 100
+	// 通知中最多列出的页面数
+	crawlerWatchNotifyPages    = 5
+	crawlerWatchWebhookTimeout = 10 * time.Second
+)
+
+var (
+	ErrCrawlerChangeNotFound   = errors.New("页面变化记录不存在")
+	ErrCrawlerSnapshotNotFound = errors.New("页面快照不存在")
+)
+
+// 规范化文本时单独成行的元素
+var watchBlockElements = map[atom.Atom]bool{
+	atom.Title: true, atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true, atom.Nav: true,
+	atom.Main: true, atom.Aside: true, atom.Table: true, atom.Ul: true, atom.Ol: true, atom.Dl: true,
+	atom.Dt: true, atom.Dd: true, atom.Blockquote: true, atom.Pre: true, atom.Form: true, atom.Hr: true,
+	atom.Td: true, atom.Th: true, atom.Option: true, atom.Figcaption: true,
+}
+
+// crawlerWatchConfig CrawlerTask.Config 中的 watch，开启后每次执行都和上一次的快照比较
+type crawlerWatchConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Mode           string   `json:"mode"`            // 默认为data
+	Fields         []string `json:"fields"`          // 需要通知的字段，如 price、products.*.price，为空时任何变化都通知
+	IgnoreFields   []string `json:"ignore_fields"`   // 不参与比较的字段
+	IgnorePatterns []string `json:"ignore_patterns"` // 比较文本前删除匹配的内容，如时间戳
+	Notify         *bool    `json:"notify"`          // 站内通知，默认开启
+	WebhookURL     string   `json:"webhook_url"`
+}
+
+// crawlerWatcher 解析后的监控配置，记录一次执行中需要通知的变化
+type crawlerWatcher struct {
+	mode           string
+	fields         [][]string
+	ignoreFields   [][]string
+	ignorePatterns []*regexp.Regexp
+	notify         bool
+	webhookURL     string
+
+	// 任务已有快照时，新出现的页面记为added
+	baseline bool
+	alerts   []models.CrawlerChange
+}
+
+// crawlerWatchSnapshot 一个页面用于比较的内容
+type crawlerWatchSnapshot struct {
+	statusCode int
+	data       interface{}
+	text       string
+	hash       string
+}
+
+// parseCrawlerWatcher 解析任务的监控配置，未开启时返回nil
+func parseCrawlerWatcher(task *models.CrawlerTask) (*crawlerWatcher, error) {
+	cfg, err := decodeCrawlerTaskConfig(task)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Watch == nil || !cfg.Watch.Enabled {
+		return nil, nil
+	}
+	watch := cfg.Watch
+
+	w := &crawlerWatcher{
+		mode:       watch.Mode,
+		notify:     watch.Notify == nil || *watch.Notify,
+		webhookURL: strings.TrimSpace(watch.WebhookURL),
+	}
+	switch w.mode {
+	case "":
+		w.mode = WatchModeData
+	case WatchModeData, WatchModeText, WatchModeBoth:
+	default:
+		return nil, fmt.Errorf("%w: watch.mode只能为data、text或both", ErrInvalidCrawlerTask)
+	}
+
+	if len(watch.Fields) > 0 && w.mode == WatchModeText {
+		return nil, fmt.Errorf("%w: watch.fields只能用于data或both模式", ErrInvalidCrawlerTask)
+	}
+	for _, field := range watch.Fields {
+		path := splitWatchPath(field)
+		if len(path) == 0 {
+			return nil, fmt.Errorf("%w: watch.fields不能包含空字段", ErrInvalidCrawlerTask)
+		}
+		w.fields = append(w.fields, path)
+	}
+	for _, field := range watch.IgnoreFields {
+		path := splitWatchPath(field)
+		if len(path) == 0 {
+			return nil, fmt.Errorf("%w: watch.ignore_fields不能包含空字段", ErrInvalidCrawlerTask)
+		}
+		w.ignoreFields = append(w.ignoreFields, path)
+	}
+	for _, pattern := range watch.IgnorePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: watch.ignore_patterns %q 无效: %v", ErrInvalidCrawlerTask, pattern, err)
+		}
+		w.ignorePatterns = append(w.ignorePatterns, re)
+	}
+	if w.webhookURL != "" {
+		u, err := url.Parse(w.webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: watch.webhook_url只支持http(s)地址", ErrInvalidCrawlerTask)
+		}
+	}
+	return w, nil
+}
+
+// snapshot 生成页面的快照，JSON响应以响应体作为数据
+func (w *crawlerWatcher) snapshot(page *CrawledPage, extracted map[string]interface{}) (*crawlerWatchSnapshot, error) {
+	snap := &crawlerWatchSnapshot{statusCode: page.StatusCode}
+
+	if w.mode != WatchModeText {
+		var data interface{} = extracted
+		if isJSONContentType(page.ContentType) {
+			var body interface{}
+			if err := json.Unmarshal(page.Body, &body); err == nil {
+				data = body
+			}
+		}
+		snap.data = w.stripIgnored(data, nil)
+	}
+	if w.mode != WatchModeData {
+		text := normalizePageText(page)
+		if len(w.ignorePatterns) > 0 {
+			for _, re := range w.ignorePatterns {
+				text = re.ReplaceAllString(text, "")
+			}
+			lines := strings.Split(text, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimRight(line, " \t")
+			}
+			text = strings.Join(lines, "\n")
+		}
+		snap.text = truncateUTF8(text, crawlerWatchMaxTextBytes)
+	}
+
+	data, err := json.Marshal(snap.data)
+	if err != nil {
+		return nil, fmt.Errorf("序列化快照失败: %w", err)
+	}
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%d\n", snap.statusCode)
+	sum.Write(data)
+	sum.Write([]byte{'\n'})
+	sum.Write([]byte(snap.text))
+	snap.hash = hex.EncodeToString(sum.Sum(nil))
+	return snap, nil
+}
+
+// stripIgnored 删除ignore_fields指定的字段
+func (w *crawlerWatcher) stripIgnored(value interface{}, path []string) interface{} {
+	if len(w.ignoreFields) == 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			child := append(path[:len(path):len(path)], key)
+			if !w.ignored(child) {
+				out[key] = w.stripIgnored(item, child)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			child := append(path[:len(path):len(path)], strconv.Itoa(i))
+			if !w.ignored(child) {
+				out = append(out, w.stripIgnored(item, child))
+			}
+		}
+		return out
+	}
+	return value
+}
+
+func (w *crawlerWatcher) ignored(path []string) bool {
+	for _, pattern := range w.ignoreFields {
+		if len(pattern) == len(path) && watchPathOverlaps(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// alerting 变化是否需要通知：未指定fields时任何变化都通知，否则状态码变化或涉及指定字段时通知
+func (w *crawlerWatcher) alerting(change *models.CrawlerChange, fields []models.CrawlerFieldChange) bool {
+	if len(w.fields) == 0 {
+		return true
+	}
+	if change.ChangeType == CrawlerChangeChanged && change.StatusFrom != change.StatusTo {
+		return true
+	}
+	for _, field := range fields {
+		path := splitWatchPath(field.Path)
+		for _, pattern := range w.fields {
+			if watchPathOverlaps(pattern, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitWatchPath 把 products[0].price 拆分为 products、0、price
+func splitWatchPath(path string) []string {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(strings.TrimSpace(path))
+	var segments []string
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// watchPathOverlaps 两个路径在共同长度内逐段相同（*匹配任意一段），即一个包含另一个
+func watchPathOverlaps(pattern, path []string) bool {
+	n := len(pattern)
+	if len(path) < n {
+		n = len(path)
+	}
+	for i := 0; i < n; i++ {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isJSONContentType(contentType string) bool {
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+// normalizePageText 规范化页面文本用于比较：HTML取可见文本并按块级元素分行，JSON按键排序缩进
+func normalizePageText(page *CrawledPage) string {
+	switch {
+	case page.IsHTML():
+		doc, err := html.Parse(bytes.NewReader(page.Body))
+		if err != nil {
+			return ""
+		}
+		var b strings.Builder
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			switch {
+			case n.Type == html.TextNode:
+				b.WriteString(n.Data)
+				b.WriteByte(' ')
+			case n.Type == html.ElementNode:
+				switch n.DataAtom {
+				case atom.Script, atom.Style, atom.Noscript, atom.Template:
+					return
+				}
+			}
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+			if n.Type == html.ElementNode && watchBlockElements[n.DataAtom] {
+				b.WriteByte('\n')
+			}
+		}
+		walk(doc)
+		return normalizeTextLines(b.String())
+	case isJSONContentType(page.ContentType):
+		var body interface{}
+		if err := json.Unmarshal(page.Body, &body); err == nil {
+			if indented, err := json.MarshalIndent(body, "", "  "); err == nil {
+				return string(indented)
+			}
+		}
+		return normalizeTextLines(string(page.Body))
+	case strings.HasPrefix(page.ContentType, "text/"), page.ContentType == "application/xml":
+		return normalizeTextLines(string(page.Body))
+	}
+	return ""
+}
+
+// normalizeTextLines 合并每行内的连续空白并去掉空行
+func normalizeTextLines(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = collapseWhitespace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// diffWatchData 比较两次的数据，按字段路径排序返回所有变化
+func diffWatchData(before, after interface{}) []models.CrawlerFieldChange {
+	changes := []models.CrawlerFieldChange{}
+	add := func(change models.CrawlerFieldChange) {
+		changes = append(changes, change)
+	}
+
+	var walk func(path string, before, after interface{})
+	walk = func(path string, before, after interface{}) {
+		switch b := before.(type) {
+		case map[string]interface{}:
+			if a, ok := after.(map[string]interface{}); ok {
+				keys := make([]string, 0, len(b)+len(a))
+				for key := range b {
+					keys = append(keys, key)
+				}
+				for key := range a {
+					if _, ok := b[key]; !ok {
+						keys = append(keys, key)
+					}
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					child := key
+					if path != "" {
+						child = path + "." + key
+					}
+					beforeValue, inBefore := b[key]
+					afterValue, inAfter := a[key]
+					switch {
+					case !inBefore:
+						add(models.CrawlerFieldChange{Path: child, Type: "added", To: afterValue})
+					case !inAfter:
+						add(models.CrawlerFieldChange{Path: child, Type: "removed", From: beforeValue})
+					default:
+						walk(child, beforeValue, afterValue)
+					}
+				}
+				return
+			}
+		case []interface{}:
+			if a, ok := after.([]interface{}); ok {
+				for i := 0; i < len(b) || i < len(a); i++ {
+					child := fmt.Sprintf("%s[%d]", path, i)
+					switch {
+					case i >= len(b):
+						add(models.CrawlerFieldChange{Path: child, Type: "added", To: a[i]})
+					case i >= len(a):
+						add(models.CrawlerFieldChange{Path: child, Type: "removed", From: b[i]})
+					default:
+						walk(child, b[i], a[i])
+					}
+				}
+				return
+			}
+		}
+		if !reflect.DeepEqual(before, after) {
+			add(models.CrawlerFieldChange{Path: path, Type: "changed", From: before, To: after})
+		}
+	}
+	walk("", before, after)
+	return changes
+}
+
+// diffWatchText 两次文本的unified diff，超过crawlerWatchMaxDiffBytes时截断
+func diffWatchText(before, after string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: "previous",
+		ToFile:   "current",
+		Context:  2,
+	})
+	if err != nil {
+		return ""
+	}
+	if len(diff) > crawlerWatchMaxDiffBytes {
+		diff = truncateUTF8(diff, crawlerWatchMaxDiffBytes) + "\n... (diff已截断)\n"
+	}
+	return diff
+}
+
+// hasCrawlerSnapshots 任务是否已有快照，用于判断新页面是否算作变化
+func (s *QAToolBoxService) hasCrawlerSnapshots(ctx context.Context, taskID string) (bool, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM crawler_snapshots WHERE task_id = $1)`, taskID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("查询页面快照失败: %w", err)
+	}
+	return exists, nil
+}
+
+// recordCrawlerSnapshot 保存页面快照并与上一个快照比较，内容不变时只更新checked_at
+//
+// 请求失败（没有响应）的页面不记录，避免网络抖动被当作变化
+func (s *QAToolBoxService) recordCrawlerSnapshot(ctx context.Context, taskID string, w *crawlerWatcher, page *CrawledPage, extracted map[string]interface{}) error {
+	if page.Err != nil {
+		return nil
+	}
+	snap, err := w.snapshot(page, extracted)
+	if err != nil {
+		return err
+	}
+
+	var previous models.CrawlerSnapshot
+	var previousData []byte
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id, status_code, data, COALESCE(text, ''), content_hash
+		FROM crawler_snapshots
+		WHERE task_id = $1 AND url = $2
+		ORDER BY captured_at DESC
+		LIMIT 1
+	`, taskID, page.URL).Scan(&previous.ID, &previous.StatusCode, &previousData, &previous.Text, &previous.ContentHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("查询页面快照失败: %w", err)
+	}
+	hasPrevious := err == nil
+
+	now := time.Now()
+	if hasPrevious && previous.ContentHash == snap.hash {
+		if _, err := s.db.ExecContext(ctx, `UPDATE crawler_snapshots SET checked_at = $1 WHERE id = $2`, now, previous.ID); err != nil {
+			return fmt.Errorf("更新页面快照失败: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(snap.data)
+	if err != nil {
+		return fmt.Errorf("序列化快照失败: %w", err)
+	}
+	snapshotID := uuid.New().String()
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO crawler_snapshots (id, task_id, url, status_code, data, text, content_hash, captured_at, checked_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $8)
+	`, snapshotID, taskID, page.URL, snap.statusCode, data, snap.text, snap.hash, now); err != nil {
+		return fmt.Errorf("保存页面快照失败: %w", err)
+	}
+	if !hasPrevious && !w.baseline {
+		return nil
+	}
+
+	change := models.CrawlerChange{
+		ID:         uuid.New().String(),
+		TaskID:     taskID,
+		URL:        page.URL,
+		SnapshotID: snapshotID,
+		ChangeType: CrawlerChangeAdded,
+		StatusTo:   snap.statusCode,
+		DetectedAt: now,
+	}
+	var fields []models.CrawlerFieldChange
+	if hasPrevious {
+		change.ChangeType = CrawlerChangeChanged
+		change.PreviousSnapshotID = previous.ID
+		change.StatusFrom = previous.StatusCode
+
+		var before interface{}
+		if len(previousData) > 0 {
+			if err := json.Unmarshal(previousData, &before); err != nil {
+				return fmt.Errorf("解析页面快照失败: %w", err)
+			}
+		}
+		// 快照存入数据库后数字都解析为float64，比较前统一格式
+		var after interface{}
+		if err := json.Unmarshal(data, &after); err != nil {
+			return fmt.Errorf("解析页面快照失败: %w", err)
+		}
+		fields = diffWatchData(before, after)
+		if previous.Text != snap.text {
+			change.TextChanged = true
+			change.TextDiff = diffWatchText(previous.Text, snap.text)
+		}
+	}
+	change.Alert = w.alerting(&change, fields)
+	change.FieldCount = len(fields)
+	if len(fields) > crawlerWatchMaxFieldChanges {
+		fields = fields[:crawlerWatchMaxFieldChanges]
+	}
+	change.Fields = fields
+	if change.Fields == nil {
+		change.Fields = []models.CrawlerFieldChange{}
+	}
+
+	fieldsJSON, err := json.Marshal(change.Fields)
+	if err != nil {
+		return fmt.Errorf("序列化页面变化失败: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO crawler_changes (id, task_id, url, snapshot_id, previous_snapshot_id, change_type,
+			status_from, status_to, fields, field_count, text_changed, text_diff, alert, detected_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13, $14)
+	`, change.ID, change.TaskID, change.URL, change.SnapshotID, change.PreviousSnapshotID, change.ChangeType,
+		change.StatusFrom, change.StatusTo, fieldsJSON, change.FieldCount, change.TextChanged, change.TextDiff,
+		change.Alert, change.DetectedAt); err != nil {
+		return fmt.Errorf("保存页面变化失败: %w", err)
+	}
+	if change.Alert {
+		w.alerts = append(w.alerts, change)
+	}
+	return nil
+}
+
+// crawlerWatchWebhookPayload 发送到webhook_url的内容
+type crawlerWatchWebhookPayload struct {
+	Event      string                 `json:"event"`
+	TaskID     string                 `json:"task_id"`
+	TaskName   string                 `json:"task_name"`
+	DetectedAt time.Time              `json:"detected_at"`
+	Changes    []models.CrawlerChange `json:"changes"`
+}
+
+// notifyCrawlerChanges 一次执行结束后汇总需要通知的变化，发送站内通知和webhook，失败只记录日志
+func (s *QAToolBoxService) notifyCrawlerChanges(ctx context.Context, task *models.CrawlerTask, w *crawlerWatcher) {
+	if len(w.alerts) == 0 || (!w.notify && w.webhookURL == "") {
+		return
+	}
+
+	delivered := false
+	if w.notify {
+		title := truncateUTF8(fmt.Sprintf("网页监控：%s 有%d个页面发生变化", task.Name, len(w.alerts)), 200)
+		if _, err := s.db.ExecContext(ctx, `
+			INSERT INTO notifications (id, user_id, title, content, type, created_at)
+			VALUES ($1, $2, $3, $4, 'update', NOW())
+		`, uuid.New().String(), task.UserID, title, crawlerChangeSummary(w.alerts)); err != nil {
+			log.Printf("发送网页监控通知失败 (task=%s): %v", task.ID, err)
+		} else {
+			delivered = true
+		}
+	}
+	if w.webhookURL != "" {
+		if err := sendCrawlerWatchWebhook(ctx, s.crawler.HTTPClient(), w.webhookURL, task, w.alerts); err != nil {
+			log.Printf("发送网页监控webhook失败 (task=%s): %v", task.ID, err)
+		} else {
+			delivered = true
+		}
+	}
+
+	if delivered {
+		ids := make([]string, len(w.alerts))
+		for i, change := range w.alerts {
+			ids[i] = change.ID
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE crawler_changes SET notified = TRUE WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+			log.Printf("更新页面变化失败 (task=%s): %v", task.ID, err)
+		}
+	}
+}
+
+// crawlerChangeSummary 通知内容，列出前几个页面及变化的字段
+func crawlerChangeSummary(changes []models.CrawlerChange) string {
+	var b strings.Builder
+	for i, change := range changes {
+		if i == crawlerWatchNotifyPages {
+			fmt.Fprintf(&b, "……另有%d个页面\n", len(changes)-i)
+			break
+		}
+		b.WriteString(change.URL)
+		switch {
+		case change.ChangeType == CrawlerChangeAdded:
+			b.WriteString("：新页面")
+		case change.StatusFrom != change.StatusTo:
+			fmt.Fprintf(&b, "：状态码 %d → %d", change.StatusFrom, change.StatusTo)
+		case change.FieldCount > 0:
+			paths := make([]string, 0, 3)
+			for _, field := range change.Fields {
+				if len(paths) == 3 {
+					break
+				}
+				paths = append(paths, field.Path)
+			}
+			fmt.Fprintf(&b, "：%d个字段变化（%s）", change.FieldCount, strings.Join(paths, "、"))
+		case change.TextChanged:
+			b.WriteString("：页面文本变化")
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// sendCrawlerWatchWebhook 推送页面变化，client禁止访问内网地址，避免用户配置的地址访问内部服务
+func sendCrawlerWatchWebhook(ctx context.Context, client *http.Client, webhookURL string, task *models.CrawlerTask, changes []models.CrawlerChange) error {
+	body, err := json.Marshal(crawlerWatchWebhookPayload{
+		Event:      "crawler.changed",
+		TaskID:     task.ID,
+		TaskName:   task.Name,
+		DetectedAt: time.Now(),
+		Changes:    changes,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化webhook内容失败: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, crawlerWatchWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回状态码%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// GetCrawlerChanges 分页获取任务的页面变化，不包含文本diff
+func (s *QAToolBoxService) GetCrawlerChanges(ctx context.Context, userID, taskID, pageURL string, alertOnly bool, page, perPage int) ([]models.CrawlerChange, int, error) {
+	if _, err := s.getUserCrawlerTaskName(ctx, userID, taskID); err != nil {
+		return nil, 0, err
+	}
+
+	where := `task_id = $1`
+	args := []interface{}{taskID}
+	if pageURL != "" {
+		args = append(args, pageURL)
+		where += fmt.Sprintf(` AND url = $%d`, len(args))
+	}
+	if alertOnly {
+		where += ` AND alert = TRUE`
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM crawler_changes WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	}
+
+	args = append(args, perPage, (page-1)*perPage)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s, '' FROM crawler_changes WHERE %s
+		ORDER BY detected_at DESC, id
+		LIMIT $%d OFFSET $%d
+	`, crawlerChangeColumns, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询页面变化失败: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []models.CrawlerChange{}
+	for rows.Next() {
+		change, err := scanCrawlerChange(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, *change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询页面变化失败: %w", err)
+	}
+	return changes, total, nil
+}
+
+// GetCrawlerChange 获取单个页面变化，包含文本diff
+func (s *QAToolBoxService) GetCrawlerChange(ctx context.Context, userID, taskID, changeID string) (*models.CrawlerChange, error) {
+	if _, err := s.getUserCrawlerTaskName(ctx, userID, taskID); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(changeID); err != nil {
+		return nil, ErrCrawlerChangeNotFound
+	}
+
+	change, err := scanCrawlerChange(s.db.QueryRowContext(ctx, `
+		SELECT `+crawlerChangeColumns+`, COALESCE(text_diff, '') FROM crawler_changes WHERE id = $1 AND task_id = $2
+	`, changeID, taskID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCrawlerChangeNotFound
+	}
+	return change, err
+}
+
+const crawlerChangeColumns = `id, task_id, url, snapshot_id, COALESCE(previous_snapshot_id::text, ''), change_type,
+	status_from, status_to, fields, field_count, text_changed, alert, notified, detected_at`
+
+func scanCrawlerChange(row interface{ Scan(...interface{}) error }) (*models.CrawlerChange, error) {
+	var change models.CrawlerChange
+	var fields []byte
+	if err := row.Scan(&change.ID, &change.TaskID, &change.URL, &change.SnapshotID, &change.PreviousSnapshotID,
+		&change.ChangeType, &change.StatusFrom, &change.StatusTo, &fields, &change.FieldCount, &change.TextChanged,
+		&change.Alert, &change.Notified, &change.DetectedAt, &change.TextDiff); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("查询页面变化失败: %w", err)
+		}
+		return nil, fmt.Errorf("扫描页面变化失败: %w", err)
+	}
+	change.Fields = []models.CrawlerFieldChange{}
+	if len(fields) > 0 {
+		if err := json.Unmarshal(fields, &change.Fields); err != nil {
+			return nil, fmt.Errorf("解析页面变化失败: %w", err)
+		}
+	}
+	return &change, nil
+}
+
+// GetCrawlerSnapshots 分页获取任务的页面快照，不包含页面文本
+func (s *QAToolBoxService) GetCrawlerSnapshots(ctx context.Context, userID, taskID, pageURL string, page, perPage int) ([]models.CrawlerSnapshot, int, error) {
+	if _, err := s.getUserCrawlerTaskName(ctx, userID, taskID); err != nil {
+		return nil, 0, err
+	}
+
+	where := `task_id = $1`
+	args := []interface{}{taskID}
+	if pageURL != "" {
+		args = append(args, pageURL)
+		where += ` AND url = $2`
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM crawler_snapshots WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	}
+
+	args = append(args, perPage, (page-1)*perPage)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, task_id, url, status_code, data, '', content_hash, captured_at, checked_at
+		FROM crawler_snapshots WHERE %s
+		ORDER BY captured_at DESC, id
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询页面快照失败: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []models.CrawlerSnapshot{}
+	for rows.Next() {
+		snapshot, err := scanCrawlerSnapshot(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询页面快照失败: %w", err)
+	}
+	return snapshots, total, nil
+}
+
+// GetCrawlerSnapshot 获取单个页面快照，包含规范化后的页面文本
+func (s *QAToolBoxService) GetCrawlerSnapshot(ctx context.Context, userID, taskID, snapshotID string) (*models.CrawlerSnapshot, error) {
+	if _, err := s.getUserCrawlerTaskName(ctx, userID, taskID); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(snapshotID); err != nil {
+		return nil, ErrCrawlerSnapshotNotFound
+	}
+
+	snapshot, err := scanCrawlerSnapshot(s.db.QueryRowContext(ctx, `
+		SELECT id, task_id, url, status_code, data, COALESCE(text, ''), content_hash, captured_at, checked_at
+		FROM crawler_snapshots WHERE id = $1 AND task_id = $2
+	`, snapshotID, taskID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCrawlerSnapshotNotFound
+	}
+	return snapshot, err
+}
+
+func scanCrawlerSnapshot(row interface{ Scan(...interface{}) error }) (*models.CrawlerSnapshot, error) {
+	var snapshot models.CrawlerSnapshot
+	var data []byte
+	if err := row.Scan(&snapshot.ID, &snapshot.TaskID, &snapshot.URL, &snapshot.StatusCode, &data,
+		&snapshot.Text, &snapshot.ContentHash, &snapshot.CapturedAt, &snapshot.CheckedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("查询页面快照失败: %w", err)
+		}
+		return nil, fmt.Errorf("扫描页面快照失败: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &snapshot.Data); err != nil {
+			return nil, fmt.Errorf("解析页面快照失败: %w", err)
+		}
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"qa-toolbox-backend/internal/models"
+)
+
+func TestSendCrawlerWatchWebhook(t *testing.T) {
+	var received crawlerWatchWebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	task := &models.CrawlerTask{ID: "task-1", Name: "价格监控"}
+	changes := []models.CrawlerChange{{ID: "c1", URL: "https://shop.example.com/", ChangeType: CrawlerChangeAdded}}
+
+	tests := []struct {
+		name        string
+		allowed     []string
+		path        string
+		wantErr     bool
+		wantBlocked bool
+	}{
+		{name: "internal address blocked", path: "/", wantErr: true, wantBlocked: true},
+		{name: "delivered", allowed: []string{"127.0.0.0/8"}, path: "/"},
+		{name: "error status", allowed: []string{"127.0.0.0/8"}, path: "/fail", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = crawlerWatchWebhookPayload{}
+			client := newTestCrawler(tt.allowed...).HTTPClient()
+			err := sendCrawlerWatchWebhook(context.Background(), client, server.URL+tt.path, task, changes)
+			if (err != nil) != tt.wantErr || errors.Is(err, ErrBlockedAddress) != tt.wantBlocked {
+				t.Fatalf("sendCrawlerWatchWebhook() error = %v, wantErr %v, wantBlocked %v", err, tt.wantErr, tt.wantBlocked)
+			}
+			if tt.wantBlocked {
+				if received.TaskID != "" {
+					t.Error("blocked webhook reached the server")
+				}
+				return
+			}
+			if received.Event != "crawler.changed" || received.TaskID != "task-1" || len(received.Changes) != 1 {
+				t.Errorf("payload = %+v", received)
+			}
+		})
+	}
+}
+
+func TestDiffWatchData(t *testing.T) {
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   []models.CrawlerFieldChange
+	}{
+		{
+			name:   "unchanged",
+			before: map[string]interface{}{"price": 10.0, "tags": []interface{}{"a"}},
+			after:  map[string]interface{}{"price": 10.0, "tags": []interface{}{"a"}},
+			want:   []models.CrawlerFieldChange{},
+		},
+		{
+			name:   "scalar changed",
+			before: map[string]interface{}{"price": 10.0},
+			after:  map[string]interface{}{"price": 12.0},
+			want:   []models.CrawlerFieldChange{{Path: "price", Type: "changed", From: 10.0, To: 12.0}},
+		},
+		{
+			name:   "keys added and removed in order",
+			before: map[string]interface{}{"c": 3.0, "a": 1.0},
+			after:  map[string]interface{}{"c": 3.0, "b": 2.0},
+			want: []models.CrawlerFieldChange{
+				{Path: "a", Type: "removed", From: 1.0},
+				{Path: "b", Type: "added", To: 2.0},
+			},
+		},
+		{
+			name: "nested lists",
+			before: map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"p": 1.0}, map[string]interface{}{"p": 2.0},
+			}},
+			after: map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"p": 1.0}, map[string]interface{}{"p": 3.0}, map[string]interface{}{"p": 4.0},
+			}},
+			want: []models.CrawlerFieldChange{
+				{Path: "items[1].p", Type: "changed", From: 2.0, To: 3.0},
+				{Path: "items[2]", Type: "added", To: map[string]interface{}{"p": 4.0}},
+			},
+		},
+		{
+			name:   "list shrinks",
+			before: []interface{}{"a", "b"},
+			after:  []interface{}{"a"},
+			want:   []models.CrawlerFieldChange{{Path: "[1]", Type: "removed", From: "b"}},
+		},
+		{
+			name:   "type changed",
+			before: map[string]interface{}{"x": map[string]interface{}{"y": 1.0}},
+			after:  map[string]interface{}{"x": "s"},
+			want:   []models.CrawlerFieldChange{{Path: "x", Type: "changed", From: map[string]interface{}{"y": 1.0}, To: "s"}},
+		},
+		{
+			name:   "null to value",
+			before: map[string]interface{}{"x": nil},
+			after:  map[string]interface{}{"x": 1.0},
+			want:   []models.CrawlerFieldChange{{Path: "x", Type: "changed", From: nil, To: 1.0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffWatchData(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffWatchData() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawlerWatcherStripIgnored(t *testing.T) {
+	data := func() interface{} {
+		return map[string]interface{}{
+			"title":      "首页",
+			"updated_at": "12:00",
+			"meta":       map[string]interface{}{"updated_at": "12:00"},
+			"items": []interface{}{
+				map[string]interface{}{"price": 2.0, "stock": 5.0},
+				map[string]interface{}{"price": 3.0, "stock": 0.0},
+			},
+			"tags": []interface{}{"new", "hot"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		ignore []string
+		want   interface{}
+	}{
+		{
+			name:   "nothing ignored",
+			ignore: nil,
+			want:   data(),
+		},
+		{
+			name:   "top level field only",
+			ignore: []string{"updated_at"},
+			want: map[string]interface{}{
+				"title": "首页",
+				"meta":  map[string]interface{}{"updated_at": "12:00"},
+				"items": []interface{}{
+					map[string]interface{}{"price": 2.0, "stock": 5.0},
+					map[string]interface{}{"price": 3.0, "stock": 0.0},
+				},
+				"tags": []interface{}{"new", "hot"},
+			},
+		},
+		{
+			name:   "wildcard in list and index",
+			ignore: []string{"items[*].stock", "tags.0", "meta"},
+			want: map[string]interface{}{
+				"title":      "首页",
+				"updated_at": "12:00",
+				"items": []interface{}{
+					map[string]interface{}{"price": 2.0},
+					map[string]interface{}{"price": 3.0},
+				},
+				"tags": []interface{}{"hot"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &crawlerWatcher{}
+			for _, field := range tt.ignore {
+				w.ignoreFields = append(w.ignoreFields, splitWatchPath(field))
+			}
+			if got := w.stripIgnored(data(), nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stripIgnored() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchPathOverlaps(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"price", "price", true},
+		{"price", "title", false},
+		{"products.*.price", "products[0].price", true},
+		{"products[*].price", "products.3.price", true},
+		{"products.*.price", "products[0].name", false},
+		{"products", "products[0].price", true}, // 字段包含其下的所有子字段
+		{"products.*.price", "products", true},  // 整个列表变化时涉及其中的字段
+		{"products.*.price", "products[1]", true},
+		{"a.b", "a.c.b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			if got := watchPathOverlaps(splitWatchPath(tt.pattern), splitWatchPath(tt.path)); got != tt.want {
+				t.Errorf("watchPathOverlaps(%s, %s) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWatchPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"price", []string{"price"}},
+		{" products[0].price ", []string{"products", "0", "price"}},
+		{"a..b", []string{"a", "b"}},
+		{"[*]", []string{"*"}},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := splitWatchPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitWatchPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePageText(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:        "html blocks on separate lines",
+			contentType: "text/html",
+			body: `<html><head><title>标题</title><style>p{color:red}</style></head><body>
+				<h1>Hello   World</h1><p>第一段 <b>加粗</b></p><script>track()</script><noscript>开启JS</noscript>
+				<ul><li>a</li><li>b</li></ul>更新于 12:00</body></html>`,
+			want: "标题\nHello World\n第一段 加粗\na\nb\n更新于 12:00",
+		},
+		{
+			name:        "json sorted and indented",
+			contentType: "application/json",
+			body:        `{"b":1,"a":[1,2]}`,
+			want:        "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": 1\n}",
+		},
+		{
+			name:        "invalid json as text",
+			contentType: "application/problem+json",
+			body:        "{bad   json\n\n}",
+			want:        "{bad json\n}",
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			body:        "  line1  \n\n\t line   2 ",
+			want:        "line1\nline 2",
+		},
+		{
+			name:        "binary",
+			contentType: "image/png",
+			body:        "\x89PNG",
+			want:        "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &CrawledPage{ContentType: tt.contentType, Body: []byte(tt.body)}
+			if got := normalizePageText(page); got != tt.want {
+				t.Errorf("normalizePageText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawlerWatcherSnapshotIgnorePatterns(t *testing.T) {
+	task := &models.CrawlerTask{Config: map[string]interface{}{"watch": map[string]interface{}{
+		"enabled":         true,
+		"mode":            WatchModeText,
+		"ignore_patterns": []interface{}{`\d{2}:\d{2}`},
+	}}}
+	w, err := parseCrawlerWatcher(task)
+	if err != nil {
+		t.Fatalf("parseCrawlerWatcher() error = %v", err)
+	}
+
+	snapshot := func(body string) *crawlerWatchSnapshot {
+		snap, err := w.snapshot(&CrawledPage{StatusCode: 200, ContentType: "text/html", Body: []byte(body)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snap
+	}
+	// 只有被忽略的时间不同，快照相同
+	first, second := snapshot("<p>价格 99</p><p>更新于 12:00</p>"), snapshot("<p>价格 99</p><p>更新于 13:30</p>")
+	if first.hash != second.hash || strings.Contains(first.text, "12:00") {
+		t.Errorf("snapshots differ: %q vs %q", first.text, second.text)
+	}
+	if changed := snapshot("<p>价格 89</p><p>更新于 12:00</p>"); changed.hash == first.hash {
+		t.Error("price change not reflected in the snapshot hash")
+	}
+}
+
+func TestParseCrawlerWatcherInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		watch map[string]interface{}
+	}{
+		{"unknown mode", map[string]interface{}{"mode": "html"}},
+		{"fields in text mode", map[string]interface{}{"mode": WatchModeText, "fields": []interface{}{"price"}}},
+		{"empty field", map[string]interface{}{"fields": []interface{}{" "}}},
+		{"empty ignore field", map[string]interface{}{"ignore_fields": []interface{}{"[]"}}},
+		{"invalid pattern", map[string]interface{}{"ignore_patterns": []interface{}{"("}}},
+		{"webhook scheme", map[string]interface{}{"webhook_url": "file:///etc/passwd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.watch["enabled"] = true
+			task := &models.CrawlerTask{Config: map[string]interface{}{"watch": tt.watch}}
+			if _, err := parseCrawlerWatcher(task); !errors.Is(err, ErrInvalidCrawlerTask) {
+				t.Errorf("parseCrawlerWatcher() error = %v, want ErrInvalidCrawlerTask", err)
+			}
+		})
+	}
+}
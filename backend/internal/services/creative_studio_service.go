@@ -1,19 +1,23 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"qa-toolbox-backend/internal/database"
 )
 
 type CreativeStudioService struct {
-	db *database.DB
+	db         *database.DB
+	moderation *ModerationService
 }
 
-func NewCreativeStudioService(db *database.DB) *CreativeStudioService {
+func NewCreativeStudioService(db *database.DB, moderation *ModerationService) *CreativeStudioService {
 	return &CreativeStudioService{
-		db: db,
+		db:         db,
+		moderation: moderation,
 	}
 }
 
@@ -38,10 +42,28 @@ type WritingResponse struct {
 	Content     string    `json:"content"`
 	WordCount   int       `json:"word_count"`
 	CreatedAt   time.Time `json:"created_at"`
+	// 内容被打码或标记时返回审核结果
+	Moderation  ModerationAction `json:"moderation,omitempty"`
 }
 
 // GenerateContent 生成内容
 func (s *CreativeStudioService) GenerateContent(req *WritingRequest) (*WritingResponse, error) {
+	ctx := context.Background()
+	input, err := s.moderation.Check(ctx, ModerationInput{
+		UserID:    req.UserID,
+		Source:    ModerationSourceCreativeStudio,
+		Direction: ModerationDirectionInput,
+		Text:      strings.Join([]string{req.Title, req.Topic, req.Requirements}, "\n"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if input.Action == ModerationRedact {
+		req.Title = s.moderation.Redact(req.Title)
+		req.Topic = s.moderation.Redact(req.Topic)
+		req.Requirements = s.moderation.Redact(req.Requirements)
+	}
+
 	// 这里应该调用AI服务生成内容
 	content := fmt.Sprintf(`
 关于"%s"的%s：
@@ -66,8 +88,25 @@ func (s *CreativeStudioService) GenerateContent(req *WritingRequest) (*WritingRe
 		CreatedAt: time.Now(),
 	}
 
+	output, err := s.moderation.Check(ctx, ModerationInput{
+		UserID:    req.UserID,
+		Source:    ModerationSourceCreativeStudio,
+		Direction: ModerationDirectionOutput,
+		Text:      response.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	response.Content = output.Text
+	if moderationActionRank[output.Action] < moderationActionRank[input.Action] {
+		output.Action = input.Action
+	}
+	if output.Action != ModerationAllow {
+		response.Moderation = output.Action
+	}
+
 	// 保存写作内容
-	_, err := s.db.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO writings (id, user_id, title, type, topic, content, word_count, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
 	`, response.ID, req.UserID, req.Title, req.Type, req.Topic, response.Content, req.Length)
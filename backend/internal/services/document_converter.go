@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+	"qa-toolbox-backend/internal/config"
+)
+
+// 文档格式
+const (
+	DocFormatPDF      = "pdf"
+	DocFormatText     = "txt"
+	DocFormatMarkdown = "md"
+	DocFormatHTML     = "html"
+	DocFormatJPEG     = "jpg"
+	DocFormatPNG      = "png"
+	DocFormatGIF      = "gif"
+)
+
+// 格式别名
+var docFormatAliases = map[string]string{
+	"text":     DocFormatText,
+	"markdown": DocFormatMarkdown,
+	"htm":      DocFormatHTML,
+	"jpeg":     DocFormatJPEG,
+}
+
+// 转换结果保存在 UPLOAD_DIR 下的子目录
+const convertedDirName = "converted"
+
+var (
+	// ErrUnsupportedConversion 没有可以处理该格式组合的转换器
+	ErrUnsupportedConversion = errors.New("不支持的转换格式")
+	// ErrInvalidConversionSource 源文件地址不是http(s)地址或已上传文件的引用
+	ErrInvalidConversionSource = errors.New("源文件地址无效")
+	// ErrInvalidConversionOptions 转换参数不合法
+	ErrInvalidConversionOptions = errors.New("转换参数无效")
+	// ErrConversionNotFound 转换记录或结果文件不存在
+	ErrConversionNotFound = errors.New("转换记录不存在")
+	// ErrConversionNotReady 转换尚未完成，没有可下载的文件
+	ErrConversionNotReady = errors.New("转换尚未完成")
+)
+
+// NormalizeDocumentFormat 统一格式名的大小写和别名，如 JPEG -> jpg、markdown -> md
+func NormalizeDocumentFormat(format string) string {
+	format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+	if alias, ok := docFormatAliases[format]; ok {
+		return alias
+	}
+	return format
+}
+
+// ConversionOptions 转换参数，来自转换请求的options
+type ConversionOptions struct {
+	PageSize    string  `json:"page_size,omitempty"`   // A3、A4、A5、Letter、Legal，图片转PDF时可以为 fit 表示页面与图片同尺寸
+	Orientation string  `json:"orientation,omitempty"` // portrait 或 landscape
+	FontSize    float64 `json:"font_size,omitempty"`   // 生成PDF时正文的字号
+}
+
+// ParseConversionOptions 解析转换请求的options
+func ParseConversionOptions(options map[string]interface{}) (ConversionOptions, error) {
+	var opts ConversionOptions
+	if len(options) == 0 {
+		return opts, nil
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return opts, fmt.Errorf("解析转换参数失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return opts, fmt.Errorf("解析转换参数失败: %w", err)
+	}
+
+	switch strings.ToLower(opts.Orientation) {
+	case "", "portrait", "landscape":
+	default:
+		return opts, fmt.Errorf("orientation只能为portrait或landscape")
+	}
+	if opts.PageSize != "" && !strings.EqualFold(opts.PageSize, "fit") {
+		if _, ok := pdfPageSizes[strings.ToLower(opts.PageSize)]; !ok {
+			return opts, fmt.Errorf("不支持的页面尺寸: %s", opts.PageSize)
+		}
+	}
+	if opts.FontSize < 0 || opts.FontSize > 72 {
+		return opts, fmt.Errorf("font_size应在0~72之间")
+	}
+	return opts, nil
+}
+
+// DocumentConverter 文档转换器
+//
+// 转换器只处理本地文件：src为源文件，结果写入dst。Convert返回错误时由下一个支持该格式的转换器继续尝试
+type DocumentConverter interface {
+	Name() string
+	Supports(source, target string) bool
+	Convert(ctx context.Context, src, dst string, opts ConversionOptions) error
+}
+
+// ConversionResult 转换结果
+type ConversionResult struct {
+	Path      string `json:"-"`
+	Converter string `json:"converter"`
+	FileSize  int64  `json:"file_size"`
+	PageCount int    `json:"page_count"`
+}
+
+// ConversionFormat 支持的转换组合
+type ConversionFormat struct {
+	Source     string   `json:"source"`
+	Targets    []string `json:"targets"`
+	Converters []string `json:"converters"`
+}
+
+// DocumentConversionService 文档转换
+//
+// 按注册顺序选择转换器，本地安装的转换工具优先于内置的纯Go实现；转换结果保存在 UPLOAD_DIR/converted
+type DocumentConversionService struct {
+	converters  []DocumentConverter
+	files       *FileService
+	outputDir   string
+	maxFileSize int64
+	timeout     time.Duration
+	client      *http.Client
+}
+
+func NewDocumentConversionService(cfg *config.Config, files *FileService) *DocumentConversionService {
+	s := &DocumentConversionService{
+		files:       files,
+		outputDir:   filepath.Join(cfg.UploadDir, convertedDirName),
+		maxFileSize: cfg.MaxFileSize,
+		timeout:     time.Duration(cfg.ConversionTimeoutSeconds) * time.Second,
+		// 源文件地址由用户提供，与爬虫一样拒绝连接内网地址（包括重定向后的地址）
+		client: newAddressGuard(cfg.CrawlerAllowedNetworks).HTTPClient(60 * time.Second),
+	}
+
+	if cfg.ConversionToolsEnabled {
+		for _, converter := range detectToolConverters() {
+			s.converters = append(s.converters, converter)
+			log.Printf("文档转换使用本地工具: %s", converter.Name())
+		}
+	}
+	fontFile := findConversionFont(cfg.ConversionFontFile)
+	s.converters = append(s.converters,
+		&pdfTextConverter{},
+		&textPDFConverter{fontFile: fontFile},
+		&imagePDFConverter{},
+	)
+
+	return s
+}
+
+// Register 注册转换器，后注册的优先
+func (s *DocumentConversionService) Register(converter DocumentConverter) {
+	s.converters = append([]DocumentConverter{converter}, s.converters...)
+}
+
+// Supports 检查是否有转换器可以处理该格式组合
+func (s *DocumentConversionService) Supports(source, target string) error {
+	source, target = NormalizeDocumentFormat(source), NormalizeDocumentFormat(target)
+	if len(s.candidates(source, target)) == 0 {
+		return fmt.Errorf("%w: %s -> %s", ErrUnsupportedConversion, source, target)
+	}
+	return nil
+}
+
+// Formats 列出支持的转换组合
+func (s *DocumentConversionService) Formats() []ConversionFormat {
+	sources := []string{}
+	targets := map[string]map[string]bool{}
+	converters := map[string][]string{}
+	for _, source := range knownDocumentFormats() {
+		for _, target := range knownDocumentFormats() {
+			if source == target {
+				continue
+			}
+			for _, converter := range s.candidates(source, target) {
+				if targets[source] == nil {
+					sources = append(sources, source)
+					targets[source] = map[string]bool{}
+				}
+				targets[source][target] = true
+				if !containsString(converters[source], converter.Name()) {
+					converters[source] = append(converters[source], converter.Name())
+				}
+			}
+		}
+	}
+
+	formats := make([]ConversionFormat, 0, len(sources))
+	for _, source := range sources {
+		format := ConversionFormat{Source: source, Converters: converters[source]}
+		for target := range targets[source] {
+			format.Targets = append(format.Targets, target)
+		}
+		sort.Strings(format.Targets)
+		formats = append(formats, format)
+	}
+	return formats
+}
+
+// OutputPath 转换结果的保存路径
+func (s *DocumentConversionService) OutputPath(id, target string) string {
+	return filepath.Join(s.outputDir, id+"."+NormalizeDocumentFormat(target))
+}
+
+// Convert 获取源文件并转换，结果保存为 OutputPath(id, target)
+//
+// sourceURL为http(s)地址或已上传文件的引用 file:<id>，调用方需要事先校验文件的所有者。源文件无效、格式不支持或转换失败时返回不可重试的错误
+func (s *DocumentConversionService) Convert(ctx context.Context, id, sourceURL, source, target string, opts ConversionOptions) (*ConversionResult, error) {
+	source, target = NormalizeDocumentFormat(source), NormalizeDocumentFormat(target)
+	candidates := s.candidates(source, target)
+	if len(candidates) == 0 {
+		return nil, PermanentJobError(fmt.Errorf("%w: %s -> %s", ErrUnsupportedConversion, source, target))
+	}
+
+	workDir, err := os.MkdirTemp("", "conversion-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	src := filepath.Join(workDir, "source."+source)
+	if err := s.fetchSource(ctx, sourceURL, src); err != nil {
+		return nil, err
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	dst := filepath.Join(workDir, "output."+target)
+	var converter DocumentConverter
+	var errs []string
+	for _, candidate := range candidates {
+		os.Remove(dst)
+		err := candidate.Convert(ctx, src, dst, opts)
+		if err == nil {
+			converter = candidate
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("转换超时: %w", ctx.Err())
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", candidate.Name(), err))
+	}
+	if converter == nil {
+		return nil, PermanentJobError(fmt.Errorf("转换失败: %s", strings.Join(errs, "; ")))
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		return nil, fmt.Errorf("读取转换结果失败: %w", err)
+	}
+
+	// 页数取PDF一侧的实际页数
+	pdfPath := dst
+	if target != DocFormatPDF {
+		pdfPath = src
+	}
+	pageCount := 0
+	if source == DocFormatPDF || target == DocFormatPDF {
+		if pageCount, err = countPDFPages(pdfPath); err != nil {
+			return nil, PermanentJobError(err)
+		}
+	}
+
+	output := s.OutputPath(id, target)
+	if err := installFile(dst, output); err != nil {
+		return nil, err
+	}
+
+	return &ConversionResult{
+		Path:      output,
+		Converter: converter.Name(),
+		FileSize:  info.Size(),
+		PageCount: pageCount,
+	}, nil
+}
+
+func (s *DocumentConversionService) candidates(source, target string) []DocumentConverter {
+	var candidates []DocumentConverter
+	for _, converter := range s.converters {
+		if converter.Supports(source, target) {
+			candidates = append(candidates, converter)
+		}
+	}
+	return candidates
+}
+
+// fetchSource 下载或复制源文件，超过 MAX_FILE_SIZE 的文件拒绝转换
+func (s *DocumentConversionService) fetchSource(ctx context.Context, sourceURL, dst string) error {
+	var body io.Reader
+	if strings.HasPrefix(sourceURL, "http://") || strings.HasPrefix(sourceURL, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+		if err != nil {
+			return PermanentJobError(fmt.Errorf("源文件地址无效: %w", err))
+		}
+		resp, err := s.client.Do(req)
+		if errors.Is(err, ErrBlockedAddress) {
+			return PermanentJobError(fmt.Errorf("下载源文件失败: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("下载源文件失败: %w", err)
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			return fmt.Errorf("下载源文件失败: HTTP %d", resp.StatusCode)
+		case resp.StatusCode != http.StatusOK:
+			return PermanentJobError(fmt.Errorf("下载源文件失败: HTTP %d", resp.StatusCode))
+		}
+		body = resp.Body
+	} else if id, ok := strings.CutPrefix(sourceURL, FileSourcePrefix); ok && s.files != nil {
+		file, err := s.files.openSource(ctx, id)
+		if errors.Is(err, ErrFileNotFound) || errors.Is(err, ErrObjectNotFound) {
+			return PermanentJobError(fmt.Errorf("读取源文件失败: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("读取源文件失败: %w", err)
+		}
+		defer file.Close()
+		body = file
+	} else {
+		return PermanentJobError(fmt.Errorf("%w: %s", ErrInvalidConversionSource, sourceURL))
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("保存源文件失败: %w", err)
+	}
+	defer out.Close()
+
+	limit := s.maxFileSize
+	if limit <= 0 {
+		limit = 1<<63 - 2
+	}
+	n, err := io.Copy(out, io.LimitReader(body, limit+1))
+	if err != nil {
+		return fmt.Errorf("保存源文件失败: %w", err)
+	}
+	if n > limit {
+		return PermanentJobError(fmt.Errorf("源文件超过大小限制（%d字节）", s.maxFileSize))
+	}
+	return nil
+}
+
+// installFile 把转换结果移动到输出目录，先写临时文件再重命名
+func installFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("读取转换结果失败: %w", err)
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("保存转换结果失败: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("保存转换结果失败: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存转换结果失败: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存转换结果失败: %w", err)
+	}
+	return nil
+}
+
+// countPDFPages 读取PDF的页数
+func countPDFPages(path string) (pages int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解析PDF失败: %v", r)
+		}
+	}()
+
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("解析PDF失败: %w", err)
+	}
+	defer file.Close()
+	return reader.NumPage(), nil
+}
+
+func knownDocumentFormats() []string {
+	formats := []string{DocFormatPDF, DocFormatText, DocFormatMarkdown, DocFormatHTML, DocFormatJPEG, DocFormatPNG, DocFormatGIF}
+	return append(formats, officeDocumentFormats...)
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,756 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/ledongthuc/pdf"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// 生成PDF支持的页面尺寸
+var pdfPageSizes = map[string]string{
+	"a3":     "A3",
+	"a4":     "A4",
+	"a5":     "A5",
+	"letter": "Letter",
+	"legal":  "Legal",
+}
+
+// 未配置 CONVERSION_FONT_FILE 时依次查找的系统字体，内置的Helvetica只支持西文字符
+var conversionFontCandidates = []string{
+	"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+	"/usr/share/fonts/google-droid/DroidSansFallbackFull.ttf",
+	"/usr/share/fonts/truetype/arphic/uming.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+	"C:\\Windows\\Fonts\\simhei.ttf",
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/dejavu/DejaVuSans.ttf",
+}
+
+// 生成PDF的页边距和正文默认字号
+const (
+	pdfMargin          = 20.0 // mm
+	pdfDefaultFontSize = 11.0 // pt
+)
+
+// findConversionFont 生成PDF使用的TrueType字体，都不存在时返回空字符串
+func findConversionFont(configured string) string {
+	if configured != "" {
+		if _, err := os.Stat(configured); err != nil {
+			log.Printf("文档转换字体不可用: %v", err)
+			return ""
+		}
+		return configured
+	}
+	for _, path := range conversionFontCandidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// newConversionPDF 按转换参数创建PDF文档
+func newConversionPDF(opts ConversionOptions, defaultOrientation string) *gofpdf.Fpdf {
+	orientation := defaultOrientation
+	switch strings.ToLower(opts.Orientation) {
+	case "portrait":
+		orientation = "P"
+	case "landscape":
+		orientation = "L"
+	}
+	size := "A4"
+	if s, ok := pdfPageSizes[strings.ToLower(opts.PageSize)]; ok {
+		size = s
+	}
+
+	doc := gofpdf.New(orientation, "mm", size, "")
+	doc.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	doc.SetAutoPageBreak(true, pdfMargin)
+	return doc
+}
+
+// ==================== PDF -> 文本 ====================
+
+// pdfTextConverter 提取PDF中的文本，输出纯文本或Markdown
+//
+// 只能提取文本层，扫描件没有文本层时结果为空
+type pdfTextConverter struct{}
+
+func (c *pdfTextConverter) Name() string {
+	return "builtin-pdf-text"
+}
+
+func (c *pdfTextConverter) Supports(source, target string) bool {
+	return source == DocFormatPDF && (target == DocFormatText || target == DocFormatMarkdown)
+}
+
+func (c *pdfTextConverter) Convert(ctx context.Context, src, dst string, opts ConversionOptions) error {
+	pages, err := extractPDFPages(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	if strings.HasSuffix(dst, "."+DocFormatMarkdown) {
+		// 每页一节，页与页之间用分隔线隔开
+		sections := make([]string, len(pages))
+		for i, page := range pages {
+			sections[i] = fmt.Sprintf("<!-- page %d -->\n\n%s", i+1, page)
+		}
+		out = strings.Join(sections, "\n\n---\n\n") + "\n"
+	} else {
+		// 与pdftotext一致，每页之后加换页符
+		out = strings.Join(pages, "\n\f") + "\n\f"
+	}
+	return os.WriteFile(dst, []byte(out), 0o644)
+}
+
+// extractPDFPages 按页提取文本，行距明显大于正文行距的位置作为段落分隔
+func extractPDFPages(ctx context.Context, path string) (pages []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解析PDF失败: %v", r)
+		}
+	}()
+
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("解析PDF失败: %w", err)
+	}
+	defer file.Close()
+
+	for i := 1; i <= reader.NumPage(); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			pages = append(pages, "")
+			continue
+		}
+		pages = append(pages, joinPDFText(page.Content().Text))
+	}
+	return pages, nil
+}
+
+// joinPDFText 按纵坐标把字形拼成行，行距明显大于正文行距时视为段落分隔
+func joinPDFText(texts []pdf.Text) string {
+	type textLine struct {
+		y    float64
+		text strings.Builder
+	}
+	var lines []*textLine
+	for _, t := range texts {
+		if n := len(lines); n == 0 || math.Abs(lines[n-1].y-t.Y) > t.FontSize/2 {
+			lines = append(lines, &textLine{y: t.Y})
+		}
+		lines[len(lines)-1].text.WriteString(t.S)
+	}
+
+	var kept []*textLine
+	for _, line := range lines {
+		if strings.TrimSpace(line.text.String()) != "" {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+
+	// 正文行距取相邻行的最小间距，段落间距通常为其1.5倍
+	gaps := make([]float64, 0, len(kept))
+	var lineGap float64
+	for i := 1; i < len(kept); i++ {
+		gap := kept[i-1].y - kept[i].y
+		gaps = append(gaps, gap)
+		if gap > 0 && (lineGap == 0 || gap < lineGap) {
+			lineGap = gap
+		}
+	}
+
+	var b strings.Builder
+	for i, line := range kept {
+		if i > 0 {
+			// 间距为负说明换栏或回到页面上方，同样按段落处理
+			if gap := gaps[i-1]; gap < 0 || (lineGap > 0 && gap > lineGap*1.3) {
+				b.WriteString("\n\n")
+			} else {
+				b.WriteString("\n")
+			}
+		}
+		b.WriteString(strings.TrimRightFunc(line.text.String(), unicode.IsSpace))
+	}
+	return b.String()
+}
+
+// ==================== 文本、Markdown、HTML -> PDF ====================
+
+type docBlockKind int
+
+const (
+	docParagraph docBlockKind = iota
+	docHeading
+	docListItem
+	docCode
+	docQuote
+	docRule
+)
+
+// docBlock 文档中的一个块，生成PDF时逐块排版
+type docBlock struct {
+	kind   docBlockKind
+	level  int    // 标题级别或列表嵌套层级
+	marker string // 列表项的符号或序号
+	text   string
+}
+
+// textPDFConverter 把纯文本、Markdown和HTML排版为PDF
+//
+// 支持标题、段落、列表、代码块、引用和分隔线，不支持图片和表格样式；
+// 包含非西文字符时需要配置支持该字符集的TrueType字体
+type textPDFConverter struct {
+	fontFile string
+}
+
+func (c *textPDFConverter) Name() string {
+	return "builtin-text-pdf"
+}
+
+func (c *textPDFConverter) Supports(source, target string) bool {
+	if target != DocFormatPDF {
+		return false
+	}
+	return source == DocFormatText || source == DocFormatMarkdown || source == DocFormatHTML
+}
+
+func (c *textPDFConverter) Convert(ctx context.Context, src, dst string, opts ConversionOptions) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("读取源文件失败: %w", err)
+	}
+
+	var blocks []docBlock
+	switch {
+	case strings.HasSuffix(src, "."+DocFormatMarkdown):
+		blocks = parseMarkdownBlocks(data)
+	case strings.HasSuffix(src, "."+DocFormatHTML):
+		if blocks, err = parseHTMLBlocks(bytes.NewReader(data)); err != nil {
+			return err
+		}
+	default:
+		blocks = parseTextBlocks(string(data))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.render(blocks, dst, opts)
+}
+
+func (c *textPDFConverter) render(blocks []docBlock, dst string, opts ConversionOptions) error {
+	doc := newConversionPDF(opts, "P")
+
+	family := "Helvetica"
+	translate := func(s string) string { return s }
+	if c.fontFile != "" {
+		font, err := os.ReadFile(c.fontFile)
+		if err != nil {
+			return fmt.Errorf("读取字体文件失败: %w", err)
+		}
+		family = "document"
+		doc.AddUTF8FontFromBytes(family, "", font)
+	} else {
+		for _, block := range blocks {
+			if !isCP1252Text(block.text) {
+				return fmt.Errorf("文本包含内置字体不支持的字符，请通过 CONVERSION_FONT_FILE 配置支持该字符集的TrueType字体")
+			}
+		}
+		translate = doc.UnicodeTranslatorFromDescriptor("")
+	}
+
+	size := opts.FontSize
+	if size == 0 {
+		size = pdfDefaultFontSize
+	}
+	lineHeight := size * 0.5 // mm，约1.4倍行距
+	left, _, right, _ := doc.GetMargins()
+	pageWidth, _ := doc.GetPageSize()
+
+	doc.SetFont(family, "", size)
+	doc.AddPage()
+	for _, block := range blocks {
+		switch block.kind {
+		case docHeading:
+			scale := []float64{1.8, 1.5, 1.3, 1.15}[minInt(block.level, 4)-1]
+			doc.SetFont(family, "", size*scale)
+			doc.Ln(lineHeight * 0.5)
+			doc.MultiCell(0, size*scale*0.5, translate(block.text), "", "L", false)
+			doc.Ln(lineHeight * 0.3)
+			doc.SetFont(family, "", size)
+		case docListItem:
+			indent := 6.0 * float64(block.level+1)
+			doc.SetLeftMargin(left + indent)
+			doc.SetX(left + indent)
+			doc.MultiCell(0, lineHeight, translate(block.marker+" "+block.text), "", "L", false)
+			doc.SetLeftMargin(left)
+			doc.Ln(lineHeight * 0.2)
+		case docCode:
+			doc.SetFont(family, "", size*0.9)
+			doc.SetFillColor(245, 245, 245)
+			doc.MultiCell(0, lineHeight*0.9, translate(block.text), "", "L", true)
+			doc.SetFont(family, "", size)
+			doc.Ln(lineHeight * 0.5)
+		case docQuote:
+			doc.SetLeftMargin(left + 6)
+			doc.SetX(left + 6)
+			doc.SetTextColor(90, 90, 90)
+			doc.MultiCell(0, lineHeight, translate(block.text), "", "L", false)
+			doc.SetTextColor(0, 0, 0)
+			doc.SetLeftMargin(left)
+			doc.Ln(lineHeight * 0.5)
+		case docRule:
+			y := doc.GetY() + lineHeight*0.3
+			doc.Line(left, y, pageWidth-right, y)
+			doc.Ln(lineHeight * 0.8)
+		default:
+			doc.MultiCell(0, lineHeight, translate(block.text), "", "L", false)
+			doc.Ln(lineHeight * 0.5)
+		}
+	}
+
+	if err := doc.OutputFileAndClose(dst); err != nil {
+		return fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return nil
+}
+
+var blankLinePattern = regexp.MustCompile(`\n[ \t]*\n`)
+
+// parseTextBlocks 纯文本按空行分段，段内保留换行
+func parseTextBlocks(s string) []docBlock {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\t", "    ")
+	var blocks []docBlock
+	for _, paragraph := range blankLinePattern.Split(s, -1) {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		blocks = append(blocks, docBlock{kind: docParagraph, text: paragraph})
+	}
+	return blocks
+}
+
+// parseMarkdownBlocks 解析Markdown，HTML块按HTML解析
+func parseMarkdownBlocks(source []byte) []docBlock {
+	doc := goldmark.New().Parser().Parse(text.NewReader(source))
+	var blocks []docBlock
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		markdownBlocks(child, source, 0, false, &blocks)
+	}
+	return blocks
+}
+
+func markdownBlocks(n ast.Node, source []byte, depth int, quote bool, blocks *[]docBlock) {
+	paragraph := docParagraph
+	if quote {
+		paragraph = docQuote
+	}
+
+	switch node := n.(type) {
+	case *ast.Heading:
+		*blocks = append(*blocks, docBlock{kind: docHeading, level: node.Level, text: markdownInlineText(node, source)})
+	case *ast.Paragraph, *ast.TextBlock:
+		if s := markdownInlineText(node, source); s != "" {
+			*blocks = append(*blocks, docBlock{kind: paragraph, text: s})
+		}
+	case *ast.List:
+		index := node.Start
+		for item := node.FirstChild(); item != nil; item = item.NextSibling() {
+			marker := "•"
+			if node.IsOrdered() {
+				marker = fmt.Sprintf("%d.", index)
+				index++
+			}
+			first := true
+			for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+				switch child.(type) {
+				case *ast.Paragraph, *ast.TextBlock:
+					if first {
+						*blocks = append(*blocks, docBlock{kind: docListItem, level: depth, marker: marker, text: markdownInlineText(child, source)})
+						first = false
+						continue
+					}
+				}
+				markdownBlocks(child, source, depth+1, quote, blocks)
+			}
+		}
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		var b strings.Builder
+		lines := node.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			b.Write(segment.Value(source))
+		}
+		if s := strings.TrimRight(b.String(), "\n"); s != "" {
+			*blocks = append(*blocks, docBlock{kind: docCode, text: strings.ReplaceAll(s, "\t", "    ")})
+		}
+	case *ast.Blockquote:
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			markdownBlocks(child, source, depth, true, blocks)
+		}
+	case *ast.ThematicBreak:
+		*blocks = append(*blocks, docBlock{kind: docRule})
+	case *ast.HTMLBlock:
+		var b strings.Builder
+		lines := node.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			b.Write(segment.Value(source))
+		}
+		if htmlBlocks, err := parseHTMLBlocks(strings.NewReader(b.String())); err == nil {
+			*blocks = append(*blocks, htmlBlocks...)
+		}
+	default:
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			markdownBlocks(child, source, depth, quote, blocks)
+		}
+	}
+}
+
+// markdownInlineText 行内元素转为纯文本，链接地址附在链接文字之后
+func markdownInlineText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch node := child.(type) {
+		case *ast.Text:
+			if entering {
+				b.Write(node.Segment.Value(source))
+				if node.HardLineBreak() {
+					b.WriteString("\n")
+				} else if node.SoftLineBreak() {
+					b.WriteString(" ")
+				}
+			}
+		case *ast.String:
+			if entering {
+				b.Write(node.Value)
+			}
+		case *ast.AutoLink:
+			if entering {
+				b.Write(node.Label(source))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Link:
+			if !entering && len(node.Destination) > 0 {
+				fmt.Fprintf(&b, " (%s)", node.Destination)
+			}
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// htmlBlockBuilder 把HTML的块级元素转为docBlock
+type htmlBlockBuilder struct {
+	blocks []docBlock
+	text   strings.Builder
+	kind   docBlockKind
+	level  int
+	marker string
+	pre    int
+	quote  int
+	lists  []htmlList
+}
+
+type htmlList struct {
+	ordered bool
+	next    int
+}
+
+// HTML中不输出内容的元素
+var htmlSkippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Iframe: true, atom.Object: true,
+}
+
+// 作为段落处理的块级元素
+var htmlParagraphElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Header: true,
+	atom.Footer: true, atom.Main: true, atom.Nav: true, atom.Aside: true, atom.Form: true,
+	atom.Table: true, atom.Tr: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Address: true, atom.Details: true, atom.Summary: true,
+}
+
+var htmlHeadingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 4, atom.H6: 4,
+}
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// parseHTMLBlocks 解析HTML正文
+func parseHTMLBlocks(r io.Reader) ([]docBlock, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("解析HTML失败: %w", err)
+	}
+	b := &htmlBlockBuilder{}
+	b.walk(root)
+	b.flush()
+	return b.blocks, nil
+}
+
+func (b *htmlBlockBuilder) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if b.pre > 0 {
+			b.text.WriteString(n.Data)
+		} else {
+			b.text.WriteString(whitespacePattern.ReplaceAllString(n.Data, " "))
+		}
+		return
+	case html.ElementNode:
+		if htmlSkippedElements[n.DataAtom] {
+			return
+		}
+		if level, ok := htmlHeadingLevels[n.DataAtom]; ok {
+			b.block(n, docHeading, level, "")
+			return
+		}
+		switch n.DataAtom {
+		case atom.Br:
+			b.text.WriteString("\n")
+			return
+		case atom.Hr:
+			b.flush()
+			b.blocks = append(b.blocks, docBlock{kind: docRule})
+			return
+		case atom.Ul, atom.Ol:
+			b.flush()
+			b.lists = append(b.lists, htmlList{ordered: n.DataAtom == atom.Ol, next: 1})
+			b.children(n)
+			b.flush()
+			b.lists = b.lists[:len(b.lists)-1]
+			return
+		case atom.Li:
+			marker := "•"
+			level := 0
+			if len(b.lists) > 0 {
+				list := &b.lists[len(b.lists)-1]
+				if list.ordered {
+					marker = fmt.Sprintf("%d.", list.next)
+					list.next++
+				}
+				level = len(b.lists) - 1
+			}
+			b.block(n, docListItem, level, marker)
+			return
+		case atom.Pre:
+			b.flush()
+			b.pre++
+			b.kind = docCode
+			b.children(n)
+			b.flush()
+			b.pre--
+			return
+		case atom.Blockquote:
+			b.flush()
+			b.quote++
+			b.children(n)
+			b.flush()
+			b.quote--
+			return
+		case atom.Td, atom.Th:
+			b.children(n)
+			b.text.WriteString(" ")
+			return
+		}
+		if htmlParagraphElements[n.DataAtom] {
+			b.flush()
+			b.children(n)
+			b.flush()
+			return
+		}
+	}
+	b.children(n)
+}
+
+func (b *htmlBlockBuilder) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.walk(child)
+	}
+}
+
+func (b *htmlBlockBuilder) block(n *html.Node, kind docBlockKind, level int, marker string) {
+	b.flush()
+	b.kind, b.level, b.marker = kind, level, marker
+	b.children(n)
+	b.flush()
+}
+
+// flush 结束当前块
+func (b *htmlBlockBuilder) flush() {
+	s := b.text.String()
+	b.text.Reset()
+	kind, level, marker := b.kind, b.level, b.marker
+	b.kind, b.level, b.marker = docParagraph, 0, ""
+
+	if kind == docCode {
+		s = strings.Trim(strings.ReplaceAll(s, "\t", "    "), "\n")
+	} else {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimSpace(line)
+		}
+		s = strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	if s == "" {
+		return
+	}
+	if kind == docParagraph && b.quote > 0 {
+		kind = docQuote
+	}
+	b.blocks = append(b.blocks, docBlock{kind: kind, level: level, marker: marker, text: s})
+}
+
+// isCP1252Text 文本是否可以用内置字体（cp1252编码）输出
+func isCP1252Text(s string) bool {
+	for _, r := range s {
+		if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+			continue
+		}
+		if !strings.ContainsRune("€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ==================== 图片 -> PDF ====================
+
+// imagePDFConverter 把JPEG、PNG、GIF图片放入PDF页面
+//
+// 图片按比例缩放到页面内居中；page_size为fit时页面与图片同尺寸（按96dpi换算）。
+// 未指定方向时横向图片使用横向页面
+type imagePDFConverter struct{}
+
+func (c *imagePDFConverter) Name() string {
+	return "builtin-image-pdf"
+}
+
+func (c *imagePDFConverter) Supports(source, target string) bool {
+	if target != DocFormatPDF {
+		return false
+	}
+	return source == DocFormatJPEG || source == DocFormatPNG || source == DocFormatGIF
+}
+
+func (c *imagePDFConverter) Convert(ctx context.Context, src, dst string, opts ConversionOptions) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("读取源文件失败: %w", err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("无法识别的图片: %w", err)
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return fmt.Errorf("图片尺寸无效")
+	}
+
+	// JPEG直接嵌入，PNG和GIF统一转为8位PNG（PDF不支持16位PNG和GIF动画）
+	imageType := "JPG"
+	if format != "jpeg" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("解析图片失败: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return fmt.Errorf("转换图片失败: %w", err)
+		}
+		data = buf.Bytes()
+		imageType = "PNG"
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	const pxToMM = 25.4 / 96
+	imageWidth := float64(config.Width) * pxToMM
+	imageHeight := float64(config.Height) * pxToMM
+
+	var doc *gofpdf.Fpdf
+	var x, y, w, h float64
+	if strings.EqualFold(opts.PageSize, "fit") {
+		doc = gofpdf.NewCustom(&gofpdf.InitType{
+			UnitStr: "mm",
+			Size:    gofpdf.SizeType{Wd: imageWidth, Ht: imageHeight},
+		})
+		doc.SetMargins(0, 0, 0)
+		doc.SetAutoPageBreak(false, 0)
+		w, h = imageWidth, imageHeight
+	} else {
+		orientation := "P"
+		if config.Width > config.Height {
+			orientation = "L"
+		}
+		doc = newConversionPDF(opts, orientation)
+		doc.SetAutoPageBreak(false, 0)
+		pageWidth, pageHeight := doc.GetPageSize()
+		boxWidth, boxHeight := pageWidth-2*pdfMargin, pageHeight-2*pdfMargin
+
+		// 小图不放大
+		scale := 1.0
+		if imageWidth > boxWidth || imageHeight > boxHeight {
+			scale = minFloat(boxWidth/imageWidth, boxHeight/imageHeight)
+		}
+		w, h = imageWidth*scale, imageHeight*scale
+		x, y = (pageWidth-w)/2, (pageHeight-h)/2
+	}
+
+	options := gofpdf.ImageOptions{ImageType: imageType}
+	doc.AddPage()
+	doc.RegisterImageOptionsReader("image", options, bytes.NewReader(data))
+	doc.ImageOptions("image", x, y, w, h, false, options, 0, "")
+	if err := doc.OutputFileAndClose(dst); err != nil {
+		return fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return nil
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
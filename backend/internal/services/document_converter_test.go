@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+func TestDocumentConversionFetchSourceGuard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("内网文档"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		allowed     []string
+		wantBlocked bool
+	}{
+		{"loopback refused", nil, true},
+		{"allowed network", []string{"127.0.0.0/8"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := NewDocumentConversionService(&config.Config{UploadDir: dir, MaxFileSize: 1 << 20, CrawlerAllowedNetworks: tt.allowed}, nil)
+			dst := filepath.Join(dir, "source")
+
+			err := s.fetchSource(context.Background(), server.URL+"/doc.txt", dst)
+			if blocked := errors.Is(err, ErrBlockedAddress); blocked != tt.wantBlocked {
+				t.Fatalf("fetchSource() error = %v, wantBlocked %v", err, tt.wantBlocked)
+			}
+			if tt.wantBlocked {
+				// 被拒绝的地址重试也没有意义
+				var permanent *permanentJobError
+				if !errors.As(err, &permanent) {
+					t.Errorf("fetchSource() error = %v, want a permanent job error", err)
+				}
+				return
+			}
+			if data, err := os.ReadFile(dst); err != nil || string(data) != "内网文档" {
+				t.Errorf("source = %q, %v", data, err)
+			}
+		})
+	}
+}
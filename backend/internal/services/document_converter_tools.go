@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// officeDocumentFormats 由LibreOffice转换为PDF的办公文档格式
+var officeDocumentFormats = []string{"doc", "docx", "odt", "rtf", "xls", "xlsx", "ods", "ppt", "pptx", "odp"}
+
+// 命令失败时错误信息中保留的输出长度
+const toolOutputLimit = 500
+
+// detectToolConverters 查找本地安装的转换工具
+func detectToolConverters() []DocumentConverter {
+	var converters []DocumentConverter
+	if path, err := exec.LookPath("pdftotext"); err == nil {
+		converters = append(converters, &pdftotextConverter{path: path})
+	}
+	if path, err := exec.LookPath("wkhtmltopdf"); err == nil {
+		converters = append(converters, &wkhtmltopdfConverter{path: path})
+	}
+	for _, name := range []string{"soffice", "libreoffice"} {
+		if path, err := exec.LookPath(name); err == nil {
+			converters = append(converters, &libreOfficeConverter{path: path})
+			break
+		}
+	}
+	return converters
+}
+
+// pdftotextConverter 使用poppler的pdftotext提取PDF文本，保留版面布局
+type pdftotextConverter struct {
+	path string
+}
+
+func (c *pdftotextConverter) Name() string {
+	return "pdftotext"
+}
+
+func (c *pdftotextConverter) Supports(source, target string) bool {
+	return source == DocFormatPDF && target == DocFormatText
+}
+
+func (c *pdftotextConverter) Convert(ctx context.Context, src, dst string, opts ConversionOptions) error {
+	return runConversionTool(ctx, c.path, "-layout", "-enc", "UTF-8", src, dst)
+}
+
+// wkhtmltopdfConverter 使用wkhtmltopdf渲染HTML，禁止读取本地文件
+type wkhtmltopdfConverter struct {
+	path string
+}
+
+func (c *wkhtmltopdfConverter) Name() string {
+	return "wkhtmltopdf"
+}
+
+func (c *wkhtmltopdfConverter) Supports(source, target string) bool {
+	return source == DocFormatHTML && target == DocFormatPDF
+}
+
+func (c *wkhtmltopdfConverter) Convert(ctx context.Context, src, dst string, opts ConversionOptions) error {
+	args := []string{"--quiet", "--disable-local-file-access"}
+	if size, ok := pdfPageSizes[strings.ToLower(opts.PageSize)]; ok {
+		args = append(args, "--page-size", size)
+	}
+	if strings.EqualFold(opts.Orientation, "landscape") {
+		args = append(args, "--orientation", "Landscape")
+	}
+	args = append(args, src, dst)
+	return runConversionTool(ctx, c.path, args...)
+}
+
+// libreOfficeConverter 使用LibreOffice把办公文档、HTML和纯文本转换为PDF
+type libreOfficeConverter struct {
+	path string
+}
+
+func (c *libreOfficeConverter) Name() string {
+	return "libreoffice"
+}
+
+func (c *libreOfficeConverter) Supports(source, target string) bool {
+	if target != DocFormatPDF {
+		return false
+	}
+	return source == DocFormatHTML || source == DocFormatText || containsString(officeDocumentFormats, source)
+}
+
+func (c *libreOfficeConverter) Convert(ctx context.Context, src, dst string, opts ConversionOptions) error {
+	// 每次转换使用独立的用户配置目录，否则并发转换会互相阻塞
+	workDir, err := os.MkdirTemp("", "libreoffice-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	profile := "file://" + filepath.ToSlash(filepath.Join(workDir, "profile"))
+	outDir := filepath.Join(workDir, "out")
+	if err := runConversionTool(ctx, c.path, "--headless", "--norestore", "-env:UserInstallation="+profile,
+		"--convert-to", DocFormatPDF, "--outdir", outDir, src); err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src)) + "." + DocFormatPDF
+	return installFile(filepath.Join(outDir, name), dst)
+}
+
+// runConversionTool 执行转换命令，失败时错误信息中附带命令输出
+func runConversionTool(ctx context.Context, path string, args ...string) error {
+	output, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	message := strings.TrimSpace(string(output))
+	if len(message) > toolOutputLimit {
+		message = message[:toolOutputLimit] + "..."
+	}
+	if message == "" {
+		return fmt.Errorf("%s执行失败: %w", filepath.Base(path), err)
+	}
+	return fmt.Errorf("%s执行失败: %w: %s", filepath.Base(path), err, message)
+}
@@ -0,0 +1,571 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+)
+
+var (
+	// ErrFileNotFound 文件不存在或不属于当前用户
+	ErrFileNotFound = errors.New("文件不存在")
+	// ErrEmptyFile 上传的文件为空
+	ErrEmptyFile = errors.New("文件为空")
+	// ErrFileTooLarge 文件超过 MAX_FILE_SIZE
+	ErrFileTooLarge = errors.New("文件超过大小限制")
+	// ErrFileTypeNotAllowed 扩展名不在 ALLOWED_FILE_TYPES 中，或文件内容与扩展名不符
+	ErrFileTypeNotAllowed = errors.New("不允许上传该类型的文件")
+	// ErrInvalidFileSignature 下载链接签名无效
+	ErrInvalidFileSignature = errors.New("下载链接无效")
+	// ErrFileURLExpired 下载链接已过期
+	ErrFileURLExpired = errors.New("下载链接已过期")
+)
+
+// FileSourcePrefix 其他功能引用已上传文件时使用的地址前缀，如 file:<id>
+const FileSourcePrefix = "file:"
+
+const (
+	// 对象存储签发的跳转地址只需要在跳转后立即可用
+	fileRedirectTTL = 5 * time.Minute
+	// 签名下载链接的最长有效期，与S3预签名地址的上限一致
+	maxFileURLTTL = 7 * 24 * time.Hour
+	// 文件名最大长度（字节）
+	maxFilenameLength = 255
+)
+
+// StoredFile 已上传的文件
+type StoredFile struct {
+	ID          string         `json:"id"`
+	UserID      string         `json:"user_id"`
+	Filename    string         `json:"filename"`
+	ContentType string         `json:"content_type"`
+	Extension   string         `json:"extension"`
+	Size        int64          `json:"size"`
+	Checksum    string         `json:"checksum"` // SHA-256
+	Purpose     string         `json:"purpose,omitempty"`
+	Backend     string         `json:"backend"`
+	StorageKey  string         `json:"-"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DownloadURL *SignedFileURL `json:"download_url,omitempty"`
+}
+
+// SignedFileURL 无需登录即可访问的下载链接
+type SignedFileURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FileContent 文件下载内容，对象存储返回跳转地址，本地存储返回文件内容
+type FileContent struct {
+	File        *StoredFile
+	Body        io.ReadCloser
+	RedirectURL string
+}
+
+// FileService 文件上传、下载和签名链接
+type FileService struct {
+	db           *database.DB
+	storage      ObjectStorage
+	maxFileSize  int64
+	allowedTypes []string
+	signingKey   []byte
+	urlTTL       time.Duration
+}
+
+// NewFileService 创建文件服务，存储后端配置错误时使用本地存储
+func NewFileService(db *database.DB, cfg *config.Config) *FileService {
+	storage, err := NewObjectStorage(cfg)
+	if err != nil {
+		log.Printf("初始化文件存储失败，使用本地存储: %v", err)
+		storage = NewLocalStorage(path.Join(cfg.UploadDir, storedFilesDirName))
+	}
+
+	allowed := make([]string, 0, len(cfg.AllowedFileTypes))
+	for _, ext := range cfg.AllowedFileTypes {
+		if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+			allowed = append(allowed, ext)
+		}
+	}
+
+	key := cfg.StorageSigningKey
+	if key == "" {
+		key = cfg.JWTSecret
+	}
+
+	return &FileService{
+		db:           db,
+		storage:      storage,
+		maxFileSize:  cfg.MaxFileSize,
+		allowedTypes: allowed,
+		signingKey:   []byte(key),
+		urlTTL:       time.Duration(cfg.StorageURLTTLSeconds) * time.Second,
+	}
+}
+
+// MaxFileSize 单个文件的大小上限
+func (s *FileService) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+// Upload 保存上传的文件
+//
+// 文件先写入临时文件计算大小和SHA-256，再根据内容嗅探真实类型，扩展名必须在 ALLOWED_FILE_TYPES 中且与内容相符
+func (s *FileService) Upload(ctx context.Context, userID, filename, purpose string, r io.Reader) (*StoredFile, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	limit := s.maxFileSize
+	if limit <= 0 {
+		limit = 1<<63 - 2
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取上传文件失败: %w", err)
+	}
+	if size > limit {
+		return nil, fmt.Errorf("%w（%d字节）", ErrFileTooLarge, s.maxFileSize)
+	}
+	if size == 0 {
+		return nil, ErrEmptyFile
+	}
+
+	filename = sanitizeFilename(filename)
+	contentType, ext, err := s.detectType(tmp, size, filename)
+	if err != nil {
+		return nil, err
+	}
+	if path.Ext(filename) == "" {
+		filename += "." + ext
+	}
+
+	now := time.Now()
+	file := &StoredFile{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Extension:   ext,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		Purpose:     purpose,
+		Backend:     s.storage.Name(),
+		CreatedAt:   now,
+	}
+	file.StorageKey = fmt.Sprintf("%s/%s/%s.%s", userID, now.Format("2006/01"), file.ID, ext)
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("读取上传文件失败: %w", err)
+	}
+	if err := s.storage.Put(ctx, file.StorageKey, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO files (id, user_id, filename, content_type, extension, size, checksum, purpose, backend, storage_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, file.ID, userID, file.Filename, file.ContentType, file.Extension, file.Size, file.Checksum,
+		sql.NullString{String: purpose, Valid: purpose != ""}, file.Backend, file.StorageKey, now)
+	if err != nil {
+		s.storage.Delete(context.WithoutCancel(ctx), file.StorageKey)
+		return nil, fmt.Errorf("保存文件记录失败: %w", err)
+	}
+
+	file.DownloadURL = s.signURL(file.ID, s.urlTTL)
+	return file, nil
+}
+
+// detectType 嗅探文件类型并与扩展名比对，返回保存时使用的Content-Type和扩展名
+func (s *FileService) detectType(file *os.File, size int64, filename string) (string, string, error) {
+	sniffed, candidates, err := sniffFileType(file, size)
+	if err != nil {
+		return "", "", err
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	if ext == "" {
+		// 没有扩展名时按内容推断
+		for _, candidate := range candidates {
+			if containsString(s.allowedTypes, candidate) {
+				ext = candidate
+				break
+			}
+		}
+		if ext == "" {
+			return "", "", fmt.Errorf("%w: %s", ErrFileTypeNotAllowed, sniffed)
+		}
+	}
+
+	if !containsString(s.allowedTypes, ext) {
+		return "", "", fmt.Errorf("%w: .%s", ErrFileTypeNotAllowed, ext)
+	}
+	if !containsString(candidates, ext) {
+		return "", "", fmt.Errorf("%w: 文件内容(%s)与扩展名.%s不符", ErrFileTypeNotAllowed, sniffed, ext)
+	}
+
+	if contentType, ok := fileContentTypes[ext]; ok {
+		return contentType, ext, nil
+	}
+	if contentType := mime.TypeByExtension("." + ext); contentType != "" {
+		return contentType, ext, nil
+	}
+	return sniffed, ext, nil
+}
+
+// fileContentTypes 系统MIME表中可能缺少的类型
+var fileContentTypes = map[string]string{
+	"md":   "text/markdown; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+	"doc":  "application/msword",
+	"xls":  "application/vnd.ms-excel",
+	"ppt":  "application/vnd.ms-powerpoint",
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"odp":  "application/vnd.oasis.opendocument.presentation",
+}
+
+// sniffedExtensions 嗅探出的MIME类型对应的扩展名
+var sniffedExtensions = map[string][]string{
+	"application/pdf":           {"pdf"},
+	"image/jpeg":                {"jpg", "jpeg"},
+	"image/png":                 {"png"},
+	"image/gif":                 {"gif"},
+	"image/webp":                {"webp"},
+	"image/bmp":                 {"bmp"},
+	"image/x-icon":              {"ico"},
+	"text/plain":                {"txt", "md", "csv", "json", "log", "yaml", "yml"},
+	"text/html":                 {"html", "htm"},
+	"text/xml":                  {"xml"},
+	"audio/mpeg":                {"mp3"},
+	"audio/wave":                {"wav"},
+	"audio/ogg":                 {"ogg"},
+	"video/mp4":                 {"mp4"},
+	"video/webm":                {"webm"},
+	"application/x-gzip":        {"gz"},
+	"application/zip":           {"zip"},
+	"application/x-ole-storage": {"doc", "xls", "ppt"},
+}
+
+// oleSignature 旧版Office文档（复合文档格式）的文件头
+var oleSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// sniffFileType 根据文件内容判断类型，返回MIME类型和与之相符的扩展名
+func sniffFileType(file *os.File, size int64) (string, []string, error) {
+	head := make([]byte, 512)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", nil, fmt.Errorf("读取上传文件失败: %w", err)
+	}
+	head = head[:n]
+
+	if bytes.HasPrefix(head, oleSignature) {
+		return "application/x-ole-storage", sniffedExtensions["application/x-ole-storage"], nil
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if sniffed == "application/zip" {
+		if contentType, ext := sniffZipDocument(file, size); ext != "" {
+			return contentType, []string{ext}, nil
+		}
+	}
+	return sniffed, sniffedExtensions[sniffed], nil
+}
+
+// sniffZipDocument 识别基于zip的Office和OpenDocument文档
+func sniffZipDocument(file *os.File, size int64) (string, string) {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return "", ""
+	}
+	for _, f := range reader.File {
+		switch {
+		case f.Name == "word/document.xml":
+			return fileContentTypes["docx"], "docx"
+		case f.Name == "xl/workbook.xml":
+			return fileContentTypes["xlsx"], "xlsx"
+		case f.Name == "ppt/presentation.xml":
+			return fileContentTypes["pptx"], "pptx"
+		case f.Name == "mimetype":
+			rc, err := f.Open()
+			if err != nil {
+				return "", ""
+			}
+			data, _ := io.ReadAll(io.LimitReader(rc, 100))
+			rc.Close()
+			for _, ext := range []string{"odt", "ods", "odp"} {
+				if string(data) == fileContentTypes[ext] {
+					return fileContentTypes[ext], ext
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// sanitizeFilename 去掉客户端文件名中的路径和控制字符
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if len(name) > maxFilenameLength {
+		// 保留扩展名，按字符截断文件名主体
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := name[:len(name)-len(ext)]
+		for len(base)+len(ext) > maxFilenameLength {
+			_, width := utf8.DecodeLastRuneInString(base)
+			base = base[:len(base)-width]
+		}
+		name = base + ext
+	}
+	return name
+}
+
+const storedFileColumns = `id, user_id, filename, content_type, extension, size, checksum, purpose, backend, storage_key, created_at`
+
+func scanStoredFile(scanner interface{ Scan(...interface{}) error }) (*StoredFile, error) {
+	var file StoredFile
+	var purpose sql.NullString
+	err := scanner.Scan(&file.ID, &file.UserID, &file.Filename, &file.ContentType, &file.Extension,
+		&file.Size, &file.Checksum, &purpose, &file.Backend, &file.StorageKey, &file.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	file.Purpose = purpose.String
+	return &file, nil
+}
+
+// Get 获取文件信息，只能获取自己上传的文件
+func (s *FileService) Get(ctx context.Context, userID, id string) (*StoredFile, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrFileNotFound
+	}
+	file, err := scanStoredFile(s.db.QueryRowContext(ctx, `
+		SELECT `+storedFileColumns+` FROM files WHERE id = $1 AND user_id = $2
+	`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询文件失败: %w", err)
+	}
+	return file, nil
+}
+
+// getByID 按ID获取文件信息，不检查所有者，调用方需要事先校验权限
+func (s *FileService) getByID(ctx context.Context, id string) (*StoredFile, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrFileNotFound
+	}
+	file, err := scanStoredFile(s.db.QueryRowContext(ctx, `
+		SELECT `+storedFileColumns+` FROM files WHERE id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询文件失败: %w", err)
+	}
+	return file, nil
+}
+
+// List 分页获取用户上传的文件，purpose不为空时按用途过滤
+func (s *FileService) List(ctx context.Context, userID, purpose string, page, perPage int) ([]StoredFile, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM files WHERE user_id = $1 AND ($2 = '' OR purpose = $2)
+	`, userID, purpose).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询文件失败: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+storedFileColumns+` FROM files
+		WHERE user_id = $1 AND ($2 = '' OR purpose = $2)
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`, userID, purpose, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询文件失败: %w", err)
+	}
+	defer rows.Close()
+
+	files := []StoredFile{}
+	for rows.Next() {
+		file, err := scanStoredFile(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取文件记录失败: %w", err)
+		}
+		files = append(files, *file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询文件失败: %w", err)
+	}
+	return files, total, nil
+}
+
+// Delete 删除自己上传的文件
+func (s *FileService) Delete(ctx context.Context, userID, id string) error {
+	file, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM files WHERE id = $1`, file.ID); err != nil {
+		return fmt.Errorf("删除文件记录失败: %w", err)
+	}
+	// 记录已删除，对象删除失败只会留下无法访问的孤立文件
+	if err := s.storage.Delete(ctx, file.StorageKey); err != nil {
+		log.Printf("删除文件 %s 失败: %v", file.StorageKey, err)
+	}
+	return nil
+}
+
+// SignedURL 为自己上传的文件生成签名下载链接，ttl为0时使用 STORAGE_URL_TTL_SECONDS
+func (s *FileService) SignedURL(ctx context.Context, userID, id string, ttl time.Duration) (*SignedFileURL, error) {
+	file, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		ttl = s.urlTTL
+	}
+	if ttl > maxFileURLTTL {
+		ttl = maxFileURLTTL
+	}
+	return s.signURL(file.ID, ttl), nil
+}
+
+// ResolveURL 把 file:<id> 形式的文件引用转换为签名下载链接，其他地址原样返回
+//
+// 只为userID自己的文件签发链接，文件已删除或不属于该用户时返回空字符串
+func (s *FileService) ResolveURL(ctx context.Context, userID, ref string) string {
+	id, ok := strings.CutPrefix(ref, FileSourcePrefix)
+	if !ok {
+		return ref
+	}
+	if s == nil {
+		return ""
+	}
+	signed, err := s.SignedURL(ctx, userID, id, 0)
+	if err != nil {
+		if !errors.Is(err, ErrFileNotFound) {
+			log.Printf("生成文件 %s 的下载链接失败: %v", id, err)
+		}
+		return ""
+	}
+	return signed.URL
+}
+
+func (s *FileService) signURL(id string, ttl time.Duration) *SignedFileURL {
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return &SignedFileURL{
+		URL:       fmt.Sprintf("/api/v1/files/%s/content?expires=%s&signature=%s", id, expires, s.signature(id, expires)),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (s *FileService) signature(id, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(id + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Open 下载自己上传的文件
+func (s *FileService) Open(ctx context.Context, userID, id string) (*FileContent, error) {
+	file, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.content(ctx, file)
+}
+
+// OpenSigned 校验签名链接后下载文件
+func (s *FileService) OpenSigned(ctx context.Context, id, expires, signature string) (*FileContent, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.signature(id, expires))) {
+		return nil, ErrInvalidFileSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidFileSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return nil, ErrFileURLExpired
+	}
+
+	file, err := s.getByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.content(ctx, file)
+}
+
+func (s *FileService) content(ctx context.Context, file *StoredFile) (*FileContent, error) {
+	url, err := s.storage.PresignGet(ctx, file.StorageKey, file.Filename, fileRedirectTTL)
+	if err != nil {
+		return nil, err
+	}
+	if url != "" {
+		return &FileContent{File: file, RedirectURL: url}, nil
+	}
+
+	body, err := s.storage.Open(ctx, file.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	return &FileContent{File: file, Body: body}, nil
+}
+
+// openSource 读取已上传文件的内容，供文档转换等后台任务使用，调用方需要事先校验权限
+func (s *FileService) openSource(ctx context.Context, id string) (io.ReadCloser, error) {
+	file, err := s.getByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.storage.Open(ctx, file.StorageKey)
+}
@@ -0,0 +1,626 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+)
+
+// JobStatus 任务状态
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobRetrying  JobStatus = "retrying" // 失败后等待重试
+	JobSucceeded JobStatus = "succeeded"
+	JobDead      JobStatus = "dead" // 重试次数用完或不可重试的错误，进入死信队列
+)
+
+// 任务队列的Redis键
+const (
+	jobKeyPrefix   = "jobs:job:"
+	jobReadyKey    = "jobs:ready"    // 待执行的任务ID，LPUSH入队、RPOP出队
+	jobDelayedKey  = "jobs:delayed"  // 等待重试的任务，score为下次执行时间
+	jobInflightKey = "jobs:inflight" // 执行中的任务，score为租约到期时间
+	jobDeadKey     = "jobs:dead"     // 死信队列
+)
+
+// 空闲时轮询队列的间隔
+const jobPollInterval = 500 * time.Millisecond
+
+// 任务租约的默认时长和下限，租约每1/3时长续期一次，太短会频繁续期或在续期前过期
+const (
+	defaultJobLease = 60 * time.Second
+	minJobLease     = 6 * time.Second
+)
+
+// 每次从延迟队列和过期租约中转移的最大任务数
+const jobPromoteBatch = 100
+
+// 死信队列保留的最大任务数
+const jobMaxDeadLetters = 10000
+
+var (
+	// ErrJobNotFound 任务不存在、已过期或不属于当前用户
+	ErrJobNotFound = errors.New("任务不存在")
+	// ErrJobQueueUnavailable 未连接Redis
+	ErrJobQueueUnavailable = errors.New("任务队列不可用")
+	// ErrJobNotDead 只能重试死信队列中的任务
+	ErrJobNotDead = errors.New("只能重试死信队列中的任务")
+)
+
+// 出队并登记租约
+var jobDequeueScript = redis.NewScript(`
+local id = redis.call('RPOP', KEYS[1])
+if id then
+	redis.call('ZADD', KEYS[2], ARGV[1], id)
+end
+return id
+`)
+
+// 把到期的任务转回待执行队列
+var jobPromoteScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('LPUSH', KEYS[2], id)
+end
+return #ids
+`)
+
+// Job 队列中的一个任务
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	UserID      string          `json:"user_id,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Status      JobStatus       `json:"status"`
+	Progress    int             `json:"progress"`
+	Message     string          `json:"message,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	NextRunAt   *time.Time      `json:"next_run_at,omitempty"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// FinalAttempt 本次执行失败后是否不再重试
+func (j *Job) FinalAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// DecodePayload 解析任务参数
+func (j *Job) DecodePayload(out interface{}) error {
+	if err := json.Unmarshal(j.Payload, out); err != nil {
+		return PermanentJobError(fmt.Errorf("解析任务参数失败: %w", err))
+	}
+	return nil
+}
+
+// WillRetry 本次执行返回err后任务是否还会重试，处理函数据此决定是否把业务记录标记为失败
+func (j *Job) WillRetry(err error) bool {
+	var permanent *permanentJobError
+	return err != nil && !errors.As(err, &permanent) && !j.FinalAttempt()
+}
+
+// JobProgress 上报任务进度，percent为0~100
+type JobProgress func(percent int, message string)
+
+// JobHandler 执行任务，返回值序列化后保存为任务结果
+//
+// 任务至少执行一次：进程崩溃或租约过期时任务会重新执行，处理函数需要可以重入
+type JobHandler func(ctx context.Context, job *Job, progress JobProgress) (interface{}, error)
+
+// JobOptions 任务类型的执行参数，为0时使用队列的默认值
+type JobOptions struct {
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+type jobRegistration struct {
+	handler JobHandler
+	options JobOptions
+}
+
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentJobError) Unwrap() error {
+	return e.err
+}
+
+// PermanentJobError 标记不需要重试的错误，任务直接进入死信队列
+func PermanentJobError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentJobError{err: err}
+}
+
+// JobQueue 基于Redis的持久化任务队列
+//
+// 任务保存在Redis中，进程重启后继续执行；执行中的任务定期续租，
+// 租约过期（进程崩溃）的任务重新入队。失败的任务按指数退避重试，重试用完后进入死信队列
+type JobQueue struct {
+	redis       *database.RedisClient
+	workers     int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	lease       time.Duration
+	retention   time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]jobRegistration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewJobQueue 创建任务队列，redis为nil时不能入队
+func NewJobQueue(redis *database.RedisClient, cfg *config.Config) *JobQueue {
+	lease := time.Duration(cfg.JobLeaseSeconds) * time.Second
+	if lease <= 0 {
+		lease = defaultJobLease
+	} else if lease < minJobLease {
+		log.Printf("任务租约%v过短，使用最小值%v", lease, minJobLease)
+		lease = minJobLease
+	}
+
+	return &JobQueue{
+		redis:       redis,
+		workers:     cfg.JobWorkers,
+		maxAttempts: cfg.JobMaxAttempts,
+		backoff:     time.Duration(cfg.JobRetryBackoffSeconds) * time.Second,
+		maxBackoff:  time.Duration(cfg.JobMaxBackoffSeconds) * time.Second,
+		lease:       lease,
+		retention:   time.Duration(cfg.JobRetentionHours) * time.Hour,
+		handlers:    make(map[string]jobRegistration),
+	}
+}
+
+// Register 注册任务类型的处理函数
+func (q *JobQueue) Register(jobType string, handler JobHandler, options JobOptions) {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = q.maxAttempts
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = jobRegistration{handler: handler, options: options}
+}
+
+func (q *JobQueue) registration(jobType string) (jobRegistration, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	reg, ok := q.handlers[jobType]
+	return reg, ok
+}
+
+// Enqueue 创建任务并加入队列
+func (q *JobQueue) Enqueue(ctx context.Context, jobType, userID string, payload interface{}) (*Job, error) {
+	if q.redis == nil {
+		return nil, ErrJobQueueUnavailable
+	}
+	reg, ok := q.registration(jobType)
+	if !ok {
+		return nil, fmt.Errorf("未注册的任务类型: %s", jobType)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化任务参数失败: %w", err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:          generateUUID(),
+		Type:        jobType,
+		UserID:      userID,
+		Payload:     data,
+		Status:      JobQueued,
+		MaxAttempts: reg.options.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	record, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, jobKeyPrefix+job.ID, record, 0)
+		pipe.LPush(ctx, jobReadyKey, job.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("任务入队失败: %w", err)
+	}
+	return job, nil
+}
+
+// Get 获取任务，登录用户创建的任务只有本人可以获取，匿名创建的任务凭ID即可获取
+func (q *JobQueue) Get(ctx context.Context, id, userID string) (*Job, error) {
+	if q.redis == nil {
+		return nil, ErrJobQueueUnavailable
+	}
+	job, err := q.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != "" && job.UserID != userID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// DeadJobs 死信队列中最近的任务
+func (q *JobQueue) DeadJobs(ctx context.Context, limit int) ([]*Job, error) {
+	if q.redis == nil {
+		return nil, ErrJobQueueUnavailable
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	ids, err := q.redis.LRange(ctx, jobDeadKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("查询死信队列失败: %w", err)
+	}
+	jobs := []*Job{}
+	for _, id := range ids {
+		job, err := q.load(ctx, id)
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Retry 把死信队列中的任务重新入队，重试次数清零
+func (q *JobQueue) Retry(ctx context.Context, id string) (*Job, error) {
+	if q.redis == nil {
+		return nil, ErrJobQueueUnavailable
+	}
+	job, err := q.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != JobDead {
+		return nil, ErrJobNotDead
+	}
+
+	removed, err := q.redis.LRem(ctx, jobDeadKey, 0, id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("重试任务失败: %w", err)
+	}
+	if removed == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	job.Status = JobQueued
+	job.Attempts = 0
+	job.Progress = 0
+	job.Error = ""
+	job.NextRunAt = nil
+	job.FinishedAt = nil
+	if err := q.commit(ctx, job, func(pipe redis.Pipeliner) {
+		pipe.LPush(ctx, jobReadyKey, job.ID)
+	}); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Start 启动worker和调度循环
+func (q *JobQueue) Start(ctx context.Context) {
+	if q.redis == nil {
+		log.Printf("未连接Redis，任务队列不启动")
+		return
+	}
+	ctx, q.cancel = context.WithCancel(ctx)
+
+	q.wg.Add(1)
+	go q.schedule(ctx)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+// Stop 停止取新任务，取消执行中的任务并等待其返回，被中断的任务重新入队
+func (q *JobQueue) Stop() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+}
+
+// schedule 定期转移到期的任务
+func (q *JobQueue) schedule(ctx context.Context) {
+	defer q.wg.Done()
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		q.promote(ctx)
+	}
+}
+
+// promote 把到期的重试任务和租约过期的任务转回待执行队列
+func (q *JobQueue) promote(ctx context.Context) {
+	now := float64(time.Now().UnixMilli())
+	for _, key := range []string{jobDelayedKey, jobInflightKey} {
+		n, err := jobPromoteScript.Run(ctx, q.redis, []string{key, jobReadyKey}, now, jobPromoteBatch).Int()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("调度任务失败: %v", err)
+			}
+			continue
+		}
+		if key == jobInflightKey && n > 0 {
+			log.Printf("%d个任务租约过期，重新入队", n)
+		}
+	}
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		job, err := q.dequeue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("获取任务失败: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		q.run(ctx, job)
+	}
+}
+
+// dequeue 取出一个任务并登记租约，队列为空时返回nil
+func (q *JobQueue) dequeue(ctx context.Context) (*Job, error) {
+	deadline := time.Now().Add(q.lease).UnixMilli()
+	id, err := jobDequeueScript.Run(ctx, q.redis, []string{jobReadyKey, jobInflightKey}, deadline).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := q.load(ctx, id)
+	if errors.Is(err, ErrJobNotFound) {
+		q.redis.ZRem(ctx, jobInflightKey, id)
+		return nil, nil
+	}
+	return job, err
+}
+
+// run 执行任务并根据结果完成、重试或转入死信队列
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	reg, ok := q.registration(job.Type)
+	if !ok {
+		q.finish(ctx, job, nil, PermanentJobError(fmt.Errorf("未注册的任务类型: %s", job.Type)))
+		return
+	}
+	// 上次执行中进程退出且重试次数已用完
+	if job.Status == JobRunning && job.FinalAttempt() {
+		q.finish(ctx, job, nil, PermanentJobError(fmt.Errorf("任务执行中断，重试次数已用完")))
+		return
+	}
+
+	now := time.Now()
+	job.Attempts++
+	job.Status = JobRunning
+	job.StartedAt = &now
+	job.NextRunAt = nil
+	if err := q.commit(ctx, job, nil); err != nil {
+		log.Printf("更新任务 %s 状态失败: %v", job.ID, err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	if reg.options.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, reg.options.Timeout)
+	}
+	defer cancel()
+
+	// 执行期间续租
+	stopHeartbeat := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ticker.C:
+				deadline := float64(time.Now().Add(q.lease).UnixMilli())
+				q.redis.ZAddXX(context.WithoutCancel(ctx), jobInflightKey, &redis.Z{Score: deadline, Member: job.ID})
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	progress := func(percent int, message string) {
+		if percent < 0 {
+			percent = 0
+		} else if percent > 100 {
+			percent = 100
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		job.Progress = percent
+		job.Message = message
+		if err := q.commit(ctx, job, nil); err != nil {
+			log.Printf("更新任务 %s 进度失败: %v", job.ID, err)
+		}
+	}
+
+	result, err := q.invoke(runCtx, reg.handler, job, progress)
+	close(stopHeartbeat)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 队列停止导致的中断不计入重试次数，放回队首
+	if err != nil && ctx.Err() != nil {
+		job.Attempts--
+		job.Status = JobQueued
+		bg := context.WithoutCancel(ctx)
+		if err := q.commit(bg, job, func(pipe redis.Pipeliner) {
+			pipe.ZRem(bg, jobInflightKey, job.ID)
+			pipe.RPush(bg, jobReadyKey, job.ID)
+		}); err != nil {
+			log.Printf("任务 %s 重新入队失败: %v", job.ID, err)
+		}
+		return
+	}
+	q.finish(ctx, job, result, err)
+}
+
+// invoke 调用处理函数，panic按失败处理
+func (q *JobQueue) invoke(ctx context.Context, handler JobHandler, job *Job, progress JobProgress) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("任务执行panic: %v", r)
+		}
+	}()
+	return handler(ctx, job, progress)
+}
+
+// finish 记录执行结果
+func (q *JobQueue) finish(ctx context.Context, job *Job, result interface{}, err error) {
+	ctx = context.WithoutCancel(ctx)
+	now := time.Now()
+
+	if err == nil {
+		data, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			err = PermanentJobError(fmt.Errorf("序列化任务结果失败: %w", marshalErr))
+		} else {
+			job.Result = data
+			job.Status = JobSucceeded
+			job.Progress = 100
+			job.Error = ""
+			job.FinishedAt = &now
+			if err := q.commit(ctx, job, func(pipe redis.Pipeliner) {
+				pipe.ZRem(ctx, jobInflightKey, job.ID)
+			}); err != nil {
+				log.Printf("保存任务 %s 结果失败: %v", job.ID, err)
+			}
+			return
+		}
+	}
+
+	job.Error = err.Error()
+	if job.WillRetry(err) {
+		next := now.Add(q.backoffFor(job.Attempts))
+		job.Status = JobRetrying
+		job.NextRunAt = &next
+		if err := q.commit(ctx, job, func(pipe redis.Pipeliner) {
+			pipe.ZRem(ctx, jobInflightKey, job.ID)
+			pipe.ZAdd(ctx, jobDelayedKey, &redis.Z{Score: float64(next.UnixMilli()), Member: job.ID})
+		}); err != nil {
+			log.Printf("任务 %s 加入重试队列失败: %v", job.ID, err)
+		}
+		log.Printf("任务 %s (%s) 第%d次执行失败，%s后重试: %v", job.ID, job.Type, job.Attempts, next.Sub(now).Round(time.Second), err)
+		return
+	}
+
+	job.Status = JobDead
+	job.FinishedAt = &now
+	if err := q.commit(ctx, job, func(pipe redis.Pipeliner) {
+		pipe.ZRem(ctx, jobInflightKey, job.ID)
+		pipe.LPush(ctx, jobDeadKey, job.ID)
+		pipe.LTrim(ctx, jobDeadKey, 0, jobMaxDeadLetters-1)
+	}); err != nil {
+		log.Printf("任务 %s 加入死信队列失败: %v", job.ID, err)
+	}
+	log.Printf("任务 %s (%s) 执行%d次后失败，已加入死信队列: %v", job.ID, job.Type, job.Attempts, err)
+}
+
+// backoffFor 第attempt次失败后的等待时间，指数增长并加入最多20%的随机抖动
+func (q *JobQueue) backoffFor(attempt int) time.Duration {
+	delay := q.backoff
+	for i := 1; i < attempt && delay < q.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.maxBackoff {
+		delay = q.maxBackoff
+	}
+	if delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	}
+	return delay
+}
+
+// commit 保存任务，并在同一事务中执行队列操作；已结束的任务保留 JOB_RETENTION_HOURS
+func (q *JobQueue) commit(ctx context.Context, job *Job, ops func(pipe redis.Pipeliner)) error {
+	job.UpdatedAt = time.Now()
+	record, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	var ttl time.Duration
+	if job.Status == JobSucceeded || job.Status == JobDead {
+		ttl = q.retention
+	}
+	_, err = q.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, jobKeyPrefix+job.ID, record, ttl)
+		if ops != nil {
+			ops(pipe)
+		}
+		return nil
+	})
+	return err
+}
+
+func (q *JobQueue) load(ctx context.Context, id string) (*Job, error) {
+	data, err := q.redis.Get(ctx, jobKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("解析任务失败: %w", err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+)
+
+// newTestJobQueue 连接miniredis的任务队列，重试等待1秒、最长4秒
+func newTestJobQueue(t *testing.T) (*JobQueue, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	q := NewJobQueue(&database.RedisClient{Client: client}, &config.Config{
+		JobWorkers:             1,
+		JobMaxAttempts:         3,
+		JobRetryBackoffSeconds: 1,
+		JobMaxBackoffSeconds:   4,
+		JobLeaseSeconds:        60,
+		JobRetentionHours:      1,
+	})
+	return q, mr
+}
+
+// mustDequeue 取出一个任务，队列为空时测试失败
+func mustDequeue(t *testing.T, q *JobQueue) *Job {
+	t.Helper()
+	job, err := q.dequeue(context.Background())
+	if err != nil || job == nil {
+		t.Fatalf("dequeue() = %v, %v, want a job", job, err)
+	}
+	return job
+}
+
+func TestNewJobQueueLease(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    time.Duration
+	}{
+		{0, defaultJobLease},
+		{-5, defaultJobLease},
+		{1, minJobLease},
+		{2, minJobLease},
+		{30, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		q := NewJobQueue(nil, &config.Config{JobLeaseSeconds: tt.seconds})
+		if q.lease != tt.want {
+			t.Errorf("JOB_LEASE_SECONDS=%d lease = %v, want %v", tt.seconds, q.lease, tt.want)
+		}
+		// 续期间隔必须为正，否则NewTicker会panic
+		if q.lease/3 <= 0 {
+			t.Errorf("JOB_LEASE_SECONDS=%d renew interval = %v", tt.seconds, q.lease/3)
+		}
+	}
+}
+
+func TestJobQueueEnqueueDequeue(t *testing.T) {
+	q, mr := newTestJobQueue(t)
+	ctx := context.Background()
+	q.Register("echo", func(ctx context.Context, job *Job, progress JobProgress) (interface{}, error) {
+		var payload map[string]string
+		if err := job.DecodePayload(&payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}, JobOptions{})
+
+	if _, err := q.Enqueue(ctx, "missing", "", nil); err == nil {
+		t.Error("Enqueue() of an unregistered type succeeded")
+	}
+	first, err := q.Enqueue(ctx, "echo", "user-1", map[string]string{"n": "1"})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	second, _ := q.Enqueue(ctx, "echo", "user-1", map[string]string{"n": "2"})
+	if first.Status != JobQueued || first.MaxAttempts != 3 {
+		t.Errorf("job = %+v", first)
+	}
+
+	// 先进先出，出队时登记租约
+	job := mustDequeue(t, q)
+	if job.ID != first.ID {
+		t.Errorf("dequeued %s, want %s", job.ID, first.ID)
+	}
+	if _, err := mr.ZScore(jobInflightKey, first.ID); err != nil {
+		t.Errorf("job not leased: %v", err)
+	}
+
+	q.run(ctx, job)
+	got, err := q.Get(ctx, first.ID, "user-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Status != JobSucceeded || got.Attempts != 1 || got.Progress != 100 || string(got.Result) != `{"n":"1"}` {
+		t.Errorf("finished job = %+v", got)
+	}
+	if mr.Exists(jobInflightKey) {
+		t.Error("lease not released after success")
+	}
+	if ttl := mr.TTL(jobKeyPrefix + first.ID); ttl != time.Hour {
+		t.Errorf("finished job ttl = %v, want 1h", ttl)
+	}
+
+	// 其他用户看不到任务
+	if _, err := q.Get(ctx, first.ID, "user-2"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Get() by another user error = %v, want ErrJobNotFound", err)
+	}
+
+	if job := mustDequeue(t, q); job.ID != second.ID {
+		t.Errorf("dequeued %s, want %s", job.ID, second.ID)
+	}
+	if job, err := q.dequeue(ctx); job != nil || err != nil {
+		t.Errorf("dequeue() on empty queue = %v, %v", job, err)
+	}
+}
+
+func TestJobQueueLeaseExpiry(t *testing.T) {
+	q, _ := newTestJobQueue(t)
+	ctx := context.Background()
+	q.Register("slow", func(context.Context, *Job, JobProgress) (interface{}, error) { return nil, nil }, JobOptions{})
+	q.lease = 50 * time.Millisecond
+
+	enqueued, _ := q.Enqueue(ctx, "slow", "", nil)
+	mustDequeue(t, q)
+
+	// 租约未过期时不会重新投递
+	q.promote(ctx)
+	if job, _ := q.dequeue(ctx); job != nil {
+		t.Fatalf("job redelivered before the lease expired")
+	}
+
+	// 模拟worker崩溃：不执行也不续租，租约过期后重新投递
+	time.Sleep(80 * time.Millisecond)
+	q.promote(ctx)
+	job := mustDequeue(t, q)
+	if job.ID != enqueued.ID {
+		t.Errorf("redelivered %s, want %s", job.ID, enqueued.ID)
+	}
+}
+
+func TestJobQueueRetryBackoff(t *testing.T) {
+	q, mr := newTestJobQueue(t)
+	ctx := context.Background()
+	q.Register("flaky", func(context.Context, *Job, JobProgress) (interface{}, error) {
+		return nil, errors.New("暂时失败")
+	}, JobOptions{})
+
+	enqueued, _ := q.Enqueue(ctx, "flaky", "", nil)
+	wantDelays := []time.Duration{time.Second, 2 * time.Second}
+	for attempt, want := range wantDelays {
+		job := mustDequeue(t, q)
+		before := time.Now()
+		q.run(ctx, job)
+
+		got, _ := q.Get(ctx, enqueued.ID, "")
+		if got.Status != JobRetrying || got.Attempts != attempt+1 || got.Error != "暂时失败" || got.NextRunAt == nil {
+			t.Fatalf("attempt %d job = %+v", attempt+1, got)
+		}
+		// 指数退避，最多20%抖动
+		delay := got.NextRunAt.Sub(before)
+		if delay < want-50*time.Millisecond || delay > want+want/5+50*time.Millisecond {
+			t.Errorf("attempt %d retry delay = %v, want %v~%v", attempt+1, delay, want, want+want/5)
+		}
+		if score, err := mr.ZScore(jobDelayedKey, enqueued.ID); err != nil || int64(score) != got.NextRunAt.UnixMilli() {
+			t.Errorf("delayed score = %v, %v", score, err)
+		}
+
+		// 未到重试时间不会执行
+		q.promote(ctx)
+		if job, _ := q.dequeue(ctx); job != nil {
+			t.Fatalf("attempt %d retried before the backoff", attempt+1)
+		}
+		mr.ZAdd(jobDelayedKey, 0, enqueued.ID)
+		q.promote(ctx)
+	}
+
+	// 重试次数用完后进入死信队列
+	q.run(ctx, mustDequeue(t, q))
+	got, _ := q.Get(ctx, enqueued.ID, "")
+	if got.Status != JobDead || got.Attempts != 3 {
+		t.Errorf("exhausted job = %+v", got)
+	}
+	if mr.Exists(jobDelayedKey) {
+		t.Error("exhausted job left in the delayed queue")
+	}
+}
+
+func TestJobQueueBackoffFor(t *testing.T) {
+	q := NewJobQueue(nil, &config.Config{JobRetryBackoffSeconds: 10, JobMaxBackoffSeconds: 60})
+	for attempt, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 60 * time.Second, 60 * time.Second} {
+		got := q.backoffFor(attempt + 1)
+		if got < want || got > want+want/5 {
+			t.Errorf("backoffFor(%d) = %v, want %v~%v", attempt+1, got, want, want+want/5)
+		}
+	}
+}
+
+func TestJobQueuePermanentError(t *testing.T) {
+	q, mr := newTestJobQueue(t)
+	ctx := context.Background()
+	q.Register("broken", func(context.Context, *Job, JobProgress) (interface{}, error) {
+		return nil, PermanentJobError(errors.New("参数错误"))
+	}, JobOptions{})
+
+	enqueued, _ := q.Enqueue(ctx, "broken", "", nil)
+	q.run(ctx, mustDequeue(t, q))
+
+	// 不可重试的错误第一次失败就进入死信队列
+	got, _ := q.Get(ctx, enqueued.ID, "")
+	if got.Status != JobDead || got.Attempts != 1 || got.Error != "参数错误" || got.FinishedAt == nil {
+		t.Errorf("job = %+v", got)
+	}
+	if mr.Exists(jobDelayedKey) || mr.Exists(jobInflightKey) {
+		t.Error("dead job left in the delayed or inflight queue")
+	}
+	dead, err := q.DeadJobs(ctx, 10)
+	if err != nil || len(dead) != 1 || dead[0].ID != enqueued.ID {
+		t.Fatalf("DeadJobs() = %v, %v", dead, err)
+	}
+
+	// 手动重试清零重试次数并重新入队
+	if _, err := q.Retry(ctx, enqueued.ID); err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	job := mustDequeue(t, q)
+	if job.Status != JobQueued || job.Attempts != 0 || job.Error != "" {
+		t.Errorf("retried job = %+v", job)
+	}
+	if _, err := q.Retry(ctx, enqueued.ID); !errors.Is(err, ErrJobNotDead) {
+		t.Errorf("Retry() of a queued job error = %v, want ErrJobNotDead", err)
+	}
+}
+
+func TestJobQueueProgress(t *testing.T) {
+	q, _ := newTestJobQueue(t)
+	ctx := context.Background()
+
+	var seen []*Job
+	q.Register("report", func(ctx context.Context, job *Job, progress JobProgress) (interface{}, error) {
+		for _, p := range []struct {
+			percent int
+			message string
+		}{{-5, "开始"}, {40, "处理中"}, {150, "收尾"}} {
+			progress(p.percent, p.message)
+			stored, err := q.Get(ctx, job.ID, "")
+			if err != nil {
+				return nil, err
+			}
+			seen = append(seen, stored)
+		}
+		return nil, nil
+	}, JobOptions{})
+
+	enqueued, _ := q.Enqueue(ctx, "report", "", nil)
+	q.run(ctx, mustDequeue(t, q))
+
+	// 进度限制在0~100，并立即保存
+	want := []struct {
+		progress int
+		message  string
+	}{{0, "开始"}, {40, "处理中"}, {100, "收尾"}}
+	if len(seen) != len(want) {
+		t.Fatalf("progress updates = %d, want %d", len(seen), len(want))
+	}
+	for i, w := range want {
+		if seen[i].Status != JobRunning || seen[i].Progress != w.progress || seen[i].Message != w.message {
+			t.Errorf("update %d = %d %q (%s), want %d %q", i, seen[i].Progress, seen[i].Message, seen[i].Status, w.progress, w.message)
+		}
+	}
+	if got, _ := q.Get(ctx, enqueued.ID, ""); got.Status != JobSucceeded || got.Progress != 100 {
+		t.Errorf("finished job = %+v", got)
+	}
+}
@@ -22,7 +22,8 @@ func NewMembershipService(db *database.DB) *MembershipService {
 // GetPlans 获取会员计划列表
 func (s *MembershipService) GetPlans() ([]models.MembershipPlan, error) {
 	query := `
-		SELECT id, name, description, price, currency, duration, max_apps, features, is_active
+		SELECT id, name, description, price, currency, duration, max_apps, features, is_active,
+			ai_daily_token_quota, ai_monthly_token_quota
 		FROM membership_plans
 		WHERE is_active = TRUE
 		ORDER BY price ASC
@@ -41,6 +42,7 @@ func (s *MembershipService) GetPlans() ([]models.MembershipPlan, error) {
 		err := rows.Scan(
 			&plan.ID, &plan.Name, &plan.Description, &plan.Price, &plan.Currency,
 			&plan.Duration, &plan.MaxApps, &featuresJSON, &plan.IsActive,
+			&plan.AIDailyTokenQuota, &plan.AIMonthlyTokenQuota,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan membership plan: %w", err)
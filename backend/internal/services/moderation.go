@@ -0,0 +1,996 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+)
+
+//go:embed moderation/rules.yaml
+var builtinModerationRules embed.FS
+
+// ModerationAction 审核的处理方式，按严重程度递增
+type ModerationAction string
+
+const (
+	ModerationAllow  ModerationAction = "allow"  // 放行
+	ModerationFlag   ModerationAction = "flag"   // 放行并标记
+	ModerationRedact ModerationAction = "redact" // 打码命中的内容后放行
+	ModerationBlock  ModerationAction = "block"  // 拒绝
+)
+
+var moderationActionRank = map[ModerationAction]int{
+	ModerationAllow:  0,
+	ModerationFlag:   1,
+	ModerationRedact: 2,
+	ModerationBlock:  3,
+}
+
+// ParseModerationAction 解析处理方式
+func ParseModerationAction(value string) (ModerationAction, error) {
+	action := ModerationAction(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := moderationActionRank[action]; !ok {
+		return "", fmt.Errorf("未知的审核处理方式: %s", value)
+	}
+	return action, nil
+}
+
+// 审核内容的方向
+const (
+	ModerationDirectionInput  = "input"
+	ModerationDirectionOutput = "output"
+)
+
+// 审核内容的来源
+const (
+	ModerationSourceAI             = "ai"
+	ModerationSourceSocialHub      = "social-hub"
+	ModerationSourceCreativeStudio = "creative-studio"
+)
+
+// 申诉状态
+const (
+	ModerationAppealNone       = "none"
+	ModerationAppealPending    = "pending"
+	ModerationAppealUpheld     = "upheld"     // 维持原决定
+	ModerationAppealOverturned = "overturned" // 撤销原决定
+)
+
+// 分类器命中的类别没有配置处理方式时按标记处理
+const moderationClassifierAction = ModerationFlag
+
+// 送给分类器的最大字数
+const moderationClassifierMaxRunes = 4000
+
+// 打码的默认替换文本
+const moderationDefaultReplacement = "***"
+
+// 分类器调用失败且 MODERATION_CLASSIFIER_FAIL_CLOSED 时拒绝内容使用的类别
+const moderationUnreviewedCategory = "unreviewed"
+
+// 流式审核每次回看的最大字数，规则可能匹配任意长度时使用
+const moderationStreamMaxWindow = 256
+
+var (
+	// ErrModerationAuditNotFound 审核记录不存在或不属于当前用户
+	ErrModerationAuditNotFound = errors.New("审核记录不存在")
+	// ErrModerationAppealNotAllowed 放行的内容、已申诉或已处理的记录不能再申诉
+	ErrModerationAppealNotAllowed = errors.New("该审核记录不能申诉")
+	// ErrModerationAppealNotPending 只能处理待处理的申诉
+	ErrModerationAppealNotPending = errors.New("申诉不在待处理状态")
+)
+
+// ModerationError 内容未通过审核
+type ModerationError struct {
+	Direction  string   `json:"direction"`
+	Categories []string `json:"categories"`
+	AuditID    string   `json:"audit_id,omitempty"`
+}
+
+func (e *ModerationError) Error() string {
+	subject := "输入内容"
+	if e.Direction == ModerationDirectionOutput {
+		subject = "生成内容"
+	}
+	return fmt.Sprintf("%s未通过审核: %s", subject, strings.Join(e.Categories, ", "))
+}
+
+// ModerationRule 关键词和正则规则，keywords不区分大小写
+type ModerationRule struct {
+	Name        string           `yaml:"name" json:"name"`
+	Category    string           `yaml:"category" json:"category"`
+	Action      ModerationAction `yaml:"action" json:"action"`
+	Keywords    []string         `yaml:"keywords" json:"keywords,omitempty"`
+	Patterns    []string         `yaml:"patterns" json:"patterns,omitempty"`
+	Replacement string           `yaml:"replacement" json:"replacement,omitempty"`
+
+	res      []*regexp.Regexp
+	maxRunes int // 命中文本的最大字数，-1表示不限
+}
+
+type moderationRulesFile struct {
+	Rules []*ModerationRule `yaml:"rules"`
+}
+
+// compile 校验规则并编译关键词和正则
+func (r *ModerationRule) compile() error {
+	if r.Name == "" || r.Category == "" {
+		return fmt.Errorf("审核规则缺少name或category")
+	}
+	action, err := ParseModerationAction(string(r.Action))
+	if err != nil {
+		return fmt.Errorf("审核规则 %s: %w", r.Name, err)
+	}
+	r.Action = action
+	if r.Replacement == "" {
+		r.Replacement = moderationDefaultReplacement
+	}
+
+	r.res = nil
+	r.maxRunes = 0
+	var keywords []string
+	for _, keyword := range r.Keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, regexp.QuoteMeta(keyword))
+			r.maxRunes = maxRuneLength(r.maxRunes, utf8.RuneCountInString(keyword))
+		}
+	}
+	if len(keywords) > 0 {
+		r.res = append(r.res, regexp.MustCompile("(?i)"+strings.Join(keywords, "|")))
+	}
+	for _, pattern := range r.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("审核规则 %s 的正则不合法: %w", r.Name, err)
+		}
+		r.res = append(r.res, re)
+		parsed, err := syntax.Parse(pattern, syntax.Perl)
+		if err != nil {
+			return fmt.Errorf("审核规则 %s 的正则不合法: %w", r.Name, err)
+		}
+		r.maxRunes = maxRuneLength(r.maxRunes, regexpMaxRunes(parsed))
+	}
+	return nil
+}
+
+// regexpMaxRunes 正则能匹配的最大字数，-1表示不限
+func regexpMaxRunes(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpQuest:
+		return regexpMaxRunes(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		return -1
+	case syntax.OpRepeat:
+		n := regexpMaxRunes(re.Sub[0])
+		if re.Max < 0 || n < 0 {
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			n := regexpMaxRunes(sub)
+			if n < 0 {
+				return -1
+			}
+			total += n
+		}
+		return total
+	case syntax.OpAlternate:
+		longest := 0
+		for _, sub := range re.Sub {
+			longest = maxRuneLength(longest, regexpMaxRunes(sub))
+		}
+		return longest
+	default:
+		// 空匹配和 ^ $ \b 等断言不占字数
+		return 0
+	}
+}
+
+// maxRuneLength 取较大的字数，-1表示不限
+func maxRuneLength(a, b int) int {
+	if a < 0 || b < 0 {
+		return -1
+	}
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// ModerationMatch 命中的一条规则或分类器给出的类别
+type ModerationMatch struct {
+	Rule     string           `json:"rule"` // 分类器命中时为 classifier
+	Category string           `json:"category"`
+	Action   ModerationAction `json:"action"`
+	Text     string           `json:"text,omitempty"`
+	Score    float64          `json:"score,omitempty"`
+
+	start       int
+	end         int
+	replacement string
+}
+
+// ModerationInput 待审核的内容
+type ModerationInput struct {
+	UserID    string
+	Source    string
+	Feature   string
+	Direction string
+	Text      string
+}
+
+// ModerationResult 审核结果，Text为处理后的内容
+type ModerationResult struct {
+	Action     ModerationAction  `json:"action"`
+	Categories []string          `json:"categories"`
+	Matches    []ModerationMatch `json:"matches"`
+	Classified bool              `json:"classified"` // 是否经过分类器
+	AuditID    string            `json:"audit_id,omitempty"`
+	Text       string            `json:"-"`
+}
+
+// ModerationAudit 审核记录，放行的内容只保存哈希
+type ModerationAudit struct {
+	ID           string            `json:"id"`
+	UserID       string            `json:"user_id,omitempty"`
+	Source       string            `json:"source"`
+	Feature      string            `json:"feature,omitempty"`
+	Direction    string            `json:"direction"`
+	Action       ModerationAction  `json:"action"`
+	Categories   []string          `json:"categories"`
+	Matches      []ModerationMatch `json:"matches"`
+	Content      string            `json:"content,omitempty"`
+	ContentHash  string            `json:"content_hash"`
+	Classified   bool              `json:"classified"`
+	AppealStatus string            `json:"appeal_status"`
+	AppealReason string            `json:"appeal_reason,omitempty"`
+	AppealedAt   *time.Time        `json:"appealed_at,omitempty"`
+	ReviewedBy   string            `json:"reviewed_by,omitempty"`
+	ReviewNote   string            `json:"review_note,omitempty"`
+	ReviewedAt   *time.Time        `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// ModerationAuditFilter 审核记录查询条件，空字段不过滤
+type ModerationAuditFilter struct {
+	UserID       string
+	Source       string
+	Action       string
+	AppealStatus string
+	Page         int
+	PerPage      int
+}
+
+// ModerationService 内容审核
+//
+// 关键词和正则规则离线执行；开启分类器时，规则没有拒绝的内容再交给模型判断类别。
+// 每次审核的结果都写入 moderation_audits，用户可以对被拒绝、打码或标记的记录申诉
+type ModerationService struct {
+	db         *database.DB
+	ai         *AIClientManager
+	enabled    bool
+	classifier bool
+	failClosed bool
+	minScore   float64
+	rules      []*ModerationRule
+	actions    map[string]ModerationAction
+	window     int // 流式审核回看的字数
+}
+
+// NewModerationService 创建内容审核服务，db为nil时不记录审核结果，ai为nil时不使用分类器
+func NewModerationService(db *database.DB, ai *AIClientManager, cfg *config.Config) *ModerationService {
+	rules, err := LoadModerationRules(cfg.ModerationRulesFile)
+	if err != nil {
+		log.Printf("加载审核规则失败，仅使用内置规则: %v", err)
+	}
+
+	actions := make(map[string]ModerationAction)
+	for _, item := range cfg.ModerationActions {
+		category, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		action, err := ParseModerationAction(value)
+		if err != nil {
+			log.Printf("MODERATION_ACTIONS配置错误: %v", err)
+			continue
+		}
+		actions[strings.TrimSpace(category)] = action
+	}
+
+	return &ModerationService{
+		db:         db,
+		ai:         ai,
+		enabled:    cfg.ModerationEnabled,
+		classifier: cfg.ModerationClassifierEnabled && ai != nil,
+		failClosed: cfg.ModerationClassifierFailClosed,
+		minScore:   cfg.ModerationClassifierMinScore,
+		rules:      rules,
+		actions:    actions,
+		window:     moderationStreamWindow(rules),
+	}
+}
+
+// moderationStreamWindow 最长规则的字数，不超过 moderationStreamMaxWindow
+func moderationStreamWindow(rules []*ModerationRule) int {
+	window := 0
+	for _, rule := range rules {
+		window = maxRuneLength(window, rule.maxRunes)
+	}
+	if window < 0 || window > moderationStreamMaxWindow {
+		return moderationStreamMaxWindow
+	}
+	return window
+}
+
+// LoadModerationRules 加载内置审核规则，path不为空时合并文件中的规则
+//
+// 文件中与内置规则同名的条目替换内置规则，其余追加
+func LoadModerationRules(path string) ([]*ModerationRule, error) {
+	data, err := builtinModerationRules.ReadFile("moderation/rules.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("读取内置审核规则失败: %w", err)
+	}
+	rules, err := parseModerationRules(data)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return rules, nil
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return rules, fmt.Errorf("读取审核规则文件失败: %w", err)
+	}
+	overrides, err := parseModerationRules(data)
+	if err != nil {
+		return rules, err
+	}
+
+	index := make(map[string]int, len(rules))
+	for i, rule := range rules {
+		index[rule.Name] = i
+	}
+	for _, rule := range overrides {
+		if i, ok := index[rule.Name]; ok {
+			rules[i] = rule
+			continue
+		}
+		index[rule.Name] = len(rules)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseModerationRules(data []byte) ([]*ModerationRule, error) {
+	var file moderationRulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析审核规则失败: %w", err)
+	}
+	for _, rule := range file.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return file.Rules, nil
+}
+
+// Rules 当前生效的规则
+func (s *ModerationService) Rules() []*ModerationRule {
+	return append([]*ModerationRule{}, s.rules...)
+}
+
+// Categories 规则和配置中出现的所有类别
+func (s *ModerationService) Categories() []string {
+	seen := make(map[string]bool)
+	var categories []string
+	add := func(category string) {
+		if !seen[category] {
+			seen[category] = true
+			categories = append(categories, category)
+		}
+	}
+	for _, rule := range s.rules {
+		add(rule.Category)
+	}
+	for category := range s.actions {
+		add(category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Check 审核内容并记录结果，被拒绝时返回 *ModerationError
+func (s *ModerationService) Check(ctx context.Context, in ModerationInput) (*ModerationResult, error) {
+	result := &ModerationResult{Action: ModerationAllow, Categories: []string{}, Matches: []ModerationMatch{}, Text: in.Text}
+	if !s.enabled || strings.TrimSpace(in.Text) == "" {
+		return result, nil
+	}
+
+	result.Matches = append(result.Matches, s.match(in.Text)...)
+	if s.classifier && !hasModerationAction(result.Matches, ModerationBlock) {
+		matches, err := s.classify(ctx, in.Text)
+		if err != nil && s.failClosed {
+			// 无法确认内容安全时拒绝，记录后可以申诉人工复核
+			log.Printf("内容审核分类失败，拒绝内容: %v", err)
+			result.Matches = append(result.Matches, ModerationMatch{
+				Rule:     "classifier",
+				Category: moderationUnreviewedCategory,
+				Action:   ModerationBlock,
+			})
+		} else if err != nil {
+			// 分类器不可用时仍以规则的结果为准
+			log.Printf("内容审核分类失败，仅使用规则审核: %v", err)
+		} else {
+			result.Matches = append(result.Matches, matches...)
+			result.Classified = true
+		}
+	}
+	s.decide(result)
+
+	auditID, err := s.audit(ctx, in, result)
+	if err != nil {
+		log.Printf("记录审核结果失败: %v", err)
+	}
+	result.AuditID = auditID
+
+	if result.Action == ModerationBlock {
+		return result, &ModerationError{Direction: in.Direction, Categories: result.Categories, AuditID: auditID}
+	}
+	return result, nil
+}
+
+// match 执行关键词和正则规则
+func (s *ModerationService) match(text string) []ModerationMatch {
+	var matches []ModerationMatch
+	for _, rule := range s.rules {
+		action := s.categoryAction(rule.Category, rule.Action)
+		for _, re := range rule.res {
+			for _, loc := range re.FindAllStringIndex(text, -1) {
+				if loc[0] == loc[1] {
+					continue
+				}
+				matches = append(matches, ModerationMatch{
+					Rule:        rule.Name,
+					Category:    rule.Category,
+					Action:      action,
+					Text:        text[loc[0]:loc[1]],
+					start:       loc[0],
+					end:         loc[1],
+					replacement: rule.Replacement,
+				})
+			}
+		}
+	}
+	return matches
+}
+
+// matchTail 只对text中from之后新增的内容执行规则
+//
+// 回看from之前最长规则字数的内容，只返回结束位置在新增内容中的命中。
+// 多回看一个字作为 ^ 和 \b 等断言的上下文，从该字开始的命中不计入
+func (s *ModerationService) matchTail(text string, from int) []ModerationMatch {
+	start := from
+	for n := 0; n < s.window && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+
+	var matches []ModerationMatch
+	for _, m := range s.match(text[start:]) {
+		if start+m.end <= from || (start > 0 && m.start == 0) {
+			continue
+		}
+		m.start += start
+		m.end += start
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// Redact 只按规则打码文本，不记录审核结果，用于审核多个字段拼接后的内容后分别打码
+func (s *ModerationService) Redact(text string) string {
+	if !s.enabled {
+		return text
+	}
+	return redactModerationMatches(text, s.match(text))
+}
+
+// categoryAction 类别的处理方式，MODERATION_ACTIONS 中的配置优先
+func (s *ModerationService) categoryAction(category string, fallback ModerationAction) ModerationAction {
+	if action, ok := s.actions[category]; ok {
+		return action
+	}
+	return fallback
+}
+
+type moderationVerdict struct {
+	Categories []moderationVerdictItem `json:"categories"`
+}
+
+type moderationVerdictItem struct {
+	Category string  `json:"category"`
+	Score    float64 `json:"score" jsonschema:"minimum=0,maximum=1"`
+}
+
+// classify 由模型判断内容所属类别，分类器无法定位命中的文本，redact按flag处理
+func (s *ModerationService) classify(ctx context.Context, text string) ([]ModerationMatch, error) {
+	ctx = WithAIFeature(withoutModeration(ctx), AIFeatureModeration)
+	tpl, err := s.ai.selectPrompt(ctx, PromptModerationClassify)
+	if err != nil {
+		return nil, err
+	}
+	req, err := tpl.Render(map[string]interface{}{
+		"text":       truncateRunes(text, moderationClassifierMaxRunes),
+		"categories": strings.Join(s.Categories(), ", "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var verdict moderationVerdict
+	if _, err := s.ai.GenerateStructured(ctx, req, nil, &verdict); err != nil {
+		return nil, err
+	}
+
+	var matches []ModerationMatch
+	for _, item := range verdict.Categories {
+		category := strings.ToLower(strings.TrimSpace(item.Category))
+		if category == "" || item.Score < s.minScore {
+			continue
+		}
+		action := s.categoryAction(category, moderationClassifierAction)
+		if action == ModerationRedact {
+			action = ModerationFlag
+		}
+		matches = append(matches, ModerationMatch{
+			Rule:     "classifier",
+			Category: category,
+			Action:   action,
+			Score:    item.Score,
+		})
+	}
+	return matches, nil
+}
+
+// decide 取命中项中最严重的处理方式，redact时打码对应的文本
+func (s *ModerationService) decide(result *ModerationResult) {
+	seen := make(map[string]bool)
+	for _, m := range result.Matches {
+		if moderationActionRank[m.Action] > moderationActionRank[result.Action] {
+			result.Action = m.Action
+		}
+		if m.Action != ModerationAllow && !seen[m.Category] {
+			seen[m.Category] = true
+			result.Categories = append(result.Categories, m.Category)
+		}
+	}
+	if result.Action == ModerationRedact {
+		result.Text = redactModerationMatches(result.Text, result.Matches)
+	}
+}
+
+// redactModerationMatches 替换处理方式为redact的命中文本，重叠的命中只替换一次
+func redactModerationMatches(text string, matches []ModerationMatch) string {
+	var spans []ModerationMatch
+	for _, m := range matches {
+		if m.Action == ModerationRedact && m.end > m.start {
+			spans = append(spans, m)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	var b strings.Builder
+	pos := 0
+	for _, span := range spans {
+		if span.start < pos {
+			if span.end > pos {
+				pos = span.end
+			}
+			continue
+		}
+		b.WriteString(text[pos:span.start])
+		b.WriteString(span.replacement)
+		pos = span.end
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+func hasModerationAction(matches []ModerationMatch, action ModerationAction) bool {
+	for _, m := range matches {
+		if m.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// audit 写入审核记录，返回记录ID
+func (s *ModerationService) audit(ctx context.Context, in ModerationInput, result *ModerationResult) (string, error) {
+	if s.db == nil {
+		return "", nil
+	}
+
+	sum := sha256.Sum256([]byte(in.Text))
+	var userID, content interface{}
+	if in.UserID != "" {
+		userID = in.UserID
+	}
+	if result.Action != ModerationAllow {
+		content = in.Text
+	}
+	matches, err := json.Marshal(result.Matches)
+	if err != nil {
+		return "", fmt.Errorf("序列化审核结果失败: %w", err)
+	}
+
+	id := generateUUID()
+	_, err = s.db.ExecContext(context.WithoutCancel(ctx), `
+		INSERT INTO moderation_audits (id, user_id, source, feature, direction, action, categories,
+			matches, content, content_hash, classified, appeal_status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+	`, id, userID, in.Source, in.Feature, in.Direction, string(result.Action), pq.Array(result.Categories),
+		string(matches), content, hex.EncodeToString(sum[:]), result.Classified, ModerationAppealNone)
+	if err != nil {
+		return "", fmt.Errorf("写入审核记录失败: %w", err)
+	}
+	return id, nil
+}
+
+const moderationAuditColumns = `id, user_id, source, feature, direction, action, categories, matches, content,
+	content_hash, classified, appeal_status, appeal_reason, appealed_at, reviewed_by, review_note, reviewed_at, created_at`
+
+func scanModerationAudit(scanner interface{ Scan(...interface{}) error }) (*ModerationAudit, error) {
+	var audit ModerationAudit
+	var userID, feature, content, appealReason, reviewedBy, reviewNote sql.NullString
+	var appealedAt, reviewedAt sql.NullTime
+	var action string
+	var matches []byte
+	err := scanner.Scan(&audit.ID, &userID, &audit.Source, &feature, &audit.Direction, &action,
+		pq.Array(&audit.Categories), &matches, &content, &audit.ContentHash, &audit.Classified,
+		&audit.AppealStatus, &appealReason, &appealedAt, &reviewedBy, &reviewNote, &reviewedAt, &audit.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.UserID = userID.String
+	audit.Feature = feature.String
+	audit.Action = ModerationAction(action)
+	audit.Content = content.String
+	audit.AppealReason = appealReason.String
+	audit.ReviewedBy = reviewedBy.String
+	audit.ReviewNote = reviewNote.String
+	if appealedAt.Valid {
+		audit.AppealedAt = &appealedAt.Time
+	}
+	if reviewedAt.Valid {
+		audit.ReviewedAt = &reviewedAt.Time
+	}
+	if audit.Categories == nil {
+		audit.Categories = []string{}
+	}
+	audit.Matches = []ModerationMatch{}
+	if len(matches) > 0 {
+		if err := json.Unmarshal(matches, &audit.Matches); err != nil {
+			return nil, fmt.Errorf("解析审核结果失败: %w", err)
+		}
+	}
+	return &audit, nil
+}
+
+// ListAudits 分页查询审核记录，按时间倒序
+func (s *ModerationService) ListAudits(ctx context.Context, filter ModerationAuditFilter) ([]ModerationAudit, int, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PerPage < 1 || filter.PerPage > 100 {
+		filter.PerPage = 20
+	}
+
+	var conditions []string
+	var args []interface{}
+	add := func(column, value string) {
+		if value != "" {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+		}
+	}
+	add("user_id", filter.UserID)
+	add("source", filter.Source)
+	add("action", filter.Action)
+	add("appeal_status", filter.AppealStatus)
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM moderation_audits "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询审核记录失败: %w", err)
+	}
+
+	args = append(args, filter.PerPage, (filter.Page-1)*filter.PerPage)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM moderation_audits %s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, moderationAuditColumns, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询审核记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	audits := []ModerationAudit{}
+	for rows.Next() {
+		audit, err := scanModerationAudit(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取审核记录失败: %w", err)
+		}
+		audits = append(audits, *audit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("查询审核记录失败: %w", err)
+	}
+	return audits, total, nil
+}
+
+// GetAudit 获取审核记录，userID不为空时只能获取自己的记录
+func (s *ModerationService) GetAudit(ctx context.Context, userID, auditID string) (*ModerationAudit, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+moderationAuditColumns+` FROM moderation_audits
+		WHERE id = $1 AND ($2 = '' OR user_id::text = $2)
+	`, auditID, userID)
+	audit, err := scanModerationAudit(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrModerationAuditNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询审核记录失败: %w", err)
+	}
+	return audit, nil
+}
+
+// Appeal 用户对自己被拒绝、打码或标记的记录提出申诉，每条记录只能申诉一次
+func (s *ModerationService) Appeal(ctx context.Context, userID, auditID, reason string) (*ModerationAudit, error) {
+	audit, err := s.GetAudit(ctx, userID, auditID)
+	if err != nil {
+		return nil, err
+	}
+	if audit.Action == ModerationAllow || audit.AppealStatus != ModerationAppealNone {
+		return nil, ErrModerationAppealNotAllowed
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE moderation_audits
+		SET appeal_status = $1, appeal_reason = $2, appealed_at = NOW()
+		WHERE id = $3 AND appeal_status = $4
+	`, ModerationAppealPending, reason, auditID, ModerationAppealNone)
+	if err != nil {
+		return nil, fmt.Errorf("提交申诉失败: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrModerationAppealNotAllowed
+	}
+	return s.GetAudit(ctx, userID, auditID)
+}
+
+// ReviewAppeal 管理员处理申诉，decision为 upheld 或 overturned，处理结果通知申诉人
+func (s *ModerationService) ReviewAppeal(ctx context.Context, reviewerID, auditID, decision, note string) (*ModerationAudit, error) {
+	if decision != ModerationAppealUpheld && decision != ModerationAppealOverturned {
+		return nil, fmt.Errorf("未知的申诉处理结果: %s", decision)
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE moderation_audits
+		SET appeal_status = $1, review_note = $2, reviewed_by = $3, reviewed_at = NOW()
+		WHERE id = $4 AND appeal_status = $5
+	`, decision, note, reviewerID, auditID, ModerationAppealPending)
+	if err != nil {
+		return nil, fmt.Errorf("处理申诉失败: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := s.GetAudit(ctx, "", auditID); err != nil {
+			return nil, err
+		}
+		return nil, ErrModerationAppealNotPending
+	}
+
+	audit, err := s.GetAudit(ctx, "", auditID)
+	if err != nil {
+		return nil, err
+	}
+	if audit.UserID != "" {
+		title := "内容审核申诉已处理"
+		content := "您的申诉未通过，维持原审核结果。"
+		if decision == ModerationAppealOverturned {
+			content = "您的申诉已通过，原审核结果已撤销。"
+		}
+		if note != "" {
+			content += "说明：" + note
+		}
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO notifications (id, user_id, title, content, type, created_at)
+			VALUES ($1, $2, $3, $4, 'system', NOW())
+		`, generateUUID(), audit.UserID, title, content)
+		if err != nil {
+			log.Printf("发送申诉结果通知失败: %v", err)
+		}
+	}
+	return audit, nil
+}
+
+type moderationSkipKey struct{}
+
+// withoutModeration 标记ctx中的AI调用不需要审核（分类器自身的调用）
+func withoutModeration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, moderationSkipKey{}, true)
+}
+
+func moderationSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(moderationSkipKey{}).(bool)
+	return skip
+}
+
+// Moderation 内容审核服务
+func (m *AIClientManager) Moderation() *ModerationService {
+	return m.moderation
+}
+
+// moderateRequest 审核最后一条用户消息，打码时返回替换后的请求副本
+//
+// 多轮对话和工具调用中之前的消息已经审核过，不再重复审核
+func (m *AIClientManager) moderateRequest(ctx context.Context, req *AIRequest) (*AIRequest, error) {
+	if m.moderation == nil || moderationSkipped(ctx) || len(req.Messages) == 0 {
+		return req, nil
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != "user" {
+		return req, nil
+	}
+
+	scope := AIUsageScopeFrom(ctx)
+	result, err := m.moderation.Check(ctx, ModerationInput{
+		UserID:    scope.UserID,
+		Source:    ModerationSourceAI,
+		Feature:   scope.Feature,
+		Direction: ModerationDirectionInput,
+		Text:      last.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Text == last.Content {
+		return req, nil
+	}
+
+	moderated := *req
+	moderated.Messages = append([]AIMessage{}, req.Messages...)
+	moderated.Messages[len(moderated.Messages)-1].Content = result.Text
+	return &moderated, nil
+}
+
+// moderateResponse 审核生成的内容，打码时直接替换响应内容
+func (m *AIClientManager) moderateResponse(ctx context.Context, resp *AIResponse) error {
+	if m.moderation == nil || moderationSkipped(ctx) || len(resp.Choices) == 0 {
+		return nil
+	}
+
+	scope := AIUsageScopeFrom(ctx)
+	result, err := m.moderation.Check(ctx, ModerationInput{
+		UserID:    scope.UserID,
+		Source:    ModerationSourceAI,
+		Feature:   scope.Feature,
+		Direction: ModerationDirectionOutput,
+		Text:      resp.Choices[0].Message.Content,
+	})
+	if err != nil {
+		return err
+	}
+	resp.Choices[0].Message.Content = result.Text
+	return nil
+}
+
+// moderateStream 审核流式输出
+//
+// 每个片段到达时用规则检查新增的内容（连同之前最长规则字数的内容），命中拒绝规则时以错误结束流；
+// 结束片段暂缓发送，流结束后完整审核一次并记录，拒绝时用错误代替结束片段。
+// 已发送的片段无法修改，流式输出中的打码只记录不替换
+func (m *AIClientManager) moderateStream(ctx context.Context, stream <-chan AIStreamChunk) <-chan AIStreamChunk {
+	if m.moderation == nil || !m.moderation.enabled || moderationSkipped(ctx) {
+		return stream
+	}
+
+	scope := AIUsageScopeFrom(ctx)
+	in := ModerationInput{
+		UserID:    scope.UserID,
+		Source:    ModerationSourceAI,
+		Feature:   scope.Feature,
+		Direction: ModerationDirectionOutput,
+	}
+
+	out := make(chan AIStreamChunk)
+	go func() {
+		defer close(out)
+		send := func(chunk AIStreamChunk) bool {
+			select {
+			case out <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		drain := func() {
+			for range stream {
+			}
+		}
+
+		var content strings.Builder
+		var held []AIStreamChunk
+		for chunk := range stream {
+			if chunk.Err != nil {
+				send(chunk)
+				drain()
+				return
+			}
+			from := content.Len()
+			content.WriteString(chunk.Delta)
+			if chunk.Delta != "" && hasModerationAction(m.moderation.matchTail(content.String(), from), ModerationBlock) {
+				in.Text = content.String()
+				if _, err := m.moderation.Check(ctx, in); err != nil {
+					send(AIStreamChunk{Err: err})
+					drain()
+					return
+				}
+			}
+			// 从结束片段或用量片段开始暂缓发送
+			if len(held) > 0 || chunk.FinishReason != "" || chunk.Usage != nil {
+				held = append(held, chunk)
+				continue
+			}
+			if !send(chunk) {
+				drain()
+				return
+			}
+		}
+
+		in.Text = content.String()
+		if _, err := m.moderation.Check(ctx, in); err != nil {
+			send(AIStreamChunk{Err: err})
+			return
+		}
+		for _, chunk := range held {
+			if !send(chunk) {
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp/syntax"
+	"strings"
+	"testing"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+func TestRegexpMaxRunes(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    int
+	}{
+		{`abc`, 3},
+		{`制毒|cook meth`, 9},
+		{`\b1[3-9]\d{9}\b`, 11},
+		{`(?:\+?86[- ]?)?\b1[3-9]\d{9}\b`, 15},
+		{`\d{14,17}`, 17},
+		{`a.c?`, 3},
+		{`a+`, -1},
+		{`x\d{3,}`, -1},
+		{`^$`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			re, err := syntax.Parse(tt.pattern, syntax.Perl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := regexpMaxRunes(re); got != tt.want {
+				t.Errorf("regexpMaxRunes(%q) = %d, want %d", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModerationStreamWindow(t *testing.T) {
+	rules := []*ModerationRule{
+		{Name: "a", Category: "a", Action: ModerationBlock, Keywords: []string{"制毒", "冰毒配方"}},
+		{Name: "b", Category: "b", Action: ModerationRedact, Patterns: []string{`\b1[3-9]\d{9}\b`}},
+	}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := moderationStreamWindow(rules); got != 11 {
+		t.Errorf("window = %d, want 11", got)
+	}
+
+	// 可以匹配任意长度的规则使用上限
+	unbounded := &ModerationRule{Name: "c", Category: "c", Action: ModerationFlag, Patterns: []string{`[a-z]+@[a-z]+`}}
+	if err := unbounded.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := moderationStreamWindow(append(rules, unbounded)); got != moderationStreamMaxWindow {
+		t.Errorf("window = %d, want %d", got, moderationStreamMaxWindow)
+	}
+}
+
+func TestModerationMatchTail(t *testing.T) {
+	s := NewModerationService(nil, nil, &config.Config{ModerationEnabled: true})
+
+	tests := []struct {
+		name     string
+		previous string
+		delta    string
+		want     []string
+	}{
+		{"keyword in delta", "这是一段很长的正常内容", "讲讲制毒", []string{"制毒"}},
+		{"keyword across chunks", "讲讲制", "毒的方法", []string{"制毒"}},
+		{"old match not repeated", "制毒" + strings.Repeat("正常", 20), "内容", nil},
+		{"phone across chunks", "电话是138001", "38000，", []string{"13800138000"}},
+		{"word boundary needs context", "电话是9138001", "38000，", nil},
+		{"case insensitive keyword", "how to COOK ", "METH now", []string{"COOK METH"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := tt.previous + tt.delta
+			var got []string
+			for _, m := range s.matchTail(text, len(tt.previous)) {
+				if text[m.start:m.end] != m.Text {
+					t.Errorf("match %q at %d:%d does not point into the text", m.Text, m.start, m.end)
+				}
+				got = append(got, m.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchTail() = %q, want %q", got, tt.want)
+			}
+
+			// 与检查全文时结束在新增内容中的命中一致
+			var full []string
+			for _, m := range s.match(text) {
+				if m.end > len(tt.previous) {
+					full = append(full, m.Text)
+				}
+			}
+			if !reflect.DeepEqual(got, full) {
+				t.Errorf("matchTail() = %q, full scan = %q", got, full)
+			}
+		})
+	}
+}
+
+// runModeratedStream 依次发送deltas，返回审核后收到的内容和错误
+func runModeratedStream(m *AIClientManager, deltas ...string) (string, string, error) {
+	stream := make(chan AIStreamChunk, len(deltas)+1)
+	for _, delta := range deltas {
+		stream <- AIStreamChunk{Delta: delta}
+	}
+	stream <- AIStreamChunk{FinishReason: "stop"}
+	close(stream)
+
+	var content strings.Builder
+	var finish string
+	var err error
+	for chunk := range m.moderateStream(context.Background(), stream) {
+		if chunk.Err != nil {
+			err = chunk.Err
+			continue
+		}
+		content.WriteString(chunk.Delta)
+		if chunk.FinishReason != "" {
+			finish = chunk.FinishReason
+		}
+	}
+	return content.String(), finish, err
+}
+
+func TestModerateStream(t *testing.T) {
+	m := newTestAIClientManager(t, "default:\n  content: ok\n")
+	m.moderation = NewModerationService(nil, m, &config.Config{ModerationEnabled: true})
+
+	t.Run("block stops the stream", func(t *testing.T) {
+		content, finish, err := runModeratedStream(m, "好的，", "下面介绍制", "毒的步骤", "第一步")
+		var moderationErr *ModerationError
+		if !errors.As(err, &moderationErr) || moderationErr.Direction != ModerationDirectionOutput || !reflect.DeepEqual(moderationErr.Categories, []string{"illegal"}) {
+			t.Fatalf("error = %v, want an output ModerationError", err)
+		}
+		// 命中拒绝规则的片段和之后的内容都不发送
+		if content != "好的，下面介绍制" || finish != "" {
+			t.Errorf("content = %q, finish = %q", content, finish)
+		}
+	})
+
+	t.Run("redact is recorded but not replaced", func(t *testing.T) {
+		content, finish, err := runModeratedStream(m, "电话是138", "0013800", "0，请联系")
+		if err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		if content != "电话是13800138000，请联系" || finish != "stop" {
+			t.Errorf("content = %q, finish = %q", content, finish)
+		}
+	})
+
+	t.Run("clean stream", func(t *testing.T) {
+		content, finish, err := runModeratedStream(m, "你好", "世界")
+		if err != nil || content != "你好世界" || finish != "stop" {
+			t.Errorf("content = %q, finish = %q, error = %v", content, finish, err)
+		}
+	})
+}
+
+func TestModerationCheckRedact(t *testing.T) {
+	s := NewModerationService(nil, nil, &config.Config{ModerationEnabled: true})
+	result, err := s.Check(context.Background(), ModerationInput{Direction: ModerationDirectionInput, Text: "电话13800138000，身份证11010519491231002X"})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if result.Action != ModerationRedact || result.Text != "电话[手机号]，身份证[身份证号]" {
+		t.Errorf("result = %s %q", result.Action, result.Text)
+	}
+}
+
+func TestModerationClassifierFailure(t *testing.T) {
+	// 两个模拟服务都失败，分类器不可用
+	const failing = `
+fixtures:
+  - service: mock
+    match: "."
+    error: {status: 500}
+  - service: mock-backup
+    match: "."
+    error: {status: 500}
+`
+
+	tests := []struct {
+		name       string
+		failClosed bool
+		wantBlock  bool
+	}{
+		{"fail open", false, false},
+		{"fail closed", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestAIClientManager(t, failing)
+			m.moderation = NewModerationService(nil, m, &config.Config{
+				ModerationEnabled:              true,
+				ModerationClassifierEnabled:    true,
+				ModerationClassifierFailClosed: tt.failClosed,
+			})
+
+			result, err := m.moderation.Check(context.Background(), ModerationInput{Direction: ModerationDirectionInput, Text: "普通的问题"})
+			var moderationErr *ModerationError
+			if blocked := errors.As(err, &moderationErr); blocked != tt.wantBlock {
+				t.Fatalf("Check() error = %v, wantBlock %v", err, tt.wantBlock)
+			}
+			if result.Classified {
+				t.Error("result marked as classified")
+			}
+			if tt.wantBlock && !reflect.DeepEqual(moderationErr.Categories, []string{moderationUnreviewedCategory}) {
+				t.Errorf("categories = %v", moderationErr.Categories)
+			}
+
+			// 流结束后的完整审核同样按配置放行或拒绝
+			content, finish, err := runModeratedStream(m, "普通的", "回答")
+			if (err != nil) != tt.wantBlock || content != "普通的回答" || (finish == "stop") == tt.wantBlock {
+				t.Errorf("stream content = %q, finish = %q, error = %v", content, finish, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,747 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/robfig/cron/v3"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+	"qa-toolbox-backend/internal/models"
+)
+
+// 定时任务的执行目标
+const (
+	ScheduleTargetCrawler  = "crawler_task"
+	ScheduleTargetAPISuite = "api_test_suite"
+)
+
+// 定时任务执行记录的状态
+const (
+	ScheduleRunQueued    = "queued"
+	ScheduleRunRunning   = "running"
+	ScheduleRunCompleted = "completed"
+	ScheduleRunFailed    = "failed"
+	ScheduleRunSkipped   = "skipped" // 同一目标的上一次执行尚未结束
+)
+
+// 执行记录的触发方式
+const (
+	ScheduleTriggerCron   = "schedule"
+	ScheduleTriggerManual = "manual"
+)
+
+// JobTypeScheduleRun 定时任务的后台任务类型
+const JobTypeScheduleRun = "schedule.run"
+
+const (
+	scheduleRunJobTimeout = 30 * time.Minute
+	// 排队或执行超过该时间的记录视为已中断，不再阻止同一目标的新执行
+	scheduleRunStaleAfter = 6 * time.Hour
+	// 每次最多触发的定时任务数
+	scheduleFireBatch = 100
+	// 变化详情中每一类最多记录的条目数
+	scheduleMaxChangeItems = 50
+)
+
+var (
+	ErrScheduleNotFound      = errors.New("定时任务不存在")
+	ErrInvalidSchedule       = errors.New("定时任务配置无效")
+	ErrScheduleRunInProgress = errors.New("该目标的上一次执行尚未结束")
+)
+
+// 标准的5段cron表达式，支持@hourly、@daily、@every 1h等写法
+var scheduleCronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ScheduleService 定时任务和执行记录，到期的定时任务由Scheduler触发
+type ScheduleService struct {
+	db          *database.DB
+	jobs        *JobQueue
+	qa          *QAToolBoxService
+	minInterval time.Duration
+}
+
+func NewScheduleService(db *database.DB, jobs *JobQueue, qa *QAToolBoxService, cfg *config.Config) *ScheduleService {
+	s := &ScheduleService{
+		db:          db,
+		jobs:        jobs,
+		qa:          qa,
+		minInterval: time.Duration(cfg.SchedulerMinIntervalSeconds) * time.Second,
+	}
+	jobs.Register(JobTypeScheduleRun, s.runScheduleJob, JobOptions{Timeout: scheduleRunJobTimeout})
+	return s
+}
+
+// scheduleRunJob 定时任务执行的参数
+type scheduleRunJob struct {
+	RunID string `json:"run_id"`
+}
+
+// scheduleSnapshot 一次执行的结果快照，爬虫以页面URL为键，API测试以用例ID为键
+type scheduleSnapshot map[string]scheduleSnapshotEntry
+
+type scheduleSnapshotEntry struct {
+	StatusCode int    `json:"status_code"`
+	Result     string `json:"result,omitempty"`    // API测试的passed、failed或error
+	DataHash   string `json:"data_hash,omitempty"` // 爬虫提取数据的哈希
+}
+
+// scheduleChanges 与上一次执行相比的变化
+type scheduleChanges struct {
+	Total         int                   `json:"total"`
+	Added         []string              `json:"added,omitempty"`
+	Removed       []string              `json:"removed,omitempty"`
+	StatusChanged []scheduleValueChange `json:"status_changed,omitempty"`
+	ResultChanged []scheduleValueChange `json:"result_changed,omitempty"`
+	DataChanged   []string              `json:"data_changed,omitempty"`
+}
+
+type scheduleValueChange struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// parseCronSchedule 解析cron表达式和时区，相邻两次执行的间隔不能小于minInterval
+func (s *ScheduleService) parseCronSchedule(expr, timezone string) (cron.Schedule, *time.Location, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: 时区 %q 无效", ErrInvalidSchedule, timezone)
+	}
+	if strings.HasPrefix(expr, "TZ=") || strings.HasPrefix(expr, "CRON_TZ=") {
+		return nil, nil, fmt.Errorf("%w: 时区请通过timezone指定", ErrInvalidSchedule)
+	}
+	schedule, err := scheduleCronParser.Parse(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: cron表达式 %q 无效: %v", ErrInvalidSchedule, expr, err)
+	}
+
+	// 检查接下来几次执行的间隔
+	prev := schedule.Next(time.Now().In(loc))
+	if prev.IsZero() {
+		return nil, nil, fmt.Errorf("%w: cron表达式 %q 不会触发", ErrInvalidSchedule, expr)
+	}
+	for i := 0; i < 5; i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(prev) < s.minInterval {
+			return nil, nil, fmt.Errorf("%w: 执行间隔不能小于%s", ErrInvalidSchedule, s.minInterval)
+		}
+		prev = next
+	}
+	return schedule, loc, nil
+}
+
+// nextRun 下一次执行时间，不会触发时返回nil
+func nextRun(schedule cron.Schedule, loc *time.Location, after time.Time) *time.Time {
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// checkScheduleTarget 确认执行目标存在且属于该用户
+func (s *ScheduleService) checkScheduleTarget(ctx context.Context, userID, targetType, targetID string) error {
+	switch targetType {
+	case ScheduleTargetCrawler:
+		_, err := s.qa.getUserCrawlerTaskName(ctx, userID, targetID)
+		return err
+	case ScheduleTargetAPISuite:
+		_, err := s.qa.getAPITestSuite(ctx, userID, targetID)
+		return err
+	}
+	return fmt.Errorf("%w: target_type只能为%s或%s", ErrInvalidSchedule, ScheduleTargetCrawler, ScheduleTargetAPISuite)
+}
+
+// Create 创建定时任务
+func (s *ScheduleService) Create(ctx context.Context, userID string, req *models.ScheduleRequest) (*models.Schedule, error) {
+	if err := s.checkScheduleTarget(ctx, userID, req.TargetType, req.TargetID); err != nil {
+		return nil, err
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	cronSchedule, loc, err := s.parseCronSchedule(strings.TrimSpace(req.CronExpr), req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schedule := &models.Schedule{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		TargetType: req.TargetType,
+		TargetID:   req.TargetID,
+		CronExpr:   strings.TrimSpace(req.CronExpr),
+		Timezone:   req.Timezone,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if schedule.Enabled {
+		schedule.NextRunAt = nextRun(cronSchedule, loc, now)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO schedules (id, user_id, target_type, target_id, cron_expr, timezone, enabled, next_run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, schedule.ID, schedule.UserID, schedule.TargetType, schedule.TargetID, schedule.CronExpr, schedule.Timezone,
+		schedule.Enabled, schedule.NextRunAt, schedule.CreatedAt, schedule.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("创建定时任务失败: %w", err)
+	}
+	return schedule, nil
+}
+
+// Update 修改cron表达式、时区或启用状态，修改后重新计算下一次执行时间
+func (s *ScheduleService) Update(ctx context.Context, userID, id string, req *models.ScheduleRequest) (*models.Schedule, error) {
+	schedule, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.CronExpr != "" {
+		schedule.CronExpr = strings.TrimSpace(req.CronExpr)
+	}
+	if req.Timezone != "" {
+		schedule.Timezone = req.Timezone
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	cronSchedule, loc, err := s.parseCronSchedule(schedule.CronExpr, schedule.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		schedule.NextRunAt = nextRun(cronSchedule, loc, time.Now())
+	}
+	schedule.UpdatedAt = time.Now()
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE schedules SET cron_expr = $1, timezone = $2, enabled = $3, next_run_at = $4, updated_at = $5
+		WHERE id = $6
+	`, schedule.CronExpr, schedule.Timezone, schedule.Enabled, schedule.NextRunAt, schedule.UpdatedAt, schedule.ID); err != nil {
+		return nil, fmt.Errorf("更新定时任务失败: %w", err)
+	}
+	return schedule, nil
+}
+
+// Delete 删除定时任务和执行记录
+func (s *ScheduleService) Delete(ctx context.Context, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrScheduleNotFound
+	}
+	res, err := s.db.ExecContext(ctx, `DELETE FROM schedules WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("删除定时任务失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+const scheduleColumns = `id, user_id, target_type, target_id, cron_expr, timezone, enabled, next_run_at, last_run_at, created_at, updated_at`
+
+func scanSchedule(row interface{ Scan(...interface{}) error }) (*models.Schedule, error) {
+	var schedule models.Schedule
+	err := row.Scan(&schedule.ID, &schedule.UserID, &schedule.TargetType, &schedule.TargetID, &schedule.CronExpr,
+		&schedule.Timezone, &schedule.Enabled, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// Get 获取定时任务
+func (s *ScheduleService) Get(ctx context.Context, userID, id string) (*models.Schedule, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrScheduleNotFound
+	}
+	schedule, err := scanSchedule(s.db.QueryRowContext(ctx,
+		`SELECT `+scheduleColumns+` FROM schedules WHERE id = $1 AND user_id = $2`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询定时任务失败: %w", err)
+	}
+	return schedule, nil
+}
+
+// List 用户的定时任务，可按执行目标过滤
+func (s *ScheduleService) List(ctx context.Context, userID, targetType, targetID string, page, perPage int) ([]models.Schedule, int, error) {
+	where := `user_id = $1`
+	args := []interface{}{userID}
+	if targetType != "" {
+		args = append(args, targetType)
+		where += fmt.Sprintf(` AND target_type = $%d`, len(args))
+	}
+	if targetID != "" {
+		if _, err := uuid.Parse(targetID); err != nil {
+			return []models.Schedule{}, 0, nil
+		}
+		args = append(args, targetID)
+		where += fmt.Sprintf(` AND target_id = $%d`, len(args))
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schedules WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	}
+
+	args = append(args, perPage, (page-1)*perPage)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s FROM schedules WHERE %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d
+	`, scheduleColumns, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询定时任务失败: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []models.Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("扫描定时任务失败: %w", err)
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, total, rows.Err()
+}
+
+// Runs 定时任务的执行记录，changedOnly为true时只返回结果有变化的记录
+func (s *ScheduleService) Runs(ctx context.Context, userID, scheduleID string, changedOnly bool, page, perPage int) ([]models.ScheduleRun, int, error) {
+	if _, err := s.Get(ctx, userID, scheduleID); err != nil {
+		return nil, 0, err
+	}
+
+	where := `schedule_id = $1`
+	if changedOnly {
+		where += ` AND changed = TRUE`
+	}
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schedule_runs WHERE `+where, scheduleID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询总数失败: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, schedule_id, target_type, target_id, trigger_type, status, COALESCE(job_id, ''),
+			summary, changed, changes, COALESCE(error, ''), scheduled_at, started_at, finished_at
+		FROM schedule_runs WHERE `+where+`
+		ORDER BY scheduled_at DESC
+		LIMIT $2 OFFSET $3
+	`, scheduleID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询执行记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.ScheduleRun{}
+	for rows.Next() {
+		var run models.ScheduleRun
+		var summary, changes []byte
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &run.TargetType, &run.TargetID, &run.Trigger, &run.Status,
+			&run.JobID, &summary, &run.Changed, &changes, &run.Error, &run.ScheduledAt, &run.StartedAt, &run.FinishedAt); err != nil {
+			return nil, 0, fmt.Errorf("扫描执行记录失败: %w", err)
+		}
+		if len(summary) > 0 {
+			json.Unmarshal(summary, &run.Summary)
+		}
+		if len(changes) > 0 {
+			json.Unmarshal(changes, &run.Changes)
+		}
+		runs = append(runs, run)
+	}
+	return runs, total, rows.Err()
+}
+
+// Trigger 立即执行一次定时任务，不影响下一次定时执行的时间
+func (s *ScheduleService) Trigger(ctx context.Context, userID, id string) (*models.ScheduleRun, *Job, error) {
+	schedule, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.startRun(ctx, schedule, ScheduleTriggerManual, time.Now())
+}
+
+// fireDue 触发到期的定时任务，由Scheduler在主节点上定期调用
+//
+// 下一次执行时间从当前时间开始计算，停机期间错过的多次执行只补执行一次
+func (s *ScheduleService) fireDue(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+scheduleColumns+` FROM schedules
+		WHERE enabled = TRUE AND next_run_at <= $1
+		ORDER BY next_run_at
+		LIMIT $2
+	`, now, scheduleFireBatch)
+	if err != nil {
+		return 0, fmt.Errorf("查询到期的定时任务失败: %w", err)
+	}
+	var due []*models.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描定时任务失败: %w", err)
+		}
+		due = append(due, schedule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("查询到期的定时任务失败: %w", err)
+	}
+
+	fired := 0
+	for _, schedule := range due {
+		scheduledAt := *schedule.NextRunAt
+		var next *time.Time
+		if cronSchedule, loc, err := s.parseCronSchedule(schedule.CronExpr, schedule.Timezone); err == nil {
+			next = nextRun(cronSchedule, loc, now)
+		} else {
+			log.Printf("定时任务 %s 配置无效，不再执行: %v", schedule.ID, err)
+		}
+
+		// 以next_run_at作为乐观锁，避免同一次执行被触发两次
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE schedules SET next_run_at = $1, last_run_at = $2, enabled = $3
+			WHERE id = $4 AND next_run_at = $5
+		`, next, now, next != nil, schedule.ID, scheduledAt)
+		if err != nil {
+			return fired, fmt.Errorf("更新定时任务失败: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 || next == nil {
+			continue
+		}
+
+		if _, _, err := s.startRun(ctx, schedule, ScheduleTriggerCron, scheduledAt); err != nil {
+			log.Printf("执行定时任务 %s 失败: %v", schedule.ID, err)
+			continue
+		}
+		fired++
+	}
+	return fired, nil
+}
+
+// startRun 创建执行记录并加入任务队列
+//
+// 同一目标同时只能有一个排队或执行中的记录，定时触发时记录为skipped，手动触发时返回ErrScheduleRunInProgress
+func (s *ScheduleService) startRun(ctx context.Context, schedule *models.Schedule, trigger string, scheduledAt time.Time) (*models.ScheduleRun, *Job, error) {
+	// 长时间未结束的记录视为已中断
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE schedule_runs SET status = 'failed', error = '执行超时', finished_at = $1
+		WHERE target_type = $2 AND target_id = $3 AND status IN ('queued', 'running') AND scheduled_at < $4
+	`, time.Now(), schedule.TargetType, schedule.TargetID, time.Now().Add(-scheduleRunStaleAfter)); err != nil {
+		return nil, nil, fmt.Errorf("更新执行记录失败: %w", err)
+	}
+
+	run := &models.ScheduleRun{
+		ID:          uuid.New().String(),
+		ScheduleID:  schedule.ID,
+		TargetType:  schedule.TargetType,
+		TargetID:    schedule.TargetID,
+		Trigger:     trigger,
+		Status:      ScheduleRunQueued,
+		ScheduledAt: scheduledAt,
+	}
+	insert := func() error {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO schedule_runs (id, schedule_id, target_type, target_id, trigger_type, status, error, scheduled_at, finished_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)
+		`, run.ID, run.ScheduleID, run.TargetType, run.TargetID, run.Trigger, run.Status, run.Error, run.ScheduledAt, run.FinishedAt)
+		return err
+	}
+
+	// 唯一索引保证同一目标只有一个未结束的记录
+	err := insert()
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if trigger == ScheduleTriggerManual {
+			return nil, nil, ErrScheduleRunInProgress
+		}
+		finishedAt := time.Now()
+		run.Status, run.Error, run.FinishedAt = ScheduleRunSkipped, ErrScheduleRunInProgress.Error(), &finishedAt
+		err = insert()
+		if err == nil {
+			return run, nil, nil
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建执行记录失败: %w", err)
+	}
+
+	job, err := s.jobs.Enqueue(ctx, JobTypeScheduleRun, schedule.UserID, scheduleRunJob{RunID: run.ID})
+	if err != nil {
+		s.finishRun(context.WithoutCancel(ctx), run.ID, ScheduleRunFailed, nil, nil, nil, err)
+		return nil, nil, err
+	}
+	run.JobID = job.ID
+	if _, err := s.db.ExecContext(ctx, `UPDATE schedule_runs SET job_id = $1 WHERE id = $2`, job.ID, run.ID); err != nil {
+		return nil, nil, fmt.Errorf("更新执行记录失败: %w", err)
+	}
+	return run, job, nil
+}
+
+// runScheduleJob 执行定时任务的目标，完成后与同一目标上一次完成的执行比较
+func (s *ScheduleService) runScheduleJob(ctx context.Context, job *Job, progress JobProgress) (interface{}, error) {
+	var payload scheduleRunJob
+	if err := job.DecodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	var run models.ScheduleRun
+	var userID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT r.id, r.schedule_id, r.target_type, r.target_id, r.status, s.user_id
+		FROM schedule_runs r JOIN schedules s ON s.id = r.schedule_id
+		WHERE r.id = $1
+	`, payload.RunID).Scan(&run.ID, &run.ScheduleID, &run.TargetType, &run.TargetID, &run.Status, &userID)
+	if err == sql.ErrNoRows {
+		return nil, PermanentJobError(fmt.Errorf("执行记录不存在: %s", payload.RunID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询执行记录失败: %w", err)
+	}
+	if run.Status != ScheduleRunQueued && run.Status != ScheduleRunRunning {
+		return map[string]interface{}{"run_id": run.ID, "status": run.Status}, nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE schedule_runs SET status = 'running', started_at = COALESCE(started_at, $1) WHERE id = $2
+	`, time.Now(), run.ID); err != nil {
+		return nil, fmt.Errorf("更新执行记录失败: %w", err)
+	}
+
+	var summary map[string]interface{}
+	var snapshot scheduleSnapshot
+	switch run.TargetType {
+	case ScheduleTargetCrawler:
+		summary, snapshot, err = s.runCrawlerTarget(ctx, run.TargetID, job, progress)
+	case ScheduleTargetAPISuite:
+		summary, snapshot, err = s.runAPISuiteTarget(ctx, userID, run.TargetID, progress)
+	default:
+		err = PermanentJobError(fmt.Errorf("未知的执行目标: %s", run.TargetType))
+	}
+	if err != nil {
+		if !job.WillRetry(err) {
+			s.finishRun(context.WithoutCancel(ctx), run.ID, ScheduleRunFailed, summary, nil, nil, err)
+		}
+		// 执行目标已删除，停用定时任务
+		if errors.Is(err, ErrCrawlerTaskNotFound) || errors.Is(err, ErrAPITestSuiteNotFound) {
+			if _, dbErr := s.db.ExecContext(context.WithoutCancel(ctx), `
+				UPDATE schedules SET enabled = FALSE, next_run_at = NULL WHERE id = $1
+			`, run.ScheduleID); dbErr != nil {
+				log.Printf("停用定时任务 %s 失败: %v", run.ScheduleID, dbErr)
+			}
+		}
+		return nil, err
+	}
+
+	previous, err := s.previousSnapshot(ctx, &run)
+	if err != nil {
+		return nil, err
+	}
+	var changes *scheduleChanges
+	if previous != nil {
+		changes = diffScheduleSnapshots(previous, snapshot)
+	}
+	if err := s.finishRun(ctx, run.ID, ScheduleRunCompleted, summary, snapshot, changes, nil); err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{"run_id": run.ID, "status": ScheduleRunCompleted, "summary": summary, "changed": false}
+	if changes != nil && changes.Total > 0 {
+		result["changed"] = true
+		result["changes"] = changes
+	}
+	return result, nil
+}
+
+// runCrawlerTarget 重新执行爬虫任务，快照为每个页面的状态码和提取数据的哈希
+func (s *ScheduleService) runCrawlerTarget(ctx context.Context, taskID string, job *Job, progress JobProgress) (map[string]interface{}, scheduleSnapshot, error) {
+	task, err := s.qa.getCrawlerTask(ctx, taskID)
+	if err != nil {
+		if errors.Is(err, ErrCrawlerTaskNotFound) {
+			err = PermanentJobError(err)
+		}
+		return nil, nil, err
+	}
+	if task.Status == "cancelled" {
+		return nil, nil, PermanentJobError(errors.New("爬虫任务已取消"))
+	}
+
+	result, err := s.qa.executeCrawlerTask(ctx, task, progress, job.WillRetry)
+	summary := map[string]interface{}{
+		"pages_crawled": result.Crawled,
+		"pages_failed":  result.Failed,
+		"pages_skipped": result.Skipped,
+	}
+	if err != nil {
+		return summary, nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT url, status_code, data FROM crawler_results WHERE task_id = $1`, taskID)
+	if err != nil {
+		return summary, nil, fmt.Errorf("查询爬虫结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	snapshot := scheduleSnapshot{}
+	for rows.Next() {
+		var pageURL string
+		var entry scheduleSnapshotEntry
+		var data []byte
+		if err := rows.Scan(&pageURL, &entry.StatusCode, &data); err != nil {
+			return summary, nil, fmt.Errorf("扫描爬虫结果失败: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		entry.DataHash = hex.EncodeToString(sum[:])
+		snapshot[pageURL] = entry
+	}
+	return summary, snapshot, rows.Err()
+}
+
+// runAPISuiteTarget 执行测试套件，快照为每个用例的测试结果和状态码
+func (s *ScheduleService) runAPISuiteTarget(ctx context.Context, userID, suiteID string, progress JobProgress) (map[string]interface{}, scheduleSnapshot, error) {
+	progress(10, "正在执行测试用例")
+	results, err := s.qa.RunAPITestSuite(ctx, userID, suiteID)
+	if err != nil {
+		if errors.Is(err, ErrAPITestSuiteNotFound) {
+			err = PermanentJobError(err)
+		}
+		return nil, nil, err
+	}
+
+	counts := map[string]int{}
+	snapshot := scheduleSnapshot{}
+	for _, result := range results {
+		counts[result.Status]++
+		snapshot[result.TestCaseID] = scheduleSnapshotEntry{StatusCode: result.ResponseStatus, Result: result.Status}
+	}
+	summary := map[string]interface{}{
+		"total":  len(results),
+		"passed": counts["passed"],
+		"failed": counts["failed"],
+		"error":  counts["error"],
+	}
+	return summary, snapshot, nil
+}
+
+// previousSnapshot 同一目标上一次完成的执行的快照，没有时返回nil
+func (s *ScheduleService) previousSnapshot(ctx context.Context, run *models.ScheduleRun) (scheduleSnapshot, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT snapshot FROM schedule_runs
+		WHERE target_type = $1 AND target_id = $2 AND status = 'completed' AND id <> $3
+		ORDER BY finished_at DESC
+		LIMIT 1
+	`, run.TargetType, run.TargetID, run.ID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询上一次执行失败: %w", err)
+	}
+	snapshot := scheduleSnapshot{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("解析上一次执行的快照失败: %w", err)
+		}
+	}
+	return snapshot, nil
+}
+
+// finishRun 保存执行结果
+func (s *ScheduleService) finishRun(ctx context.Context, runID, status string, summary map[string]interface{}, snapshot scheduleSnapshot, changes *scheduleChanges, runErr error) error {
+	if summary == nil {
+		summary = map[string]interface{}{}
+	}
+	if snapshot == nil {
+		snapshot = scheduleSnapshot{}
+	}
+	summaryJSON, _ := json.Marshal(summary)
+	snapshotJSON, _ := json.Marshal(snapshot)
+	changesJSON := []byte("{}")
+	changed := changes != nil && changes.Total > 0
+	if changed {
+		changesJSON, _ = json.Marshal(changes)
+	}
+	var message sql.NullString
+	if runErr != nil {
+		message = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE schedule_runs
+		SET status = $1, summary = $2, snapshot = $3, changed = $4, changes = $5, error = $6, finished_at = $7
+		WHERE id = $8
+	`, status, summaryJSON, snapshotJSON, changed, changesJSON, message, time.Now(), runID); err != nil {
+		return fmt.Errorf("更新执行记录失败: %w", err)
+	}
+	return nil
+}
+
+// diffScheduleSnapshots 比较两次执行的快照，每一类变化最多记录scheduleMaxChangeItems条
+func diffScheduleSnapshots(previous, current scheduleSnapshot) *scheduleChanges {
+	keys := make([]string, 0, len(previous)+len(current))
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	for key := range current {
+		if _, ok := previous[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := &scheduleChanges{}
+	appendKey := func(list *[]string, key string) {
+		changes.Total++
+		if len(*list) < scheduleMaxChangeItems {
+			*list = append(*list, key)
+		}
+	}
+	appendChange := func(list *[]scheduleValueChange, key string, from, to interface{}) {
+		changes.Total++
+		if len(*list) < scheduleMaxChangeItems {
+			*list = append(*list, scheduleValueChange{Key: key, From: from, To: to})
+		}
+	}
+
+	for _, key := range keys {
+		before, existed := previous[key]
+		after, exists := current[key]
+		switch {
+		case !existed:
+			appendKey(&changes.Added, key)
+		case !exists:
+			appendKey(&changes.Removed, key)
+		default:
+			if before.StatusCode != after.StatusCode {
+				appendChange(&changes.StatusChanged, key, before.StatusCode, after.StatusCode)
+			}
+			if before.Result != after.Result {
+				appendChange(&changes.ResultChanged, key, before.Result, after.Result)
+			}
+			if before.DataHash != after.DataHash {
+				appendKey(&changes.DataChanged, key)
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffScheduleSnapshots(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous scheduleSnapshot
+		current  scheduleSnapshot
+		want     *scheduleChanges
+	}{
+		{
+			name:     "first run",
+			previous: nil,
+			current:  scheduleSnapshot{"b": {StatusCode: 200}, "a": {StatusCode: 200}},
+			want:     &scheduleChanges{Total: 2, Added: []string{"a", "b"}},
+		},
+		{
+			name:     "unchanged",
+			previous: scheduleSnapshot{"a": {StatusCode: 200, DataHash: "h1"}},
+			current:  scheduleSnapshot{"a": {StatusCode: 200, DataHash: "h1"}},
+			want:     &scheduleChanges{},
+		},
+		{
+			name:     "added and removed",
+			previous: scheduleSnapshot{"a": {StatusCode: 200}, "b": {StatusCode: 200}},
+			current:  scheduleSnapshot{"b": {StatusCode: 200}, "c": {StatusCode: 200}},
+			want:     &scheduleChanges{Total: 2, Added: []string{"c"}, Removed: []string{"a"}},
+		},
+		{
+			name:     "crawler page status and data",
+			previous: scheduleSnapshot{"https://a/": {StatusCode: 200, DataHash: "h1"}, "https://a/x": {StatusCode: 200, DataHash: "h2"}},
+			current:  scheduleSnapshot{"https://a/": {StatusCode: 500, DataHash: "h3"}, "https://a/x": {StatusCode: 200, DataHash: "h4"}},
+			want: &scheduleChanges{
+				Total:         3,
+				StatusChanged: []scheduleValueChange{{Key: "https://a/", From: 200, To: 500}},
+				DataChanged:   []string{"https://a/", "https://a/x"},
+			},
+		},
+		{
+			name:     "api test result",
+			previous: scheduleSnapshot{"case-1": {StatusCode: 200, Result: "passed"}},
+			current:  scheduleSnapshot{"case-1": {StatusCode: 200, Result: "failed"}},
+			want: &scheduleChanges{
+				Total:         1,
+				ResultChanged: []scheduleValueChange{{Key: "case-1", From: "passed", To: "failed"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffScheduleSnapshots(tt.previous, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffScheduleSnapshots() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffScheduleSnapshotsLimit(t *testing.T) {
+	current := scheduleSnapshot{}
+	for i := 0; i < scheduleMaxChangeItems+10; i++ {
+		current[fmt.Sprintf("page-%03d", i)] = scheduleSnapshotEntry{StatusCode: 200}
+	}
+
+	// 超出部分只计入总数
+	changes := diffScheduleSnapshots(nil, current)
+	if changes.Total != scheduleMaxChangeItems+10 || len(changes.Added) != scheduleMaxChangeItems {
+		t.Errorf("total = %d, added = %d", changes.Total, len(changes.Added))
+	}
+	if changes.Added[0] != "page-000" || changes.Added[scheduleMaxChangeItems-1] != fmt.Sprintf("page-%03d", scheduleMaxChangeItems-1) {
+		t.Errorf("added not sorted: %v", changes.Added)
+	}
+}
+
+func TestParseCronSchedule(t *testing.T) {
+	s := &ScheduleService{minInterval: 10 * time.Minute}
+
+	tests := []struct {
+		name     string
+		expr     string
+		timezone string
+		wantErr  bool
+	}{
+		{name: "hourly", expr: "0 * * * *", timezone: "UTC"},
+		{name: "every 10 minutes", expr: "*/10 * * * *", timezone: "UTC"},
+		{name: "descriptor", expr: "@daily", timezone: "Asia/Shanghai"},
+		{name: "every duration", expr: "@every 1h", timezone: "UTC"},
+		{name: "empty timezone is utc", expr: "@hourly", timezone: ""},
+		{name: "below minimum interval", expr: "*/5 * * * *", timezone: "UTC", wantErr: true},
+		{name: "every minute", expr: "* * * * *", timezone: "UTC", wantErr: true},
+		{name: "irregular gap below minimum", expr: "0,5 * * * *", timezone: "UTC", wantErr: true},
+		{name: "every duration below minimum", expr: "@every 1m", timezone: "UTC", wantErr: true},
+		{name: "invalid expression", expr: "61 * * * *", timezone: "UTC", wantErr: true},
+		{name: "seconds field not supported", expr: "0 0 * * * *", timezone: "UTC", wantErr: true},
+		{name: "invalid timezone", expr: "@daily", timezone: "Mars/Base", wantErr: true},
+		{name: "inline timezone", expr: "CRON_TZ=Asia/Shanghai 0 * * * *", timezone: "UTC", wantErr: true},
+		{name: "never fires", expr: "0 0 30 2 *", timezone: "UTC", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, loc, err := s.parseCronSchedule(tt.expr, tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCronSchedule(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidSchedule) {
+					t.Errorf("error %v is not ErrInvalidSchedule", err)
+				}
+				return
+			}
+			if schedule == nil || loc == nil {
+				t.Errorf("parseCronSchedule(%q) = %v, %v", tt.expr, schedule, loc)
+			}
+		})
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	schedule, err := scheduleCronParser.Parse("0 9 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按时区计算，结果为UTC
+	after := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC) // 上海时间10:00
+	next := nextRun(schedule, shanghai, after)
+	want := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	if next == nil || !next.Equal(want) || next.Location() != time.UTC {
+		t.Errorf("nextRun() = %v, want %v", next, want)
+	}
+}
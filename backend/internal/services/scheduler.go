@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"qa-toolbox-backend/internal/config"
+	"qa-toolbox-backend/internal/database"
+)
+
+// 主节点租约的Redis键，值为持有者的实例ID
+const schedulerLeaderKey = "scheduler:leader"
+
+// 只有租约仍属于自己时才续期
+var schedulerRenewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// 只有租约仍属于自己时才释放
+var schedulerReleaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Scheduler 定时触发到期的定时任务
+//
+// 每个副本都运行Scheduler，通过Redis上带过期时间的租约选主，只有持有租约的副本触发定时任务。
+// 主节点宕机后租约过期，由其他副本接管
+type Scheduler struct {
+	redis     *database.RedisClient
+	schedules *ScheduleService
+	id        string
+	enabled   bool
+	poll      time.Duration
+	ttl       time.Duration
+
+	leader bool
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(redis *database.RedisClient, schedules *ScheduleService, cfg *config.Config) *Scheduler {
+	poll := time.Duration(cfg.SchedulerPollSeconds) * time.Second
+	if poll <= 0 {
+		poll = 15 * time.Second
+	}
+	// 租约至少覆盖两个检查周期，避免一次续期延迟就失去主节点
+	ttl := time.Duration(cfg.SchedulerLeaderTTLSeconds) * time.Second
+	if ttl < 2*poll {
+		ttl = 2 * poll
+	}
+	return &Scheduler{
+		redis:     redis,
+		schedules: schedules,
+		id:        uuid.New().String(),
+		enabled:   cfg.SchedulerEnabled,
+		poll:      poll,
+		ttl:       ttl,
+	}
+}
+
+// Start 启动调度器，未连接Redis或未启用时不启动
+func (s *Scheduler) Start(ctx context.Context) {
+	if !s.enabled {
+		log.Printf("调度器未启用")
+		return
+	}
+	if s.redis == nil {
+		log.Printf("未连接Redis，调度器不启动")
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop 停止调度器，是主节点时释放租约以便其他副本立即接管
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+
+	if s.leader {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := schedulerReleaseScript.Run(ctx, s.redis, []string{schedulerLeaderKey}, s.id).Err(); err != nil {
+			log.Printf("释放调度器主节点失败: %v", err)
+		}
+		s.leader = false
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+
+	for {
+		if s.elect(ctx) {
+			if n, err := s.schedules.fireDue(ctx, time.Now()); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("触发定时任务失败: %v", err)
+				}
+			} else if n > 0 {
+				log.Printf("触发了%d个定时任务", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// elect 续期或争取租约，返回本实例当前是否为主节点
+func (s *Scheduler) elect(ctx context.Context) bool {
+	ttlMillis := s.ttl.Milliseconds()
+	if s.leader {
+		renewed, err := schedulerRenewScript.Run(ctx, s.redis, []string{schedulerLeaderKey}, s.id, ttlMillis).Int()
+		if err == nil && renewed == 1 {
+			return true
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("续期调度器主节点失败: %v", err)
+		}
+		s.leader = false
+		log.Printf("调度器 %s 不再是主节点", s.id)
+	}
+
+	acquired, err := s.redis.SetNX(ctx, schedulerLeaderKey, s.id, s.ttl).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("争取调度器主节点失败: %v", err)
+		}
+		return false
+	}
+	if acquired {
+		s.leader = true
+		log.Printf("调度器 %s 成为主节点", s.id)
+	}
+	return s.leader
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"qa-toolbox-backend/internal/database"
+)
+
+// 语义搜索支持的内容类型
+const (
+	SearchSourceWritings      = "writings"
+	SearchSourceTestCases     = "test_cases"
+	SearchSourceMoodNotes     = "mood_notes"
+	SearchSourceChatMessages  = "chat_messages"
+	SearchSourceConversations = "conversations"
+)
+
+// ErrUnknownSearchSource 不支持的内容类型
+var ErrUnknownSearchSource = errors.New("不支持的搜索内容类型")
+
+const (
+	semanticSyncLimit     = 200  // 每次搜索最多补建的向量数，其余在后续搜索中补建
+	semanticEmbedBatch    = 32   // 每次向量化请求的文本数
+	semanticMaxInputRunes = 2000 // 向量化文本的最大长度
+	semanticSnippetRunes  = 200  // 结果摘要长度
+)
+
+// 各内容类型的数据来源，返回 id, title, text, created_at，$1为用户ID，按时间倒序
+var semanticSources = map[string]string{
+	SearchSourceWritings: `
+		SELECT id::text, title, content, created_at FROM writings
+		WHERE user_id = $1 ORDER BY created_at DESC`,
+	SearchSourceTestCases: `
+		SELECT id::text, name, COALESCE(description, '') || E'\n' || code, created_at FROM test_cases
+		WHERE user_id = $1 ORDER BY created_at DESC`,
+	SearchSourceMoodNotes: `
+		SELECT id::text, mood_type, notes, created_at FROM mood_entries
+		WHERE user_id = $1 AND COALESCE(notes, '') <> '' ORDER BY created_at DESC`,
+	SearchSourceChatMessages: `
+		SELECT m.id::text, COALESCE(r.name, ''), m.content, m.created_at
+		FROM chat_messages m LEFT JOIN chat_rooms r ON r.id = m.chat_room_id
+		WHERE m.user_id = $1 AND COALESCE(m.message_type, 'text') = 'text' ORDER BY m.created_at DESC`,
+	SearchSourceConversations: `
+		SELECT m.id::text, c.title, m.content, m.created_at
+		FROM ai_conversation_messages m JOIN ai_conversations c ON c.id = m.conversation_id
+		WHERE c.user_id = $1 ORDER BY m.created_at DESC`,
+}
+
+var semanticSourceOrder = []string{
+	SearchSourceWritings,
+	SearchSourceTestCases,
+	SearchSourceMoodNotes,
+	SearchSourceChatMessages,
+	SearchSourceConversations,
+}
+
+// SemanticSearchRequest 语义搜索条件
+type SemanticSearchRequest struct {
+	Query    string
+	Types    []string // 为空时搜索全部类型
+	Limit    int
+	From     *time.Time // 按内容创建时间过滤
+	To       *time.Time
+	MinScore float64
+}
+
+// SemanticSearchResult 一条匹配的内容
+type SemanticSearchResult struct {
+	SourceType string    `json:"source_type"`
+	SourceID   string    `json:"source_id"`
+	Title      string    `json:"title"`
+	Snippet    string    `json:"snippet"`
+	Score      float64   `json:"score"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SemanticSearchResponse 语义搜索结果
+//
+// Indexed为本次补建的向量数，Pending为尚未建立向量、本次未参与搜索的内容数
+type SemanticSearchResponse struct {
+	Query   string                 `json:"query"`
+	Model   string                 `json:"model"`
+	Results []SemanticSearchResult `json:"results"`
+	Indexed int                    `json:"indexed"`
+	Pending int                    `json:"pending"`
+}
+
+// SemanticSearchService 基于向量的语义搜索
+//
+// 向量以浮点数组保存在content_embeddings表中，搜索时按余弦相似度暴力计算。
+// 内容在搜索时增量建立向量：新增或修改过的内容重新向量化，已删除的内容移除向量
+type SemanticSearchService struct {
+	db *database.DB
+	ai *AIClientManager
+}
+
+func NewSemanticSearchService(db *database.DB, ai *AIClientManager) *SemanticSearchService {
+	return &SemanticSearchService{
+		db: db,
+		ai: ai,
+	}
+}
+
+// 待向量化的内容
+type semanticDocument struct {
+	sourceType string
+	sourceID   string
+	title      string
+	text       string
+	hash       string
+	createdAt  time.Time
+}
+
+// Search 在用户自己的内容中做语义搜索
+func (s *SemanticSearchService) Search(ctx context.Context, userID string, req *SemanticSearchRequest) (*SemanticSearchResponse, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, fmt.Errorf("搜索内容不能为空")
+	}
+
+	types := req.Types
+	if len(types) == 0 {
+		types = semanticSourceOrder
+	}
+	for _, sourceType := range types {
+		if _, ok := semanticSources[sourceType]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSearchSource, sourceType)
+		}
+	}
+
+	limit := req.Limit
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	ctx = WithAIFeature(ctx, AIFeatureEmbedding)
+	queryEmbedding, err := s.ai.Embed(ctx, "", []string{query})
+	if err != nil {
+		return nil, err
+	}
+	model := queryEmbedding.Model
+
+	indexed, pending, err := s.sync(ctx, userID, model, types)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.rank(ctx, userID, model, types, queryEmbedding.Vectors[0], req)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return &SemanticSearchResponse{
+		Query:   query,
+		Model:   model,
+		Results: results,
+		Indexed: indexed,
+		Pending: pending,
+	}, nil
+}
+
+// rank 计算查询向量与已保存向量的相似度并排序
+func (s *SemanticSearchService) rank(ctx context.Context, userID, model string, types []string, queryVector []float32, req *SemanticSearchRequest) ([]SemanticSearchResult, error) {
+	query := `
+		SELECT source_type, source_id, title, snippet, embedding, source_created_at
+		FROM content_embeddings
+		WHERE user_id = $1 AND model = $2 AND source_type = ANY($3)
+	`
+	args := []interface{}{userID, model, pq.Array(types)}
+	if req.From != nil {
+		args = append(args, *req.From)
+		query += fmt.Sprintf(" AND source_created_at >= $%d", len(args))
+	}
+	if req.To != nil {
+		args = append(args, *req.To)
+		query += fmt.Sprintf(" AND source_created_at <= $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询内容向量失败: %w", err)
+	}
+	defer rows.Close()
+
+	results := []SemanticSearchResult{}
+	for rows.Next() {
+		var result SemanticSearchResult
+		var embedding pq.Float32Array
+		if err := rows.Scan(&result.SourceType, &result.SourceID, &result.Title, &result.Snippet, &embedding, &result.CreatedAt); err != nil {
+			return nil, fmt.Errorf("读取内容向量失败: %w", err)
+		}
+		result.Score = cosineSimilarity(queryVector, embedding)
+		if result.Score < req.MinScore {
+			continue
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询内容向量失败: %w", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// sync 为新增或修改过的内容建立向量，并删除已不存在内容的向量
+func (s *SemanticSearchService) sync(ctx context.Context, userID, model string, types []string) (int, int, error) {
+	var stale []semanticDocument
+	for _, sourceType := range types {
+		documents, err := s.loadDocuments(ctx, userID, sourceType)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		existing, err := s.loadHashes(ctx, userID, model, sourceType)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		for _, doc := range documents {
+			if existing[doc.sourceID] != doc.hash {
+				stale = append(stale, doc)
+			}
+			delete(existing, doc.sourceID)
+		}
+
+		if len(existing) > 0 {
+			removed := make([]string, 0, len(existing))
+			for sourceID := range existing {
+				removed = append(removed, sourceID)
+			}
+			_, err := s.db.ExecContext(ctx, `
+				DELETE FROM content_embeddings
+				WHERE user_id = $1 AND model = $2 AND source_type = $3 AND source_id = ANY($4)
+			`, userID, model, sourceType, pq.Array(removed))
+			if err != nil {
+				return 0, 0, fmt.Errorf("删除过期内容向量失败: %w", err)
+			}
+		}
+	}
+
+	pending := 0
+	if len(stale) > semanticSyncLimit {
+		pending = len(stale) - semanticSyncLimit
+		stale = stale[:semanticSyncLimit]
+	}
+
+	indexed := 0
+	for start := 0; start < len(stale); start += semanticEmbedBatch {
+		end := start + semanticEmbedBatch
+		if end > len(stale) {
+			end = len(stale)
+		}
+		batch := stale[start:end]
+
+		inputs := make([]string, len(batch))
+		for i, doc := range batch {
+			inputs[i] = embeddingInput(doc.title, doc.text)
+		}
+		result, err := s.ai.Embed(ctx, model, inputs)
+		if err != nil {
+			// 已有的向量仍可搜索，剩余内容在下次搜索时补建
+			log.Printf("内容向量化失败: %v", err)
+			pending += len(stale) - start
+			break
+		}
+
+		for i, doc := range batch {
+			if err := s.saveEmbedding(ctx, userID, model, doc, result.Vectors[i]); err != nil {
+				return indexed, pending, err
+			}
+			indexed++
+		}
+	}
+
+	return indexed, pending, nil
+}
+
+func (s *SemanticSearchService) loadDocuments(ctx context.Context, userID, sourceType string) ([]semanticDocument, error) {
+	rows, err := s.db.QueryContext(ctx, semanticSources[sourceType], userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询%s失败: %w", sourceType, err)
+	}
+	defer rows.Close()
+
+	var documents []semanticDocument
+	for rows.Next() {
+		doc := semanticDocument{sourceType: sourceType}
+		if err := rows.Scan(&doc.sourceID, &doc.title, &doc.text, &doc.createdAt); err != nil {
+			return nil, fmt.Errorf("读取%s失败: %w", sourceType, err)
+		}
+		sum := sha256.Sum256([]byte(embeddingInput(doc.title, doc.text)))
+		doc.hash = hex.EncodeToString(sum[:])
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询%s失败: %w", sourceType, err)
+	}
+	return documents, nil
+}
+
+// loadHashes 已建立向量的内容及其内容哈希
+func (s *SemanticSearchService) loadHashes(ctx context.Context, userID, model, sourceType string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT source_id, content_hash FROM content_embeddings
+		WHERE user_id = $1 AND model = $2 AND source_type = $3
+	`, userID, model, sourceType)
+	if err != nil {
+		return nil, fmt.Errorf("查询内容向量失败: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var sourceID, hash string
+		if err := rows.Scan(&sourceID, &hash); err != nil {
+			return nil, fmt.Errorf("读取内容向量失败: %w", err)
+		}
+		hashes[sourceID] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("查询内容向量失败: %w", err)
+	}
+	return hashes, nil
+}
+
+func (s *SemanticSearchService) saveEmbedding(ctx context.Context, userID, model string, doc semanticDocument, vector []float32) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO content_embeddings (id, user_id, source_type, source_id, model, title, snippet,
+			content_hash, embedding, source_created_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
+		ON CONFLICT (source_type, source_id, model) DO UPDATE SET
+			title = EXCLUDED.title,
+			snippet = EXCLUDED.snippet,
+			content_hash = EXCLUDED.content_hash,
+			embedding = EXCLUDED.embedding,
+			updated_at = NOW()
+	`, generateUUID(), userID, doc.sourceType, doc.sourceID, model, doc.title, truncateRunes(doc.text, semanticSnippetRunes),
+		doc.hash, pq.Float32Array(vector), doc.createdAt)
+	if err != nil {
+		return fmt.Errorf("保存内容向量失败: %w", err)
+	}
+	return nil
+}
+
+// embeddingInput 标题和正文合并为向量化文本
+func embeddingInput(title, text string) string {
+	input := strings.TrimSpace(title + "\n" + text)
+	return truncateRunes(input, semanticMaxInputRunes)
+}
+
+func truncateRunes(text string, n int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n])
+}
@@ -9,6 +9,8 @@ type Services struct {
 	DB           *database.DB
 	Redis        *database.RedisClient
 	Config       *config.Config
+	JobQueue     *JobQueue
+	FileService  *FileService
 	
 	// 核心服务
 	AuthService       *AuthService
@@ -18,6 +20,10 @@ type Services struct {
 	
 	// AI和第三方服务
 	AIClientManager        *AIClientManager
+	AITools                *AIToolRegistry
+	ConversationService    *ConversationService
+	SemanticSearchService  *SemanticSearchService
+	ModerationService      *ModerationService
 	ThirdPartyClientManager *ThirdPartyClientManager
 	
 	// 应用服务
@@ -26,29 +32,50 @@ type Services struct {
 	FitTrackerService    *FitTrackerService
 	SocialHubService     *SocialHubService
 	CreativeStudioService *CreativeStudioService
+	ScheduleService      *ScheduleService
+	Scheduler            *Scheduler
 }
 
 func NewServices(db *database.DB, redis *database.RedisClient, cfg *config.Config) *Services {
+	aiClientManager := NewAIClientManager(db, redis, cfg)
+	thirdPartyClientManager := NewThirdPartyClientManager(cfg)
+	fitTrackerService := NewFitTrackerService(db)
+	jobQueue := NewJobQueue(redis, cfg)
+	fileService := NewFileService(db, cfg)
+	aiTools := NewBackendAIToolRegistry(thirdPartyClientManager, fitTrackerService)
+	conversationService := NewConversationService(db, aiClientManager, cfg.AIConversationContextTokens)
+	RegisterAIJobs(jobQueue, aiClientManager, conversationService, aiTools)
+	qaToolBoxService := NewQAToolBoxService(db, aiClientManager, jobQueue, NewDocumentConversionService(cfg, fileService), fileService, NewCrawler(cfg))
+	scheduleService := NewScheduleService(db, jobQueue, qaToolBoxService, cfg)
+	
 	return &Services{
 		DB:           db,
 		Redis:        redis,
 		Config:       cfg,
+		JobQueue:     jobQueue,
+		FileService:  fileService,
 		
 		// 核心服务
-		AuthService:       NewAuthService(db, redis, cfg.JWTSecret),
+		AuthService:       NewAuthService(db, redis, cfg.JWTSecret, fileService),
 		AppService:        NewAppService(db),
 		MembershipService: NewMembershipService(db),
 		PaymentService:    NewPaymentService(db, redis),
 		
 		// AI和第三方服务
-		AIClientManager:        NewAIClientManager(cfg),
-		ThirdPartyClientManager: NewThirdPartyClientManager(cfg),
+		AIClientManager:        aiClientManager,
+		AITools:                aiTools,
+		ConversationService:    conversationService,
+		SemanticSearchService:  NewSemanticSearchService(db, aiClientManager),
+		ModerationService:      aiClientManager.Moderation(),
+		ThirdPartyClientManager: thirdPartyClientManager,
 		
 		// 应用服务
-		QAToolBoxService:     NewQAToolBoxService(db),
+		QAToolBoxService:     qaToolBoxService,
 		LifeModeService:      NewLifeModeService(db),
-		FitTrackerService:    NewFitTrackerService(db),
-		SocialHubService:     NewSocialHubService(db),
-		CreativeStudioService: NewCreativeStudioService(db),
+		FitTrackerService:    fitTrackerService,
+		SocialHubService:     NewSocialHubService(db, aiClientManager.Moderation()),
+		CreativeStudioService: NewCreativeStudioService(db, aiClientManager.Moderation()),
+		ScheduleService:      scheduleService,
+		Scheduler:            NewScheduler(redis, scheduleService, cfg),
 	}
 }
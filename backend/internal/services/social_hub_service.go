@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -9,12 +10,14 @@ import (
 )
 
 type SocialHubService struct {
-	db *database.DB
+	db         *database.DB
+	moderation *ModerationService
 }
 
-func NewSocialHubService(db *database.DB) *SocialHubService {
+func NewSocialHubService(db *database.DB, moderation *ModerationService) *SocialHubService {
 	return &SocialHubService{
-		db: db,
+		db:         db,
+		moderation: moderation,
 	}
 }
 
@@ -321,10 +324,24 @@ type MessageResponse struct {
 	Type      string    `json:"type"`
 	ReplyTo   string    `json:"reply_to,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+	// 消息被打码或标记时返回审核结果
+	Moderation ModerationAction `json:"moderation,omitempty"`
 }
 
 // SendMessage 发送消息
 func (s *SocialHubService) SendMessage(req *MessageRequest) (*MessageResponse, error) {
+	// 审核未通过的消息不保存，打码后的消息保存打码后的内容
+	result, err := s.moderation.Check(context.Background(), ModerationInput{
+		UserID:    req.UserID,
+		Source:    ModerationSourceSocialHub,
+		Direction: ModerationDirectionInput,
+		Text:      req.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.Content = result.Text
+
 	response := &MessageResponse{
 		ID:        generateUUID(),
 		UserID:    req.UserID,
@@ -334,9 +351,12 @@ func (s *SocialHubService) SendMessage(req *MessageRequest) (*MessageResponse, e
 		ReplyTo:   req.ReplyTo,
 		CreatedAt: time.Now(),
 	}
+	if result.Action != ModerationAllow {
+		response.Moderation = result.Action
+	}
 
 	// 保存消息到chat_messages表
-	_, err := s.db.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO chat_messages (id, chat_room_id, user_id, content, message_type, created_at)
 		VALUES ($1, $2, $3, $4, $5, NOW())
 	`, response.ID, req.ChatID, req.UserID, req.Content, req.Type)
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"qa-toolbox-backend/internal/config"
+)
+
+// 存储后端
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+// 本地存储的文件保存在 UPLOAD_DIR 下的子目录
+const storedFilesDirName = "files"
+
+// ErrObjectNotFound 存储中不存在该对象
+var ErrObjectNotFound = errors.New("文件不存在")
+
+// ObjectStorage 文件存储后端，key为斜杠分隔的相对路径
+type ObjectStorage interface {
+	Name() string
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	// Open 打开对象，本地存储返回的对象实现了io.Seeker，可以支持Range请求
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// PresignGet 由存储直接签发下载地址，不支持时返回空字符串，由应用代理下载
+	PresignGet(ctx context.Context, key, filename string, expiry time.Duration) (string, error)
+}
+
+// NewObjectStorage 根据 STORAGE_BACKEND 创建存储后端
+func NewObjectStorage(cfg *config.Config) (ObjectStorage, error) {
+	switch strings.ToLower(cfg.StorageBackend) {
+	case "", StorageBackendLocal:
+		return NewLocalStorage(filepath.Join(cfg.UploadDir, storedFilesDirName)), nil
+	case StorageBackendS3, "minio":
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.StorageBackend)
+	}
+}
+
+// LocalStorage 本地磁盘存储
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+func (s *LocalStorage) Name() string {
+	return StorageBackendLocal
+}
+
+// path 把key转换为root下的路径，不能引用root之外的文件
+func (s *LocalStorage) path(key string) (string, error) {
+	rel := filepath.Clean("/" + filepath.FromSlash(key))
+	if rel == string(filepath.Separator) {
+		return "", fmt.Errorf("文件路径无效: %s", key)
+	}
+	return filepath.Join(s.root, rel), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("创建存储目录失败: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	return file, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除文件失败: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) PresignGet(ctx context.Context, key, filename string, expiry time.Duration) (string, error) {
+	return "", nil
+}
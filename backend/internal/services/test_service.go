@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,10 +12,11 @@ import (
 
 type TestService struct {
 	db *database.DB
+	ai *AIClientManager
 }
 
-func NewTestService(db *database.DB) *TestService {
-	return &TestService{db: db}
+func NewTestService(db *database.DB, ai *AIClientManager) *TestService {
+	return &TestService{db: db, ai: ai}
 }
 
 // GenerateTestCases - AI驱动的测试用例生成
@@ -219,9 +221,12 @@ func (s *TestService) validateTestRequest(req *models.TestGenerationRequest) err
 }
 
 func (s *TestService) callAIService(ctx context.Context, req *models.TestGenerationRequest) ([]models.TestCase, error) {
-	// 这里应该调用真实的AI服务（如OpenAI、Claude等）
-	// 现在返回模拟数据
-	return s.generateMockTestCases(req), nil
+	testCases, _, err := s.ai.GenerateTestCaseList(ctx, req)
+	if errors.Is(err, ErrNoAIService) {
+		// 未配置AI服务时返回示例用例
+		return s.generateMockTestCases(req), nil
+	}
+	return testCases, err
 }
 
 func (s *TestService) generateMockTestCases(req *models.TestGenerationRequest) []models.TestCase {
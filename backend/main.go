@@ -44,6 +44,10 @@ func main() {
 	// 初始化服务
 	services := services.NewServices(db, redis, cfg)
 
+	// 启动后台任务队列和定时任务调度器
+	services.JobQueue.Start(context.Background())
+	services.Scheduler.Start(context.Background())
+
 	// 设置Gin模式
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -96,5 +100,9 @@ func main() {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	// 停止调度器和后台任务，被中断的任务重新入队
+	services.Scheduler.Stop()
+	services.JobQueue.Stop()
+
 	log.Println("Server exited")
 }
@@ -204,6 +204,268 @@ CREATE TABLE IF NOT EXISTS designs (
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
+-- 18. 为membership_plans表添加AI token配额字段 (NULL表示不限)
+ALTER TABLE membership_plans ADD COLUMN IF NOT EXISTS ai_daily_token_quota BIGINT;
+ALTER TABLE membership_plans ADD COLUMN IF NOT EXISTS ai_monthly_token_quota BIGINT;
+UPDATE membership_plans SET ai_daily_token_quota = 20000, ai_monthly_token_quota = 200000 WHERE id = '550e8400-e29b-41d4-a716-446655440001';
+UPDATE membership_plans SET ai_daily_token_quota = 100000, ai_monthly_token_quota = 1000000 WHERE id = '550e8400-e29b-41d4-a716-446655440002';
+UPDATE membership_plans SET ai_daily_token_quota = 500000, ai_monthly_token_quota = 5000000 WHERE id = '550e8400-e29b-41d4-a716-446655440003';
+
+-- 19. 创建ai_usage_records表 (AI用量计量)
+CREATE TABLE IF NOT EXISTS ai_usage_records (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36),
+    client_ip VARCHAR(45),
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(100),
+    feature VARCHAR(50) NOT NULL,
+    prompt_tokens INTEGER DEFAULT 0,
+    completion_tokens INTEGER DEFAULT 0,
+    total_tokens INTEGER DEFAULT 0,
+    estimated BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 20. 创建prompt_templates表 (提示词模板版本与A/B分流权重)
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    name VARCHAR(100) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    locale VARCHAR(20) NOT NULL,
+    description TEXT,
+    model VARCHAR(100),
+    temperature DOUBLE PRECISION DEFAULT 0,
+    max_tokens INTEGER DEFAULT 2000,
+    variables JSONB DEFAULT '[]',
+    system_prompt TEXT,
+    user_prompt TEXT NOT NULL,
+    weight INTEGER DEFAULT 0,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(name, version, locale)
+);
+
+-- 21. 创建ai_conversations和ai_conversation_messages表 (服务端保存的多轮对话)
+CREATE TABLE IF NOT EXISTS ai_conversations (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36) NOT NULL,
+    title VARCHAR(200) NOT NULL DEFAULT '',
+    model VARCHAR(100),
+    system_prompt TEXT,
+    summary TEXT,
+    summarized_seq INTEGER DEFAULT 0,
+    message_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS ai_conversation_messages (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    conversation_id VARCHAR(36) NOT NULL,
+    seq INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    model VARCHAR(100),
+    tokens INTEGER DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(conversation_id, seq),
+    FOREIGN KEY (conversation_id) REFERENCES ai_conversations(id) ON DELETE CASCADE
+);
+
+-- 22. 创建content_embeddings表 (语义搜索的内容向量)
+CREATE TABLE IF NOT EXISTS content_embeddings (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36) NOT NULL,
+    source_type VARCHAR(50) NOT NULL,
+    source_id VARCHAR(36) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    title VARCHAR(500),
+    snippet TEXT,
+    content_hash VARCHAR(64) NOT NULL,
+    embedding REAL[] NOT NULL,
+    source_created_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(source_type, source_id, model),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 23. 创建ai_cost_ledger和ai_cost_daily表 (AI调用成本明细和每日汇总)
+CREATE TABLE IF NOT EXISTS ai_cost_ledger (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36),
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(100),
+    feature VARCHAR(50) NOT NULL,
+    prompt_tokens INTEGER DEFAULT 0,
+    completion_tokens INTEGER DEFAULT 0,
+    input_price NUMERIC(12,6) DEFAULT 0,
+    output_price NUMERIC(12,6) DEFAULT 0,
+    cost NUMERIC(16,8) DEFAULT 0,
+    currency VARCHAR(10) NOT NULL DEFAULT 'USD',
+    priced BOOLEAN DEFAULT TRUE,
+    estimated BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS ai_cost_daily (
+    day DATE NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    feature VARCHAR(50) NOT NULL,
+    cost NUMERIC(16,8) DEFAULT 0,
+    requests INTEGER DEFAULT 0,
+    total_tokens BIGINT DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (day, provider, feature)
+);
+
+-- 24. 创建moderation_audits表 (内容审核记录和申诉)
+CREATE TABLE IF NOT EXISTS moderation_audits (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36),
+    source VARCHAR(50) NOT NULL,
+    feature VARCHAR(50),
+    direction VARCHAR(10) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    categories TEXT[],
+    matches JSONB,
+    content TEXT,
+    content_hash VARCHAR(64) NOT NULL,
+    classified BOOLEAN DEFAULT FALSE,
+    appeal_status VARCHAR(20) NOT NULL DEFAULT 'none',
+    appeal_reason TEXT,
+    appealed_at TIMESTAMP,
+    reviewed_by VARCHAR(36),
+    review_note TEXT,
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (reviewed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- 25. 为pdf_conversions和crawler_tasks表添加job_id字段 (异步任务队列中的任务ID)
+ALTER TABLE pdf_conversions ADD COLUMN IF NOT EXISTS job_id VARCHAR(36);
+ALTER TABLE crawler_tasks ADD COLUMN IF NOT EXISTS job_id VARCHAR(36);
+
+-- 26. 创建files表 (上传文件，内容保存在本地磁盘或S3兼容存储)
+CREATE TABLE IF NOT EXISTS files (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    extension VARCHAR(20) NOT NULL,
+    size BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    purpose VARCHAR(50),
+    backend VARCHAR(20) NOT NULL,
+    storage_key VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 27. 为crawler_tasks表添加爬取进度字段，crawler_results的url改为TEXT (跟随链接时地址可能超过500字符)
+ALTER TABLE crawler_tasks ADD COLUMN IF NOT EXISTS pages_crawled INTEGER DEFAULT 0;
+ALTER TABLE crawler_tasks ADD COLUMN IF NOT EXISTS pages_failed INTEGER DEFAULT 0;
+ALTER TABLE crawler_tasks ADD COLUMN IF NOT EXISTS pages_skipped INTEGER DEFAULT 0;
+ALTER TABLE crawler_tasks ADD COLUMN IF NOT EXISTS pages_queued INTEGER DEFAULT 0;
+ALTER TABLE crawler_results ALTER COLUMN url TYPE TEXT;
+
+-- 28. 创建schedules和schedule_runs表 (定时执行爬虫任务和API测试套件)
+CREATE TABLE IF NOT EXISTS schedules (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    user_id VARCHAR(36) NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    cron_expr VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN DEFAULT TRUE,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    schedule_id VARCHAR(36) NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    trigger_type VARCHAR(20) NOT NULL DEFAULT 'schedule',
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    job_id VARCHAR(36),
+    summary JSONB DEFAULT '{}',
+    snapshot JSONB DEFAULT '{}',
+    changed BOOLEAN DEFAULT FALSE,
+    changes JSONB DEFAULT '{}',
+    error TEXT,
+    scheduled_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE
+);
+
+-- 29. 创建crawler_snapshots和crawler_changes表 (爬虫任务的网页监控)
+CREATE TABLE IF NOT EXISTS crawler_snapshots (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    task_id VARCHAR(36) NOT NULL,
+    url TEXT NOT NULL,
+    status_code INTEGER DEFAULT 0,
+    data JSONB,
+    text TEXT,
+    content_hash VARCHAR(64) NOT NULL,
+    captured_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES crawler_tasks(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS crawler_changes (
+    id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+    task_id VARCHAR(36) NOT NULL,
+    url TEXT NOT NULL,
+    snapshot_id VARCHAR(36) NOT NULL,
+    previous_snapshot_id VARCHAR(36),
+    change_type VARCHAR(20) NOT NULL,
+    status_from INTEGER DEFAULT 0,
+    status_to INTEGER DEFAULT 0,
+    fields JSONB DEFAULT '[]',
+    field_count INTEGER DEFAULT 0,
+    text_changed BOOLEAN DEFAULT FALSE,
+    text_diff TEXT,
+    alert BOOLEAN DEFAULT FALSE,
+    notified BOOLEAN DEFAULT FALSE,
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES crawler_tasks(id) ON DELETE CASCADE,
+    FOREIGN KEY (snapshot_id) REFERENCES crawler_snapshots(id) ON DELETE CASCADE,
+    FOREIGN KEY (previous_snapshot_id) REFERENCES crawler_snapshots(id) ON DELETE SET NULL
+);
+
+-- 30. 为api_test_suites和api_test_cases表添加标签和用例顺序字段 (API测试套件管理)
+ALTER TABLE api_test_suites ADD COLUMN IF NOT EXISTS tags TEXT[] DEFAULT '{}';
+ALTER TABLE api_test_cases ADD COLUMN IF NOT EXISTS position INTEGER DEFAULT 0;
+ALTER TABLE api_test_cases ADD COLUMN IF NOT EXISTS tags TEXT[] DEFAULT '{}';
+ALTER TABLE api_test_cases ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+-- 已有用例按创建时间编号，只处理尚未排过序的套件
+UPDATE api_test_cases c SET position = o.rn - 1
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY suite_id ORDER BY created_at, id) AS rn FROM api_test_cases) o
+WHERE c.id = o.id AND c.suite_id IN (
+    SELECT suite_id FROM api_test_cases GROUP BY suite_id HAVING COUNT(*) > 1 AND MAX(COALESCE(position, 0)) = 0
+);
+
+-- 31. 创建ai_usage_counters表 (AI配额按周期预占和结算，避免并发调用超出配额)
+CREATE TABLE IF NOT EXISTS ai_usage_counters (
+    scope_key VARCHAR(100) NOT NULL,
+    period VARCHAR(10) NOT NULL,
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_tokens BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope_key, period, period_start)
+);
+
 -- 创建索引
 CREATE INDEX IF NOT EXISTS idx_mood_entries_user_id ON mood_entries(user_id);
 CREATE INDEX IF NOT EXISTS idx_workouts_user_id ON workouts(user_id);
@@ -218,6 +480,24 @@ CREATE INDEX IF NOT EXISTS idx_activities_user_id ON activities(user_id);
 CREATE INDEX IF NOT EXISTS idx_avatars_user_id ON avatars(user_id);
 CREATE INDEX IF NOT EXISTS idx_music_compositions_user_id ON music_compositions(user_id);
 CREATE INDEX IF NOT EXISTS idx_designs_user_id ON designs(user_id);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_user_created ON ai_usage_records(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_ip_created ON ai_usage_records(client_ip, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_conversations_user_updated ON ai_conversations(user_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_content_embeddings_user_model ON content_embeddings(user_id, model, source_type);
+CREATE INDEX IF NOT EXISTS idx_ai_cost_ledger_provider_created ON ai_cost_ledger(provider, created_at);
+CREATE INDEX IF NOT EXISTS idx_moderation_audits_user_created ON moderation_audits(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_moderation_audits_appeal_status ON moderation_audits(appeal_status);
+CREATE INDEX IF NOT EXISTS idx_files_user_created ON files(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_schedules_user_id ON schedules(user_id);
+CREATE INDEX IF NOT EXISTS idx_schedules_due ON schedules(enabled, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_scheduled ON schedule_runs(schedule_id, scheduled_at);
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_target_finished ON schedule_runs(target_type, target_id, finished_at);
+-- 同一目标同时只能有一个未结束的执行
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schedule_runs_target_active ON schedule_runs(target_type, target_id) WHERE status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS idx_crawler_snapshots_task_url ON crawler_snapshots(task_id, url, captured_at);
+CREATE INDEX IF NOT EXISTS idx_crawler_changes_task_detected ON crawler_changes(task_id, detected_at);
+CREATE INDEX IF NOT EXISTS idx_api_test_cases_suite_position ON api_test_cases(suite_id, position);
+CREATE INDEX IF NOT EXISTS idx_api_test_suites_tags ON api_test_suites USING GIN(tags);
 
 -- 为test_cases表创建索引
 CREATE INDEX IF NOT EXISTS idx_test_cases_user_id ON test_cases(user_id);
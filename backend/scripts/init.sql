@@ -61,6 +61,8 @@ CREATE TABLE IF NOT EXISTS membership_plans (
     duration INTEGER NOT NULL, -- 天数
     max_apps INTEGER NOT NULL,
     features JSONB DEFAULT '[]',
+    ai_daily_token_quota BIGINT, -- 每日AI token配额，NULL表示不限
+    ai_monthly_token_quota BIGINT, -- 每月AI token配额，NULL表示不限
     is_active BOOLEAN DEFAULT TRUE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
@@ -189,6 +191,7 @@ CREATE TABLE IF NOT EXISTS pdf_conversions (
     file_size INTEGER DEFAULT 0,
     page_count INTEGER DEFAULT 0,
     error_message TEXT,
+    job_id VARCHAR(36),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT valid_conversion_status CHECK (status IN ('pending', 'processing', 'completed', 'failed'))
@@ -207,6 +210,11 @@ CREATE TABLE IF NOT EXISTS crawler_tasks (
     delay_ms INTEGER DEFAULT 1000,
     follow_links BOOLEAN DEFAULT FALSE,
     respect_robots BOOLEAN DEFAULT TRUE,
+    job_id VARCHAR(36),
+    pages_crawled INTEGER DEFAULT 0,
+    pages_failed INTEGER DEFAULT 0,
+    pages_skipped INTEGER DEFAULT 0,
+    pages_queued INTEGER DEFAULT 0,
     started_at TIMESTAMP WITH TIME ZONE,
     completed_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
@@ -218,7 +226,7 @@ CREATE TABLE IF NOT EXISTS crawler_tasks (
 CREATE TABLE IF NOT EXISTS crawler_results (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     task_id UUID NOT NULL REFERENCES crawler_tasks(id) ON DELETE CASCADE,
-    url VARCHAR(500) NOT NULL,
+    url TEXT NOT NULL,
     data JSONB DEFAULT '{}',
     status_code INTEGER DEFAULT 0,
     response_time INTEGER DEFAULT 0,
@@ -236,6 +244,7 @@ CREATE TABLE IF NOT EXISTS api_test_suites (
     headers JSONB DEFAULT '{}',
     variables JSONB DEFAULT '{}',
     status VARCHAR(20) DEFAULT 'active',
+    tags TEXT[] DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT valid_suite_status CHECK (status IN ('active', 'inactive', 'archived'))
@@ -255,7 +264,10 @@ CREATE TABLE IF NOT EXISTS api_test_cases (
     expected_status INTEGER DEFAULT 200,
     timeout INTEGER DEFAULT 30,
     enabled BOOLEAN DEFAULT TRUE,
+    position INTEGER DEFAULT 0, -- 套件内的执行顺序，从0开始
+    tags TEXT[] DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT valid_http_method CHECK (method IN ('GET', 'POST', 'PUT', 'DELETE', 'PATCH', 'HEAD', 'OPTIONS'))
 );
 
@@ -350,6 +362,232 @@ CREATE TABLE IF NOT EXISTS system_configs (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- AI用量记录表
+CREATE TABLE IF NOT EXISTS ai_usage_records (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- 匿名调用为NULL
+    client_ip VARCHAR(45),
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(100),
+    feature VARCHAR(50) NOT NULL,
+    prompt_tokens INTEGER DEFAULT 0,
+    completion_tokens INTEGER DEFAULT 0,
+    total_tokens INTEGER DEFAULT 0,
+    estimated BOOLEAN DEFAULT FALSE, -- 服务未返回用量时按文本长度估算
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- AI配额计数（调用前预占估算的token，调用结束后按实际用量结算）
+CREATE TABLE IF NOT EXISTS ai_usage_counters (
+    scope_key VARCHAR(100) NOT NULL, -- user:<用户ID> 或 ip:<来源IP>
+    period VARCHAR(10) NOT NULL, -- daily 或 monthly
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_tokens BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (scope_key, period, period_start)
+);
+
+-- 提示词模板表（覆盖内置和文件中的同名同版本模板）
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    locale VARCHAR(20) NOT NULL,
+    description TEXT,
+    model VARCHAR(100),
+    temperature DOUBLE PRECISION DEFAULT 0,
+    max_tokens INTEGER DEFAULT 2000,
+    variables JSONB DEFAULT '[]',
+    system_prompt TEXT,
+    user_prompt TEXT NOT NULL,
+    weight INTEGER DEFAULT 0, -- A/B分流权重，0表示不参与分流
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(name, version, locale)
+);
+
+-- AI多轮对话表
+CREATE TABLE IF NOT EXISTS ai_conversations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(200) NOT NULL DEFAULT '',
+    model VARCHAR(100),
+    system_prompt TEXT,
+    summary TEXT, -- 超出上下文预算的早期消息摘要
+    summarized_seq INTEGER DEFAULT 0, -- 已压缩进摘要的最后一条消息序号
+    message_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- AI对话消息表
+CREATE TABLE IF NOT EXISTS ai_conversation_messages (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    conversation_id UUID NOT NULL REFERENCES ai_conversations(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL, -- 对话内从1递增
+    role VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    model VARCHAR(100),
+    tokens INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(conversation_id, seq)
+);
+
+-- 用户内容向量表（语义搜索）
+CREATE TABLE IF NOT EXISTS content_embeddings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_type VARCHAR(50) NOT NULL, -- writings, test_cases, mood_notes, chat_messages, conversations
+    source_id VARCHAR(36) NOT NULL,
+    model VARCHAR(100) NOT NULL, -- 不同模型的向量不可比较
+    title VARCHAR(500),
+    snippet TEXT,
+    content_hash VARCHAR(64) NOT NULL, -- 内容变化时重新向量化
+    embedding REAL[] NOT NULL,
+    source_created_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(source_type, source_id, model)
+);
+
+-- AI调用成本明细
+CREATE TABLE IF NOT EXISTS ai_cost_ledger (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(100),
+    feature VARCHAR(50) NOT NULL,
+    prompt_tokens INTEGER DEFAULT 0,
+    completion_tokens INTEGER DEFAULT 0,
+    input_price NUMERIC(12,6) DEFAULT 0, -- 每百万token单价
+    output_price NUMERIC(12,6) DEFAULT 0,
+    cost NUMERIC(16,8) DEFAULT 0,
+    currency VARCHAR(10) NOT NULL DEFAULT 'USD',
+    priced BOOLEAN DEFAULT TRUE, -- 模型不在价格表中时为FALSE，成本记为0
+    estimated BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- AI每日成本汇总（已换算为预算币种）
+CREATE TABLE IF NOT EXISTS ai_cost_daily (
+    day DATE NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    feature VARCHAR(50) NOT NULL,
+    cost NUMERIC(16,8) DEFAULT 0,
+    requests INTEGER DEFAULT 0,
+    total_tokens BIGINT DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (day, provider, feature)
+);
+
+-- 内容审核记录（放行的内容只保存哈希）
+CREATE TABLE IF NOT EXISTS moderation_audits (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    source VARCHAR(50) NOT NULL, -- ai, social-hub, creative-studio
+    feature VARCHAR(50),
+    direction VARCHAR(10) NOT NULL, -- input, output
+    action VARCHAR(20) NOT NULL, -- allow, flag, redact, block
+    categories TEXT[],
+    matches JSONB,
+    content TEXT,
+    content_hash VARCHAR(64) NOT NULL,
+    classified BOOLEAN DEFAULT FALSE,
+    appeal_status VARCHAR(20) NOT NULL DEFAULT 'none', -- none, pending, upheld, overturned
+    appeal_reason TEXT,
+    appealed_at TIMESTAMP WITH TIME ZONE,
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    review_note TEXT,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 上传文件表
+CREATE TABLE IF NOT EXISTS files (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    extension VARCHAR(20) NOT NULL,
+    size BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL, -- SHA-256
+    purpose VARCHAR(50),
+    backend VARCHAR(20) NOT NULL, -- local, s3
+    storage_key VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+
+-- 定时任务表 (按cron表达式定时执行爬虫任务或API测试套件)
+CREATE TABLE IF NOT EXISTS schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type VARCHAR(20) NOT NULL,
+    target_id UUID NOT NULL,
+    cron_expr VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN DEFAULT TRUE,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_schedule_target CHECK (target_type IN ('crawler_task', 'api_test_suite'))
+);
+
+-- 定时任务执行记录表 (snapshot用于和下一次执行比较)
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    target_type VARCHAR(20) NOT NULL,
+    target_id UUID NOT NULL,
+    trigger_type VARCHAR(20) NOT NULL DEFAULT 'schedule', -- schedule, manual
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    job_id VARCHAR(36),
+    summary JSONB DEFAULT '{}',
+    snapshot JSONB DEFAULT '{}',
+    changed BOOLEAN DEFAULT FALSE,
+    changes JSONB DEFAULT '{}',
+    error TEXT,
+    scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT valid_schedule_run_status CHECK (status IN ('queued', 'running', 'completed', 'failed', 'skipped'))
+);
+
+
+-- 网页监控快照表 (爬虫任务开启watch后保存，内容不变时只更新checked_at)
+CREATE TABLE IF NOT EXISTS crawler_snapshots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    task_id UUID NOT NULL REFERENCES crawler_tasks(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    status_code INTEGER DEFAULT 0,
+    data JSONB,
+    text TEXT, -- 规范化后的页面文本
+    content_hash VARCHAR(64) NOT NULL,
+    captured_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    checked_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 网页监控变化表
+CREATE TABLE IF NOT EXISTS crawler_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    task_id UUID NOT NULL REFERENCES crawler_tasks(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    snapshot_id UUID NOT NULL REFERENCES crawler_snapshots(id) ON DELETE CASCADE,
+    previous_snapshot_id UUID REFERENCES crawler_snapshots(id) ON DELETE SET NULL,
+    change_type VARCHAR(20) NOT NULL, -- added, changed
+    status_from INTEGER DEFAULT 0,
+    status_to INTEGER DEFAULT 0,
+    fields JSONB DEFAULT '[]',
+    field_count INTEGER DEFAULT 0,
+    text_changed BOOLEAN DEFAULT FALSE,
+    text_diff TEXT,
+    alert BOOLEAN DEFAULT FALSE,
+    notified BOOLEAN DEFAULT FALSE,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- 创建索引
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);
@@ -407,6 +645,30 @@ CREATE INDEX IF NOT EXISTS idx_feedbacks_type ON feedbacks(type);
 CREATE INDEX IF NOT EXISTS idx_system_configs_config_key ON system_configs(config_key);
 CREATE INDEX IF NOT EXISTS idx_system_configs_is_active ON system_configs(is_active);
 
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_user_created ON ai_usage_records(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_ip_created ON ai_usage_records(client_ip, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_provider ON ai_usage_records(provider, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_records_feature ON ai_usage_records(feature);
+
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_name_locale ON prompt_templates(name, locale);
+
+CREATE INDEX IF NOT EXISTS idx_ai_conversations_user_updated ON ai_conversations(user_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_content_embeddings_user_model ON content_embeddings(user_id, model, source_type);
+CREATE INDEX IF NOT EXISTS idx_ai_cost_ledger_provider_created ON ai_cost_ledger(provider, created_at);
+CREATE INDEX IF NOT EXISTS idx_moderation_audits_user_created ON moderation_audits(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_moderation_audits_appeal_status ON moderation_audits(appeal_status);
+CREATE INDEX IF NOT EXISTS idx_files_user_created ON files(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_schedules_user_id ON schedules(user_id);
+CREATE INDEX IF NOT EXISTS idx_schedules_due ON schedules(enabled, next_run_at);
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_scheduled ON schedule_runs(schedule_id, scheduled_at);
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_target_finished ON schedule_runs(target_type, target_id, finished_at);
+-- 同一目标同时只能有一个未结束的执行
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schedule_runs_target_active ON schedule_runs(target_type, target_id) WHERE status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS idx_crawler_snapshots_task_url ON crawler_snapshots(task_id, url, captured_at);
+CREATE INDEX IF NOT EXISTS idx_crawler_changes_task_detected ON crawler_changes(task_id, detected_at);
+CREATE INDEX IF NOT EXISTS idx_api_test_cases_suite_position ON api_test_cases(suite_id, position);
+CREATE INDEX IF NOT EXISTS idx_api_test_suites_tags ON api_test_suites USING GIN(tags);
+
 -- 创建更新时间触发器函数
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
@@ -431,13 +693,18 @@ CREATE TRIGGER update_code_reviews_updated_at BEFORE UPDATE ON code_reviews FOR
 CREATE TRIGGER update_code_review_comments_updated_at BEFORE UPDATE ON code_review_comments FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 CREATE TRIGGER update_feedbacks_updated_at BEFORE UPDATE ON feedbacks FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 CREATE TRIGGER update_system_configs_updated_at BEFORE UPDATE ON system_configs FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_prompt_templates_updated_at BEFORE UPDATE ON prompt_templates FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_ai_conversations_updated_at BEFORE UPDATE ON ai_conversations FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_content_embeddings_updated_at BEFORE UPDATE ON content_embeddings FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_schedules_updated_at BEFORE UPDATE ON schedules FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_api_test_cases_updated_at BEFORE UPDATE ON api_test_cases FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
 -- 插入默认会员计划
-INSERT INTO membership_plans (id, name, description, price, currency, duration, max_apps, features) VALUES
-('550e8400-e29b-41d4-a716-446655440001', '免费版', '基础功能，适合个人用户', 0.00, 'CNY', 365, 1, '["基础功能", "每日10次使用限制", "社区支持"]'),
-('550e8400-e29b-41d4-a716-446655440002', '基础会员', '适合个人用户和小团队', 29.90, 'CNY', 30, 2, '["2个应用", "每日100次使用", "优先支持", "高级功能"]'),
-('550e8400-e29b-41d4-a716-446655440003', '高级会员', '适合中小型团队', 59.90, 'CNY', 30, 4, '["4个应用", "每日500次使用", "专属客服", "所有高级功能", "API访问"]'),
-('550e8400-e29b-41d4-a716-446655440004', 'VIP会员', '适合大型团队和企业', 99.90, 'CNY', 30, 5, '["全部应用", "无使用限制", "专属客户经理", "定制功能", "企业级支持", "私有部署"]');
+INSERT INTO membership_plans (id, name, description, price, currency, duration, max_apps, features, ai_daily_token_quota, ai_monthly_token_quota) VALUES
+('550e8400-e29b-41d4-a716-446655440001', '免费版', '基础功能，适合个人用户', 0.00, 'CNY', 365, 1, '["基础功能", "每日10次使用限制", "社区支持"]', 20000, 200000),
+('550e8400-e29b-41d4-a716-446655440002', '基础会员', '适合个人用户和小团队', 29.90, 'CNY', 30, 2, '["2个应用", "每日100次使用", "优先支持", "高级功能"]', 100000, 1000000),
+('550e8400-e29b-41d4-a716-446655440003', '高级会员', '适合中小型团队', 59.90, 'CNY', 30, 4, '["4个应用", "每日500次使用", "专属客服", "所有高级功能", "API访问"]', 500000, 5000000),
+('550e8400-e29b-41d4-a716-446655440004', 'VIP会员', '适合大型团队和企业', 99.90, 'CNY', 30, 5, '["全部应用", "无使用限制", "专属客户经理", "定制功能", "企业级支持", "私有部署"]', NULL, NULL);
 
 -- 插入默认应用数据
 INSERT INTO apps (id, name, description, category, icon, color, features, screenshots) VALUES
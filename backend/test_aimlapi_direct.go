@@ -1,59 +0,0 @@
-package main
-
-import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"time"
-)
-
-func main() {
-	// 直接测试AIMLAPI
-	url := "https://api.aimlapi.com/v1/chat/completions"
-	apiKey := "d78968b01cd8440eb7b28d683f3230da"
-
-	reqBody := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
-		"messages": []map[string]string{
-			{"role": "system", "content": "你是一个专业的软件测试工程师。"},
-			{"role": "user", "content": "请为以下Go代码生成测试用例：func Add(a, b int) int { return a + b }"},
-		},
-		"temperature": 0.7,
-		"max_tokens":  1000,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		fmt.Printf("JSON序列化失败: %v\n", err)
-		return
-	}
-
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Printf("创建请求失败: %v\n", err)
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("请求失败: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("读取响应失败: %v\n", err)
-		return
-	}
-
-	fmt.Printf("响应状态码: %d\n", resp.StatusCode)
-	fmt.Printf("响应内容: %s\n", string(body))
-}
@@ -1,3 +1,8 @@
 module test-db
 
 go 1.25.1
+
+require (
+	github.com/gin-gonic/gin v1.12.0 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
+)